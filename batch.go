@@ -0,0 +1,187 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// batchCollector collects the responses for the requests received within a JSON-RPC batch, so
+// the responses can be sent back in a single batch, as required by the JSON-RPC specification.
+// Every received batch has its own collector, so the concurrent batches that reuse the same request
+// IDs don't mix their responses. The nil collector stands for the message received outside of any
+// batch, which is answered on its own.
+type batchCollector struct {
+	lock sync.Mutex
+	// pending counts the requests of the batch waiting for their responses by ID. The invalid
+	// elements are answered as well, with the empty ID if it can't be read.
+	pending   map[MustString]int
+	remaining int
+	responses []JSONRPCMessage
+}
+
+// newBatchCollector returns the collector of the batch message, or nil if the message is not a
+// batch. The notifications and responses in the batch don't expect any response, so they're
+// skipped.
+func newBatchCollector(msg JSONRPCMessage) *batchCollector {
+	if len(msg.Batch) == 0 {
+		return nil
+	}
+
+	b := &batchCollector{
+		pending: make(map[MustString]int),
+	}
+	for _, m := range msg.Batch {
+		if m.JSONRPC == JSONRPCVersion && (m.Method == "" || m.ID == "") {
+			continue
+		}
+		b.pending[m.ID]++
+		b.remaining++
+	}
+	return b
+}
+
+// collect stores the response if it answers a request of the batch, and reports whether it does.
+// Once all the requests in the batch are answered, the collected responses are returned, and should
+// be sent as a single batch.
+func (b *batchCollector) collect(msg JSONRPCMessage) ([]JSONRPCMessage, bool) {
+	if b == nil || msg.Method != "" {
+		return nil, false
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if !b.remove(msg.ID) {
+		return nil, false
+	}
+
+	b.responses = append(b.responses, msg)
+	if b.remaining > 0 {
+		return nil, true
+	}
+	return b.responses, true
+}
+
+// drop marks the request as not going to be answered. If it's the last request of the batch
+// waiting for the response, the collected responses are returned, and should be sent as a single
+// batch. Nothing is returned if none of the requests in the batch is answered.
+func (b *batchCollector) drop(msg JSONRPCMessage) []JSONRPCMessage {
+	if b == nil {
+		return nil
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if !b.remove(msg.ID) || b.remaining > 0 {
+		return nil
+	}
+	return b.responses
+}
+
+// remove removes the request from the pending ones, and reports whether it was pending. It must be
+// called with lock held.
+func (b *batchCollector) remove(id MustString) bool {
+	if b.pending[id] == 0 {
+		return false
+	}
+	b.pending[id]--
+	b.remaining--
+	return true
+}
+
+// batchSender gathers the requests of a batch sent by the Client, as they pass through the
+// middlewares one by one, and sends them together in a single batch, once every request of the
+// batch either joins it or is skipped, e.g. when it's answered by the middlewares.
+type batchSender struct {
+	ctx  context.Context
+	send func(ctx context.Context, msgs []JSONRPCMessage) error
+
+	lock      sync.Mutex
+	remaining int
+	messages  []JSONRPCMessage
+	sent      chan struct{}
+	err       error
+}
+
+func newBatchSender(
+	ctx context.Context,
+	size int,
+	send func(ctx context.Context, msgs []JSONRPCMessage) error,
+) *batchSender {
+	return &batchSender{
+		ctx:       ctx,
+		send:      send,
+		remaining: size,
+		sent:      make(chan struct{}),
+	}
+}
+
+// join adds the request to the batch, and waits until the batch is sent.
+func (b *batchSender) join(ctx context.Context, msg JSONRPCMessage) error {
+	b.lock.Lock()
+	b.messages = append(b.messages, msg)
+	b.lock.Unlock()
+	b.skip()
+
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("failed to send batch: %w", ctx.Err())
+	case <-b.sent:
+	}
+	if b.err != nil {
+		return fmt.Errorf("failed to send batch: %w", b.err)
+	}
+	return nil
+}
+
+// skip marks the request as not joining the batch. The batch is sent once all of its requests
+// are either joined or skipped.
+func (b *batchSender) skip() {
+	b.lock.Lock()
+	b.remaining--
+	if b.remaining > 0 {
+		b.lock.Unlock()
+		return
+	}
+	messages := b.messages
+	b.lock.Unlock()
+
+	if len(messages) > 0 {
+		b.err = b.send(b.ctx, messages)
+	}
+	close(b.sent)
+}
+
+// requestIDs returns the IDs of the requests in the message, which is either a single message
+// or a batch. The invalid messages with an ID are included, as they're answered with an error.
+func requestIDs(msg JSONRPCMessage) []MustString {
+	var ids []MustString
+	for _, m := range batchMessages(msg) {
+		if m.ID != "" && (m.Method != "" || m.JSONRPC != JSONRPCVersion) {
+			ids = append(ids, m.ID)
+		}
+	}
+	return ids
+}
+
+// responseIDs returns the IDs of the responses in the message, which is either a single message
+// or a batch.
+func responseIDs(msg JSONRPCMessage) []MustString {
+	var ids []MustString
+	for _, m := range batchMessages(msg) {
+		if m.Method == "" && m.ID != "" {
+			ids = append(ids, m.ID)
+		}
+	}
+	return ids
+}
+
+// batchMessages returns the messages in the batch, or the message itself if it's not a batch.
+func batchMessages(msg JSONRPCMessage) []JSONRPCMessage {
+	if len(msg.Batch) > 0 {
+		return msg.Batch
+	}
+	return []JSONRPCMessage{msg}
+}
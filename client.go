@@ -6,6 +6,8 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
@@ -26,18 +28,22 @@ type ClientOption func(*Client)
 //
 // A Client must be created using NewClient() and requires Connect() to be called
 // before any operations can be performed. The client should be properly closed
-// using Disconnect() when it's no longer needed.
+// using Disconnect() when it's no longer needed. If a ReconnectPolicy is set with
+// WithClientReconnect, the client connects to the server again when the session is
+// ended by the transport.
 type Client struct {
-	capabilities ClientCapabilities
-	info         Info
-	transport    ClientTransport
-	session      Session
-	serverState  *serverState
+	capabilities     ClientCapabilities
+	info             Info
+	protocolVersions []string
+	transport        ClientTransport
+	connection       *clientConnection
+	serverState      *serverState
 
 	rootsListHandler RootsListHandler
 	rootsListUpdater RootsListUpdater
 
-	samplingHandler SamplingHandler
+	samplingHandler    SamplingHandler
+	elicitationHandler ElicitationHandler
 
 	promptListWatcher PromptListWatcher
 
@@ -45,40 +51,130 @@ type Client struct {
 	resourceSubscribedWatcher ResourceSubscribedWatcher
 
 	toolListWatcher ToolListWatcher
+	toolCallPolicy  ToolCallPolicy
+	// tools caches the tools listed by the server, to look up the annotations of the called tools for
+	// the toolCallPolicy.
+	tools *clientToolCache
 
 	progressListener ProgressListener
 	logReceiver      LogReceiver
 
+	middlewares []Middleware
+
 	pingInterval time.Duration
 	pingTimeout  time.Duration
 	onPingFailed func(error)
 
+	reconnectPolicy          *ReconnectPolicy
+	onConnectionStateChanged func(ConnectionState)
+
 	logger *slog.Logger
 
-	resultManager *clientResultManager
+	resultManager *resultManager
+	// handlerCancels stores the cancellation of the server's requests being handled by the handler
+	// implementations, so they can be cancelled when the server requests it.
+	handlerCancels *handlerCancels
 
-	closed          chan struct{}
-	pingClosed      chan struct{}
+	rootsListOnce   sync.Once
 	rootsListClosed chan struct{}
 }
 
-type clientResultManager struct {
-	lock     sync.Mutex
-	channels map[string]chan JSONRPCMessage
-	closed   bool
+// ReconnectPolicy configures how the Client connects to the server again, when the session is
+// ended by the transport, e.g. when the network connection is lost. The delay before the first
+// attempt is InitialDelay, and it's multiplied by Multiplier after every failed attempt, up to
+// MaxDelay. The client gives up after MaxAttempts failed attempts, or never if it's zero.
+//
+// The zero values of InitialDelay, MaxDelay and Multiplier are replaced by 500ms, 30s and 2.
+type ReconnectPolicy struct {
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	Multiplier   float64
+	MaxAttempts  int
+}
+
+// ConnectionState represents the state of the connection between the Client and the server.
+type ConnectionState int
+
+// The states reported to the callback set with WithClientOnConnectionStateChanged.
+const (
+	// ConnectionStateDisconnected means the client is not connected, either because it's
+	// disconnected by the user, or it fails to reconnect to the server.
+	ConnectionStateDisconnected ConnectionState = iota
+	// ConnectionStateConnected means the client is connected and initialized.
+	ConnectionStateConnected
+	// ConnectionStateReconnecting means the session is ended by the transport, and the client is
+	// trying to connect to the server again.
+	ConnectionStateReconnecting
+)
+
+type handlerCancels struct {
+	lock    sync.Mutex
+	cancels map[MustString]context.CancelFunc
+}
+
+// clientConnection holds the session the client is currently connected with. Unlike the session,
+// it outlives the reconnections, so it also records the subscriptions and the log level requested
+// by the user, to replay them to the new session.
+type clientConnection struct {
+	lock  sync.Mutex
+	state ConnectionState
+
+	session Session
+	// closed is closed when the main loop of the session exits.
+	closed chan struct{}
+	// established is set when the initialization of the session is done, and ended is set when
+	// the main loop of the session exits, only the established session is reconnected when it ends.
+	established bool
+	ended       bool
+	// closing is set when the user disconnects the client, so the ended session is not reconnected.
+	closing bool
+
+	reconnectCancel context.CancelFunc
+	reconnectDone   chan struct{}
+
+	subscriptions []string
+	logLevel      *LogLevel
+}
+
+// clientToolCache holds the tools listed by the server, it's dropped when the server notifies that
+// the tools list has changed, or when the client connects to a new session.
+type clientToolCache struct {
+	lock sync.Mutex
+	// tools maps the names of the tools to the tools, it's nil until the tools are listed.
+	tools map[string]Tool
+	// generation is incremented on every invalidation, so the tools listed before the invalidation
+	// are not cached.
+	generation int
 }
 
 type serverState struct {
-	lock         sync.Mutex
-	initialized  bool
-	info         Info
-	capabilities ServerCapabilities
-	stopped      bool
+	lock            sync.Mutex
+	initialized     bool
+	info            Info
+	capabilities    ServerCapabilities
+	protocolVersion string
+	stopped         bool
+}
+
+// protocolVersionSession is implemented by the sessions of the client transports that send the
+// negotiated protocol version to the server along with the messages.
+type protocolVersionSession interface {
+	setProtocolVersion(version string)
 }
 
 var (
 	defaultClientPingInterval = 30 * time.Second
 	defaultClientPingTimeout  = 30 * time.Second
+
+	defaultReconnectInitialDelay = 500 * time.Millisecond
+	defaultReconnectMaxDelay     = 30 * time.Second
+	defaultReconnectMultiplier   = 2.0
+
+	// ErrToolCallRefused is returned by CallTool, wrapping the error of the ToolCallPolicy, when the
+	// policy refuses the call.
+	ErrToolCallRefused = errors.New("tool call refused")
+
+	errClientDisconnected = errors.New("client is disconnected")
 )
 
 // WithRootsListHandler sets the roots list handler for the client.
@@ -102,6 +198,13 @@ func WithSamplingHandler(handler SamplingHandler) ClientOption {
 	}
 }
 
+// WithElicitationHandler sets the elicitation handler for the client.
+func WithElicitationHandler(handler ElicitationHandler) ClientOption {
+	return func(c *Client) {
+		c.elicitationHandler = handler
+	}
+}
+
 // WithPromptListWatcher sets the prompt list watcher for the client.
 func WithPromptListWatcher(watcher PromptListWatcher) ClientOption {
 	return func(c *Client) {
@@ -130,6 +233,16 @@ func WithToolListWatcher(watcher ToolListWatcher) ClientOption {
 	}
 }
 
+// WithToolCallPolicy sets the policy that decides whether the tools may be called, checked by
+// CallTool before the call is sent to the server. To look up the annotations of the called tool, the
+// client lists the tools of the server, and caches them until the server notifies that the tools
+// list has changed.
+func WithToolCallPolicy(policy ToolCallPolicy) ClientOption {
+	return func(c *Client) {
+		c.toolCallPolicy = policy
+	}
+}
+
 // WithProgressListener sets the progress listener for the client.
 func WithProgressListener(listener ProgressListener) ClientOption {
 	return func(c *Client) {
@@ -144,6 +257,16 @@ func WithLogReceiver(receiver LogReceiver) ClientOption {
 	}
 }
 
+// WithClientProtocolVersions sets the protocol revisions supported by the client, such as
+// ProtocolVersion20241105. The client requests the latest revision from this list, and accepts
+// any revision from this list the server proposes. By default, ProtocolVersion20250326 and
+// ProtocolVersion20241105 are supported, ProtocolVersion20250618 has to be listed to be negotiated.
+func WithClientProtocolVersions(versions ...string) ClientOption {
+	return func(c *Client) {
+		c.protocolVersions = versions
+	}
+}
+
 // WithClientPingInterval sets the ping interval for the client.
 func WithClientPingInterval(interval time.Duration) ClientOption {
 	return func(c *Client) {
@@ -165,6 +288,46 @@ func WithClientOnPingFailed(onPingFailed func(error)) ClientOption {
 	}
 }
 
+// WithClientReconnect enables the automatic reconnection of the client with the given policy. When
+// the session is ended by the transport, the client connects and initializes a new session, then
+// subscribes again to the resources subscribed with SubscribeResource, and sets again the log level
+// set with SetLogLevel. The requests that are pending when the session ends fail.
+//
+// The reconnection requires a transport that is able to start a new session after the previous one
+// ends, such as SSEClient and StreamableHTTPClient.
+func WithClientReconnect(policy ReconnectPolicy) ClientOption {
+	return func(c *Client) {
+		if policy.InitialDelay <= 0 {
+			policy.InitialDelay = defaultReconnectInitialDelay
+		}
+		if policy.MaxDelay <= 0 {
+			policy.MaxDelay = defaultReconnectMaxDelay
+		}
+		if policy.Multiplier <= 0 {
+			policy.Multiplier = defaultReconnectMultiplier
+		}
+		c.reconnectPolicy = &policy
+	}
+}
+
+// WithClientOnConnectionStateChanged sets the callback for when the state of the connection to the
+// server changes. The callback is called synchronously, so it should return quickly.
+func WithClientOnConnectionStateChanged(onStateChanged func(ConnectionState)) ClientOption {
+	return func(c *Client) {
+		c.onConnectionStateChanged = onStateChanged
+	}
+}
+
+// WithClientMiddleware wraps the requests sent to the server, and the requests received from the
+// server that are handled by the handler implementations, with the middlewares, see Middleware. The
+// middlewares are composed in order, so the first one receives the request first, and they're
+// appended to the middlewares of the previous WithClientMiddleware options.
+func WithClientMiddleware(middlewares ...Middleware) ClientOption {
+	return func(c *Client) {
+		c.middlewares = append(c.middlewares, middlewares...)
+	}
+}
+
 // WithClientLogger sets the logger for the client.
 func WithClientLogger(logger *slog.Logger) ClientOption {
 	return func(c *Client) {
@@ -194,17 +357,18 @@ func NewClient(
 	options ...ClientOption,
 ) *Client {
 	c := &Client{
-		info:      info,
-		transport: transport,
-		logger:    slog.Default(),
+		info:       info,
+		transport:  transport,
+		connection: &clientConnection{},
+		logger:     slog.Default(),
 		serverState: &serverState{
 			stopped: true,
 		},
-		resultManager: &clientResultManager{
-			channels: make(map[string]chan JSONRPCMessage),
+		resultManager: newResultManager(),
+		handlerCancels: &handlerCancels{
+			cancels: make(map[MustString]context.CancelFunc),
 		},
-		closed:          make(chan struct{}),
-		pingClosed:      make(chan struct{}),
+		tools:           &clientToolCache{},
 		rootsListClosed: make(chan struct{}),
 	}
 	for _, opt := range options {
@@ -217,6 +381,9 @@ func NewClient(
 	if c.pingTimeout == 0 {
 		c.pingTimeout = defaultClientPingTimeout
 	}
+	if len(c.protocolVersions) == 0 {
+		c.protocolVersions = defaultProtocolVersions
+	}
 
 	c.capabilities = ClientCapabilities{}
 
@@ -229,6 +396,9 @@ func NewClient(
 	if c.samplingHandler != nil {
 		c.capabilities.Sampling = &SamplingCapability{}
 	}
+	if c.elicitationHandler != nil {
+		c.capabilities.Elicitation = &ElicitationCapability{}
+	}
 
 	return c
 }
@@ -242,94 +412,19 @@ func NewClient(
 // Connect must be called after creating a new client and before making any other client method calls.
 // It returns an error if the session cannot be established or if the initialization fails.
 func (c *Client) Connect(ctx context.Context) error {
-	// Start session using the transport.
-	sess, err := c.transport.StartSession(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to start session: %w", err)
-	}
-	c.session = sess
-
-	// Initialize the result manager.
-	c.resultManager.init()
-
-	// Spawn the main loop for handling messages. And because we already started this,
-	// if then the initialization fails, we should call Disconnect to clean up resources.
-	go c.start()
+	c.connection.open()
 
-	// Register the initialization result channel and initiate the initialization request.
-	initMsgID := uuid.New().String()
-	results := c.resultManager.register(initMsgID)
-	if err := c.sendInitialize(ctx, MustString(initMsgID)); err != nil {
-		c.logger.Error("failed to send initialize request", slog.String("err", err.Error()))
-		if disconnectErr := c.Disconnect(ctx); disconnectErr != nil {
-			c.logger.Error("failed to disconnect", slog.String("err", disconnectErr.Error()))
-		}
+	if err := c.connect(ctx); err != nil {
 		return err
 	}
 
-	// Wait for the initialization result.
-	var initResMsg JSONRPCMessage
-	select {
-	case <-ctx.Done():
-		c.logger.Error("failed to initialize", slog.String("err", ctx.Err().Error()))
-		if disconnectErr := c.Disconnect(ctx); disconnectErr != nil {
-			c.logger.Error("failed to disconnect", slog.String("err", disconnectErr.Error()))
-		}
-		return fmt.Errorf("failed to initialize: %w", ctx.Err())
-	case initResMsg = <-results:
-	}
-
-	if initResMsg.Error != nil {
-		// Server told our initialization request failed.
-		c.logger.Error("failed to initialize", slog.String("err", initResMsg.Error.Error()))
-		if disconnectErr := c.Disconnect(ctx); disconnectErr != nil {
-			c.logger.Error("failed to disconnect", slog.String("err", disconnectErr.Error()))
-		}
-		return fmt.Errorf("failed to initialize: %w", initResMsg.Error)
-	}
-
-	// Verify the server's initialization result.
-	initRes, err := c.verifyInitialize(initResMsg)
-	if err != nil {
-		nErr := fmt.Errorf("failed to verify initialize result: %w", err)
-		c.logger.Error("failed to verify initialize result", slog.String("err", err.Error()))
-		// Server initialization result is invalid, we should send the error back to them and disconnect the client.
-		if err := c.session.Send(ctx, JSONRPCMessage{
-			JSONRPC: JSONRPCVersion,
-			ID:      initResMsg.ID,
-			Error: &JSONRPCError{
-				Code:    jsonRPCInvalidParamsCode,
-				Message: err.Error(),
-			},
-		}); err != nil {
-			c.logger.Error("failed to send initialization error", slog.String("err", err.Error()))
-			nErr = fmt.Errorf("failed to send initialization error: %w", err)
-		}
-		if disconnectErr := c.Disconnect(ctx); disconnectErr != nil {
-			c.logger.Error("failed to disconnect", slog.String("err", disconnectErr.Error()))
-		}
-		return nErr
-	}
-
-	// Send the initialization notification to server.
-	if err := c.session.Send(ctx, JSONRPCMessage{
-		JSONRPC: JSONRPCVersion,
-		Method:  methodNotificationsInitialized,
-	}); err != nil {
-		c.logger.Error("failed to send initialization notification", slog.String("err", err.Error()))
-		if disconnectErr := c.Disconnect(ctx); disconnectErr != nil {
-			c.logger.Error("failed to disconnect", slog.String("err", disconnectErr.Error()))
-		}
-		return fmt.Errorf("failed to send initialization notification: %w", err)
-	}
-
-	// Initialize the server state.
-	c.serverState.init(initRes.ServerInfo, initRes.Capabilities)
+	c.setConnectionState(ConnectionStateConnected)
 
 	return nil
 }
 
-// Disconnect closes the client session and resets the server state.
+// Disconnect closes the client session and resets the server state. If the client is reconnecting
+// to the server, the reconnection is stopped.
 // It ensures proper cleanup of resources, including all pending requests and background routines.
 //
 // If the client implements a RootsListUpdater, this method will wait for it to finish
@@ -340,6 +435,15 @@ func (c *Client) Disconnect(ctx context.Context) error {
 	// Close the result manager to close all the result channels.
 	c.resultManager.close()
 
+	// Stop the reconnection, if it's running, so the session is not replaced anymore.
+	if reconnectDone := c.connection.close(); reconnectDone != nil {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed to stop reconnection: %w", ctx.Err())
+		case <-reconnectDone:
+		}
+	}
+
 	// Wait for the roots list updater to finish, if the client implements it.
 	if c.rootsListUpdater != nil {
 		select {
@@ -351,29 +455,32 @@ func (c *Client) Disconnect(ctx context.Context) error {
 
 	// If Client failed when calling transport.StartSession, then session will be nil,
 	// which mean we can return at this point.
-	if c.session == nil {
+	sess, closed := c.connection.current()
+	if sess == nil {
 		return nil
 	}
 
-	// If user called Disconnect multiple times, or called it after failed at
-	// Connect (that function automaticly call Disconnect), then we should return at this point,
-	// because we guarantee to call Session.Stop only once.
+	// If user called Disconnect multiple times, or called it after failed at Connect, or after the
+	// session is ended by the transport, then we should return at this point, because the session
+	// is already stopped, and we guarantee to call Session.Stop only once.
 	if c.serverState.isStopped() {
+		c.setConnectionState(ConnectionStateDisconnected)
 		return nil
 	}
 
 	// Stop the session to signal the main loop to exit.
-	c.session.Stop()
+	sess.Stop()
 
 	// Wait for the main loop to finish.
 	select {
 	case <-ctx.Done():
 		return fmt.Errorf("failed to close Client: %w", ctx.Err())
-	case <-c.closed:
+	case <-closed:
 	}
 
 	// Reset the server state.
 	c.serverState.reset()
+	c.setConnectionState(ConnectionStateDisconnected)
 
 	return nil
 }
@@ -605,6 +712,9 @@ func (c *Client) SubscribeResource(ctx context.Context, params SubscribeResource
 		return err
 	}
 
+	// Record the subscription, so it can be restored when the client reconnects.
+	c.connection.addSubscription(params.URI)
+
 	return nil
 }
 
@@ -622,6 +732,8 @@ func (c *Client) UnsubscribeResource(ctx context.Context, params UnsubscribeReso
 		return err
 	}
 
+	c.connection.removeSubscription(params.URI)
+
 	return nil
 }
 
@@ -669,6 +781,11 @@ func (c *Client) CallTool(ctx context.Context, params CallToolParams) (CallToolR
 	if !c.serverState.toolServerAvailable() {
 		return CallToolResult{}, errors.New("tool server not supported by server")
 	}
+	if c.toolCallPolicy != nil {
+		if err := c.checkToolCall(ctx, params); err != nil {
+			return CallToolResult{}, err
+		}
+	}
 
 	res, err := c.sendRequest(ctx, MethodToolsCall, params)
 	if err != nil {
@@ -683,12 +800,81 @@ func (c *Client) CallTool(ctx context.Context, params CallToolParams) (CallToolR
 	return result, nil
 }
 
+// CallToolStructured executes a specific tool and decodes its structured content into the value
+// pointed to by out, with the same rules as json.Unmarshal. The raw result is returned as well, so
+// the caller can still access the unstructured content.
+//
+// An error is returned if the tool reports an error, or it doesn't return any structured content.
+func (c *Client) CallToolStructured(ctx context.Context, params CallToolParams, out any) (CallToolResult, error) {
+	result, err := c.CallTool(ctx, params)
+	if err != nil {
+		return CallToolResult{}, err
+	}
+
+	if result.IsError {
+		var texts []string
+		for _, content := range result.Content {
+			if content.Type == ContentTypeText {
+				texts = append(texts, content.Text)
+			}
+		}
+		return result, fmt.Errorf("tool %s returned an error: %s", params.Name, strings.Join(texts, "\n"))
+	}
+	if result.StructuredContent == nil {
+		return result, fmt.Errorf("tool %s returned no structured content", params.Name)
+	}
+	if err := json.Unmarshal(result.StructuredContent, out); err != nil {
+		return result, fmt.Errorf("failed to decode structured content: %w", err)
+	}
+
+	return result, nil
+}
+
+// checkToolCall asks the toolCallPolicy whether the tool may be called, with the tool looked up from
+// the tools listed by the server.
+func (c *Client) checkToolCall(ctx context.Context, params CallToolParams) error {
+	tool, ok, err := c.tools.lookup(ctx, params.Name, c.listAllTools)
+	if err != nil {
+		return fmt.Errorf("failed to look up tool %s: %w", params.Name, err)
+	}
+	if !ok {
+		tool = Tool{Name: params.Name}
+	}
+
+	if err := c.toolCallPolicy.CheckToolCall(ctx, tool, params); err != nil {
+		return fmt.Errorf("%w: %w", ErrToolCallRefused, err)
+	}
+	return nil
+}
+
+// listAllTools lists the tools through all the pages of the tools list.
+func (c *Client) listAllTools(ctx context.Context) (map[string]Tool, error) {
+	tools := make(map[string]Tool)
+
+	var params ListToolsParams
+	for {
+		result, err := c.ListTools(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+		for _, tool := range result.Tools {
+			tools[tool.Name] = tool
+		}
+		// Stop on the repeated cursor as well, to avoid looping forever on the misbehaving server.
+		if result.NextCursor == "" || result.NextCursor == params.Cursor {
+			return tools, nil
+		}
+		params.Cursor = result.NextCursor
+	}
+}
+
 // SetLogLevel configures the logging level for the MCP server.
 // It allows dynamic adjustment of the server's logging verbosity during runtime.
 //
 // The level parameter specifies the desired logging level. Valid levels are defined
 // by the LogLevel type. The server will adjust its logging output to match the
-// requested level.
+// requested level. The request passes through the middlewares set with WithClientMiddleware, and
+// the error response of the server is returned.
 func (c *Client) SetLogLevel(ctx context.Context, level LogLevel) error {
 	if !c.serverState.isInitialized() {
 		return errors.New("client not initialized")
@@ -697,19 +883,119 @@ func (c *Client) SetLogLevel(ctx context.Context, level LogLevel) error {
 		return errors.New("logging not supported by server")
 	}
 
-	params := LogParams{
-		Level: level,
+	if _, err := c.sendRequest(ctx, MethodLoggingSetLevel, LogParams{Level: level}); err != nil {
+		return err
 	}
-	paramsBs, err := json.Marshal(params)
-	if err != nil {
-		return fmt.Errorf("failed to marshal params: %w", err)
+
+	// Record the level, so it can be set again when the client reconnects.
+	c.connection.setLogLevel(level)
+
+	return nil
+}
+
+// Batch sends the requests to the server in a single JSON-RPC batch, and waits for all of their
+// results. The results are returned in the same order as the requests, and each of them holds either
+// the raw result or the error returned by the server for its request.
+//
+// Every request passes through the middlewares set with WithClientMiddleware on its own, and the
+// requests answered by the middlewares are not sent to the server.
+//
+// Batching is only available when the negotiated protocol version is ProtocolVersion20250326, as the
+// earlier revision doesn't define it, and ProtocolVersion20250618 removed it.
+// The request can be cancelled via the context. When cancelled, a cancellation request will be sent
+// to the server for each of the requests that is not answered yet.
+func (c *Client) Batch(ctx context.Context, requests ...BatchRequest) ([]BatchResult, error) {
+	if !c.serverState.isInitialized() {
+		return nil, errors.New("client not initialized")
 	}
-	return c.session.Send(ctx, JSONRPCMessage{
-		JSONRPC: JSONRPCVersion,
-		ID:      MustString(uuid.New().String()),
-		Method:  MethodLoggingSetLevel,
-		Params:  paramsBs,
+	if version := c.serverState.negotiatedProtocolVersion(); version != ProtocolVersion20250326 {
+		return nil, fmt.Errorf("batch not supported in protocol version %s", version)
+	}
+	if len(requests) == 0 {
+		return nil, errors.New("empty batch")
+	}
+
+	batch := make([]JSONRPCMessage, len(requests))
+	for i, req := range requests {
+		paramsBs, err := json.Marshal(req.Params)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal params of request %d: %w", i, err)
+		}
+		batch[i] = JSONRPCMessage{
+			JSONRPC: JSONRPCVersion,
+			ID:      MustString(uuid.New().String()),
+			Method:  req.Method,
+			Params:  paramsBs,
+		}
+	}
+
+	// Every request goes through the middlewares on its own, and the requests that reach the end of
+	// the chain are sent together, once all of them either reach it or are answered by the middlewares.
+	sender := newBatchSender(ctx, len(batch), func(ctx context.Context, msgs []JSONRPCMessage) error {
+		return c.session().Send(ctx, JSONRPCMessage{Batch: msgs})
 	})
+	results := make([]BatchResult, len(batch))
+	errs := make([]error, len(batch))
+	var wg sync.WaitGroup
+	for i, msg := range batch {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = c.batchRoundTrip(ctx, sender, msg)
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return results, nil
+}
+
+// batchRoundTrip passes the request of the batch through the middlewares, and returns its result.
+// The request that reaches the end of the chain is sent with the other requests of the batch, and
+// the one that is passed again, e.g. retried by the middleware, is sent on its own.
+func (c *Client) batchRoundTrip(ctx context.Context, sender *batchSender, msg JSONRPCMessage) (BatchResult, error) {
+	var once sync.Once
+	handler := func(ctx context.Context, msg JSONRPCMessage) (any, error) {
+		joined := false
+		once.Do(func() { joined = true })
+		if !joined {
+			return c.roundTrip(ctx, msg)
+		}
+
+		results := c.resultManager.register(string(msg.ID))
+		defer c.resultManager.unregister(string(msg.ID))
+
+		if err := sender.join(ctx, msg); err != nil {
+			return nil, err
+		}
+		return c.waitResult(ctx, msg, results)
+	}
+
+	result, err := chainMiddlewares(handler, c.middlewares)(ctx, msg)
+	// The request answered by the middlewares without reaching the end of the chain should not hold
+	// the other requests.
+	once.Do(sender.skip)
+
+	if err != nil {
+		if jsonErr, ok := toJSONRPCError(err); ok {
+			return BatchResult{Error: &jsonErr}, nil
+		}
+		return BatchResult{}, err
+	}
+
+	// The middlewares may replace the result with any value.
+	resultBs, ok := result.(json.RawMessage)
+	if !ok {
+		if resultBs, err = json.Marshal(result); err != nil {
+			return BatchResult{}, fmt.Errorf("failed to marshal result: %w", err)
+		}
+	}
+	return BatchResult{Result: resultBs}, nil
 }
 
 // ServerInfo returns the server's info.
@@ -737,191 +1023,529 @@ func (c *Client) LoggingServerSupported() bool {
 	return c.serverState.loggingAvailable()
 }
 
-func (c *Client) start() {
-	defer close(c.closed)
-
-	// This channel would be used to notify ping goroutine to stop.
-	pingDone := make(chan struct{})
-	defer close(pingDone)
+// ProtocolVersion returns the protocol revision negotiated with the server. It returns an
+// empty string if the client is not connected.
+func (c *Client) ProtocolVersion() string {
+	return c.serverState.negotiatedProtocolVersion()
+}
 
-	// Spawn a goroutine to ping the server.
-	go c.ping(pingDone)
-	// Spawn a goroutine to handle the roots list updater, if it is implemented by user.
-	if c.rootsListUpdater != nil {
-		go c.listenListRootUpdates()
+// connect starts a new session with the transport, and initializes it. If the initialization fails,
+// the session is closed.
+func (c *Client) connect(ctx context.Context) error {
+	// Start session using the transport.
+	sess, err := c.transport.StartSession(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start session: %w", err)
 	}
-	// This loops would break when the transport is shutdown.
-	for msg := range c.session.Messages() {
-		if msg.JSONRPC != JSONRPCVersion {
-			c.logger.Error("invalid jsonrpc version", "version", msg.JSONRPC)
-			continue
-		}
-
-		switch msg.Method {
-		case methodPing:
-			go func(msgID MustString) {
-				// Send pong back to the server.
-				pongCtx, pongCancel := context.WithTimeout(context.Background(), c.pingTimeout)
-				if err := c.session.Send(pongCtx, JSONRPCMessage{
-					JSONRPC: JSONRPCVersion,
-					ID:      msgID,
-				}); err != nil {
-					c.logger.Error("failed to send pong", slog.String("err", err.Error()))
-				}
-				pongCancel()
-			}(msg.ID)
-		case MethodRootsList, MethodSamplingCreateMessage:
-			go c.handleHandlerImplementationMessage(msg)
-		case methodNotificationsPromptsListChanged:
-			if c.serverState.isInitialized() && c.promptListWatcher != nil {
-				c.promptListWatcher.OnPromptListChanged()
-			}
-		case methodNotificationsResourcesListChanged:
-			if c.serverState.isInitialized() && c.resourceListWatcher != nil {
-				c.resourceListWatcher.OnResourceListChanged()
-			}
-		case methodNotificationsResourcesUpdated:
-			if c.serverState.isInitialized() && c.resourceSubscribedWatcher != nil {
-				var params SubscribeResourceParams
-				if err := json.Unmarshal(msg.Params, &params); err != nil {
-					c.logger.Error("failed to unmarshal resources subscribe params", slog.String("err", err.Error()))
-				}
-				c.resourceSubscribedWatcher.OnResourceSubscribedChanged(params.URI)
-			}
-		case methodNotificationsToolsListChanged:
-			if c.serverState.isInitialized() && c.toolListWatcher != nil {
-				c.toolListWatcher.OnToolListChanged()
-			}
-		case methodNotificationsProgress:
-			if c.serverState.isInitialized() && c.progressListener == nil {
-				continue
-			}
+	closed := c.connection.begin(sess)
 
-			var params ProgressParams
-			if err := json.Unmarshal(msg.Params, &params); err != nil {
-				c.logger.Error("failed to unmarshal progress params", slog.String("err", err.Error()))
-				continue
-			}
-			c.progressListener.OnProgress(params)
-		case methodNotificationsMessage:
-			if c.serverState.isInitialized() && c.logReceiver == nil {
-				continue
-			}
+	// Initialize the result manager.
+	c.resultManager.init()
 
-			var params LogParams
-			if err := json.Unmarshal(msg.Params, &params); err != nil {
-				c.logger.Error("failed to unmarshal log params", "err", err)
-				continue
-			}
-			c.logReceiver.OnLog(params)
-		case "":
-			// This should be a result from the server from our request earlier, including initialization result.
-			c.resultManager.feed(msg)
-		}
+	// Spawn a goroutine to handle the roots list updater, if it is implemented by user. It outlives
+	// the sessions, so it's only spawned once.
+	if c.rootsListUpdater != nil {
+		c.rootsListOnce.Do(func() {
+			go c.listenListRootUpdates()
+		})
 	}
-}
-
-func (c *Client) handleHandlerImplementationMessage(msg JSONRPCMessage) {
-	// This variables is used to store all the result from the handler implementation
-	// to be sent back to the server below.
-	var result any
-	// The err is should always an instance of JSONRPCError, we declare it as an error type,
-	// is for the nil-check feature.
-	var err error
 
-	switch msg.Method {
-	case MethodRootsList:
-		result, err = c.callListRoots()
-	case MethodSamplingCreateMessage:
-		result, err = c.callSamplingMessages(msg)
-	default:
-		return
-	}
+	// Spawn the main loop for handling messages. And because we already started this,
+	// if then the initialization fails, we should close the session to clean up resources.
+	go c.start(sess, closed)
 
-	resMsg := JSONRPCMessage{
-		JSONRPC: JSONRPCVersion,
-		ID:      msg.ID,
+	// Register the initialization result channel and initiate the initialization request.
+	initMsgID := uuid.New().String()
+	results := c.resultManager.register(initMsgID)
+	defer c.resultManager.unregister(initMsgID)
+	if err := c.sendInitialize(ctx, MustString(initMsgID)); err != nil {
+		c.logger.Error("failed to send initialize request", slog.String("err", err.Error()))
+		c.closeSession(sess, closed)
+		return err
 	}
 
-	if err != nil {
-		jsonErr := JSONRPCError{}
-		if errors.As(err, &jsonErr) {
-			c.logger.Error("failed to call handler implementation",
-				slog.String("method", msg.Method),
-				slog.String("err", err.Error()))
-			resMsg.Error = &jsonErr
+	// Wait for the initialization result.
+	var initResMsg JSONRPCMessage
+	select {
+	case <-ctx.Done():
+		c.logger.Error("failed to initialize", slog.String("err", ctx.Err().Error()))
+		c.closeSession(sess, closed)
+		return fmt.Errorf("failed to initialize: %w", ctx.Err())
+	case res, ok := <-results:
+		if !ok {
+			c.closeSession(sess, closed)
+			return fmt.Errorf("failed to initialize: %w", errClientDisconnected)
 		}
+		initResMsg = res
 	}
 
-	resMsg.Result, _ = json.Marshal(result)
-
-	ctx, cancel := context.WithTimeout(context.Background(), c.pingInterval)
-	defer cancel()
+	if initResMsg.Error != nil {
+		// Server told our initialization request failed.
+		c.logger.Error("failed to initialize", slog.String("err", initResMsg.Error.Error()))
+		c.closeSession(sess, closed)
+		return fmt.Errorf("failed to initialize: %w", initResMsg.Error)
+	}
 
-	if err := c.session.Send(ctx, resMsg); err != nil {
+	// Verify the server's initialization result.
+	initRes, err := c.verifyInitialize(initResMsg)
+	if err != nil {
+		nErr := fmt.Errorf("failed to verify initialize result: %w", err)
+		c.logger.Error("failed to verify initialize result", slog.String("err", err.Error()))
+		// Server initialization result is invalid, we should send the error back to them and close the session.
+		if err := sess.Send(ctx, JSONRPCMessage{
+			JSONRPC: JSONRPCVersion,
+			ID:      initResMsg.ID,
+			Error: &JSONRPCError{
+				Code:    jsonRPCInvalidParamsCode,
+				Message: err.Error(),
+			},
+		}); err != nil {
+			c.logger.Error("failed to send initialization error", slog.String("err", err.Error()))
+			nErr = fmt.Errorf("failed to send initialization error: %w", err)
+		}
+		c.closeSession(sess, closed)
+		return nErr
+	}
+
+	// Let the session carry the negotiated version in the requests that follow, e.g. in the header of
+	// the HTTP requests.
+	if versionSess, ok := sess.(protocolVersionSession); ok {
+		versionSess.setProtocolVersion(initRes.ProtocolVersion)
+	}
+
+	// Send the initialization notification to server.
+	if err := sess.Send(ctx, JSONRPCMessage{
+		JSONRPC: JSONRPCVersion,
+		Method:  methodNotificationsInitialized,
+	}); err != nil {
+		c.logger.Error("failed to send initialization notification", slog.String("err", err.Error()))
+		c.closeSession(sess, closed)
+		return fmt.Errorf("failed to send initialization notification: %w", err)
+	}
+
+	// Initialize the server state.
+	c.serverState.init(initRes.ServerInfo, initRes.Capabilities, initRes.ProtocolVersion)
+	// The tools of the new session may differ from the previous one.
+	c.tools.invalidate()
+
+	// The session may be ended by the transport while we're initializing it, or the user may
+	// disconnect the client while we're reconnecting, then it's not usable anymore.
+	if !c.connection.establish() {
+		c.serverState.reset()
+		c.closeSession(sess, closed)
+		return errors.New("session is closed while initializing")
+	}
+
+	return nil
+}
+
+// closeSession stops the session that failed to be initialized, and waits for its main loop to exit.
+func (c *Client) closeSession(sess Session, closed <-chan struct{}) {
+	sess.Stop()
+	<-closed
+}
+
+// sessionEnded is called when the main loop of the session exits. If the session is ended by the
+// transport rather than by Disconnect, the client starts reconnecting, if the policy is set.
+func (c *Client) sessionEnded(sess Session) {
+	if !c.connection.end() {
+		return
+	}
+
+	logger := c.logger
+	if errSess, ok := sess.(ErrorSession); ok {
+		if err := errSess.Err(); err != nil {
+			logger = logger.With(slog.String("err", err.Error()))
+		}
+	}
+
+	// The pending requests would never be answered, as the session is gone.
+	c.resultManager.close()
+	c.serverState.reset()
+
+	if c.reconnectPolicy == nil {
+		logger.Warn("session is ended by the transport")
+		c.setConnectionState(ConnectionStateDisconnected)
+		return
+	}
+
+	ctx, done, ok := c.connection.startReconnect()
+	if !ok {
+		return
+	}
+	logger.Warn("session is ended by the transport, reconnecting")
+	c.setConnectionState(ConnectionStateReconnecting)
+	go c.reconnect(ctx, done)
+}
+
+func (c *Client) reconnect(ctx context.Context, done chan<- struct{}) {
+	defer close(done)
+
+	delay := c.reconnectPolicy.InitialDelay
+	for attempt := 1; ; attempt++ {
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		attemptCtx, attemptCancel := context.WithTimeout(ctx, c.pingTimeout)
+		err := c.connect(attemptCtx)
+		if err == nil {
+			c.restoreSession(attemptCtx)
+			attemptCancel()
+			c.setConnectionState(ConnectionStateConnected)
+			return
+		}
+		attemptCancel()
+
+		// The reconnection is stopped by Disconnect.
+		if ctx.Err() != nil {
+			return
+		}
+
+		c.logger.Warn("failed to reconnect",
+			slog.Int("attempt", attempt),
+			slog.String("err", err.Error()))
+		if c.reconnectPolicy.MaxAttempts > 0 && attempt >= c.reconnectPolicy.MaxAttempts {
+			c.logger.Error("failed to reconnect, giving up", slog.Int("attempts", attempt))
+			c.setConnectionState(ConnectionStateDisconnected)
+			return
+		}
+
+		delay = min(time.Duration(float64(delay)*c.reconnectPolicy.Multiplier), c.reconnectPolicy.MaxDelay)
+	}
+}
+
+// restoreSession replays the subscriptions and the log level requested by the user to the new session.
+func (c *Client) restoreSession(ctx context.Context) {
+	subscriptions, logLevel := c.connection.replayed()
+
+	if c.serverState.resourceServerAvailable() {
+		for _, uri := range subscriptions {
+			if _, err := c.sendRequest(ctx, MethodResourcesSubscribe, SubscribeResourceParams{URI: uri}); err != nil {
+				c.logger.Error("failed to restore resource subscription",
+					slog.String("uri", uri),
+					slog.String("err", err.Error()))
+			}
+		}
+	}
+
+	if logLevel != nil && c.serverState.loggingAvailable() {
+		if _, err := c.sendRequest(ctx, MethodLoggingSetLevel, LogParams{Level: *logLevel}); err != nil {
+			c.logger.Error("failed to restore log level", slog.String("err", err.Error()))
+		}
+	}
+}
+
+func (c *Client) setConnectionState(state ConnectionState) {
+	if !c.connection.setState(state) {
+		return
+	}
+	if c.onConnectionStateChanged != nil {
+		c.onConnectionStateChanged(state)
+	}
+}
+
+func (c *Client) session() Session {
+	sess, _ := c.connection.current()
+	return sess
+}
+
+func (c *Client) start(sess Session, closed chan<- struct{}) {
+	defer close(closed)
+
+	// These channels would be used to notify ping goroutine to stop, and to wait until it's stopped.
+	pingDone := make(chan struct{})
+	pingClosed := make(chan struct{})
+	defer func() {
+		close(pingDone)
+		<-pingClosed
+
+		c.sessionEnded(sess)
+	}()
+
+	// Spawn a goroutine to ping the server.
+	go c.ping(pingDone, pingClosed)
+	// This loops would break when the transport is shutdown.
+	for sessMsg := range sess.Messages() {
+		// The batch is fanned out to be handled as individual messages, and the responses for its
+		// requests are collected to be sent back as a single batch.
+		batch := newBatchCollector(sessMsg)
+		for _, msg := range batchMessages(sessMsg) {
+			if msg.JSONRPC != JSONRPCVersion {
+				c.logger.Error("invalid jsonrpc version", "version", msg.JSONRPC)
+				c.dropBatchRequest(batch, msg)
+				continue
+			}
+
+			switch msg.Method {
+			case methodPing:
+				go func(msgID MustString) {
+					// Send pong back to the server.
+					pongCtx, pongCancel := context.WithTimeout(context.Background(), c.pingTimeout)
+					if err := c.sendResponse(pongCtx, batch, JSONRPCMessage{
+						JSONRPC: JSONRPCVersion,
+						ID:      msgID,
+					}); err != nil {
+						c.logger.Error("failed to send pong", slog.String("err", err.Error()))
+					}
+					pongCancel()
+				}(msg.ID)
+			case MethodRootsList, MethodSamplingCreateMessage, MethodElicitationCreate:
+				go c.handleHandlerImplementationMessage(batch, msg)
+			case methodNotificationsPromptsListChanged:
+				if c.serverState.isInitialized() && c.promptListWatcher != nil {
+					c.promptListWatcher.OnPromptListChanged()
+				}
+			case methodNotificationsResourcesListChanged:
+				if c.serverState.isInitialized() && c.resourceListWatcher != nil {
+					c.resourceListWatcher.OnResourceListChanged()
+				}
+			case methodNotificationsResourcesUpdated:
+				if c.serverState.isInitialized() && c.resourceSubscribedWatcher != nil {
+					var params SubscribeResourceParams
+					if err := json.Unmarshal(msg.Params, &params); err != nil {
+						c.logger.Error("failed to unmarshal resources subscribe params", slog.String("err", err.Error()))
+					}
+					c.resourceSubscribedWatcher.OnResourceSubscribedChanged(params.URI)
+				}
+			case methodNotificationsToolsListChanged:
+				c.tools.invalidate()
+				if c.serverState.isInitialized() && c.toolListWatcher != nil {
+					c.toolListWatcher.OnToolListChanged()
+				}
+			case methodNotificationsProgress:
+				if c.serverState.isInitialized() && c.progressListener == nil {
+					continue
+				}
+
+				var params ProgressParams
+				if err := json.Unmarshal(msg.Params, &params); err != nil {
+					c.logger.Error("failed to unmarshal progress params", slog.String("err", err.Error()))
+					continue
+				}
+				c.progressListener.OnProgress(params)
+			case methodNotificationsMessage:
+				if c.serverState.isInitialized() && c.logReceiver == nil {
+					continue
+				}
+
+				var params LogParams
+				if err := json.Unmarshal(msg.Params, &params); err != nil {
+					c.logger.Error("failed to unmarshal log params", "err", err)
+					continue
+				}
+				c.logReceiver.OnLog(params)
+			case methodNotificationsCancelled:
+				var params notificationsCancelledParams
+				if err := json.Unmarshal(msg.Params, &params); err != nil {
+					c.logger.Error("failed to unmarshal cancelled params", slog.String("err", err.Error()))
+					continue
+				}
+				c.handlerCancels.cancel(params.RequestID)
+			case "":
+				// This should be a result from the server from our request earlier, including initialization result.
+				c.resultManager.feed(msg)
+			default:
+				if msg.ID == "" {
+					// The notification with unknown method is ignored.
+					continue
+				}
+				// The request with unknown method is answered with a method not found error by the
+				// handler implementation, so the server doesn't wait for it, along with its batch.
+				go c.handleHandlerImplementationMessage(batch, msg)
+			}
+		}
+	}
+}
+
+func (c *Client) handleHandlerImplementationMessage(batch *batchCollector, msg JSONRPCMessage) {
+	// The handler implementation is cancellable, so we register its cancellation, to cancel it
+	// if the server requests it.
+	handlerCtx, handlerCancel := context.WithTimeout(context.Background(), c.pingInterval)
+	c.handlerCancels.add(msg.ID, handlerCancel)
+	defer c.handlerCancels.remove(msg.ID)
+
+	// This variables is used to store all the result from the handler implementation
+	// to be sent back to the server below. The err is usually an instance of JSONRPCError, but the
+	// middlewares may return any error, which is answered as an internal error. The request is
+	// answered even if it's cancelled, so the batch it's received within is not held waiting for it.
+	result, err := chainMiddlewares(c.callHandlerImplementation, c.middlewares)(handlerCtx, msg)
+
+	resMsg := JSONRPCMessage{
+		JSONRPC: JSONRPCVersion,
+		ID:      msg.ID,
+	}
+
+	if err != nil {
+		c.logger.Error("failed to call handler implementation",
+			slog.String("method", msg.Method),
+			slog.String("err", err.Error()))
+		jsonErr, ok := toJSONRPCError(err)
+		if !ok {
+			jsonErr = JSONRPCError{
+				Code:    jsonRPCInternalErrorCode,
+				Message: err.Error(),
+			}
+		}
+		resMsg.Error = &jsonErr
+	} else {
+		resMsg.Result, _ = json.Marshal(result)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.pingInterval)
+	defer cancel()
+
+	if err := c.sendResponse(ctx, batch, resMsg); err != nil {
 		c.logger.Error("failed to send result", slog.String("err", err.Error()))
 	}
 }
 
+// callHandlerImplementation calls the handler implementation that handles the request's method.
+func (c *Client) callHandlerImplementation(ctx context.Context, msg JSONRPCMessage) (any, error) {
+	switch msg.Method {
+	case MethodRootsList:
+		return c.callListRoots(ctx)
+	case MethodSamplingCreateMessage:
+		return c.callSamplingMessages(ctx, msg)
+	case MethodElicitationCreate:
+		return c.callElicitation(ctx, msg)
+	default:
+		return nil, JSONRPCError{
+			Code:    jsonRPCMethodNotFoundCode,
+			Message: fmt.Sprintf("method %s not found", msg.Method),
+		}
+	}
+}
+
+// sendResponse sends the response to the server. If the response is for a request received within
+// the batch, it's collected instead, and sent along with the other responses once all of the requests
+// in the batch are answered.
+func (c *Client) sendResponse(ctx context.Context, batch *batchCollector, msg JSONRPCMessage) error {
+	responses, collected := batch.collect(msg)
+	if !collected {
+		return c.session().Send(ctx, msg)
+	}
+	if responses == nil {
+		return nil
+	}
+	return c.session().Send(ctx, JSONRPCMessage{Batch: responses})
+}
+
+// dropBatchRequest marks the request as not going to be answered, so its batch is not held waiting
+// for its response.
+func (c *Client) dropBatchRequest(batch *batchCollector, msg JSONRPCMessage) {
+	responses := batch.drop(msg)
+	if responses == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.pingInterval)
+	defer cancel()
+
+	if err := c.session().Send(ctx, JSONRPCMessage{Batch: responses}); err != nil {
+		c.logger.Error("failed to send batch result", slog.String("err", err.Error()))
+	}
+}
+
 func (c *Client) sendRequest(ctx context.Context, method string, params any) (JSONRPCMessage, error) {
 	paramsBs, err := json.Marshal(params)
 	if err != nil {
 		return JSONRPCMessage{}, fmt.Errorf("failed to marshal params: %w", err)
 	}
 
-	msgID := uuid.New().String()
 	msg := JSONRPCMessage{
 		JSONRPC: JSONRPCVersion,
-		ID:      MustString(msgID),
+		ID:      MustString(uuid.New().String()),
 		Method:  method,
 		Params:  paramsBs,
 	}
 
+	result, err := chainMiddlewares(c.roundTrip, c.middlewares)(ctx, msg)
+	if err != nil {
+		return JSONRPCMessage{}, err
+	}
+
+	// The middlewares may replace the result with any value.
+	resultBs, ok := result.(json.RawMessage)
+	if !ok {
+		if resultBs, err = json.Marshal(result); err != nil {
+			return JSONRPCMessage{}, fmt.Errorf("failed to marshal result: %w", err)
+		}
+	}
+
+	return JSONRPCMessage{
+		JSONRPC: JSONRPCVersion,
+		ID:      msg.ID,
+		Result:  resultBs,
+	}, nil
+}
+
+// roundTrip sends the request to the server, and waits for its result.
+func (c *Client) roundTrip(ctx context.Context, msg JSONRPCMessage) (any, error) {
+	msgID := string(msg.ID)
 	results := c.resultManager.register(msgID)
+	// Forget the result channel if the result is not received, e.g. when the request times out, so
+	// the late response is ignored and the channel is not kept until the session ends.
+	defer c.resultManager.unregister(msgID)
 
-	if err := c.session.Send(ctx, msg); err != nil {
-		return JSONRPCMessage{}, fmt.Errorf("failed to send request: %w", err)
+	if err := c.session().Send(ctx, msg); err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
 
+	return c.waitResult(ctx, msg, results)
+}
+
+// waitResult waits for the result of the sent request. If the ctx is cancelled, the server is notified
+// of the cancellation of the request.
+func (c *Client) waitResult(ctx context.Context, msg JSONRPCMessage, results <-chan JSONRPCMessage) (any, error) {
 	var res JSONRPCMessage
 	select {
 	case <-ctx.Done():
 		err := ctx.Err()
 		if !errors.Is(err, context.Canceled) {
-			return JSONRPCMessage{}, fmt.Errorf("request timeout: %w", err)
+			return nil, fmt.Errorf("request timeout: %w", err)
 		}
 
 		// If the context is canceled, we should send a notification to the server to indicate the request was cancelled.
-
-		cCtx, cCancel := context.WithTimeout(context.Background(), c.pingInterval)
-		defer cCancel()
-
-		params := notificationsCancelledParams{
-			RequestID: msgID,
-			Reason:    userCancelledReason,
-		}
-
-		cancelParamsBs, _ := json.Marshal(params)
-
-		err = nil
-		nErr := c.session.Send(cCtx, JSONRPCMessage{
-			JSONRPC: JSONRPCVersion,
-			ID:      MustString(msgID),
-			Method:  methodNotificationsCancelled,
-			Params:  cancelParamsBs,
-		})
-		if nErr != nil {
+		if nErr := c.sendCancellation(msg.ID); nErr != nil {
 			err = fmt.Errorf("%w: failed to send notification: %w", err, nErr)
 		}
-		return JSONRPCMessage{}, err
-	case res = <-results:
+		return nil, err
+	case r, ok := <-results:
+		if !ok {
+			return nil, errClientDisconnected
+		}
+		res = r
 	}
 
 	if res.Error != nil {
-		return JSONRPCMessage{}, fmt.Errorf("result error: %w", res.Error)
+		return nil, fmt.Errorf("result error: %w", res.Error)
+	}
+
+	return res.Result, nil
+}
+
+func (c *Client) sendCancellation(msgID MustString) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.pingInterval)
+	defer cancel()
+
+	params := notificationsCancelledParams{
+		RequestID: msgID,
+		Reason:    userCancelledReason,
 	}
 
-	return res, nil
+	paramsBs, _ := json.Marshal(params)
+
+	return c.session().Send(ctx, JSONRPCMessage{
+		JSONRPC: JSONRPCVersion,
+		ID:      msgID,
+		Method:  methodNotificationsCancelled,
+		Params:  paramsBs,
+	})
 }
 
 func (c *Client) listenListRootUpdates() {
@@ -929,7 +1553,7 @@ func (c *Client) listenListRootUpdates() {
 
 	for range c.rootsListUpdater.RootsListUpdates() {
 		ctx, cancel := context.WithTimeout(context.Background(), c.pingInterval)
-		if err := c.session.Send(ctx, JSONRPCMessage{
+		if err := c.session().Send(ctx, JSONRPCMessage{
 			JSONRPC: JSONRPCVersion,
 			Method:  methodNotificationsRootsListChanged,
 			Params:  nil,
@@ -940,8 +1564,8 @@ func (c *Client) listenListRootUpdates() {
 	}
 }
 
-func (c *Client) ping(done <-chan struct{}) {
-	defer close(c.pingClosed)
+func (c *Client) ping(done <-chan struct{}, closed chan<- struct{}) {
+	defer close(closed)
 
 	pingTicker := time.NewTicker(c.pingInterval)
 	for {
@@ -960,8 +1584,13 @@ func (c *Client) ping(done <-chan struct{}) {
 			Method:  methodPing,
 		}
 
-		if err := c.session.Send(ctx, msg); err != nil {
+		// We expect pong response from server, so register the result channel for the request before
+		// sending it, as the response may arrive before the Send call returns.
+		results := c.resultManager.register(msgID)
+
+		if err := c.session().Send(ctx, msg); err != nil {
 			cancel()
+			c.resultManager.unregister(msgID)
 			c.logger.Error("failed to send ping to server",
 				slog.String("err", err.Error()),
 				slog.Any("message", msg))
@@ -971,13 +1600,11 @@ func (c *Client) ping(done <-chan struct{}) {
 			continue
 		}
 
-		// We expect pong response from server, so register the result channel for the request.
-		results := c.resultManager.register(msgID)
-
 		// Wait for the pong response.
 		select {
 		case <-ctx.Done():
 			cancel()
+			c.resultManager.unregister(msgID)
 			nErr := fmt.Errorf("failed to receive pong response from server: %w", ctx.Err())
 			c.logger.Error("failed to receive pong response from server", slog.String("err", ctx.Err().Error()))
 			if c.onPingFailed != nil {
@@ -987,8 +1614,12 @@ func (c *Client) ping(done <-chan struct{}) {
 		case <-done:
 			cancel()
 			return
-		case res := <-results:
+		case res, ok := <-results:
 			cancel()
+			if !ok {
+				// The session is ended, the reconnection or the disconnection is reported elsewhere.
+				continue
+			}
 			if res.Error != nil {
 				nErr := fmt.Errorf("received pong response error from server: %w", res.Error)
 				c.logger.Error("received pong response error from server", slog.String("err", res.Error.Error()))
@@ -1004,7 +1635,7 @@ func (c *Client) ping(done <-chan struct{}) {
 
 func (c *Client) sendInitialize(ctx context.Context, msgID MustString) error {
 	params := initializeParams{
-		ProtocolVersion: protocolVersion,
+		ProtocolVersion: latestProtocolVersion(c.protocolVersions),
 		Capabilities:    c.capabilities,
 		ClientInfo:      c.info,
 	}
@@ -1013,7 +1644,7 @@ func (c *Client) sendInitialize(ctx context.Context, msgID MustString) error {
 		return fmt.Errorf("failed to marshal initialize params: %w", err)
 	}
 
-	return c.session.Send(ctx, JSONRPCMessage{
+	return c.session().Send(ctx, JSONRPCMessage{
 		JSONRPC: JSONRPCVersion,
 		ID:      msgID,
 		Method:  methodInitialize,
@@ -1031,14 +1662,17 @@ func (c *Client) verifyInitialize(msg JSONRPCMessage) (initializeResult, error)
 		return initializeResult{}, fmt.Errorf("failed to unmarshal initialize result: %w", err)
 	}
 
-	if result.ProtocolVersion != protocolVersion {
-		return initializeResult{}, fmt.Errorf("protocol version mismatch: %s != %s", result.ProtocolVersion, protocolVersion)
+	// The server may propose another version if it doesn't support the one we requested,
+	// we can only continue if we support it too.
+	if !slices.Contains(c.protocolVersions, result.ProtocolVersion) {
+		return initializeResult{}, fmt.Errorf("unsupported protocol version %s, supported versions: %v",
+			result.ProtocolVersion, c.protocolVersions)
 	}
 
 	return result, nil
 }
 
-func (c *Client) callListRoots() (RootList, error) {
+func (c *Client) callListRoots(ctx context.Context) (RootList, error) {
 	if !c.serverState.isInitialized() {
 		return RootList{}, JSONRPCError{
 			Code:    jsonRPCInvalidParamsCode,
@@ -1052,9 +1686,6 @@ func (c *Client) callListRoots() (RootList, error) {
 		}
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), c.pingInterval)
-	defer cancel()
-
 	roots, err := c.rootsListHandler.RootsList(ctx)
 	if err != nil {
 		return RootList{}, JSONRPCError{
@@ -1066,7 +1697,7 @@ func (c *Client) callListRoots() (RootList, error) {
 	return roots, nil
 }
 
-func (c *Client) callSamplingMessages(msg JSONRPCMessage) (SamplingResult, error) {
+func (c *Client) callSamplingMessages(ctx context.Context, msg JSONRPCMessage) (SamplingResult, error) {
 	if !c.serverState.isInitialized() {
 		return SamplingResult{}, JSONRPCError{
 			Code:    jsonRPCInvalidParamsCode,
@@ -1080,9 +1711,6 @@ func (c *Client) callSamplingMessages(msg JSONRPCMessage) (SamplingResult, error
 		}
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), c.pingInterval)
-	defer cancel()
-
 	var params SamplingParams
 	if err := json.Unmarshal(msg.Params, &params); err != nil {
 		return SamplingResult{}, JSONRPCError{
@@ -1102,67 +1730,227 @@ func (c *Client) callSamplingMessages(msg JSONRPCMessage) (SamplingResult, error
 	return result, nil
 }
 
-func (c *clientResultManager) init() {
+func (c *Client) callElicitation(ctx context.Context, msg JSONRPCMessage) (ElicitationResult, error) {
+	if !c.serverState.isInitialized() {
+		return ElicitationResult{}, JSONRPCError{
+			Code:    jsonRPCInvalidParamsCode,
+			Message: "client not initialized",
+		}
+	}
+	if c.elicitationHandler == nil {
+		return ElicitationResult{}, JSONRPCError{
+			Code:    jsonRPCMethodNotFoundCode,
+			Message: "elicitation not supported by client",
+		}
+	}
+
+	var params ElicitationParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		return ElicitationResult{}, JSONRPCError{
+			Code:    jsonRPCInvalidParamsCode,
+			Message: fmt.Sprintf("failed to unmarshal params: %s", err.Error()),
+		}
+	}
+
+	result, err := c.elicitationHandler.Elicit(ctx, params)
+	if err != nil {
+		return ElicitationResult{}, JSONRPCError{
+			Code:    jsonRPCInternalErrorCode,
+			Message: fmt.Sprintf("failed to elicit user input: %s", err.Error()),
+		}
+	}
+
+	return result, nil
+}
+
+// String returns the name of the connection state.
+func (s ConnectionState) String() string {
+	switch s {
+	case ConnectionStateDisconnected:
+		return "disconnected"
+	case ConnectionStateConnected:
+		return "connected"
+	case ConnectionStateReconnecting:
+		return "reconnecting"
+	default:
+		return fmt.Sprintf("ConnectionState(%d)", int(s))
+	}
+}
+
+func (h *handlerCancels) add(msgID MustString, cancel context.CancelFunc) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.cancels[msgID] = cancel
+}
+
+// remove removes the cancellation of the finished request, and releases its context.
+func (h *handlerCancels) remove(msgID MustString) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if cancel, ok := h.cancels[msgID]; ok {
+		cancel()
+		delete(h.cancels, msgID)
+	}
+}
+
+func (h *handlerCancels) cancel(msgID MustString) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if cancel, ok := h.cancels[msgID]; ok {
+		cancel()
+	}
+}
+
+// open prepares the connection to be connected by the user.
+func (c *clientConnection) open() {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 
-	c.closed = false
+	c.closing = false
 }
 
-func (c *clientResultManager) register(msgID string) <-chan JSONRPCMessage {
+// begin sets the new session as the current one, and returns the channel that should be closed when
+// its main loop exits.
+func (c *clientConnection) begin(sess Session) chan struct{} {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 
-	results := make(chan JSONRPCMessage)
-	c.channels[msgID] = results
+	c.session = sess
+	c.closed = make(chan struct{})
+	c.established = false
+	c.ended = false
 
-	return results
+	return c.closed
 }
 
-func (c *clientResultManager) feed(result JSONRPCMessage) {
+// establish marks the current session as initialized, it returns false if the session is already
+// ended, or the connection is closed by the user.
+func (c *clientConnection) establish() bool {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 
-	// It's already closed, so we should return.
-	if c.closed {
-		return
+	if c.ended || c.closing {
+		return false
 	}
+	c.established = true
 
-	ch, ok := c.channels[string(result.ID)]
-	if !ok {
-		// Ignore the result if it's not registered.
-		return
+	return true
+}
+
+// end marks the current session as ended, it returns true if the session is ended by the transport
+// after it's initialized, which means the client should reconnect.
+func (c *clientConnection) end() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.ended = true
+
+	return c.established && !c.closing
+}
+
+// startReconnect registers the reconnection that is about to start, so it can be stopped by close.
+// It returns false if the connection is already closed by the user.
+func (c *clientConnection) startReconnect() (context.Context, chan struct{}, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.closing {
+		return nil, nil, false
 	}
 
-	// Feed the result to the registered channel and drop it if there is no receiver.
-	select {
-	case ch <- result:
-	default:
+	ctx, cancel := context.WithCancel(context.Background())
+	c.reconnectCancel = cancel
+	c.reconnectDone = make(chan struct{})
+
+	return ctx, c.reconnectDone, true
+}
+
+// close marks the connection as closed by the user, and forgets the recorded subscriptions and log
+// level. It cancels the running reconnection, and returns the channel that is closed when it stops,
+// or nil if there is none.
+func (c *clientConnection) close() <-chan struct{} {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.closing = true
+	c.subscriptions = nil
+	c.logLevel = nil
+
+	if c.reconnectCancel == nil {
+		return nil
+	}
+	c.reconnectCancel()
+	done := c.reconnectDone
+	c.reconnectCancel = nil
+	c.reconnectDone = nil
+
+	return done
+}
+
+func (c *clientConnection) current() (Session, <-chan struct{}) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.session, c.closed
+}
+
+// setState sets the state of the connection, it returns false if the state is not changed.
+func (c *clientConnection) setState(state ConnectionState) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.state == state {
+		return false
 	}
+	c.state = state
 
-	// Remove the channel from the map to avoid memory leaks.
-	delete(c.channels, string(result.ID))
+	return true
 }
 
-func (c *clientResultManager) close() {
+func (c *clientConnection) addSubscription(uri string) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 
-	// Close all the result channels
-	for _, results := range c.channels {
-		close(results)
+	if !slices.Contains(c.subscriptions, uri) {
+		c.subscriptions = append(c.subscriptions, uri)
 	}
+}
+
+func (c *clientConnection) removeSubscription(uri string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.subscriptions = slices.DeleteFunc(c.subscriptions, func(s string) bool {
+		return s == uri
+	})
+}
+
+func (c *clientConnection) setLogLevel(level LogLevel) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
 
-	c.closed = true
+	c.logLevel = &level
 }
 
-func (s *serverState) init(info Info, capabilities ServerCapabilities) {
+// replayed returns the subscriptions and the log level to replay to the new session.
+func (c *clientConnection) replayed() ([]string, *LogLevel) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return slices.Clone(c.subscriptions), c.logLevel
+}
+
+func (s *serverState) init(info Info, capabilities ServerCapabilities, protocolVersion string) {
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
 	s.initialized = true
 	s.info = info
 	s.capabilities = capabilities
+	s.protocolVersion = protocolVersion
 	s.stopped = false
 }
 
@@ -1180,6 +1968,13 @@ func (s *serverState) serverInfo() Info {
 	return s.info
 }
 
+func (s *serverState) negotiatedProtocolVersion() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.protocolVersion
+}
+
 func (s *serverState) promptServerAvailable() bool {
 	s.lock.Lock()
 	defer s.lock.Unlock()
@@ -1220,5 +2015,74 @@ func (s *serverState) reset() {
 	defer s.lock.Unlock()
 
 	s.initialized = false
+	s.protocolVersion = ""
 	s.stopped = true
 }
+
+// lookup returns the tool with the name, listing the tools with load if they aren't cached yet, or
+// the tool is not in the cached list, as it may be added since the tools were listed. The lock is
+// not held while the tools are listed, as the notifications that invalidate the cache are handled
+// by the same loop that receives the listed tools.
+func (c *clientToolCache) lookup(
+	ctx context.Context,
+	name string,
+	load func(context.Context) (map[string]Tool, error),
+) (Tool, bool, error) {
+	c.lock.Lock()
+	tool, ok := c.tools[name]
+	generation := c.generation
+	c.lock.Unlock()
+	if ok {
+		return tool, true, nil
+	}
+
+	tools, err := load(ctx)
+	if err != nil {
+		return Tool{}, false, err
+	}
+
+	c.lock.Lock()
+	if c.generation == generation {
+		c.tools = tools
+	}
+	c.lock.Unlock()
+
+	tool, ok = tools[name]
+	return tool, ok, nil
+}
+
+func (c *clientToolCache) invalidate() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.tools = nil
+	c.generation++
+}
+
+// CheckToolCall implements ToolCallPolicy by calling f.
+func (f ToolCallPolicyFunc) CheckToolCall(ctx context.Context, tool Tool, params CallToolParams) error {
+	return f(ctx, tool, params)
+}
+
+// ConfirmDestructiveToolCalls returns a ToolCallPolicy that asks confirm whether the destructive
+// tools may be called, see ToolAnnotations.IsDestructive, and refuses the calls that aren't
+// confirmed. The other tools are always allowed. The confirm function typically prompts the user,
+// and it's called while the call is blocked, so it should honor the context.
+func ConfirmDestructiveToolCalls(
+	confirm func(ctx context.Context, tool Tool, params CallToolParams) (bool, error),
+) ToolCallPolicy {
+	return ToolCallPolicyFunc(func(ctx context.Context, tool Tool, params CallToolParams) error {
+		if !tool.Annotations.IsDestructive() {
+			return nil
+		}
+
+		confirmed, err := confirm(ctx, tool, params)
+		if err != nil {
+			return fmt.Errorf("failed to confirm the call of destructive tool %s: %w", tool.Name, err)
+		}
+		if !confirmed {
+			return fmt.Errorf("call of destructive tool %s is not confirmed", tool.Name)
+		}
+		return nil
+	})
+}
@@ -23,7 +23,10 @@ type mockResourceSubscribedWatcher struct {
 	updateCount int
 }
 
-type mockToolListWatcher struct{}
+type mockToolListWatcher struct {
+	lock        sync.Mutex
+	updateCount int
+}
 
 type mockRootsListHandler struct {
 	called bool
@@ -38,6 +41,26 @@ type mockSamplingHandler struct {
 	called bool
 }
 
+type mockBlockingSamplingHandler struct {
+	lock      sync.Mutex
+	block     bool
+	calls     int
+	cancelled int
+}
+
+type mockElicitationHandler struct {
+	result mcp.ElicitationResult
+}
+
+// mockDroppableClientTransport wraps a transport, so the test can end the session as if the
+// connection is lost.
+type mockDroppableClientTransport struct {
+	mcp.ClientTransport
+
+	lock    sync.Mutex
+	session mcp.Session
+}
+
 type mockProgressListener struct {
 	lock        sync.Mutex
 	updateCount int
@@ -66,7 +89,10 @@ func (m *mockResourceSubscribedWatcher) OnResourceSubscribedChanged(string) {
 	m.updateCount++
 }
 
-func (m mockToolListWatcher) OnToolListChanged() {
+func (m *mockToolListWatcher) OnToolListChanged() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.updateCount++
 }
 
 func (m *mockRootsListHandler) RootsList(context.Context) (mcp.RootList, error) {
@@ -106,6 +132,32 @@ func (m *mockSamplingHandler) CreateSampleMessage(context.Context, mcp.SamplingP
 	}, nil
 }
 
+func (m *mockBlockingSamplingHandler) CreateSampleMessage(
+	ctx context.Context,
+	_ mcp.SamplingParams,
+) (mcp.SamplingResult, error) {
+	m.lock.Lock()
+	m.calls++
+	m.lock.Unlock()
+
+	if m.block {
+		<-ctx.Done()
+		m.lock.Lock()
+		m.cancelled++
+		m.lock.Unlock()
+		return mcp.SamplingResult{}, ctx.Err()
+	}
+
+	return mcp.SamplingResult{
+		Role:  mcp.RoleAssistant,
+		Model: "test-model",
+	}, nil
+}
+
+func (m mockElicitationHandler) Elicit(context.Context, mcp.ElicitationParams) (mcp.ElicitationResult, error) {
+	return m.result, nil
+}
+
 func (m *mockLogReceiver) OnLog(mcp.LogParams) {
 	m.lock.Lock()
 	defer m.lock.Unlock()
@@ -117,3 +169,24 @@ func (m *mockProgressListener) OnProgress(mcp.ProgressParams) {
 	defer m.lock.Unlock()
 	m.updateCount++
 }
+
+func (m *mockDroppableClientTransport) StartSession(ctx context.Context) (mcp.Session, error) {
+	sess, err := m.ClientTransport.StartSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.session = sess
+
+	return sess, nil
+}
+
+func (m *mockDroppableClientTransport) drop() {
+	m.lock.Lock()
+	sess := m.session
+	m.lock.Unlock()
+
+	sess.Stop()
+}
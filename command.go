@@ -0,0 +1,298 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CommandTransport implements a client transport that starts an MCP server executable as a
+// subprocess, and communicates with it through the subprocess's stdin and stdout with the same
+// message framing as StdIO. The stderr of the subprocess is forwarded to the logger line by line.
+//
+// Every StartSession starts a new subprocess, so the client can reconnect by starting the server
+// again. Stopping the session closes the subprocess's stdin, which asks the server to exit, then
+// sends SIGTERM if the server doesn't exit within the grace period, and SIGKILL if it still doesn't
+// exit within another grace period. The output that isn't read yet is discarded once the session is
+// stopped. The session implements ErrorSession, and reports the exit status of the subprocess that
+// exits on its own.
+//
+// Proper initialization requires using the NewCommandTransport constructor function to create
+// new instances.
+type CommandTransport struct {
+	name        string
+	args        []string
+	env         []string
+	dir         string
+	gracePeriod time.Duration
+	logger      *slog.Logger
+}
+
+// CommandTransportOption represents the options for the CommandTransport.
+type CommandTransportOption func(*CommandTransport)
+
+type commandSession struct {
+	stdIOSession
+
+	cmd         *exec.Cmd
+	stdin       io.Closer
+	stdout      *io.PipeReader
+	gracePeriod time.Duration
+
+	// exited is closed once the subprocess exits, after the exit status is recorded in the state.
+	exited chan struct{}
+	state  *commandSessionState
+}
+
+// commandSessionState holds the state of the session that is shared between Stop and the goroutine
+// that waits for the subprocess to exit.
+type commandSessionState struct {
+	lock sync.Mutex
+	err  error
+	// stopped reports whether the session is stopped by Stop, so the exit of the subprocess is expected.
+	stopped bool
+}
+
+// commandStderrWriter forwards the stderr of the subprocess to the logger, line by line.
+type commandStderrWriter struct {
+	logger *slog.Logger
+	buf    []byte
+}
+
+const defaultCommandGracePeriod = 5 * time.Second
+
+// NewCommandTransport creates a new CommandTransport that starts the executable with the name,
+// resolved with exec.LookPath if it contains no path separators, and the args. The subprocess
+// inherits the environment and the working directory of the current process, unless they're
+// configured with WithCommandEnv and WithCommandDir.
+func NewCommandTransport(name string, args []string, options ...CommandTransportOption) CommandTransport {
+	c := CommandTransport{
+		name:        name,
+		args:        args,
+		gracePeriod: defaultCommandGracePeriod,
+		logger:      slog.Default(),
+	}
+
+	for _, opt := range options {
+		opt(&c)
+	}
+
+	return c
+}
+
+// WithCommandEnv sets the environment of the subprocess, in the form of "key=value". The subprocess
+// only receives these variables, so the caller should append them to os.Environ to extend the
+// environment of the current process instead.
+func WithCommandEnv(env []string) CommandTransportOption {
+	return func(c *CommandTransport) {
+		c.env = env
+	}
+}
+
+// WithCommandDir sets the working directory of the subprocess.
+func WithCommandDir(dir string) CommandTransportOption {
+	return func(c *CommandTransport) {
+		c.dir = dir
+	}
+}
+
+// WithCommandGracePeriod sets how long the stopped session waits for the subprocess to exit after
+// closing its stdin, before sending SIGTERM, and after sending SIGTERM, before sending SIGKILL. It's
+// also how long the output is still read after the subprocess exits, if its children hold the output
+// open. The default is 5 seconds.
+func WithCommandGracePeriod(gracePeriod time.Duration) CommandTransportOption {
+	return func(c *CommandTransport) {
+		c.gracePeriod = gracePeriod
+	}
+}
+
+// WithCommandLogger sets the logger for the CommandTransport sessions, which also receives the
+// stderr of the subprocess.
+func WithCommandLogger(logger *slog.Logger) CommandTransportOption {
+	return func(c *CommandTransport) {
+		c.logger = logger.With(
+			slog.String("package", "go-mcp"),
+			slog.String("component", "command"),
+		)
+	}
+}
+
+// StartSession implements the ClientTransport interface by starting the subprocess, and returning
+// the session that communicates with it.
+func (c CommandTransport) StartSession(_ context.Context) (Session, error) {
+	cmd := exec.Command(c.name, c.args...)
+	cmd.Env = c.env
+	cmd.Dir = c.dir
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdin pipe: %w", err)
+	}
+	// The stdout is copied to a pipe instead of read from the file, so the reader receives io.EOF
+	// once the subprocess exits, rather than an error of the file closed by cmd.Wait.
+	stdout, stdoutWriter := io.Pipe()
+	cmd.Stdout = stdoutWriter
+	// The stdout and stderr may be held open by the subprocess's own children after it exits, so
+	// cmd.Wait stops copying them after the grace period.
+	cmd.WaitDelay = c.gracePeriod
+
+	id := uuid.New().String()
+	logger := c.logger.With(slog.String("sessionID", id))
+	stderr := &commandStderrWriter{logger: logger}
+	cmd.Stderr = stderr
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start command %s: %w", c.name, err)
+	}
+
+	sess := commandSession{
+		stdIOSession: stdIOSession{
+			id:            id,
+			reader:        stdout,
+			writer:        stdin,
+			logger:        logger,
+			writeMessages: make(chan stdIOMessage),
+			done:          make(chan struct{}),
+			readClosed:    make(chan struct{}),
+			writeClosed:   make(chan struct{}),
+		},
+		cmd:         cmd,
+		stdin:       stdin,
+		stdout:      stdout,
+		gracePeriod: c.gracePeriod,
+		exited:      make(chan struct{}),
+		state:       &commandSessionState{},
+	}
+
+	go sess.wait(stdoutWriter, stderr)
+	go sess.processWriteMessages()
+
+	return sess, nil
+}
+
+// Send implements the Session interface, it fails with the session's error if the subprocess
+// already exited.
+func (s commandSession) Send(ctx context.Context, msg JSONRPCMessage) error {
+	select {
+	case <-s.exited:
+		s.state.lock.Lock()
+		defer s.state.lock.Unlock()
+		return s.state.err
+	default:
+	}
+	return s.stdIOSession.Send(ctx, msg)
+}
+
+// Err implements the ErrorSession interface, it returns the exit status of the subprocess that
+// exited before the session is stopped.
+func (s commandSession) Err() error {
+	s.state.lock.Lock()
+	defer s.state.lock.Unlock()
+
+	if s.state.stopped {
+		return nil
+	}
+	return s.state.err
+}
+
+// Stop implements the Session interface by closing the stdin of the subprocess, and escalating to
+// SIGTERM and SIGKILL if the subprocess doesn't exit within the grace period.
+func (s commandSession) Stop() {
+	s.state.lock.Lock()
+	s.state.stopped = true
+	s.state.lock.Unlock()
+
+	if err := s.stdin.Close(); err != nil {
+		s.logger.Warn("failed to close stdin", slog.String("err", err.Error()))
+	}
+	// The output is not read anymore, so the copy of the stdout is unblocked, and cmd.Wait doesn't
+	// wait for the reader of the messages.
+	s.stdout.Close()
+	if !s.waitExit() {
+		s.logger.Warn("server process doesn't exit after stdin is closed, sending SIGTERM")
+		if err := s.cmd.Process.Signal(syscall.SIGTERM); err != nil {
+			s.logger.Warn("failed to send SIGTERM", slog.String("err", err.Error()))
+		}
+		if !s.waitExit() {
+			s.logger.Warn("server process doesn't exit after SIGTERM, sending SIGKILL")
+			if err := s.cmd.Process.Kill(); err != nil {
+				s.logger.Warn("failed to send SIGKILL", slog.String("err", err.Error()))
+			}
+			<-s.exited
+		}
+	}
+
+	s.stdIOSession.Stop()
+}
+
+// waitExit waits for the subprocess to exit within the grace period, and reports whether it exited.
+func (s commandSession) waitExit() bool {
+	timer := time.NewTimer(s.gracePeriod)
+	defer timer.Stop()
+
+	select {
+	case <-s.exited:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// wait waits for the subprocess to exit, and records its exit status as the session's error.
+func (s commandSession) wait(stdoutWriter *io.PipeWriter, stderr *commandStderrWriter) {
+	waitErr := s.cmd.Wait()
+	stderr.flush()
+
+	err := errors.New("server process exited")
+	if waitErr != nil {
+		err = fmt.Errorf("server process exited: %w", waitErr)
+	}
+
+	s.state.lock.Lock()
+	stopped := s.state.stopped
+	s.state.err = err
+	s.state.lock.Unlock()
+	close(s.exited)
+
+	if !stopped {
+		s.logger.Error("server process exited unexpectedly", slog.String("err", err.Error()))
+	}
+
+	// The message reader receives io.EOF once the remaining output is read.
+	stdoutWriter.Close()
+}
+
+func (w *commandStderrWriter) Write(p []byte) (int, error) {
+	// The writer is only called by the goroutine of exec.Cmd that copies the stderr.
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.log(w.buf[:i])
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// flush logs the last line that doesn't end with a newline, it's called after the subprocess exits.
+func (w *commandStderrWriter) flush() {
+	if len(w.buf) > 0 {
+		w.log(w.buf)
+		w.buf = nil
+	}
+}
+
+func (w *commandStderrWriter) log(line []byte) {
+	w.logger.Info("server stderr", slog.String("line", string(bytes.TrimSuffix(line, []byte("\r")))))
+}
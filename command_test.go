@@ -0,0 +1,238 @@
+package mcp_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/MegaGrindStone/go-mcp"
+)
+
+const commandHelperEnv = "GO_MCP_COMMAND_HELPER"
+
+// lockedBuffer is a bytes.Buffer that is safe to write from the logger and read from the test.
+type lockedBuffer struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+// eofReader closes the eof channel once the reader reaches the end.
+type eofReader struct {
+	io.Reader
+	eof  chan struct{}
+	once sync.Once
+}
+
+// TestCommandHelperProcess isn't a real test, it's the MCP server started by the CommandTransport
+// tests, with the mode in the commandHelperEnv environment variable.
+func TestCommandHelperProcess(*testing.T) {
+	mode := os.Getenv(commandHelperEnv)
+	if mode == "" {
+		return
+	}
+
+	switch mode {
+	case "exit":
+		os.Stderr.WriteString("fatal: no config\n")
+		os.Exit(3)
+	case "stubborn":
+		// The server ignores both the closed stdin and SIGTERM.
+		signal.Ignore(syscall.SIGTERM)
+		os.Stderr.WriteString("ignoring signals\n")
+		select {}
+	case "flood":
+		// The server keeps writing, even after the client stops reading.
+		os.Stderr.WriteString("flooding\n")
+		for {
+			os.Stdout.WriteString(`{"jsonrpc":"2.0","method":"notifications/message","params":{}}` + "\n")
+		}
+	}
+
+	stdin := &eofReader{Reader: os.Stdin, eof: make(chan struct{})}
+	srv := mcp.NewServer(mcp.Info{Name: "helper", Version: "1.0"},
+		mcp.NewStdIO(stdin, os.Stdout, mcp.WithStdIOLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))),
+		mcp.WithToolServer(&mockToolServer{}),
+		mcp.WithServerLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	go srv.Serve()
+
+	os.Stderr.WriteString("serving\n")
+	// The server exits once the client closes the stdin.
+	<-stdin.eof
+	os.Exit(0)
+}
+
+func TestCommandTransport(t *testing.T) {
+	logs := &lockedBuffer{}
+	transport := newHelperTransport("serve", logs, time.Second)
+	cli := mcp.NewClient(mcp.Info{Name: "test-client", Version: "1.0"}, transport,
+		mcp.WithClientLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := cli.Connect(ctx); err != nil {
+		t.Fatalf("failed to connect to the server process: %v", err)
+	}
+
+	if _, err := cli.ListTools(ctx, mcp.ListToolsParams{}); err != nil {
+		t.Errorf("failed to list tools: %v", err)
+	}
+
+	start := time.Now()
+	if err := cli.Disconnect(ctx); err != nil {
+		t.Errorf("failed to disconnect: %v", err)
+	}
+	// The server exits once its stdin is closed, without waiting for the signals.
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("expected the server to exit after stdin is closed, took %s", elapsed)
+	}
+
+	if !strings.Contains(logs.String(), "line=serving") {
+		t.Errorf("expected the stderr of the server in the logs, got %s", logs.String())
+	}
+}
+
+func TestCommandTransportExitStatus(t *testing.T) {
+	logs := &lockedBuffer{}
+	transport := newHelperTransport("exit", logs, time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	sess, err := transport.StartSession(ctx)
+	if err != nil {
+		t.Fatalf("failed to start session: %v", err)
+	}
+	defer sess.Stop()
+
+	// The messages end once the server process exits.
+	for range sess.Messages() {
+	}
+
+	errSess, ok := sess.(mcp.ErrorSession)
+	if !ok {
+		t.Fatal("expected the session to implement ErrorSession")
+	}
+	var exitErr *exec.ExitError
+	if err := errSess.Err(); !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+		t.Errorf("expected exit status 3, got %v", err)
+	}
+	if err := sess.Send(ctx, mcp.JSONRPCMessage{JSONRPC: mcp.JSONRPCVersion, Method: "ping"}); err == nil {
+		t.Error("expected error sending to the exited server process")
+	}
+
+	if !strings.Contains(logs.String(), `line="fatal: no config"`) {
+		t.Errorf("expected the stderr of the server in the logs, got %s", logs.String())
+	}
+}
+
+func TestCommandTransportKill(t *testing.T) {
+	logs := &lockedBuffer{}
+	transport := newHelperTransport("stubborn", logs, 100*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	sess, err := transport.StartSession(ctx)
+	if err != nil {
+		t.Fatalf("failed to start session: %v", err)
+	}
+	go func() {
+		for range sess.Messages() {
+		}
+	}()
+
+	// Wait for the server to ignore SIGTERM before stopping it.
+	for !strings.Contains(logs.String(), "ignoring signals") && ctx.Err() == nil {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		sess.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		t.Fatal("expected the server process to be killed")
+	}
+
+	if !strings.Contains(logs.String(), "sending SIGKILL") {
+		t.Errorf("expected the server process to be killed, got %s", logs.String())
+	}
+	if err := sess.(mcp.ErrorSession).Err(); err != nil {
+		t.Errorf("expected no error for the stopped session, got %v", err)
+	}
+}
+
+func TestCommandTransportStopUnread(t *testing.T) {
+	logs := &lockedBuffer{}
+	transport := newHelperTransport("flood", logs, 100*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	sess, err := transport.StartSession(ctx)
+	if err != nil {
+		t.Fatalf("failed to start session: %v", err)
+	}
+
+	// Read a single message, and leave the rest of the output unread, so the server blocks on writing.
+	for range sess.Messages() {
+		break
+	}
+	for !strings.Contains(logs.String(), "flooding") && ctx.Err() == nil {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		sess.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		t.Fatal("expected the session to stop while its output is not read")
+	}
+}
+
+// newHelperTransport creates the CommandTransport that starts this test binary as the helper server.
+func newHelperTransport(mode string, logs io.Writer, gracePeriod time.Duration) mcp.CommandTransport {
+	return mcp.NewCommandTransport(os.Args[0], []string{"-test.run=^TestCommandHelperProcess$"},
+		// The race detector sleeps for a second before the process exits, unless it's disabled.
+		mcp.WithCommandEnv(append(os.Environ(), commandHelperEnv+"="+mode, "GORACE=atexit_sleep_ms=0")),
+		mcp.WithCommandGracePeriod(gracePeriod),
+		mcp.WithCommandLogger(slog.New(slog.NewTextHandler(logs, nil))))
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.String()
+}
+
+func (r *eofReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err != nil {
+		r.once.Do(func() { close(r.eof) })
+	}
+	return n, err
+}
@@ -0,0 +1,194 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// InMemoryServerTransport implements a server transport that accepts the sessions started by its
+// paired InMemoryClientTransport, within the same process. It's created with NewInMemoryTransports,
+// and yields a session for every StartSession of the client transport, so a single server can serve
+// many concurrent clients.
+type InMemoryServerTransport struct {
+	transports *inMemoryTransports
+}
+
+// InMemoryClientTransport implements a client transport that starts the sessions with its paired
+// InMemoryServerTransport, within the same process. It's created with NewInMemoryTransports, and
+// can be shared by several clients, each of them starting its own session.
+type InMemoryClientTransport struct {
+	transports *inMemoryTransports
+}
+
+// InMemoryTransportsOption represents the options for the in-memory transports.
+type InMemoryTransportsOption func(*inMemoryTransports)
+
+type inMemoryTransports struct {
+	sessions  chan inMemorySession
+	serialize bool
+
+	done      chan struct{}
+	closeOnce *sync.Once
+}
+
+// inMemorySession is one end of the session, the server and the client ends share the same ID and
+// connection, and each of them receives what the other sends.
+type inMemorySession struct {
+	id        string
+	incoming  <-chan JSONRPCMessage
+	outgoing  chan<- JSONRPCMessage
+	serialize bool
+	conn      *inMemoryConn
+}
+
+// inMemoryConn holds the state shared by both ends of the session.
+type inMemoryConn struct {
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewInMemoryTransports creates a connected pair of server and client transports, which pass the
+// messages to each other through channels instead of a network connection or pipes, for embedding a
+// server in the same process as its clients, and for tests.
+//
+// The messages are passed without JSON serialization by default, so the sender and the receiver
+// share the same message, including its raw params and result. WithInMemorySerialization makes the
+// transports round-trip every message through JSON, as the other transports do, to catch the
+// marshaling bugs.
+func NewInMemoryTransports(options ...InMemoryTransportsOption) (InMemoryServerTransport, InMemoryClientTransport) {
+	t := &inMemoryTransports{
+		sessions:  make(chan inMemorySession),
+		done:      make(chan struct{}),
+		closeOnce: &sync.Once{},
+	}
+
+	for _, opt := range options {
+		opt(t)
+	}
+
+	return InMemoryServerTransport{transports: t}, InMemoryClientTransport{transports: t}
+}
+
+// WithInMemorySerialization makes the in-memory transports marshal every sent message to JSON, and
+// unmarshal it back before it's received, so the messages that can't be marshaled, or don't survive
+// the round-trip, fail or behave the same as with the other transports.
+func WithInMemorySerialization() InMemoryTransportsOption {
+	return func(t *inMemoryTransports) {
+		t.serialize = true
+	}
+}
+
+// Sessions implements the ServerTransport interface by yielding the server end of every session
+// started by the paired client transport, until the transport is shut down.
+func (s InMemoryServerTransport) Sessions() iter.Seq[Session] {
+	return func(yield func(Session) bool) {
+		for {
+			select {
+			case <-s.transports.done:
+				return
+			case sess := <-s.transports.sessions:
+				if !yield(sess) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Shutdown implements the ServerTransport interface by stopping to accept new sessions. The
+// established sessions are left to be stopped by the caller.
+func (s InMemoryServerTransport) Shutdown(context.Context) error {
+	s.transports.closeOnce.Do(func() {
+		close(s.transports.done)
+	})
+	return nil
+}
+
+// StartSession implements the ClientTransport interface by starting a new session with the paired
+// server transport, and returning the client end of the session. It fails if the server transport is
+// shut down, or isn't serving the sessions before the context is done.
+func (c InMemoryClientTransport) StartSession(ctx context.Context) (Session, error) {
+	clientToServer := make(chan JSONRPCMessage)
+	serverToClient := make(chan JSONRPCMessage)
+	conn := &inMemoryConn{done: make(chan struct{})}
+	id := uuid.New().String()
+
+	serverSess := inMemorySession{
+		id:        id,
+		incoming:  clientToServer,
+		outgoing:  serverToClient,
+		serialize: c.transports.serialize,
+		conn:      conn,
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, fmt.Errorf("failed to start session: %w", ctx.Err())
+	case <-c.transports.done:
+		return nil, errors.New("failed to start session: server transport is shut down")
+	case c.transports.sessions <- serverSess:
+	}
+
+	return inMemorySession{
+		id:        id,
+		incoming:  serverToClient,
+		outgoing:  clientToServer,
+		serialize: c.transports.serialize,
+		conn:      conn,
+	}, nil
+}
+
+func (s inMemorySession) ID() string {
+	return s.id
+}
+
+func (s inMemorySession) Send(ctx context.Context, msg JSONRPCMessage) error {
+	if s.serialize {
+		msgBs, err := json.Marshal(msg)
+		if err != nil {
+			return fmt.Errorf("failed to marshal message: %w", err)
+		}
+		msg = JSONRPCMessage{}
+		if err := json.Unmarshal(msgBs, &msg); err != nil {
+			return fmt.Errorf("failed to unmarshal message: %w", err)
+		}
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-s.conn.done:
+		return errors.New("session is closed")
+	case s.outgoing <- msg:
+	}
+	return nil
+}
+
+func (s inMemorySession) Messages() iter.Seq[JSONRPCMessage] {
+	return func(yield func(JSONRPCMessage) bool) {
+		for {
+			select {
+			case <-s.conn.done:
+				return
+			case msg := <-s.incoming:
+				if !yield(msg) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Stop implements the Session interface by closing the session, which also ends the messages of the
+// other end.
+func (s inMemorySession) Stop() {
+	s.conn.closeOnce.Do(func() {
+		close(s.conn.done)
+	})
+}
@@ -0,0 +1,137 @@
+package mcp_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MegaGrindStone/go-mcp"
+)
+
+func TestInMemoryConcurrentSessions(t *testing.T) {
+	registry := mcp.NewRegistry()
+	defer registry.Close()
+	registry.AddTool(mcp.Tool{Name: "echo"}, nil)
+
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	srv := mcp.NewServer(mcp.Info{Name: "test-server", Version: "1.0"}, serverTransport,
+		mcp.WithToolServer(registry),
+		mcp.WithServerLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	go srv.Serve()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	const clientsCount = 5
+	var wg sync.WaitGroup
+	errs := make(chan error, clientsCount)
+	for i := range clientsCount {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			cli := mcp.NewClient(mcp.Info{Name: fmt.Sprintf("test-client-%d", i), Version: "1.0"}, clientTransport,
+				mcp.WithClientLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+			if err := cli.Connect(ctx); err != nil {
+				errs <- fmt.Errorf("client %d failed to connect: %w", i, err)
+				return
+			}
+			defer cli.Disconnect(ctx)
+
+			tools, err := cli.ListTools(ctx, mcp.ListToolsParams{})
+			if err != nil {
+				errs <- fmt.Errorf("client %d failed to list tools: %w", i, err)
+				return
+			}
+			if len(tools.Tools) != 1 {
+				errs <- fmt.Errorf("client %d expected 1 tool, got %d", i, len(tools.Tools))
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("failed to shutdown server: %v", err)
+	}
+	if _, err := clientTransport.StartSession(ctx); err == nil {
+		t.Error("expected error starting session after the server transport is shut down")
+	}
+}
+
+func TestInMemorySerialization(t *testing.T) {
+	tests := []struct {
+		name        string
+		options     []mcp.InMemoryTransportsOption
+		wantSendErr bool
+	}{
+		{name: "shared", wantSendErr: false},
+		{name: "serialized", options: []mcp.InMemoryTransportsOption{mcp.WithInMemorySerialization()}, wantSendErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serverTransport, clientTransport := mcp.NewInMemoryTransports(tt.options...)
+			defer serverTransport.Shutdown(context.Background())
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			sessions := make(chan mcp.Session, 1)
+			go func() {
+				for sess := range serverTransport.Sessions() {
+					sessions <- sess
+				}
+			}()
+
+			cliSession, err := clientTransport.StartSession(ctx)
+			if err != nil {
+				t.Fatalf("failed to start session: %v", err)
+			}
+			srvSession := <-sessions
+			if srvSession.ID() != cliSession.ID() {
+				t.Errorf("expected the same session ID, got %s and %s", srvSession.ID(), cliSession.ID())
+			}
+
+			received := make(chan mcp.JSONRPCMessage, 1)
+			go func() {
+				for msg := range srvSession.Messages() {
+					received <- msg
+				}
+				close(received)
+			}()
+
+			// The invalid params can't be marshaled, so they only reach the server without serialization.
+			msg := mcp.JSONRPCMessage{JSONRPC: mcp.JSONRPCVersion, Method: "invalid", Params: json.RawMessage(`{`)}
+			err = cliSession.Send(ctx, msg)
+			if tt.wantSendErr {
+				if err == nil {
+					t.Error("expected error sending the message that can't be marshaled")
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("failed to send message: %v", err)
+				}
+				if got := <-received; got.Method != msg.Method || string(got.Params) != string(msg.Params) {
+					t.Errorf("expected message %+v, got %+v", msg, got)
+				}
+			}
+
+			// Stopping one end of the session ends the messages of the other end.
+			cliSession.Stop()
+			for range received {
+			}
+			if err := srvSession.Send(ctx, msg); err == nil {
+				t.Error("expected error sending to the stopped session")
+			}
+		})
+	}
+}
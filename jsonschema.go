@@ -0,0 +1,547 @@
+package mcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// jsonSchema is the subset of JSON Schema draft 2020-12 that is used to validate the values exchanged
+// through the protocol, such as the tool arguments and the structured content of the tool results.
+// The keywords that aren't supported are ignored, and the references are only resolved within the
+// same schema, to the root or to the $defs and definitions.
+type jsonSchema struct {
+	// boolean is set when the schema is a boolean schema, true accepts any value and false rejects
+	// every value.
+	boolean *bool
+	// pattern and patternProperties hold the compiled expressions of the keywords with the same name,
+	// so they're compiled once when the schema is decoded.
+	pattern           *regexp.Regexp
+	patternProperties []jsonSchemaPattern
+
+	Ref         string                 `json:"$ref,omitempty"`
+	Defs        map[string]*jsonSchema `json:"$defs,omitempty"`
+	Definitions map[string]*jsonSchema `json:"definitions,omitempty"`
+
+	Type        jsonSchemaTypes   `json:"type,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Enum        []json.RawMessage `json:"enum,omitempty"`
+	Const       json.RawMessage   `json:"const,omitempty"`
+
+	AllOf []*jsonSchema `json:"allOf,omitempty"`
+	AnyOf []*jsonSchema `json:"anyOf,omitempty"`
+	OneOf []*jsonSchema `json:"oneOf,omitempty"`
+	Not   *jsonSchema   `json:"not,omitempty"`
+
+	Minimum          json.Number `json:"minimum,omitempty"`
+	Maximum          json.Number `json:"maximum,omitempty"`
+	ExclusiveMinimum json.Number `json:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum json.Number `json:"exclusiveMaximum,omitempty"`
+	MultipleOf       json.Number `json:"multipleOf,omitempty"`
+
+	MinLength *int   `json:"minLength,omitempty"`
+	MaxLength *int   `json:"maxLength,omitempty"`
+	Pattern   string `json:"pattern,omitempty"`
+
+	Items       *jsonSchema   `json:"items,omitempty"`
+	PrefixItems []*jsonSchema `json:"prefixItems,omitempty"`
+	MinItems    *int          `json:"minItems,omitempty"`
+	MaxItems    *int          `json:"maxItems,omitempty"`
+	UniqueItems bool          `json:"uniqueItems,omitempty"`
+
+	Properties           map[string]*jsonSchema `json:"properties,omitempty"`
+	PatternProperties    map[string]*jsonSchema `json:"patternProperties,omitempty"`
+	AdditionalProperties *jsonSchema            `json:"additionalProperties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	MinProperties        *int                   `json:"minProperties,omitempty"`
+	MaxProperties        *int                   `json:"maxProperties,omitempty"`
+}
+
+type jsonSchemaPattern struct {
+	expr   *regexp.Regexp
+	schema *jsonSchema
+}
+
+// jsonSchemaValidator validates the values against the schemas nested in the root schema, which the
+// references are resolved against.
+type jsonSchemaValidator struct {
+	root *jsonSchema
+}
+
+// maxJSONSchemaDepth bounds the nesting of the validation, so the schemas that reference themselves
+// without consuming the value don't recurse forever.
+const maxJSONSchemaDepth = 128
+
+// jsonSchemaTypes holds the value of the type keyword, which is either a single type, or an array
+// of types.
+type jsonSchemaTypes []string
+
+type jsonSchemaAlias jsonSchema
+
+// UnmarshalJSON implements json.Unmarshaler to decode either a boolean schema or a schema object.
+func (s *jsonSchema) UnmarshalJSON(data []byte) error {
+	var b bool
+	if err := json.Unmarshal(data, &b); err == nil {
+		s.boolean = &b
+		return nil
+	}
+
+	var alias jsonSchemaAlias
+	if err := json.Unmarshal(data, &alias); err != nil {
+		return err
+	}
+	*s = jsonSchema(alias)
+
+	if s.Pattern != "" {
+		expr, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern: %w", err)
+		}
+		s.pattern = expr
+	}
+	for pattern, schema := range s.PatternProperties {
+		expr, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern property: %w", err)
+		}
+		s.patternProperties = append(s.patternProperties, jsonSchemaPattern{expr: expr, schema: schema})
+	}
+	// Sort the patterns, so the reported errors are deterministic.
+	slices.SortFunc(s.patternProperties, func(a, b jsonSchemaPattern) int {
+		return strings.Compare(a.expr.String(), b.expr.String())
+	})
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler to encode either a boolean schema or a schema object.
+func (s *jsonSchema) MarshalJSON() ([]byte, error) {
+	if s.boolean != nil {
+		return json.Marshal(*s.boolean)
+	}
+	return json.Marshal((*jsonSchemaAlias)(s))
+}
+
+// MarshalJSON implements json.Marshaler to encode a single type as a string, and multiple types as an
+// array.
+func (t jsonSchemaTypes) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+// UnmarshalJSON implements json.Unmarshaler to decode either a single type or an array of types.
+func (t *jsonSchemaTypes) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = jsonSchemaTypes{single}
+		return nil
+	}
+
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return fmt.Errorf("type must be a string or an array of strings: %w", err)
+	}
+	*t = multiple
+	return nil
+}
+
+// validateJSONSchema validates the JSON value against the JSON schema. The returned error reports
+// the JSON pointer of the first invalid location in the value.
+func validateJSONSchema(schema, value json.RawMessage) error {
+	var s jsonSchema
+	if err := json.Unmarshal(schema, &s); err != nil {
+		return fmt.Errorf("invalid schema: %w", err)
+	}
+
+	return s.validateJSON(value)
+}
+
+// validateJSON validates the JSON value against the schema. The returned error reports every invalid
+// location in the value, with its JSON pointer.
+func (s *jsonSchema) validateJSON(value json.RawMessage) error {
+	v, err := decodeJSONValue(value)
+	if err != nil {
+		return fmt.Errorf("invalid value: %w", err)
+	}
+
+	validator := jsonSchemaValidator{root: s}
+	return errors.Join(validator.validate(s, "", v, 0)...)
+}
+
+func (v jsonSchemaValidator) validate(s *jsonSchema, pointer string, value any, depth int) []error {
+	if depth > maxJSONSchemaDepth {
+		return []error{jsonSchemaError(pointer, "schema is nested too deeply")}
+	}
+	if s.boolean != nil {
+		if !*s.boolean {
+			return []error{jsonSchemaError(pointer, "value is not allowed")}
+		}
+		return nil
+	}
+
+	if s.Ref != "" {
+		ref, err := v.resolve(s.Ref)
+		if err != nil {
+			return []error{jsonSchemaError(pointer, err.Error())}
+		}
+		if errs := v.validate(ref, pointer, value, depth+1); len(errs) > 0 {
+			return errs
+		}
+	}
+
+	if len(s.Type) > 0 {
+		typ := jsonValueType(value)
+		// Every integer is a number as well.
+		if !slices.Contains(s.Type, typ) && !(typ == "integer" && slices.Contains(s.Type, "number")) {
+			return []error{jsonSchemaError(pointer, fmt.Sprintf("expected %s, got %s", strings.Join(s.Type, " or "), typ))}
+		}
+	}
+
+	var errs []error
+	if len(s.Enum) > 0 {
+		errs = append(errs, s.validateEnum(pointer, value)...)
+	}
+	if s.Const != nil {
+		errs = append(errs, s.validateConst(pointer, value)...)
+	}
+	errs = append(errs, v.validateCombinators(s, pointer, value, depth)...)
+
+	switch val := value.(type) {
+	case json.Number:
+		errs = append(errs, s.validateNumber(pointer, val)...)
+	case string:
+		errs = append(errs, s.validateString(pointer, val)...)
+	case []any:
+		errs = append(errs, v.validateArray(s, pointer, val, depth)...)
+	case map[string]any:
+		errs = append(errs, v.validateObject(s, pointer, val, depth)...)
+	}
+
+	return errs
+}
+
+// resolve returns the schema referenced by ref, which must point to the root schema or to one of its
+// $defs or definitions.
+func (v jsonSchemaValidator) resolve(ref string) (*jsonSchema, error) {
+	if ref == "#" {
+		return v.root, nil
+	}
+
+	var defs map[string]*jsonSchema
+	var name string
+	switch {
+	case strings.HasPrefix(ref, "#/$defs/"):
+		defs, name = v.root.Defs, strings.TrimPrefix(ref, "#/$defs/")
+	case strings.HasPrefix(ref, "#/definitions/"):
+		defs, name = v.root.Definitions, strings.TrimPrefix(ref, "#/definitions/")
+	default:
+		return nil, fmt.Errorf("unsupported reference %q", ref)
+	}
+
+	name = strings.ReplaceAll(strings.ReplaceAll(name, "~1", "/"), "~0", "~")
+	schema, ok := defs[name]
+	if !ok {
+		return nil, fmt.Errorf("unresolved reference %q", ref)
+	}
+	return schema, nil
+}
+
+func (v jsonSchemaValidator) validateCombinators(s *jsonSchema, pointer string, value any, depth int) []error {
+	var errs []error
+
+	for _, sub := range s.AllOf {
+		errs = append(errs, v.validate(sub, pointer, value, depth+1)...)
+	}
+
+	if len(s.AnyOf) > 0 {
+		matched := slices.ContainsFunc(s.AnyOf, func(sub *jsonSchema) bool {
+			return len(v.validate(sub, pointer, value, depth+1)) == 0
+		})
+		if !matched {
+			errs = append(errs, jsonSchemaError(pointer, "value doesn't match any of the anyOf schemas"))
+		}
+	}
+
+	if len(s.OneOf) > 0 {
+		matches := 0
+		for _, sub := range s.OneOf {
+			if len(v.validate(sub, pointer, value, depth+1)) == 0 {
+				matches++
+			}
+		}
+		if matches != 1 {
+			errs = append(errs, jsonSchemaError(pointer,
+				fmt.Sprintf("value must match exactly one of the oneOf schemas, matched %d", matches)))
+		}
+	}
+
+	if s.Not != nil && len(v.validate(s.Not, pointer, value, depth+1)) == 0 {
+		errs = append(errs, jsonSchemaError(pointer, "value must not match the not schema"))
+	}
+
+	return errs
+}
+
+func (s *jsonSchema) validateEnum(pointer string, value any) []error {
+	for _, raw := range s.Enum {
+		allowed, err := decodeJSONValue(raw)
+		if err != nil {
+			return []error{fmt.Errorf("invalid enum value in schema: %w", err)}
+		}
+		if jsonValuesEqual(allowed, value) {
+			return nil
+		}
+	}
+	return []error{jsonSchemaError(pointer, "value is not one of the enum values")}
+}
+
+func (s *jsonSchema) validateConst(pointer string, value any) []error {
+	allowed, err := decodeJSONValue(s.Const)
+	if err != nil {
+		return []error{fmt.Errorf("invalid const value in schema: %w", err)}
+	}
+	if !jsonValuesEqual(allowed, value) {
+		return []error{jsonSchemaError(pointer, fmt.Sprintf("value must be %s", s.Const))}
+	}
+	return nil
+}
+
+func (s *jsonSchema) validateNumber(pointer string, value json.Number) []error {
+	n, ok := new(big.Rat).SetString(value.String())
+	if !ok {
+		return []error{jsonSchemaError(pointer, fmt.Sprintf("invalid number %s", value))}
+	}
+
+	var errs []error
+	checks := []struct {
+		limit   json.Number
+		valid   func(cmp int) bool
+		message string
+	}{
+		{s.Minimum, func(cmp int) bool { return cmp >= 0 }, "must be greater than or equal to"},
+		{s.Maximum, func(cmp int) bool { return cmp <= 0 }, "must be less than or equal to"},
+		{s.ExclusiveMinimum, func(cmp int) bool { return cmp > 0 }, "must be greater than"},
+		{s.ExclusiveMaximum, func(cmp int) bool { return cmp < 0 }, "must be less than"},
+	}
+	for _, check := range checks {
+		if check.limit == "" {
+			continue
+		}
+		limit, ok := new(big.Rat).SetString(check.limit.String())
+		if !ok {
+			errs = append(errs, fmt.Errorf("invalid number %s in schema", check.limit))
+			continue
+		}
+		if !check.valid(n.Cmp(limit)) {
+			errs = append(errs, jsonSchemaError(pointer, fmt.Sprintf("%s %s %s", value, check.message, check.limit)))
+		}
+	}
+
+	if s.MultipleOf != "" {
+		divisor, ok := new(big.Rat).SetString(s.MultipleOf.String())
+		if !ok || divisor.Sign() <= 0 {
+			errs = append(errs, fmt.Errorf("invalid multipleOf %s in schema", s.MultipleOf))
+		} else if !new(big.Rat).Quo(n, divisor).IsInt() {
+			errs = append(errs, jsonSchemaError(pointer, fmt.Sprintf("%s is not a multiple of %s", value, s.MultipleOf)))
+		}
+	}
+
+	return errs
+}
+
+func (s *jsonSchema) validateString(pointer string, value string) []error {
+	var errs []error
+
+	length := utf8.RuneCountInString(value)
+	if s.MinLength != nil && length < *s.MinLength {
+		errs = append(errs, jsonSchemaError(pointer, fmt.Sprintf("length must be at least %d, got %d", *s.MinLength, length)))
+	}
+	if s.MaxLength != nil && length > *s.MaxLength {
+		errs = append(errs, jsonSchemaError(pointer, fmt.Sprintf("length must be at most %d, got %d", *s.MaxLength, length)))
+	}
+	if s.pattern != nil && !s.pattern.MatchString(value) {
+		errs = append(errs, jsonSchemaError(pointer, fmt.Sprintf("value doesn't match the pattern %q", s.Pattern)))
+	}
+
+	return errs
+}
+
+func (v jsonSchemaValidator) validateArray(s *jsonSchema, pointer string, arr []any, depth int) []error {
+	var errs []error
+
+	if s.MinItems != nil && len(arr) < *s.MinItems {
+		errs = append(errs, jsonSchemaError(pointer,
+			fmt.Sprintf("must have at least %d items, got %d", *s.MinItems, len(arr))))
+	}
+	if s.MaxItems != nil && len(arr) > *s.MaxItems {
+		errs = append(errs, jsonSchemaError(pointer,
+			fmt.Sprintf("must have at most %d items, got %d", *s.MaxItems, len(arr))))
+	}
+	if s.UniqueItems {
+		for i := 1; i < len(arr); i++ {
+			for j := range i {
+				if jsonValuesEqual(arr[i], arr[j]) {
+					errs = append(errs, jsonSchemaError(pointer+"/"+strconv.Itoa(i),
+						fmt.Sprintf("item is a duplicate of item %d", j)))
+					break
+				}
+			}
+		}
+	}
+
+	for i, item := range arr {
+		itemPointer := pointer + "/" + strconv.Itoa(i)
+		switch {
+		case i < len(s.PrefixItems):
+			errs = append(errs, v.validate(s.PrefixItems[i], itemPointer, item, depth+1)...)
+		case s.Items != nil:
+			errs = append(errs, v.validate(s.Items, itemPointer, item, depth+1)...)
+		}
+	}
+
+	return errs
+}
+
+func (v jsonSchemaValidator) validateObject(s *jsonSchema, pointer string, obj map[string]any, depth int) []error {
+	var errs []error
+
+	for _, name := range s.Required {
+		if _, ok := obj[name]; !ok {
+			errs = append(errs, jsonSchemaError(pointer, fmt.Sprintf("missing required property %q", name)))
+		}
+	}
+	if s.MinProperties != nil && len(obj) < *s.MinProperties {
+		errs = append(errs, jsonSchemaError(pointer,
+			fmt.Sprintf("must have at least %d properties, got %d", *s.MinProperties, len(obj))))
+	}
+	if s.MaxProperties != nil && len(obj) > *s.MaxProperties {
+		errs = append(errs, jsonSchemaError(pointer,
+			fmt.Sprintf("must have at most %d properties, got %d", *s.MaxProperties, len(obj))))
+	}
+
+	// Iterate the properties in a stable order, so the reported errors are deterministic.
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		propPointer := pointer + "/" + escapeJSONPointer(name)
+		matched := false
+		if prop, ok := s.Properties[name]; ok {
+			matched = true
+			errs = append(errs, v.validate(prop, propPointer, obj[name], depth+1)...)
+		}
+		for _, pattern := range s.patternProperties {
+			if pattern.expr.MatchString(name) {
+				matched = true
+				errs = append(errs, v.validate(pattern.schema, propPointer, obj[name], depth+1)...)
+			}
+		}
+		if matched || s.AdditionalProperties == nil {
+			continue
+		}
+		if s.AdditionalProperties.boolean != nil && !*s.AdditionalProperties.boolean {
+			errs = append(errs, jsonSchemaError(propPointer, "additional property is not allowed"))
+			continue
+		}
+		errs = append(errs, v.validate(s.AdditionalProperties, propPointer, obj[name], depth+1)...)
+	}
+
+	return errs
+}
+
+func jsonSchemaError(pointer, message string) error {
+	if pointer == "" {
+		pointer = "/"
+	}
+	return fmt.Errorf("%s: %s", pointer, message)
+}
+
+func escapeJSONPointer(token string) string {
+	token = strings.ReplaceAll(token, "~", "~0")
+	return strings.ReplaceAll(token, "/", "~1")
+}
+
+func decodeJSONValue(data json.RawMessage) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("unexpected data after the JSON value")
+	}
+	return v, nil
+}
+
+func jsonValueType(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if n, ok := new(big.Rat).SetString(v.String()); ok && n.IsInt() {
+			return "integer"
+		}
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func jsonValuesEqual(a, b any) bool {
+	an, aOk := a.(json.Number)
+	bn, bOk := b.(json.Number)
+	if aOk && bOk {
+		ar, arOk := new(big.Rat).SetString(an.String())
+		br, brOk := new(big.Rat).SetString(bn.String())
+		return arOk && brOk && ar.Cmp(br) == 0
+	}
+
+	switch av := a.(type) {
+	case []any:
+		bv, ok := b.([]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !jsonValuesEqual(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]any:
+		bv, ok := b.(map[string]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for k, v := range av {
+			other, ok := bv[k]
+			if !ok || !jsonValuesEqual(v, other) {
+				return false
+			}
+		}
+		return true
+	default:
+		return a == b
+	}
+}
@@ -2,6 +2,7 @@ package mcp
 
 import (
 	"context"
+	"encoding/json"
 	"iter"
 )
 
@@ -50,9 +51,42 @@ type Session interface {
 	Stop()
 }
 
+// PrincipalSession is implemented by the sessions of the transports that authenticate their clients,
+// such as SSEServer with WithSSEServerAuthenticator. The principal of the session is exposed to the
+// server implementations through PrincipalFromContext.
+type PrincipalSession interface {
+	Session
+
+	// Principal returns the authenticated principal bound to the session, or false if the session
+	// is not authenticated.
+	Principal() (Principal, bool)
+}
+
+// ErrorSession is implemented by the sessions of the transports that can tell why the session is
+// ended by the other party, such as CommandTransport, which reports the exit status of the server
+// process. The Client logs the error once the session is ended.
+type ErrorSession interface {
+	Session
+
+	// Err returns the error that ended the session, or nil if the session is still running, or is
+	// stopped with Stop.
+	Err() error
+}
+
+// Principal identifies the authenticated client of a session.
+type Principal struct {
+	// ID identifies the client, the transport only accepts the messages of the session from the
+	// client with the same ID.
+	ID string
+	// Attributes holds the additional information about the client, such as its roles or the
+	// claims of its token.
+	Attributes map[string]any
+}
+
 // Server interfaces
 
-// PromptServer defines the interface for managing prompts in the MCP protocol.
+// PromptServer defines the interface for managing prompts in the MCP protocol. The returned errors
+// are answered as internal errors, unless they're JSONRPCError, which are answered as they are.
 type PromptServer interface {
 	// ListPrompts returns a paginated list of available prompts. The ProgressReporter
 	// can be used to report operation progress, and RequestClientFunc enables
@@ -84,7 +118,9 @@ type PromptListUpdater interface {
 	PromptListUpdates() iter.Seq[struct{}]
 }
 
-// ResourceServer defines the interface for managing resources in the MCP protocol.
+// ResourceServer defines the interface for managing resources in the MCP protocol. The returned
+// errors are answered as internal errors, unless they're JSONRPCError, which are answered as they are,
+// such as the resource not found error (-32002).
 type ResourceServer interface {
 	// ListResources returns a paginated list of available resources. The ProgressReporter
 	// can be used to report operation progress, and RequestClientFunc enables
@@ -124,16 +160,23 @@ type ResourceListUpdater interface {
 }
 
 // ResourceSubscriptionHandler defines the interface for handling subscription for resources.
+//
+// The server keeps track of the subscriptions of each session, and only notifies the sessions
+// subscribed to the updated resource.
 type ResourceSubscriptionHandler interface {
-	// SubscribeResource subscribes to a resource.
+	// SubscribeResource subscribes to a resource. It's called when the first session subscribes to
+	// the resource.
 	SubscribeResource(SubscribeResourceParams)
-	// UnsubscribeResource unsubscribes from a resource.
+	// UnsubscribeResource unsubscribes from a resource. It's called when the last subscribed session
+	// unsubscribes from the resource, or disconnects.
 	UnsubscribeResource(UnsubscribeResourceParams)
 	// SubscribedResourceUpdates returns an iterator that emits notifications whenever a subscribed resource changes.
 	SubscribedResourceUpdates() iter.Seq[string]
 }
 
-// ToolServer defines the interface for managing tools in the MCP protocol.
+// ToolServer defines the interface for managing tools in the MCP protocol. The returned errors are
+// answered as internal errors, unless they're JSONRPCError, which are answered as they are, such as
+// the unknown tool error. The other errors returned by CallTool are reported in an error result.
 type ToolServer interface {
 	// ListTools returns a paginated list of available tools. The ProgressReporter
 	// can be used to report operation progress, and RequestClientFunc enables
@@ -163,8 +206,9 @@ type LogHandler interface {
 	// LogStreams returns an iterator that emits log messages with metadata.
 	LogStreams() iter.Seq[LogParams]
 
-	// SetLogLevel configures the minimum severity level for emitted log messages.
-	// Messages below this level are filtered out.
+	// SetLogLevel is called with the minimum severity level requested by a session. The server
+	// filters the emitted log messages with the level of each session, so the sessions that request
+	// different levels receive the messages they asked for.
 	SetLogLevel(level LogLevel)
 }
 
@@ -207,6 +251,15 @@ type SamplingHandler interface {
 	CreateSampleMessage(ctx context.Context, params SamplingParams) (SamplingResult, error)
 }
 
+// ElicitationHandler provides an interface for requesting structured input from the user on behalf of the server.
+// The implementation should present the message to the user, collect the input that matches the requested schema,
+// and report whether the user accepted, declined, or cancelled the request.
+type ElicitationHandler interface {
+	// Elicit asks the user for the input described by the params.
+	// Returns error if the user can't be asked, or context is cancelled.
+	Elicit(ctx context.Context, params ElicitationParams) (ElicitationResult, error)
+}
+
 // PromptListWatcher provides an interface for receiving notifications when the server's prompt list changes.
 // Implementations can use these notifications to update their internal state or trigger UI updates when
 // available prompts are added, removed, or modified.
@@ -242,6 +295,20 @@ type ToolListWatcher interface {
 	OnToolListChanged()
 }
 
+// ToolCallPolicy provides an interface for deciding whether the client may call a tool, before the
+// call is sent to the server. Implementations can refuse the calls by the tool's annotations, e.g. to
+// ask the user to confirm the calls of the destructive tools, see ConfirmDestructiveToolCalls.
+type ToolCallPolicy interface {
+	// CheckToolCall is called with the tool as listed by the server, and the parameters of the call.
+	// The tool that isn't listed by the server is passed with only its name, so its annotations take
+	// the default values. The returned error refuses the call, and it's returned by Client.CallTool,
+	// wrapped with ErrToolCallRefused.
+	CheckToolCall(ctx context.Context, tool Tool, params CallToolParams) error
+}
+
+// ToolCallPolicyFunc is an adapter to allow the use of ordinary functions as ToolCallPolicy.
+type ToolCallPolicyFunc func(ctx context.Context, tool Tool, params CallToolParams) error
+
 // ProgressListener provides an interface for receiving progress updates on long-running operations.
 // Implementations can use these notifications to update progress bars, status indicators, or other
 // UI elements that show operation progress to users.
@@ -319,6 +386,25 @@ type SamplingResult struct {
 	StopReason string          `json:"stopReason"`
 }
 
+// ElicitationParams defines the parameters for requesting input from the user. Contains the
+// message to present to the user, and the JSON schema of the requested input, which is
+// restricted to an object with flat properties of primitive types.
+type ElicitationParams struct {
+	Message         string          `json:"message"`
+	RequestedSchema json.RawMessage `json:"requestedSchema"`
+}
+
+// ElicitationResult represents the response of the user to an elicitation request. Content
+// holds the submitted input that matches the requested schema, and is only set when the
+// Action is ElicitationActionAccept.
+type ElicitationResult struct {
+	Action  ElicitationAction `json:"action"`
+	Content json.RawMessage   `json:"content,omitempty"`
+}
+
+// ElicitationAction represents the action taken by the user in response to an elicitation request.
+type ElicitationAction string
+
 // ProgressReporter is a function type used to report progress updates for long-running operations.
 // Server implementations use this callback to inform clients about operation progress by passing
 // a ProgressParams struct containing the progress details. When Total is non-zero in the params,
@@ -333,4 +419,6 @@ type ProgressReporter func(progress ProgressParams)
 // a client while processing a method call.
 //
 // It should respect the JSON-RPC 2.0 specification for error handling and message formatting.
+// The helpers like CreateMessage, ListRoots, and Elicit provide the typed alternatives, that also
+// respect the context and the client's capabilities.
 type RequestClientFunc func(msg JSONRPCMessage) (JSONRPCMessage, error)
@@ -1,12 +1,19 @@
 package mcp_test
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -36,6 +43,8 @@ type testSuiteConfig struct {
 	transportName string
 	serverOptions []mcp.ServerOption
 	clientOptions []mcp.ClientOption
+	// wrapClientTransport wraps the client transport before it's used by the client, if it's set.
+	wrapClientTransport func(mcp.ClientTransport) mcp.ClientTransport
 }
 
 //nolint:gocognit
@@ -163,7 +172,7 @@ func TestInitialize(t *testing.T) {
 		},
 	}
 
-	for _, transportName := range []string{"SSE", "StdIO"} {
+	for _, transportName := range []string{"SSE", "StreamableHTTP", "StdIO", "InMemory", "WebSocket", "Socket"} {
 		for _, tc := range testCases {
 			cfg := testSuiteConfig{
 				transportName: transportName,
@@ -227,6 +236,417 @@ func TestInitialize(t *testing.T) {
 	}
 }
 
+func TestProtocolVersionNegotiation(t *testing.T) {
+	testCases := []struct {
+		name           string
+		serverVersions []string
+		clientVersions []string
+		wantVersion    string
+		wantErr        bool
+	}{
+		{
+			name:        "latest version by default",
+			wantVersion: mcp.ProtocolVersion20250326,
+		},
+		{
+			name:           "fallback to server version",
+			serverVersions: []string{mcp.ProtocolVersion20241105},
+			wantVersion:    mcp.ProtocolVersion20241105,
+		},
+		{
+			name:           "requested version supported by server",
+			clientVersions: []string{mcp.ProtocolVersion20241105},
+			wantVersion:    mcp.ProtocolVersion20241105,
+		},
+		{
+			name:           "opted in version",
+			serverVersions: []string{mcp.ProtocolVersion20250618, mcp.ProtocolVersion20250326},
+			clientVersions: []string{mcp.ProtocolVersion20250618, mcp.ProtocolVersion20250326},
+			wantVersion:    mcp.ProtocolVersion20250618,
+		},
+		{
+			name:           "opted in version not supported by server",
+			clientVersions: []string{mcp.ProtocolVersion20250618, mcp.ProtocolVersion20250326},
+			wantVersion:    mcp.ProtocolVersion20250326,
+		},
+		{
+			name:           "no common version",
+			serverVersions: []string{mcp.ProtocolVersion20241105},
+			clientVersions: []string{mcp.ProtocolVersion20250326},
+			wantErr:        true,
+		},
+	}
+
+	for _, transportName := range []string{"SSE", "StreamableHTTP", "StdIO", "InMemory", "WebSocket", "Socket"} {
+		for _, tc := range testCases {
+			toolServer := &mockToolServer{}
+			cfg := testSuiteConfig{
+				transportName: transportName,
+				serverOptions: []mcp.ServerOption{
+					mcp.WithToolServer(toolServer),
+					mcp.WithPromptServer(&mockPromptServer{}),
+					mcp.WithServerProtocolVersions(tc.serverVersions...),
+				},
+				clientOptions: []mcp.ClientOption{
+					mcp.WithClientProtocolVersions(tc.clientVersions...),
+				},
+			}
+
+			t.Run(fmt.Sprintf("%s/%s", transportName, tc.name), testSuiteCase(cfg, func(t *testing.T, s *testSuite) {
+				if tc.wantErr {
+					if s.clientConnectErr == nil {
+						t.Errorf("expected error, got nil")
+					}
+					return
+				}
+				if s.clientConnectErr != nil {
+					t.Fatalf("unexpected error: %v", s.clientConnectErr)
+				}
+
+				if got := s.mcpClient.ProtocolVersion(); got != tc.wantVersion {
+					t.Errorf("expected protocol version %s, got %s", tc.wantVersion, got)
+				}
+
+				if _, err := s.mcpClient.ListTools(context.Background(), mcp.ListToolsParams{}); err != nil {
+					t.Fatalf("failed to list tools: %v", err)
+				}
+				if toolServer.protocolVersion != tc.wantVersion {
+					t.Errorf("expected server protocol version %s, got %s", tc.wantVersion, toolServer.protocolVersion)
+				}
+			}))
+		}
+	}
+}
+
+func TestSessionFromContext(t *testing.T) {
+	for _, transportName := range []string{"SSE", "StreamableHTTP", "StdIO", "InMemory", "WebSocket", "Socket"} {
+		toolServer := &mockToolServer{}
+		sessionIDs := make(chan string, 1)
+		cfg := testSuiteConfig{
+			transportName: transportName,
+			serverOptions: []mcp.ServerOption{
+				mcp.WithToolServer(toolServer),
+				mcp.WithServerOnClientConnected(func(id string, _ mcp.Info) {
+					sessionIDs <- id
+				}),
+			},
+			clientOptions: []mcp.ClientOption{
+				mcp.WithRootsListHandler(&mockRootsListHandler{}),
+			},
+		}
+
+		t.Run(transportName, testSuiteCase(cfg, func(t *testing.T, s *testSuite) {
+			if _, err := s.mcpClient.CallTool(context.Background(), mcp.CallToolParams{Name: "test-tool"}); err != nil {
+				t.Fatalf("failed to call tool: %v", err)
+			}
+
+			if !toolServer.hasSession {
+				t.Fatal("expected session in the tool context")
+			}
+			if id := <-sessionIDs; toolServer.session.ID != id {
+				t.Errorf("expected session ID %s, got %s", id, toolServer.session.ID)
+			}
+			if toolServer.session.ClientInfo.Name != "test-client" {
+				t.Errorf("expected client name test-client, got %s", toolServer.session.ClientInfo.Name)
+			}
+			if toolServer.session.ClientCapabilities.Roots == nil {
+				t.Error("expected client roots capability")
+			}
+			if toolServer.session.ServerCapabilities.Tools == nil {
+				t.Error("expected server tools capability")
+			}
+			if toolServer.session.ProtocolVersion != s.mcpClient.ProtocolVersion() {
+				t.Errorf("expected protocol version %s, got %s",
+					s.mcpClient.ProtocolVersion(), toolServer.session.ProtocolVersion)
+			}
+		}))
+	}
+
+	if _, ok := mcp.SessionFromContext(context.Background()); ok {
+		t.Error("expected no session in the background context")
+	}
+}
+
+func TestBatch(t *testing.T) {
+	for _, transportName := range []string{"SSE", "StreamableHTTP", "StdIO", "InMemory", "WebSocket", "Socket"} {
+		cfg := testSuiteConfig{
+			transportName: transportName,
+			serverOptions: []mcp.ServerOption{
+				mcp.WithToolServer(&mockToolServer{}),
+				mcp.WithPromptServer(&mockPromptServer{}),
+			},
+		}
+
+		t.Run(fmt.Sprintf("%s/Batch", transportName), testSuiteCase(cfg, func(t *testing.T, s *testSuite) {
+			if s.clientConnectErr != nil {
+				t.Fatalf("failed to connect to server: %v", s.clientConnectErr)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			results, err := s.mcpClient.Batch(ctx,
+				mcp.BatchRequest{Method: mcp.MethodToolsList, Params: mcp.ListToolsParams{}},
+				mcp.BatchRequest{Method: mcp.MethodResourcesList, Params: mcp.ListResourcesParams{}},
+				mcp.BatchRequest{Method: mcp.MethodPromptsList, Params: mcp.ListPromptsParams{}},
+			)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(results) != 3 {
+				t.Fatalf("expected 3 results, got %d", len(results))
+			}
+
+			var toolsResult mcp.ListToolsResult
+			if results[0].Error != nil {
+				t.Errorf("unexpected error for tools/list: %v", results[0].Error)
+			} else if err := json.Unmarshal(results[0].Result, &toolsResult); err != nil {
+				t.Errorf("failed to unmarshal tools/list result: %v", err)
+			}
+			// Resource server is not configured, so the server should respond with an error.
+			if results[1].Error == nil {
+				t.Errorf("expected error for resources/list, got nil")
+			}
+			var promptsResult mcp.ListPromptResult
+			if results[2].Error != nil {
+				t.Errorf("unexpected error for prompts/list: %v", results[2].Error)
+			} else if err := json.Unmarshal(results[2].Result, &promptsResult); err != nil {
+				t.Errorf("failed to unmarshal prompts/list result: %v", err)
+			}
+		}))
+
+		// The batching is not defined before 2025-03-26, and removed in 2025-06-18.
+		for _, version := range []string{mcp.ProtocolVersion20241105, mcp.ProtocolVersion20250618} {
+			cfg = testSuiteConfig{
+				transportName: transportName,
+				serverOptions: []mcp.ServerOption{
+					mcp.WithToolServer(&mockToolServer{}),
+					mcp.WithServerProtocolVersions(version),
+				},
+				clientOptions: []mcp.ClientOption{
+					mcp.WithClientProtocolVersions(version),
+				},
+			}
+
+			t.Run(fmt.Sprintf("%s/BatchUnsupportedVersion/%s", transportName, version), testSuiteCase(cfg,
+				func(t *testing.T, s *testSuite) {
+					if s.clientConnectErr != nil {
+						t.Fatalf("failed to connect to server: %v", s.clientConnectErr)
+					}
+
+					_, err := s.mcpClient.Batch(context.Background(),
+						mcp.BatchRequest{Method: mcp.MethodToolsList, Params: mcp.ListToolsParams{}},
+					)
+					if err == nil {
+						t.Errorf("expected error, got nil")
+					}
+				}))
+		}
+	}
+}
+
+func TestUnsupportedRequests(t *testing.T) {
+	for _, transportName := range []string{"SSE", "StreamableHTTP", "StdIO", "InMemory", "WebSocket", "Socket"} {
+		cfg := testSuiteConfig{
+			transportName: transportName,
+			serverOptions: []mcp.ServerOption{
+				mcp.WithPromptServer(&mockPromptServer{}),
+			},
+		}
+
+		t.Run(transportName, testSuiteCase(cfg, func(t *testing.T, s *testSuite) {
+			if s.clientConnectErr != nil {
+				t.Fatalf("failed to connect to server: %v", s.clientConnectErr)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			results, err := s.mcpClient.Batch(ctx,
+				mcp.BatchRequest{Method: "unknown/method"},
+				mcp.BatchRequest{Method: mcp.MethodToolsList, Params: mcp.ListToolsParams{}},
+				mcp.BatchRequest{Method: mcp.MethodLoggingSetLevel, Params: mcp.LogParams{}},
+				mcp.BatchRequest{Method: mcp.MethodCompletionComplete, Params: mcp.CompletesCompletionParams{
+					Ref: mcp.CompletionRef{Type: "ref/unknown"},
+				}},
+				mcp.BatchRequest{Method: mcp.MethodPromptsList, Params: mcp.ListPromptsParams{}},
+			)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(results) != 5 {
+				t.Fatalf("expected 5 results, got %d", len(results))
+			}
+
+			wantCodes := []int{-32601, -32601, -32601, -32602}
+			for i, code := range wantCodes {
+				if results[i].Error == nil || results[i].Error.Code != code {
+					t.Errorf("result %d: expected error code %d, got %+v", i, code, results[i])
+				}
+			}
+			if results[1].Error != nil && !strings.Contains(results[1].Error.Message, "tools capability") {
+				t.Errorf("expected the tools capability in the error, got %q", results[1].Error.Message)
+			}
+			if results[4].Error != nil {
+				t.Errorf("unexpected error for prompts/list: %v", results[4].Error)
+			}
+		}))
+	}
+}
+
+func TestUninitializedSession(t *testing.T) {
+	clientReader, serverWriter := io.Pipe()
+	serverReader, clientWriter := io.Pipe()
+
+	server := mcp.NewServer(mcp.Info{Name: "test-server", Version: "1.0"}, mcp.NewStdIO(serverReader, serverWriter),
+		mcp.WithToolServer(&mockToolServer{}))
+	go server.Serve()
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(ctx)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	session, err := mcp.NewStdIO(clientReader, clientWriter).StartSession(ctx)
+	if err != nil {
+		t.Fatalf("failed to start session: %v", err)
+	}
+	defer session.Stop()
+
+	// The request is answered, even though the session is not initialized yet.
+	if err := session.Send(ctx, mcp.JSONRPCMessage{
+		JSONRPC: mcp.JSONRPCVersion,
+		ID:      "1",
+		Method:  mcp.MethodToolsList,
+		Params:  json.RawMessage(`{}`),
+	}); err != nil {
+		t.Fatalf("failed to send request: %v", err)
+	}
+
+	for msg := range session.Messages() {
+		if msg.ID != "1" {
+			continue
+		}
+		if msg.Error == nil || msg.Error.Code != -32600 {
+			t.Errorf("expected invalid request error, got %+v", msg)
+		}
+		return
+	}
+	t.Error("session closed before the response")
+}
+
+func TestBatchInvalidElements(t *testing.T) {
+	clientReader, serverWriter := io.Pipe()
+	serverReader, clientWriter := io.Pipe()
+
+	server := mcp.NewServer(mcp.Info{Name: "test-server", Version: "1.0"}, mcp.NewStdIO(serverReader, serverWriter),
+		mcp.WithToolServer(&mockToolServer{}))
+	go server.Serve()
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(ctx)
+	}()
+	defer clientWriter.Close()
+
+	// The invalid elements, and the initialization, are answered with an invalid request error each,
+	// along with the other elements of the batch. The second batch reuses the ID of the first one, and
+	// is still answered with its own batch.
+	batches := `[{"jsonrpc":"2.0","id":"1","method":"ping"},1,{"jsonrpc":"2.0","id":"3","method":5},` +
+		`{"jsonrpc":"2.0","id":"4","method":"initialize","params":{}}]` + "\n" +
+		`[{"jsonrpc":"2.0","id":"1","method":"ping"}]` + "\n"
+	go func() {
+		_, _ = clientWriter.Write([]byte(batches))
+	}()
+
+	reader := bufio.NewReader(clientReader)
+	var lengths []int
+	for range 2 {
+		res := readJSONRPCLine(t, reader)
+		lengths = append(lengths, len(res.Batch))
+		if len(res.Batch) != 4 {
+			continue
+		}
+
+		errCodes := make(map[mcp.MustString]int)
+		for _, msg := range res.Batch {
+			if msg.Error != nil {
+				errCodes[msg.ID] = msg.Error.Code
+			}
+		}
+		want := map[mcp.MustString]int{"": -32600, "3": -32600, "4": -32600}
+		if !reflect.DeepEqual(errCodes, want) {
+			t.Errorf("expected error codes %v, got %v", want, errCodes)
+		}
+	}
+	slices.Sort(lengths)
+	if !slices.Equal(lengths, []int{1, 4}) {
+		t.Errorf("expected batches of 1 and 4 responses, got %v", lengths)
+	}
+}
+
+func TestClientUnknownRequests(t *testing.T) {
+	clientReader, serverWriter := io.Pipe()
+	serverReader, clientWriter := io.Pipe()
+	defer serverWriter.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client := mcp.NewClient(mcp.Info{Name: "test-client", Version: "1.0"}, mcp.NewStdIO(clientReader, clientWriter))
+	connectErrs := make(chan error, 1)
+	go func() {
+		connectErrs <- client.Connect(ctx)
+	}()
+	defer client.Disconnect(ctx)
+
+	reader := bufio.NewReader(serverReader)
+	req := readJSONRPCLine(t, reader)
+	if _, err := fmt.Fprintf(serverWriter, `{"jsonrpc":"2.0","id":%q,"result":{"protocolVersion":%q,`+
+		`"capabilities":{},"serverInfo":{"name":"test-server","version":"1.0"}}}`+"\n",
+		req.ID, mcp.ProtocolVersion20250326); err != nil {
+		t.Fatalf("failed to send initialize result: %v", err)
+	}
+	if msg := readJSONRPCLine(t, reader); msg.Method != "notifications/initialized" {
+		t.Fatalf("expected initialized notification, got %+v", msg)
+	}
+	if err := <-connectErrs; err != nil {
+		t.Fatalf("failed to connect to server: %v", err)
+	}
+
+	// The requests with unknown method are answered with a method not found error, while the
+	// notification with unknown method is ignored, so the batch is answered with a single response.
+	go func() {
+		_, _ = serverWriter.Write([]byte(`[{"jsonrpc":"2.0","id":"1","method":"unknown/method"},` +
+			`{"jsonrpc":"2.0","method":"notifications/unknown"}]` + "\n" +
+			`{"jsonrpc":"2.0","id":"2","method":"unknown/method"}` + "\n"))
+	}()
+
+	errCodes := make(map[mcp.MustString]int)
+	for range 2 {
+		msg := readJSONRPCLine(t, reader)
+		msgs := []mcp.JSONRPCMessage{msg}
+		if len(msg.Batch) > 0 {
+			if len(msg.Batch) != 1 {
+				t.Errorf("expected batch of 1 response, got %d", len(msg.Batch))
+			}
+			msgs = msg.Batch
+		}
+		for _, m := range msgs {
+			if m.Error != nil {
+				errCodes[m.ID] = m.Error.Code
+			}
+		}
+	}
+	want := map[mcp.MustString]int{"1": -32601, "2": -32601}
+	if !reflect.DeepEqual(errCodes, want) {
+		t.Errorf("expected error codes %v, got %v", want, errCodes)
+	}
+}
+
 func TestUninitializedClient(t *testing.T) {
 	// Create a client without connecting it
 	client := mcp.NewClient(mcp.Info{
@@ -327,7 +747,7 @@ func TestUninitializedClient(t *testing.T) {
 
 //nolint:gocognit
 func TestPrompt(t *testing.T) {
-	for _, transportName := range []string{"SSE", "StdIO"} {
+	for _, transportName := range []string{"SSE", "StreamableHTTP", "StdIO", "InMemory", "WebSocket", "Socket"} {
 		promptServer := mockPromptServer{}
 		progressListener := mockProgressListener{}
 
@@ -493,7 +913,7 @@ func TestPrompt(t *testing.T) {
 
 //nolint:gocognit,gocyclo // Would simplify it later
 func TestResource(t *testing.T) {
-	for _, transportName := range []string{"SSE", "StdIO"} {
+	for _, transportName := range []string{"SSE", "StreamableHTTP", "StdIO", "InMemory", "WebSocket", "Socket"} {
 		resourceServer := mockResourceServer{
 			delayList: true,
 		}
@@ -779,7 +1199,7 @@ func TestResource(t *testing.T) {
 }
 
 func TestTool(t *testing.T) {
-	for _, transportName := range []string{"SSE", "StdIO"} {
+	for _, transportName := range []string{"SSE", "StreamableHTTP", "StdIO", "InMemory", "WebSocket", "Socket"} {
 		toolServer := mockToolServer{
 			requestRootsList: true,
 		}
@@ -886,112 +1306,1001 @@ func TestTool(t *testing.T) {
 	}
 }
 
-func TestRoot(t *testing.T) {
-	for _, transportName := range []string{"SSE", "StdIO"} {
-		rootsListUpdater := mockRootsListUpdater{
-			ch:   make(chan struct{}),
-			done: make(chan struct{}),
-		}
-		rootsListWatcher := mockRootsListWatcher{}
+func TestToolStructuredContent(t *testing.T) {
+	type weather struct {
+		Temperature float64 `json:"temperature"`
+		Conditions  string  `json:"conditions"`
+	}
 
+	// The output schema and the structured content are defined since 2025-06-18.
+	serverVersions := mcp.WithServerProtocolVersions(mcp.ProtocolVersion20250618, mcp.ProtocolVersion20250326,
+		mcp.ProtocolVersion20241105)
+
+	for _, transportName := range []string{"SSE", "StreamableHTTP", "StdIO", "InMemory", "WebSocket", "Socket"} {
 		cfg := testSuiteConfig{
 			transportName: transportName,
 			serverOptions: []mcp.ServerOption{
-				mcp.WithRootsListWatcher(&rootsListWatcher),
+				mcp.WithToolServer(mockStructuredToolServer{
+					structuredContent: json.RawMessage(`{"temperature":22.5,"conditions":"sunny"}`),
+				}),
+				serverVersions,
 			},
 			clientOptions: []mcp.ClientOption{
-				mcp.WithRootsListUpdater(rootsListUpdater),
+				mcp.WithClientProtocolVersions(mcp.ProtocolVersion20250618),
 			},
 		}
 
-		t.Run(fmt.Sprintf("%s/UpdateRootList", transportName), testSuiteCase(cfg, func(t *testing.T, s *testSuite) {
+		t.Run(fmt.Sprintf("%s/ValidStructuredContent", transportName), testSuiteCase(cfg, func(t *testing.T, s *testSuite) {
 			if s.clientConnectErr != nil {
 				t.Fatalf("failed to connect to server: %v", s.clientConnectErr)
 			}
 
-			defer close(rootsListUpdater.done)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
 
-			for range 5 {
-				rootsListUpdater.ch <- struct{}{}
+			var w weather
+			result, err := s.mcpClient.CallToolStructured(ctx, mcp.CallToolParams{Name: "weather"}, &w)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
 			}
-
-			time.Sleep(100 * time.Millisecond)
-
-			rootsListWatcher.lock.Lock()
-			defer rootsListWatcher.lock.Unlock()
-			if rootsListWatcher.updateCount != 5 {
-				t.Errorf("expected 5 root list updates, got %d", rootsListWatcher.updateCount)
+			if w.Temperature != 22.5 || w.Conditions != "sunny" {
+				t.Errorf("unexpected structured content: %+v", w)
+			}
+			// The structured content should be serialized into the content for backwards compatibility.
+			if len(result.Content) != 1 || result.Content[0].Type != mcp.ContentTypeText {
+				t.Fatalf("expected 1 text content, got %+v", result.Content)
+			}
+			if result.Content[0].Text != string(result.StructuredContent) {
+				t.Errorf("expected content text %s, got %s", result.StructuredContent, result.Content[0].Text)
 			}
 		}))
-	}
-}
-
-func TestLog(t *testing.T) {
-	for _, transportName := range []string{"SSE", "StdIO"} {
-		handler := mockLogHandler{
-			params: make(chan mcp.LogParams),
-			done:   make(chan struct{}),
-		}
-		receiver := &mockLogReceiver{}
 
-		cfg := testSuiteConfig{
-			transportName: transportName,
-			serverOptions: []mcp.ServerOption{
-				mcp.WithLogHandler(&handler),
-			},
-			clientOptions: []mcp.ClientOption{
-				mcp.WithLogReceiver(receiver),
-			},
+		cfg.serverOptions = []mcp.ServerOption{
+			mcp.WithToolServer(mockStructuredToolServer{
+				structuredContent: json.RawMessage(`{"temperature":"hot","conditions":"sunny"}`),
+			}),
+			serverVersions,
 		}
 
-		t.Run(fmt.Sprintf("%s/TestLog", transportName), testSuiteCase(cfg, func(t *testing.T, s *testSuite) {
-			defer close(handler.done)
-
+		t.Run(fmt.Sprintf("%s/InvalidStructuredContent", transportName), testSuiteCase(cfg, func(t *testing.T, s *testSuite) {
 			if s.clientConnectErr != nil {
 				t.Fatalf("failed to connect to server: %v", s.clientConnectErr)
 			}
 
-			handler.level = mcp.LogLevelDebug
-			for range 10 {
-				handler.params <- mcp.LogParams{}
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			_, err := s.mcpClient.CallTool(ctx, mcp.CallToolParams{Name: "weather"})
+			if err == nil {
+				t.Fatalf("expected error, got nil")
+			}
+			if !strings.Contains(err.Error(), "/temperature") {
+				t.Errorf("expected error to point to /temperature, got %v", err)
 			}
+		}))
 
-			time.Sleep(100 * time.Millisecond)
+		cfg.serverOptions = []mcp.ServerOption{
+			mcp.WithToolServer(mockStructuredToolServer{}),
+			serverVersions,
+		}
 
-			receiver.lock.Lock()
-			defer receiver.lock.Unlock()
-			if receiver.updateCount != 10 {
-				t.Errorf("expected 10 log params, got %d", receiver.updateCount)
+		t.Run(fmt.Sprintf("%s/MissingStructuredContent", transportName), testSuiteCase(cfg, func(t *testing.T, s *testSuite) {
+			if s.clientConnectErr != nil {
+				t.Fatalf("failed to connect to server: %v", s.clientConnectErr)
 			}
 
 			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 			defer cancel()
 
-			err := s.mcpClient.SetLogLevel(ctx, mcp.LogLevelError)
-			if err != nil {
-				t.Errorf("unexpected error: %v", err)
+			var w weather
+			_, err := s.mcpClient.CallToolStructured(ctx, mcp.CallToolParams{Name: "weather"}, &w)
+			if err == nil {
+				t.Errorf("expected error, got nil")
 			}
+		}))
 
-			time.Sleep(100 * time.Millisecond)
+		var listCalls atomic.Int32
+		cfg.serverOptions = []mcp.ServerOption{
+			mcp.WithToolServer(mockStructuredToolServer{
+				structuredContent: json.RawMessage(`{"temperature":22.5,"conditions":"sunny"}`),
+				listCalls:         &listCalls,
+			}),
+			serverVersions,
+		}
 
-			handler.lock.Lock()
-			defer handler.lock.Unlock()
-			if handler.level != mcp.LogLevelError {
-				t.Errorf("expected log level %d, got %d", mcp.LogLevelError, handler.level)
+		t.Run(fmt.Sprintf("%s/CachedOutputSchema", transportName), testSuiteCase(cfg, func(t *testing.T, s *testSuite) {
+			if s.clientConnectErr != nil {
+				t.Fatalf("failed to connect to server: %v", s.clientConnectErr)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			// The output schema is listed once for the session, instead of on every call.
+			for range 3 {
+				if _, err := s.mcpClient.CallTool(ctx, mcp.CallToolParams{Name: "weather"}); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+			if got := listCalls.Load(); got != 1 {
+				t.Errorf("expected the tools to be listed once, got %d", got)
 			}
 		}))
-	}
-}
 
-func TestPing(t *testing.T) {
-	for _, transportName := range []string{"SSE", "StdIO"} {
-		// Variables to track the number of server and client connections.
-		serverClientsCount := int64(0)
-		clientPingFailedCount := int64(0)
+		listCalls.Store(0)
+		cfg.serverOptions = []mcp.ServerOption{
+			mcp.WithToolServer(mockStructuredToolServer{listCalls: &listCalls}),
+			serverVersions,
+		}
 
-		cfg := testSuiteConfig{
-			transportName: transportName,
-			serverOptions: []mcp.ServerOption{
+		t.Run(fmt.Sprintf("%s/NoStructuredContent", transportName), testSuiteCase(cfg, func(t *testing.T, s *testSuite) {
+			if s.clientConnectErr != nil {
+				t.Fatalf("failed to connect to server: %v", s.clientConnectErr)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			// The result without structured content doesn't need the output schema.
+			if _, err := s.mcpClient.CallTool(ctx, mcp.CallToolParams{Name: "weather"}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := listCalls.Load(); got != 0 {
+				t.Errorf("expected the tools not to be listed, got %d", got)
+			}
+		}))
+
+		cfg.serverOptions = []mcp.ServerOption{
+			mcp.WithToolServer(mockStructuredToolServer{
+				structuredContent: json.RawMessage(`{"temperature":22.5,"conditions":"sunny"}`),
+			}),
+			serverVersions,
+		}
+		// The output schema and the structured content are not defined in the earlier revisions.
+		for _, version := range []string{mcp.ProtocolVersion20241105, mcp.ProtocolVersion20250326} {
+			cfg.clientOptions = []mcp.ClientOption{
+				mcp.WithClientProtocolVersions(version),
+			}
+
+			t.Run(fmt.Sprintf("%s/UnsupportedVersion/%s", transportName, version), testSuiteCase(cfg,
+				func(t *testing.T, s *testSuite) {
+					if s.clientConnectErr != nil {
+						t.Fatalf("failed to connect to server: %v", s.clientConnectErr)
+					}
+
+					ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+					defer cancel()
+
+					tools, err := s.mcpClient.ListTools(ctx, mcp.ListToolsParams{})
+					if err != nil {
+						t.Fatalf("failed to list tools: %v", err)
+					}
+					if len(tools.Tools) != 1 || tools.Tools[0].OutputSchema != nil {
+						t.Errorf("expected 1 tool without output schema, got %+v", tools.Tools)
+					}
+
+					result, err := s.mcpClient.CallTool(ctx, mcp.CallToolParams{Name: "weather"})
+					if err != nil {
+						t.Fatalf("unexpected error: %v", err)
+					}
+					if result.StructuredContent != nil {
+						t.Errorf("expected no structured content, got %s", result.StructuredContent)
+					}
+					want := `{"temperature":22.5,"conditions":"sunny"}`
+					if len(result.Content) != 1 || result.Content[0].Text != want {
+						t.Errorf("expected the structured content in the text content, got %+v", result.Content)
+					}
+				}))
+		}
+	}
+}
+
+func TestToolArgumentsValidation(t *testing.T) {
+	const schema = `{
+		"type": "object",
+		"properties": {
+			"city": {"type": "string", "minLength": 2, "pattern": "^[A-Z]"},
+			"days": {"type": "integer", "minimum": 1, "exclusiveMaximum": 8},
+			"units": {"enum": ["metric", "imperial"]},
+			"tags": {"type": "array", "items": {"type": "string"}, "maxItems": 2, "uniqueItems": true},
+			"location": {"$ref": "#/$defs/location"},
+			"mode": {"oneOf": [{"const": "fast"}, {"type": "integer"}]}
+		},
+		"required": ["city"],
+		"additionalProperties": false,
+		"$defs": {
+			"location": {
+				"type": "object",
+				"properties": {"lat": {"type": "number", "maximum": 90}},
+				"required": ["lat"]
+			}
+		}
+	}`
+
+	tests := []struct {
+		name      string
+		arguments string
+		wantErrs  []string
+	}{
+		{
+			name:      "valid",
+			arguments: `{"city":"Paris","days":7,"units":"metric","tags":["a","b"],"location":{"lat":48.8},"mode":"fast"}`,
+		},
+		{
+			name:      "missing arguments",
+			arguments: ``,
+			wantErrs:  []string{`/: missing required property "city"`},
+		},
+		{
+			name:      "every invalid location",
+			arguments: `{"city":"p","days":8,"units":"kelvin","tags":["a","a","b"],"location":{},"mode":true,"extra":1}`,
+			wantErrs: []string{
+				"/city: length must be at least 2, got 1",
+				`/city: value doesn't match the pattern "^[A-Z]"`,
+				"/days: 8 must be less than 8",
+				"/extra: additional property is not allowed",
+				`/location: missing required property "lat"`,
+				"/mode: value must match exactly one of the oneOf schemas, matched 0",
+				"/tags: must have at most 2 items, got 3",
+				"/tags/1: item is a duplicate of item 0",
+				"/units: value is not one of the enum values",
+			},
+		},
+		{
+			name:      "invalid type",
+			arguments: `{"city":"Paris","days":1.5,"location":{"lat":"north"}}`,
+			wantErrs: []string{
+				"/days: expected integer, got number",
+				"/location/lat: expected number, got string",
+			},
+		},
+	}
+
+	for _, transportName := range []string{"SSE", "StreamableHTTP", "StdIO", "InMemory", "WebSocket", "Socket"} {
+		registry := mcp.NewRegistry()
+		toolWatcher := &mockToolListWatcher{}
+		calls := 0
+		var callsLock sync.Mutex
+		handler := func(context.Context, mcp.CallToolParams, mcp.ProgressReporter, mcp.RequestClientFunc) (
+			mcp.CallToolResult, error,
+		) {
+			callsLock.Lock()
+			defer callsLock.Unlock()
+			calls++
+			return mcp.CallToolResult{Content: []mcp.Content{{Type: mcp.ContentTypeText, Text: "ok"}}}, nil
+		}
+		registry.AddTool(mcp.Tool{Name: "weather", InputSchema: json.RawMessage(schema)}, handler)
+
+		cfg := testSuiteConfig{
+			transportName: transportName,
+			serverOptions: []mcp.ServerOption{
+				mcp.WithToolServer(registry),
+				mcp.WithToolListUpdater(registry),
+				mcp.WithToolArgumentsValidation(),
+			},
+			clientOptions: []mcp.ClientOption{mcp.WithToolListWatcher(toolWatcher)},
+		}
+
+		t.Run(transportName, testSuiteCase(cfg, func(t *testing.T, s *testSuite) {
+			defer registry.Close()
+
+			if s.clientConnectErr != nil {
+				t.Fatalf("failed to connect to server: %v", s.clientConnectErr)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			callTool := func(name, arguments string) mcp.CallToolResult {
+				t.Helper()
+				params := mcp.CallToolParams{Name: name}
+				if arguments != "" {
+					params.Arguments = json.RawMessage(arguments)
+				}
+				result, err := s.mcpClient.CallTool(ctx, params)
+				if err != nil {
+					t.Fatalf("failed to call tool: %v", err)
+				}
+				return result
+			}
+
+			for _, tc := range tests {
+				callsLock.Lock()
+				calls = 0
+				callsLock.Unlock()
+
+				result := callTool("weather", tc.arguments)
+
+				callsLock.Lock()
+				gotCalls := calls
+				callsLock.Unlock()
+
+				if len(tc.wantErrs) == 0 {
+					if result.IsError || gotCalls != 1 {
+						t.Errorf("%s: expected the tool to be called, got %+v", tc.name, result)
+					}
+					continue
+				}
+				if !result.IsError || len(result.Content) != 1 {
+					t.Fatalf("%s: expected error result, got %+v", tc.name, result)
+				}
+				want := "invalid arguments: " + strings.Join(tc.wantErrs, "\n")
+				if result.Content[0].Text != want {
+					t.Errorf("%s: expected error %q, got %q", tc.name, want, result.Content[0].Text)
+				}
+				if gotCalls != 0 {
+					t.Errorf("%s: expected the tool not to be called", tc.name)
+				}
+			}
+
+			// The tool added after the schemas are cached is validated as well.
+			registry.AddTool(mcp.Tool{
+				Name:        "forecast",
+				InputSchema: json.RawMessage(`{"type":"object","required":["city"]}`),
+			}, handler)
+			waitForCount(t, &toolWatcher.lock, &toolWatcher.updateCount, 1)
+			if result := callTool("forecast", `{}`); !result.IsError {
+				t.Errorf("expected error result for the added tool, got %+v", result)
+			}
+
+			// The changed schema is used once the tools list change is notified.
+			registry.AddTool(mcp.Tool{Name: "weather", InputSchema: json.RawMessage(`{"type":"object"}`)}, handler)
+			waitForCount(t, &toolWatcher.lock, &toolWatcher.updateCount, 2)
+			if result := callTool("weather", `{}`); result.IsError {
+				t.Errorf("expected the changed schema to be used, got %+v", result)
+			}
+		}))
+	}
+}
+
+func TestToolSchemaCache(t *testing.T) {
+	for _, transportName := range []string{"SSE", "StreamableHTTP", "StdIO", "InMemory", "WebSocket", "Socket"} {
+		var listCalls atomic.Int32
+		release := make(chan struct{})
+		cfg := testSuiteConfig{
+			transportName: transportName,
+			serverOptions: []mcp.ServerOption{
+				mcp.WithToolServer(mockSlowToolServer{listCalls: &listCalls, release: release}),
+				mcp.WithToolArgumentsValidation(),
+			},
+		}
+
+		t.Run(transportName, testSuiteCase(cfg, func(t *testing.T, s *testSuite) {
+			if s.clientConnectErr != nil {
+				t.Fatalf("failed to connect to server: %v", s.clientConnectErr)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			// The concurrent calls share a single listing of the tools, while it's in progress.
+			const callsCount = 3
+			errs := make(chan error, callsCount)
+			for range callsCount {
+				go func() {
+					_, err := s.mcpClient.CallTool(ctx, mcp.CallToolParams{Name: "missing"})
+					errs <- err
+				}()
+			}
+			for listCalls.Load() == 0 {
+				time.Sleep(time.Millisecond)
+			}
+			close(release)
+			for range callsCount {
+				if err := <-errs; err != nil {
+					t.Fatalf("failed to call tool: %v", err)
+				}
+			}
+
+			// The tool that isn't listed is not looked up again until the tools list changes.
+			if _, err := s.mcpClient.CallTool(ctx, mcp.CallToolParams{Name: "missing"}); err != nil {
+				t.Fatalf("failed to call tool: %v", err)
+			}
+			if got := listCalls.Load(); got != 1 {
+				t.Errorf("expected the tools to be listed once, got %d", got)
+			}
+		}))
+	}
+}
+
+func TestToolCallPolicy(t *testing.T) {
+	readOnly, notDestructive := true, false
+
+	for _, transportName := range []string{"SSE", "StreamableHTTP", "StdIO", "InMemory", "WebSocket", "Socket"} {
+		registry := mcp.NewRegistry()
+		toolWatcher := &mockToolListWatcher{}
+
+		var lock sync.Mutex
+		var called, confirmed []string
+		confirm := true
+		handler := func(_ context.Context, params mcp.CallToolParams, _ mcp.ProgressReporter, _ mcp.RequestClientFunc) (
+			mcp.CallToolResult, error,
+		) {
+			lock.Lock()
+			defer lock.Unlock()
+			called = append(called, params.Name)
+			return mcp.CallToolResult{Content: []mcp.Content{{Type: mcp.ContentTypeText, Text: "ok"}}}, nil
+		}
+		registry.AddTool(mcp.Tool{
+			Name:        "read",
+			Annotations: &mcp.ToolAnnotations{ReadOnlyHint: &readOnly},
+		}, handler)
+		registry.AddTool(mcp.Tool{Name: "delete"}, handler)
+
+		cfg := testSuiteConfig{
+			transportName: transportName,
+			serverOptions: []mcp.ServerOption{
+				mcp.WithToolServer(registry),
+				mcp.WithToolListUpdater(registry),
+			},
+			clientOptions: []mcp.ClientOption{
+				mcp.WithToolListWatcher(toolWatcher),
+				mcp.WithToolCallPolicy(mcp.ConfirmDestructiveToolCalls(
+					func(_ context.Context, tool mcp.Tool, _ mcp.CallToolParams) (bool, error) {
+						lock.Lock()
+						defer lock.Unlock()
+						confirmed = append(confirmed, tool.Name)
+						return confirm, nil
+					})),
+			},
+		}
+
+		t.Run(transportName, testSuiteCase(cfg, func(t *testing.T, s *testSuite) {
+			defer registry.Close()
+
+			if s.clientConnectErr != nil {
+				t.Fatalf("failed to connect to server: %v", s.clientConnectErr)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			calls := []struct {
+				name        string
+				confirm     bool
+				wantRefused bool
+			}{
+				{name: "read"},
+				{name: "delete", confirm: true},
+				{name: "delete", wantRefused: true},
+				// The unknown tools are destructive by default.
+				{name: "unknown", wantRefused: true},
+			}
+			for _, c := range calls {
+				lock.Lock()
+				confirm = c.confirm
+				lock.Unlock()
+
+				_, err := s.mcpClient.CallTool(ctx, mcp.CallToolParams{Name: c.name})
+				if c.wantRefused {
+					if !errors.Is(err, mcp.ErrToolCallRefused) {
+						t.Errorf("%s: expected refused call, got %v", c.name, err)
+					}
+					continue
+				}
+				if err != nil {
+					t.Errorf("%s: failed to call tool: %v", c.name, err)
+				}
+			}
+
+			// The changed annotations are used once the tools list change is notified.
+			registry.AddTool(mcp.Tool{
+				Name:        "delete",
+				Annotations: &mcp.ToolAnnotations{DestructiveHint: &notDestructive},
+			}, handler)
+			waitForCount(t, &toolWatcher.lock, &toolWatcher.updateCount, 1)
+			if _, err := s.mcpClient.CallTool(ctx, mcp.CallToolParams{Name: "delete"}); err != nil {
+				t.Errorf("expected the call of the changed tool to be allowed, got %v", err)
+			}
+
+			lock.Lock()
+			defer lock.Unlock()
+			if want := "[read delete delete]"; fmt.Sprint(called) != want {
+				t.Errorf("expected called tools %s, got %v", want, called)
+			}
+			if want := "[delete delete unknown]"; fmt.Sprint(confirmed) != want {
+				t.Errorf("expected confirmed tools %s, got %v", want, confirmed)
+			}
+		}))
+	}
+}
+
+func TestHandlerErrors(t *testing.T) {
+	for _, redact := range []bool{false, true} {
+		for _, transportName := range []string{"SSE", "StreamableHTTP", "StdIO", "InMemory", "WebSocket", "Socket"} {
+			registry := mcp.NewRegistry()
+			registry.AddTool(mcp.Tool{Name: "panic"},
+				func(context.Context, mcp.CallToolParams, mcp.ProgressReporter, mcp.RequestClientFunc) (
+					mcp.CallToolResult, error,
+				) {
+					panic("secret state")
+				})
+			registry.AddTool(mcp.Tool{Name: "echo"},
+				func(context.Context, mcp.CallToolParams, mcp.ProgressReporter, mcp.RequestClientFunc) (
+					mcp.CallToolResult, error,
+				) {
+					return mcp.CallToolResult{Content: []mcp.Content{{Type: mcp.ContentTypeText, Text: "echo"}}}, nil
+				})
+
+			// The middleware fails the tools list with an error that isn't a JSONRPCError.
+			failList := func(next mcp.MessageHandler) mcp.MessageHandler {
+				return func(ctx context.Context, msg mcp.JSONRPCMessage) (any, error) {
+					if msg.Method == mcp.MethodToolsList {
+						return nil, errors.New("secret connection string")
+					}
+					return next(ctx, msg)
+				}
+			}
+
+			serverOptions := []mcp.ServerOption{
+				mcp.WithToolServer(registry),
+				mcp.WithServerMiddleware(failList),
+			}
+			if redact {
+				serverOptions = append(serverOptions, mcp.WithServerRedactInternalErrors())
+			}
+			cfg := testSuiteConfig{
+				transportName: transportName,
+				serverOptions: serverOptions,
+			}
+
+			t.Run(fmt.Sprintf("%s/redact=%t", transportName, redact), testSuiteCase(cfg, func(t *testing.T, s *testSuite) {
+				defer registry.Close()
+
+				if s.clientConnectErr != nil {
+					t.Fatalf("failed to connect to server: %v", s.clientConnectErr)
+				}
+
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+
+				checkErr := func(err error, secret string) {
+					t.Helper()
+					var jsonErr *mcp.JSONRPCError
+					if !errors.As(err, &jsonErr) || jsonErr.Code != -32603 {
+						t.Fatalf("expected internal error, got %v", err)
+					}
+					if strings.Contains(jsonErr.Message, secret) == redact {
+						t.Errorf("unexpected error message %q with redact %t", jsonErr.Message, redact)
+					}
+				}
+
+				_, err := s.mcpClient.CallTool(ctx, mcp.CallToolParams{Name: "panic"})
+				checkErr(err, "secret state")
+				_, err = s.mcpClient.ListTools(ctx, mcp.ListToolsParams{})
+				checkErr(err, "secret connection string")
+
+				// The session survives the panic of the previous call.
+				if _, err := s.mcpClient.CallTool(ctx, mcp.CallToolParams{Name: "echo"}); err != nil {
+					t.Errorf("failed to call tool after the panic: %v", err)
+				}
+			}))
+		}
+	}
+}
+
+func TestElicitation(t *testing.T) {
+	// The elicitation is defined since 2025-06-18.
+	clientVersions := mcp.WithClientProtocolVersions(mcp.ProtocolVersion20250618)
+
+	for _, transportName := range []string{"SSE", "StreamableHTTP", "StdIO", "InMemory", "WebSocket", "Socket"} {
+		toolServer := mockToolServer{
+			requestElicitation: true,
+		}
+		cfg := testSuiteConfig{
+			transportName: transportName,
+			serverOptions: []mcp.ServerOption{
+				mcp.WithToolServer(&toolServer),
+				mcp.WithServerProtocolVersions(mcp.ProtocolVersion20250618, mcp.ProtocolVersion20250326,
+					mcp.ProtocolVersion20241105),
+			},
+			clientOptions: []mcp.ClientOption{
+				clientVersions,
+				mcp.WithElicitationHandler(mockElicitationHandler{
+					result: mcp.ElicitationResult{
+						Action:  mcp.ElicitationActionAccept,
+						Content: json.RawMessage(`{"name":"Alice"}`),
+					},
+				}),
+			},
+		}
+
+		t.Run(fmt.Sprintf("%s/Accept", transportName), testSuiteCase(cfg, func(t *testing.T, s *testSuite) {
+			if s.clientConnectErr != nil {
+				t.Fatalf("failed to connect to server: %v", s.clientConnectErr)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			result, err := s.mcpClient.CallTool(ctx, mcp.CallToolParams{Name: "test-tool"})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.IsError {
+				t.Fatalf("unexpected error result: %+v", result.Content)
+			}
+			if toolServer.elicitedAction != mcp.ElicitationActionAccept {
+				t.Errorf("expected action %s, got %s", mcp.ElicitationActionAccept, toolServer.elicitedAction)
+			}
+			if toolServer.elicitedName != "Alice" {
+				t.Errorf("expected name Alice, got %s", toolServer.elicitedName)
+			}
+		}))
+
+		cfg.clientOptions = []mcp.ClientOption{
+			clientVersions,
+			mcp.WithElicitationHandler(mockElicitationHandler{
+				result: mcp.ElicitationResult{
+					Action: mcp.ElicitationActionDecline,
+				},
+			}),
+		}
+
+		t.Run(fmt.Sprintf("%s/Decline", transportName), testSuiteCase(cfg, func(t *testing.T, s *testSuite) {
+			if s.clientConnectErr != nil {
+				t.Fatalf("failed to connect to server: %v", s.clientConnectErr)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			result, err := s.mcpClient.CallTool(ctx, mcp.CallToolParams{Name: "test-tool"})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if result.IsError {
+				t.Fatalf("unexpected error result: %+v", result.Content)
+			}
+			if toolServer.elicitedAction != mcp.ElicitationActionDecline {
+				t.Errorf("expected action %s, got %s", mcp.ElicitationActionDecline, toolServer.elicitedAction)
+			}
+		}))
+
+		cfg.clientOptions = []mcp.ClientOption{
+			clientVersions,
+			mcp.WithElicitationHandler(mockElicitationHandler{
+				result: mcp.ElicitationResult{
+					Action:  mcp.ElicitationActionAccept,
+					Content: json.RawMessage(`{"age":30}`),
+				},
+			}),
+		}
+
+		t.Run(fmt.Sprintf("%s/InvalidContent", transportName), testSuiteCase(cfg, func(t *testing.T, s *testSuite) {
+			if s.clientConnectErr != nil {
+				t.Fatalf("failed to connect to server: %v", s.clientConnectErr)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			result, err := s.mcpClient.CallTool(ctx, mcp.CallToolParams{Name: "test-tool"})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !result.IsError {
+				t.Errorf("expected error result")
+			}
+		}))
+
+		cfg.clientOptions = []mcp.ClientOption{clientVersions}
+
+		t.Run(fmt.Sprintf("%s/UnsupportedElicitation", transportName), testSuiteCase(cfg, func(t *testing.T, s *testSuite) {
+			if s.clientConnectErr != nil {
+				t.Fatalf("failed to connect to server: %v", s.clientConnectErr)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			result, err := s.mcpClient.CallTool(ctx, mcp.CallToolParams{Name: "test-tool"})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !result.IsError {
+				t.Errorf("expected error result")
+			}
+		}))
+
+		// The elicitation is not defined in the earlier revisions, even if the client declares the capability.
+		for _, version := range []string{mcp.ProtocolVersion20241105, mcp.ProtocolVersion20250326} {
+			cfg.clientOptions = []mcp.ClientOption{
+				mcp.WithClientProtocolVersions(version),
+				mcp.WithElicitationHandler(mockElicitationHandler{
+					result: mcp.ElicitationResult{
+						Action:  mcp.ElicitationActionAccept,
+						Content: json.RawMessage(`{"name":"Alice"}`),
+					},
+				}),
+			}
+
+			t.Run(fmt.Sprintf("%s/UnsupportedVersion/%s", transportName, version), testSuiteCase(cfg,
+				func(t *testing.T, s *testSuite) {
+					if s.clientConnectErr != nil {
+						t.Fatalf("failed to connect to server: %v", s.clientConnectErr)
+					}
+
+					ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+					defer cancel()
+
+					result, err := s.mcpClient.CallTool(ctx, mcp.CallToolParams{Name: "test-tool"})
+					if err != nil {
+						t.Fatalf("unexpected error: %v", err)
+					}
+					if !result.IsError {
+						t.Errorf("expected error result")
+					}
+				}))
+		}
+	}
+}
+
+func TestServerRequestHelpers(t *testing.T) {
+	for _, transportName := range []string{"SSE", "StreamableHTTP", "StdIO", "InMemory", "WebSocket", "Socket"} {
+		toolServer := mockToolServer{
+			requestWithHelpers: true,
+		}
+		logHandler := mockLogHandler{
+			params: make(chan mcp.LogParams),
+			done:   make(chan struct{}),
+		}
+		receiver := &mockLogReceiver{}
+
+		cfg := testSuiteConfig{
+			transportName: transportName,
+			serverOptions: []mcp.ServerOption{
+				mcp.WithToolServer(&toolServer),
+				mcp.WithLogHandler(&logHandler),
+			},
+			clientOptions: []mcp.ClientOption{
+				mcp.WithRootsListHandler(&mockRootsListHandler{}),
+				mcp.WithSamplingHandler(&mockSamplingHandler{}),
+				mcp.WithLogReceiver(receiver),
+			},
+		}
+
+		t.Run(fmt.Sprintf("%s/Helpers", transportName), testSuiteCase(cfg, func(t *testing.T, s *testSuite) {
+			defer close(logHandler.done)
+
+			if s.clientConnectErr != nil {
+				t.Fatalf("failed to connect to server: %v", s.clientConnectErr)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			_, err := s.mcpClient.CallTool(ctx, mcp.CallToolParams{Name: "test-tool"})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if toolServer.helperErr != nil {
+				t.Fatalf("unexpected helper error: %v", toolServer.helperErr)
+			}
+			if len(toolServer.helperRoots.Roots) != 1 {
+				t.Errorf("expected 1 root, got %d", len(toolServer.helperRoots.Roots))
+			}
+			if toolServer.helperSampling.Model != "test-model" {
+				t.Errorf("expected model test-model, got %s", toolServer.helperSampling.Model)
+			}
+
+			time.Sleep(100 * time.Millisecond)
+
+			receiver.lock.Lock()
+			defer receiver.lock.Unlock()
+			if receiver.updateCount != 1 {
+				t.Errorf("expected 1 log params, got %d", receiver.updateCount)
+			}
+		}))
+
+		cfg.serverOptions = []mcp.ServerOption{
+			mcp.WithToolServer(&toolServer),
+		}
+		cfg.clientOptions = nil
+
+		t.Run(fmt.Sprintf("%s/UnsupportedCapability", transportName), testSuiteCase(cfg, func(t *testing.T, s *testSuite) {
+			if s.clientConnectErr != nil {
+				t.Fatalf("failed to connect to server: %v", s.clientConnectErr)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			_, err := s.mcpClient.CallTool(ctx, mcp.CallToolParams{Name: "test-tool"})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !errors.Is(toolServer.helperErr, mcp.ErrClientCapabilityNotSupported) {
+				t.Errorf("expected ErrClientCapabilityNotSupported, got %v", toolServer.helperErr)
+			}
+		}))
+	}
+}
+
+func TestConcurrentClientRequests(t *testing.T) {
+	for _, transportName := range []string{"SSE", "StreamableHTTP", "StdIO", "InMemory", "WebSocket", "Socket"} {
+		toolServer := mockToolServer{
+			parallelSamplings: 5,
+		}
+		samplingHandler := &mockBlockingSamplingHandler{}
+
+		cfg := testSuiteConfig{
+			transportName: transportName,
+			serverOptions: []mcp.ServerOption{
+				mcp.WithToolServer(&toolServer),
+			},
+			clientOptions: []mcp.ClientOption{
+				mcp.WithSamplingHandler(samplingHandler),
+			},
+		}
+
+		t.Run(fmt.Sprintf("%s/Parallel", transportName), testSuiteCase(cfg, func(t *testing.T, s *testSuite) {
+			if s.clientConnectErr != nil {
+				t.Fatalf("failed to connect to server: %v", s.clientConnectErr)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			_, err := s.mcpClient.CallTool(ctx, mcp.CallToolParams{Name: "test-tool"})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for i, err := range toolServer.samplingErrs {
+				if err != nil {
+					t.Errorf("unexpected error for sampling %d: %v", i, err)
+				}
+			}
+
+			samplingHandler.lock.Lock()
+			defer samplingHandler.lock.Unlock()
+			if samplingHandler.calls != 5 {
+				t.Errorf("expected 5 sampling calls, got %d", samplingHandler.calls)
+			}
+		}))
+
+		blockingHandler := &mockBlockingSamplingHandler{block: true}
+		cfg.serverOptions = append(cfg.serverOptions, mcp.WithServerClientRequestTimeout(100*time.Millisecond))
+		cfg.clientOptions = []mcp.ClientOption{
+			mcp.WithSamplingHandler(blockingHandler),
+		}
+
+		t.Run(fmt.Sprintf("%s/Timeout", transportName), testSuiteCase(cfg, func(t *testing.T, s *testSuite) {
+			if s.clientConnectErr != nil {
+				t.Fatalf("failed to connect to server: %v", s.clientConnectErr)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			_, err := s.mcpClient.CallTool(ctx, mcp.CallToolParams{Name: "test-tool"})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for i, err := range toolServer.samplingErrs {
+				if !errors.Is(err, context.DeadlineExceeded) {
+					t.Errorf("expected deadline exceeded for sampling %d, got %v", i, err)
+				}
+			}
+
+			time.Sleep(100 * time.Millisecond)
+
+			// The server should notify the client to cancel the timed out requests.
+			blockingHandler.lock.Lock()
+			defer blockingHandler.lock.Unlock()
+			if blockingHandler.cancelled != 5 {
+				t.Errorf("expected 5 cancelled sampling calls, got %d", blockingHandler.cancelled)
+			}
+		}))
+	}
+}
+
+func TestRoot(t *testing.T) {
+	for _, transportName := range []string{"SSE", "StreamableHTTP", "StdIO", "InMemory", "WebSocket", "Socket"} {
+		rootsListUpdater := mockRootsListUpdater{
+			ch:   make(chan struct{}),
+			done: make(chan struct{}),
+		}
+		rootsListWatcher := mockRootsListWatcher{}
+
+		cfg := testSuiteConfig{
+			transportName: transportName,
+			serverOptions: []mcp.ServerOption{
+				mcp.WithRootsListWatcher(&rootsListWatcher),
+			},
+			clientOptions: []mcp.ClientOption{
+				mcp.WithRootsListUpdater(rootsListUpdater),
+			},
+		}
+
+		t.Run(fmt.Sprintf("%s/UpdateRootList", transportName), testSuiteCase(cfg, func(t *testing.T, s *testSuite) {
+			if s.clientConnectErr != nil {
+				t.Fatalf("failed to connect to server: %v", s.clientConnectErr)
+			}
+
+			defer close(rootsListUpdater.done)
+
+			for range 5 {
+				rootsListUpdater.ch <- struct{}{}
+			}
+
+			time.Sleep(100 * time.Millisecond)
+
+			rootsListWatcher.lock.Lock()
+			defer rootsListWatcher.lock.Unlock()
+			if rootsListWatcher.updateCount != 5 {
+				t.Errorf("expected 5 root list updates, got %d", rootsListWatcher.updateCount)
+			}
+		}))
+	}
+}
+
+func TestLog(t *testing.T) {
+	for _, transportName := range []string{"SSE", "StreamableHTTP", "StdIO", "InMemory", "WebSocket", "Socket"} {
+		handler := mockLogHandler{
+			params: make(chan mcp.LogParams),
+			done:   make(chan struct{}),
+		}
+		receiver := &mockLogReceiver{}
+
+		cfg := testSuiteConfig{
+			transportName: transportName,
+			serverOptions: []mcp.ServerOption{
+				mcp.WithLogHandler(&handler),
+			},
+			clientOptions: []mcp.ClientOption{
+				mcp.WithLogReceiver(receiver),
+			},
+		}
+
+		t.Run(fmt.Sprintf("%s/TestLog", transportName), testSuiteCase(cfg, func(t *testing.T, s *testSuite) {
+			defer close(handler.done)
+
+			if s.clientConnectErr != nil {
+				t.Fatalf("failed to connect to server: %v", s.clientConnectErr)
+			}
+
+			handler.level = mcp.LogLevelDebug
+			for range 10 {
+				handler.params <- mcp.LogParams{}
+			}
+
+			time.Sleep(100 * time.Millisecond)
+
+			receiver.lock.Lock()
+			defer receiver.lock.Unlock()
+			if receiver.updateCount != 10 {
+				t.Errorf("expected 10 log params, got %d", receiver.updateCount)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			err := s.mcpClient.SetLogLevel(ctx, mcp.LogLevelError)
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			time.Sleep(100 * time.Millisecond)
+
+			handler.lock.Lock()
+			defer handler.lock.Unlock()
+			if handler.level != mcp.LogLevelError {
+				t.Errorf("expected log level %d, got %d", mcp.LogLevelError, handler.level)
+			}
+		}))
+	}
+}
+
+func TestPing(t *testing.T) {
+	for _, transportName := range []string{"SSE", "StreamableHTTP", "StdIO", "InMemory", "WebSocket", "Socket"} {
+		// Variables to track the number of server and client connections.
+		serverClientsCount := int64(0)
+		clientPingFailedCount := int64(0)
+
+		cfg := testSuiteConfig{
+			transportName: transportName,
+			serverOptions: []mcp.ServerOption{
 				mcp.WithServerPingInterval(200 * time.Millisecond),
 				mcp.WithServerPingTimeout(100 * time.Millisecond),
 				mcp.WithServerOnClientConnected(func(string, mcp.Info) {
@@ -1026,6 +2335,355 @@ func TestPing(t *testing.T) {
 	}
 }
 
+func TestClientReconnect(t *testing.T) {
+	// The StdIO is not tested, as it can't start a new session after the previous one ends.
+	for _, transportName := range []string{"SSE", "StreamableHTTP"} {
+		recorder := &mockSessionRecorder{
+			updates: make(chan string),
+			done:    make(chan struct{}),
+		}
+		watcher := &mockResourceSubscribedWatcher{}
+		var transport *mockDroppableClientTransport
+		states := make(chan mcp.ConnectionState, 100)
+
+		cfg := testSuiteConfig{
+			transportName: transportName,
+			serverOptions: []mcp.ServerOption{
+				mcp.WithResourceServer(&mockResourceServer{}),
+				mcp.WithResourceSubscriptionHandler(recorder),
+				mcp.WithLogHandler(recorder),
+			},
+			clientOptions: []mcp.ClientOption{
+				mcp.WithClientReconnect(mcp.ReconnectPolicy{
+					InitialDelay: 10 * time.Millisecond,
+				}),
+				mcp.WithClientOnConnectionStateChanged(func(state mcp.ConnectionState) {
+					states <- state
+				}),
+				mcp.WithResourceSubscribedWatcher(watcher),
+			},
+			wrapClientTransport: func(clientTransport mcp.ClientTransport) mcp.ClientTransport {
+				transport = &mockDroppableClientTransport{ClientTransport: clientTransport}
+				return transport
+			},
+		}
+
+		t.Run(fmt.Sprintf("%s/Reconnect", transportName), testSuiteCase(cfg, func(t *testing.T, s *testSuite) {
+			defer close(recorder.done)
+
+			if s.clientConnectErr != nil {
+				t.Fatalf("failed to connect to server: %v", s.clientConnectErr)
+			}
+
+			expectState := func(want mcp.ConnectionState) {
+				select {
+				case got := <-states:
+					if got != want {
+						t.Fatalf("expected state %s, got %s", want, got)
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatalf("timeout waiting for state %s", want)
+				}
+			}
+			expectRecorded := func(subscriptions, logLevels int) {
+				for range 100 {
+					subs, levels := recorder.recorded()
+					if len(subs) >= subscriptions && len(levels) == logLevels {
+						return
+					}
+					time.Sleep(10 * time.Millisecond)
+				}
+				subs, levels := recorder.recorded()
+				t.Fatalf("expected at least %d subscriptions and %d log levels, got %v and %v",
+					subscriptions, logLevels, subs, levels)
+			}
+
+			expectState(mcp.ConnectionStateConnected)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			if err := s.mcpClient.SubscribeResource(ctx, mcp.SubscribeResourceParams{URI: "test://resource"}); err != nil {
+				t.Fatalf("failed to subscribe resource: %v", err)
+			}
+			if err := s.mcpClient.SetLogLevel(ctx, mcp.LogLevelDebug); err != nil {
+				t.Fatalf("failed to set log level: %v", err)
+			}
+			expectRecorded(1, 1)
+
+			transport.drop()
+
+			expectState(mcp.ConnectionStateReconnecting)
+			expectState(mcp.ConnectionStateConnected)
+
+			// The subscription and the log level should be replayed to the new session. The handler isn't
+			// asked to subscribe again if the server hasn't noticed the dropped session yet, so the
+			// resubscription is checked by the delivery of the resource updates.
+			expectRecorded(1, 2)
+			_, levels := recorder.recorded()
+			if levels[1] != mcp.LogLevelDebug {
+				t.Errorf("expected log level %d, got %d", mcp.LogLevelDebug, levels[1])
+			}
+			recorder.updates <- "test://resource"
+			for range 100 {
+				watcher.lock.Lock()
+				count := watcher.updateCount
+				watcher.lock.Unlock()
+				if count > 0 {
+					break
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			watcher.lock.Lock()
+			if watcher.updateCount != 1 {
+				t.Errorf("expected 1 resource update after reconnection, got %d", watcher.updateCount)
+			}
+			watcher.lock.Unlock()
+
+			if _, err := s.mcpClient.ListResources(ctx, mcp.ListResourcesParams{}); err != nil {
+				t.Errorf("failed to list resources after reconnection: %v", err)
+			}
+		}))
+	}
+}
+
+func TestClientDisconnectedRequest(t *testing.T) {
+	for _, transportName := range []string{"SSE", "StreamableHTTP", "InMemory"} {
+		var listCalls atomic.Int32
+		release := make(chan struct{})
+		var transport *mockDroppableClientTransport
+
+		cfg := testSuiteConfig{
+			transportName: transportName,
+			serverOptions: []mcp.ServerOption{
+				mcp.WithToolServer(mockSlowToolServer{listCalls: &listCalls, release: release}),
+			},
+			wrapClientTransport: func(clientTransport mcp.ClientTransport) mcp.ClientTransport {
+				transport = &mockDroppableClientTransport{ClientTransport: clientTransport}
+				return transport
+			},
+		}
+
+		t.Run(transportName, testSuiteCase(cfg, func(t *testing.T, s *testSuite) {
+			defer close(release)
+
+			if s.clientConnectErr != nil {
+				t.Fatalf("failed to connect to server: %v", s.clientConnectErr)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			errs := make(chan error, 1)
+			go func() {
+				_, err := s.mcpClient.ListTools(ctx, mcp.ListToolsParams{})
+				errs <- err
+			}()
+			for listCalls.Load() == 0 {
+				time.Sleep(time.Millisecond)
+			}
+
+			transport.drop()
+
+			select {
+			case err := <-errs:
+				if err == nil || !strings.Contains(err.Error(), "client is disconnected") {
+					t.Errorf("expected disconnected error, got %v", err)
+				}
+			case <-ctx.Done():
+				t.Fatal("the request is not ended with the session")
+			}
+		}))
+	}
+}
+
+func TestSessionNotifications(t *testing.T) {
+	srvTransport, aliceTransport, httpSrv := setupStreamableHTTP()
+	defer httpSrv.Close()
+	bobTransport := mcp.NewStreamableHTTPClient(httpSrv.URL, httpSrv.Client())
+
+	recorder := &mockSessionRecorder{
+		updates: make(chan string),
+		done:    make(chan struct{}),
+	}
+	logHandler := &mockLogHandler{
+		params: make(chan mcp.LogParams),
+		done:   make(chan struct{}),
+	}
+	sessionIDs := make(chan string, 2)
+	server := mcp.NewServer(mcp.Info{Name: "test-server", Version: "1.0"}, srvTransport,
+		mcp.WithResourceServer(&mockResourceServer{}),
+		mcp.WithResourceSubscriptionHandler(recorder),
+		mcp.WithLogHandler(logHandler),
+		mcp.WithServerOnClientConnected(func(id string, _ mcp.Info) {
+			sessionIDs <- id
+		}))
+	go server.Serve()
+	defer func() {
+		close(recorder.done)
+		close(logHandler.done)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := server.Shutdown(ctx); err != nil {
+			t.Errorf("failed to shutdown server: %v", err)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	type testClient struct {
+		name     string
+		id       string
+		client   *mcp.Client
+		watcher  *mockResourceSubscribedWatcher
+		receiver *mockLogReceiver
+	}
+	connect := func(name string, transport mcp.ClientTransport) testClient {
+		c := testClient{
+			name:     name,
+			watcher:  &mockResourceSubscribedWatcher{},
+			receiver: &mockLogReceiver{},
+		}
+		c.client = mcp.NewClient(mcp.Info{Name: name, Version: "1.0"}, transport,
+			mcp.WithResourceSubscribedWatcher(c.watcher),
+			mcp.WithLogReceiver(c.receiver))
+		if err := c.client.Connect(ctx); err != nil {
+			t.Fatalf("failed to connect %s: %v", name, err)
+		}
+		c.id = <-sessionIDs
+		t.Cleanup(func() {
+			if err := c.client.Disconnect(context.Background()); err != nil {
+				t.Errorf("failed to disconnect %s: %v", name, err)
+			}
+		})
+		return c
+	}
+	alice := connect("alice", aliceTransport)
+	bob := connect("bob", bobTransport)
+
+	if err := alice.client.SubscribeResource(ctx, mcp.SubscribeResourceParams{URI: "test://resource"}); err != nil {
+		t.Fatalf("failed to subscribe resource: %v", err)
+	}
+	if err := alice.client.SetLogLevel(ctx, mcp.LogLevelError); err != nil {
+		t.Fatalf("failed to set log level: %v", err)
+	}
+
+	counts := func(c testClient) (int, int) {
+		c.watcher.lock.Lock()
+		defer c.watcher.lock.Unlock()
+		c.receiver.lock.Lock()
+		defer c.receiver.lock.Unlock()
+		return c.watcher.updateCount, c.receiver.updateCount
+	}
+	expectCounts := func(c testClient, updates, logs int) {
+		t.Helper()
+		for range 100 {
+			if gotUpdates, gotLogs := counts(c); gotUpdates == updates && gotLogs == logs {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		gotUpdates, gotLogs := counts(c)
+		t.Fatalf("expected %s to receive %d updates and %d logs, got %d and %d",
+			c.name, updates, logs, gotUpdates, gotLogs)
+	}
+
+	// The resource update is only sent to the subscriber, and the log messages honor each session's level.
+	recorder.updates <- "test://resource"
+	logHandler.params <- mcp.LogParams{Level: mcp.LogLevelInfo}
+	logHandler.params <- mcp.LogParams{Level: mcp.LogLevelError}
+	expectCounts(alice, 1, 1)
+	expectCounts(bob, 0, 2)
+
+	// The targeted notifications only reach the addressed session.
+	if err := server.NotifyLog(ctx, bob.id, mcp.LogParams{Level: mcp.LogLevelDebug}); err != nil {
+		t.Fatalf("failed to notify log: %v", err)
+	}
+	if err := server.NotifyLog(ctx, alice.id, mcp.LogParams{Level: mcp.LogLevelDebug}); err != nil {
+		t.Fatalf("failed to notify log: %v", err)
+	}
+	if err := server.NotifyResourceUpdated(ctx, alice.id, "test://resource"); err != nil {
+		t.Fatalf("failed to notify resource updated: %v", err)
+	}
+	if err := server.NotifyResourceUpdated(ctx, bob.id, "test://resource"); err != nil {
+		t.Fatalf("failed to notify resource updated: %v", err)
+	}
+	expectCounts(alice, 2, 1)
+	expectCounts(bob, 0, 3)
+
+	if err := server.NotifyToolListChanged(ctx, "unknown"); !errors.Is(err, mcp.ErrSessionNotFound) {
+		t.Errorf("expected ErrSessionNotFound, got %v", err)
+	}
+}
+
+func TestNotificationsSendTimeout(t *testing.T) {
+	registry := mcp.NewRegistry()
+
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	server := mcp.NewServer(mcp.Info{Name: "test-server", Version: "1.0"}, serverTransport,
+		mcp.WithToolServer(registry),
+		mcp.WithToolListUpdater(registry),
+		mcp.WithServerSendTimeout(100*time.Millisecond),
+		mcp.WithServerLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	go server.Serve()
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(ctx)
+	}()
+	defer registry.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The stuck sessions are initialized, and never read the messages sent after that.
+	const stuckCount = 3
+	for range stuckCount {
+		session, err := clientTransport.StartSession(ctx)
+		if err != nil {
+			t.Fatalf("failed to start session: %v", err)
+		}
+		defer session.Stop()
+
+		if err := session.Send(ctx, mcp.JSONRPCMessage{
+			JSONRPC: mcp.JSONRPCVersion,
+			ID:      "1",
+			Method:  "initialize",
+			Params: json.RawMessage(`{"protocolVersion":"2025-03-26","capabilities":{},` +
+				`"clientInfo":{"name":"stuck-client","version":"1.0"}}`),
+		}); err != nil {
+			t.Fatalf("failed to send initialize request: %v", err)
+		}
+		for msg := range session.Messages() {
+			if msg.ID == "1" {
+				break
+			}
+		}
+		if err := session.Send(ctx, mcp.JSONRPCMessage{
+			JSONRPC: mcp.JSONRPCVersion,
+			Method:  "notifications/initialized",
+		}); err != nil {
+			t.Fatalf("failed to send initialized notification: %v", err)
+		}
+	}
+
+	toolWatcher := &mockToolListWatcher{}
+	cli := mcp.NewClient(mcp.Info{Name: "test-client", Version: "1.0"}, clientTransport,
+		mcp.WithToolListWatcher(toolWatcher),
+		mcp.WithClientLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	if err := cli.Connect(ctx); err != nil {
+		t.Fatalf("failed to connect to server: %v", err)
+	}
+	defer cli.Disconnect(ctx)
+
+	// The client is notified, even when it's notified after every stuck session used up its send timeout.
+	registry.AddTool(mcp.Tool{Name: "echo"}, nil)
+	waitForCount(t, &toolWatcher.lock, &toolWatcher.updateCount, 1)
+}
+
 func testSuiteCase(cfg testSuiteConfig, test func(*testing.T, *testSuite)) func(*testing.T) {
 	return func(t *testing.T) {
 		s := &testSuite{
@@ -1054,6 +2712,36 @@ func setupSSE() (mcp.SSEServer, *mcp.SSEClient, *httptest.Server) {
 	return srv, cli, httpSrv
 }
 
+func setupStreamableHTTP() (mcp.StreamableHTTPServer, *mcp.StreamableHTTPClient, *httptest.Server) {
+	srv := mcp.NewStreamableHTTPServer()
+	httpSrv := httptest.NewServer(srv.HandleMCP())
+
+	cli := mcp.NewStreamableHTTPClient(httpSrv.URL, httpSrv.Client())
+
+	return srv, cli, httpSrv
+}
+
+func setupWebSocket() (mcp.WebSocketServer, mcp.WebSocketClient, *httptest.Server) {
+	srv := mcp.NewWebSocketServer()
+	httpSrv := httptest.NewServer(srv.HandleWebSocket())
+
+	cli := mcp.NewWebSocketClient(strings.Replace(httpSrv.URL, "http://", "ws://", 1), httpSrv.Client())
+
+	return srv, cli, httpSrv
+}
+
+func setupSocket() (mcp.SocketServer, mcp.SocketClient) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("failed to listen: %v", err))
+	}
+
+	srv := mcp.NewSocketServer(listener)
+	cli := mcp.NewSocketClient("tcp", listener.Addr().String())
+
+	return srv, cli
+}
+
 func setupStdIO() (mcp.StdIO, mcp.StdIO, *io.PipeReader, *io.PipeWriter, *io.PipeReader, *io.PipeWriter) {
 	srvReader, srvWriter := io.Pipe()
 	cliReader, cliWriter := io.Pipe()
@@ -1082,11 +2770,24 @@ func generateRandomJSON(approxSize int) json.RawMessage {
 }
 
 func (t *testSuite) setup() {
-	if t.cfg.transportName == "SSE" {
+	switch t.cfg.transportName {
+	case "SSE":
 		t.serverTransport, t.clientTransport, t.httpServer = setupSSE()
-	} else {
+	case "StreamableHTTP":
+		t.serverTransport, t.clientTransport, t.httpServer = setupStreamableHTTP()
+	case "WebSocket":
+		t.serverTransport, t.clientTransport, t.httpServer = setupWebSocket()
+	case "Socket":
+		t.serverTransport, t.clientTransport = setupSocket()
+	case "InMemory":
+		// The messages are round-tripped through JSON, to catch the marshaling bugs as the other transports.
+		t.serverTransport, t.clientTransport = mcp.NewInMemoryTransports(mcp.WithInMemorySerialization())
+	default:
 		t.serverTransport, t.clientTransport, t.srvIOReader, t.srvIOWriter, t.cliIOReader, t.cliIOWriter = setupStdIO()
 	}
+	if t.cfg.wrapClientTransport != nil {
+		t.clientTransport = t.cfg.wrapClientTransport(t.clientTransport)
+	}
 
 	t.mcpServer = mcp.NewServer(mcp.Info{
 		Name:    "test-server",
@@ -1122,10 +2823,13 @@ func (t *testSuite) teardown(tt *testing.T) {
 		tt.Errorf("failed to disconnect client: %v", err)
 	}
 
-	if t.cfg.transportName == "SSE" {
+	if t.httpServer != nil {
 		t.httpServer.Close()
 		return
 	}
+	if t.srvIOWriter == nil {
+		return
+	}
 
 	_ = t.srvIOWriter.Close()
 	_ = t.srvIOReader.Close()
@@ -0,0 +1,33 @@
+package mcp
+
+import "context"
+
+// MessageHandler handles a JSON-RPC request or notification, and returns the result of the request.
+// The result and the error are ignored for the notifications.
+//
+// The handler wrapped by the middlewares of the Server receives the messages from the client, and
+// returns the result of the server implementation, such as a ListToolsResult. The handler wrapped by
+// the middlewares of the Client receives both the requests sent to the server, returning the
+// json.RawMessage of the result responded by the server, and the requests received from the server,
+// returning the result of the handler implementation, such as a SamplingResult. The direction of
+// the message is told by its method, as every method is only sent in one direction.
+type MessageHandler func(ctx context.Context, msg JSONRPCMessage) (any, error)
+
+// Middleware wraps a MessageHandler with the behavior shared by all the messages, such as logging,
+// metrics, or access control. The middleware may inspect or modify the message and the context before
+// calling next, inspect or replace the result and the error after, or answer the request without
+// calling next at all. The returned error should be a JSONRPCError, so the request is answered with
+// its code and message.
+//
+// The middleware of the Server can access the session with SessionFromContext, and the principal
+// with PrincipalFromContext.
+type Middleware func(next MessageHandler) MessageHandler
+
+// chainMiddlewares wraps the handler with the middlewares, so the first middleware is the outermost,
+// and it's the first one to receive the message.
+func chainMiddlewares(handler MessageHandler, middlewares []Middleware) MessageHandler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
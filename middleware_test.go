@@ -0,0 +1,330 @@
+package mcp_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MegaGrindStone/go-mcp"
+)
+
+// middlewareRecorder records the messages passed through the middlewares, in the order they're
+// received.
+type middlewareRecorder struct {
+	lock    sync.Mutex
+	records []string
+}
+
+func (r *middlewareRecorder) middleware(name string) mcp.Middleware {
+	return func(next mcp.MessageHandler) mcp.MessageHandler {
+		return func(ctx context.Context, msg mcp.JSONRPCMessage) (any, error) {
+			r.record(fmt.Sprintf("%s:%s", name, msg.Method))
+			result, err := next(ctx, msg)
+			resultType := fmt.Sprintf("%T", result)
+			if _, ok := result.(json.RawMessage); ok {
+				// The name of json.RawMessage depends on the encoding/json implementation.
+				resultType = "json.RawMessage"
+			}
+			r.record(fmt.Sprintf("%s:%s:%s", name, msg.Method, resultType))
+			return result, err
+		}
+	}
+}
+
+func (r *middlewareRecorder) record(record string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.records = append(r.records, record)
+}
+
+func (r *middlewareRecorder) recorded() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return slices.Clone(r.records)
+}
+
+func TestServerMiddleware(t *testing.T) {
+	for _, transportName := range []string{"SSE", "StreamableHTTP", "StdIO"} {
+		registry := mcp.NewRegistry()
+		registry.AddTool(mcp.Tool{Name: "echo"},
+			func(context.Context, mcp.CallToolParams, mcp.ProgressReporter, mcp.RequestClientFunc) (
+				mcp.CallToolResult, error,
+			) {
+				return mcp.CallToolResult{Content: []mcp.Content{{Type: mcp.ContentTypeText, Text: "echo"}}}, nil
+			})
+		registry.AddTool(mcp.Tool{Name: "forbidden"}, nil)
+
+		recorder := &middlewareRecorder{}
+		var sessionsLock sync.Mutex
+		var sessionIDs []string
+
+		// The access control middleware answers the forbidden tool calls, and the log level requests,
+		// without calling the server implementation.
+		deny := func(next mcp.MessageHandler) mcp.MessageHandler {
+			return func(ctx context.Context, msg mcp.JSONRPCMessage) (any, error) {
+				if session, ok := mcp.SessionFromContext(ctx); ok {
+					sessionsLock.Lock()
+					sessionIDs = append(sessionIDs, session.ID)
+					sessionsLock.Unlock()
+				}
+				var params mcp.CallToolParams
+				if (msg.Method == mcp.MethodToolsCall && json.Unmarshal(msg.Params, &params) == nil &&
+					params.Name == "forbidden") || msg.Method == mcp.MethodLoggingSetLevel {
+					return nil, mcp.JSONRPCError{Code: -32001, Message: "forbidden"}
+				}
+				return next(ctx, msg)
+			}
+		}
+
+		logHandler := &mockLogHandler{
+			params: make(chan mcp.LogParams),
+			done:   make(chan struct{}),
+		}
+		cfg := testSuiteConfig{
+			transportName: transportName,
+			serverOptions: []mcp.ServerOption{
+				mcp.WithToolServer(registry),
+				mcp.WithLogHandler(logHandler),
+				mcp.WithServerMiddleware(recorder.middleware("outer"), recorder.middleware("inner")),
+				mcp.WithServerMiddleware(deny),
+			},
+		}
+
+		t.Run(transportName, testSuiteCase(cfg, func(t *testing.T, s *testSuite) {
+			defer registry.Close()
+			defer close(logHandler.done)
+
+			if s.clientConnectErr != nil {
+				t.Fatalf("failed to connect to server: %v", s.clientConnectErr)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			if _, err := s.mcpClient.CallTool(ctx, mcp.CallToolParams{Name: "echo"}); err != nil {
+				t.Fatalf("failed to call tool: %v", err)
+			}
+			_, err := s.mcpClient.CallTool(ctx, mcp.CallToolParams{Name: "forbidden"})
+			var jsonErr *mcp.JSONRPCError
+			if !errors.As(err, &jsonErr) || jsonErr.Code != -32001 {
+				t.Errorf("expected forbidden error, got %v", err)
+			}
+			err = s.mcpClient.SetLogLevel(ctx, mcp.LogLevelError)
+			if !errors.As(err, &jsonErr) || jsonErr.Code != -32001 {
+				t.Errorf("expected forbidden error for the log level, got %v", err)
+			}
+
+			want := []string{
+				"outer:initialize",
+				"inner:initialize",
+				"inner:initialize:mcp.initializeResult",
+				"outer:initialize:mcp.initializeResult",
+				"outer:notifications/initialized",
+				"inner:notifications/initialized",
+				"inner:notifications/initialized:<nil>",
+				"outer:notifications/initialized:<nil>",
+				"outer:tools/call",
+				"inner:tools/call",
+				"inner:tools/call:mcp.CallToolResult",
+				"outer:tools/call:mcp.CallToolResult",
+				"outer:tools/call",
+				"inner:tools/call",
+				"inner:tools/call:<nil>",
+				"outer:tools/call:<nil>",
+				"outer:logging/setLevel",
+				"inner:logging/setLevel",
+				"inner:logging/setLevel:<nil>",
+				"outer:logging/setLevel:<nil>",
+			}
+			if got := recorder.recorded(); !slices.Equal(got, want) {
+				t.Errorf("expected records %v, got %v", want, got)
+			}
+
+			sessionsLock.Lock()
+			defer sessionsLock.Unlock()
+			if len(sessionIDs) != len(want)/4 {
+				t.Fatalf("expected the session in every middleware call, got %v", sessionIDs)
+			}
+			for _, id := range sessionIDs {
+				if id != sessionIDs[0] || id == "" {
+					t.Errorf("expected the same session in every middleware call, got %v", sessionIDs)
+					break
+				}
+			}
+		}))
+	}
+}
+
+func TestClientMiddleware(t *testing.T) {
+	for _, transportName := range []string{"SSE", "StreamableHTTP", "StdIO"} {
+		registry := mcp.NewRegistry()
+		registry.AddTool(mcp.Tool{Name: "sample"},
+			func(ctx context.Context, _ mcp.CallToolParams, _ mcp.ProgressReporter, _ mcp.RequestClientFunc) (
+				mcp.CallToolResult, error,
+			) {
+				if _, err := mcp.CreateMessage(ctx, mcp.SamplingParams{}); err != nil {
+					return mcp.CallToolResult{}, err
+				}
+				return mcp.CallToolResult{Content: []mcp.Content{{Type: mcp.ContentTypeText, Text: "sampled"}}}, nil
+			})
+
+		recorder := &middlewareRecorder{}
+		// The middleware replaces the result of the tools list.
+		replace := func(next mcp.MessageHandler) mcp.MessageHandler {
+			return func(ctx context.Context, msg mcp.JSONRPCMessage) (any, error) {
+				result, err := next(ctx, msg)
+				if msg.Method == mcp.MethodToolsList {
+					return mcp.ListToolsResult{Tools: []mcp.Tool{{Name: "replaced"}}}, err
+				}
+				return result, err
+			}
+		}
+
+		logHandler := &mockLogHandler{
+			params: make(chan mcp.LogParams),
+			done:   make(chan struct{}),
+		}
+		cfg := testSuiteConfig{
+			transportName: transportName,
+			serverOptions: []mcp.ServerOption{mcp.WithToolServer(registry), mcp.WithLogHandler(logHandler)},
+			clientOptions: []mcp.ClientOption{
+				mcp.WithSamplingHandler(&mockSamplingHandler{}),
+				mcp.WithClientMiddleware(recorder.middleware("client"), replace),
+			},
+		}
+
+		t.Run(transportName, testSuiteCase(cfg, func(t *testing.T, s *testSuite) {
+			defer registry.Close()
+			defer close(logHandler.done)
+
+			if s.clientConnectErr != nil {
+				t.Fatalf("failed to connect to server: %v", s.clientConnectErr)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			tools, err := s.mcpClient.ListTools(ctx, mcp.ListToolsParams{})
+			if err != nil {
+				t.Fatalf("failed to list tools: %v", err)
+			}
+			if len(tools.Tools) != 1 || tools.Tools[0].Name != "replaced" {
+				t.Errorf("expected the replaced tools list, got %+v", tools.Tools)
+			}
+
+			if _, err := s.mcpClient.CallTool(ctx, mcp.CallToolParams{Name: "sample"}); err != nil {
+				t.Fatalf("failed to call tool: %v", err)
+			}
+			if err := s.mcpClient.SetLogLevel(ctx, mcp.LogLevelError); err != nil {
+				t.Fatalf("failed to set log level: %v", err)
+			}
+
+			want := []string{
+				"client:tools/list",
+				"client:tools/list:mcp.ListToolsResult",
+				"client:tools/call",
+				"client:sampling/createMessage",
+				"client:sampling/createMessage:mcp.SamplingResult",
+				"client:tools/call:json.RawMessage",
+				"client:logging/setLevel",
+				"client:logging/setLevel:json.RawMessage",
+			}
+			if got := recorder.recorded(); !slices.Equal(got, want) {
+				t.Errorf("expected records %v, got %v", want, got)
+			}
+		}))
+	}
+}
+
+func TestClientMiddlewareErrors(t *testing.T) {
+	for _, transportName := range []string{"SSE", "StreamableHTTP", "StdIO"} {
+		registry := mcp.NewRegistry()
+		registry.AddTool(mcp.Tool{Name: "sample"},
+			func(ctx context.Context, _ mcp.CallToolParams, _ mcp.ProgressReporter, _ mcp.RequestClientFunc) (
+				mcp.CallToolResult, error,
+			) {
+				_, err := mcp.CreateMessage(ctx, mcp.SamplingParams{})
+				var jsonErr mcp.JSONRPCError
+				if !errors.As(err, &jsonErr) {
+					return mcp.CallToolResult{}, fmt.Errorf("expected the error response, got %v", err)
+				}
+				text := fmt.Sprintf("%d:%s", jsonErr.Code, jsonErr.Message)
+				return mcp.CallToolResult{Content: []mcp.Content{{Type: mcp.ContentTypeText, Text: text}}}, nil
+			})
+
+		recorder := &middlewareRecorder{}
+		// The middleware fails the sampling with an error that isn't a JSONRPCError, and answers the
+		// prompts list without sending it to the server.
+		fail := func(next mcp.MessageHandler) mcp.MessageHandler {
+			return func(ctx context.Context, msg mcp.JSONRPCMessage) (any, error) {
+				switch msg.Method {
+				case mcp.MethodSamplingCreateMessage:
+					return nil, errors.New("sampling failed")
+				case mcp.MethodPromptsList:
+					return nil, mcp.JSONRPCError{Code: -32001, Message: "forbidden"}
+				default:
+					return next(ctx, msg)
+				}
+			}
+		}
+
+		cfg := testSuiteConfig{
+			transportName: transportName,
+			serverOptions: []mcp.ServerOption{mcp.WithToolServer(registry)},
+			clientOptions: []mcp.ClientOption{
+				mcp.WithSamplingHandler(&mockSamplingHandler{}),
+				mcp.WithClientMiddleware(recorder.middleware("client"), fail),
+			},
+		}
+
+		t.Run(transportName, testSuiteCase(cfg, func(t *testing.T, s *testSuite) {
+			defer registry.Close()
+
+			if s.clientConnectErr != nil {
+				t.Fatalf("failed to connect to server: %v", s.clientConnectErr)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			// The error of the middleware is answered to the server as an internal error.
+			result, err := s.mcpClient.CallTool(ctx, mcp.CallToolParams{Name: "sample"})
+			if err != nil {
+				t.Fatalf("failed to call tool: %v", err)
+			}
+			if want := "-32603:sampling failed"; len(result.Content) != 1 || result.Content[0].Text != want {
+				t.Errorf("expected the tool result %q, got %+v", want, result.Content)
+			}
+
+			// Every request of the batch passes through the middlewares.
+			results, err := s.mcpClient.Batch(ctx,
+				mcp.BatchRequest{Method: mcp.MethodToolsList, Params: mcp.ListToolsParams{}},
+				mcp.BatchRequest{Method: mcp.MethodPromptsList, Params: mcp.ListPromptsParams{}},
+			)
+			if err != nil {
+				t.Fatalf("failed to send batch: %v", err)
+			}
+			if results[0].Error != nil || len(results[0].Result) == 0 {
+				t.Errorf("expected the tools list result, got %+v", results[0])
+			}
+			if results[1].Error == nil || results[1].Error.Code != -32001 {
+				t.Errorf("expected the forbidden error, got %+v", results[1])
+			}
+
+			records := recorder.recorded()
+			for _, want := range []string{
+				"client:tools/list:json.RawMessage",
+				"client:prompts/list:<nil>",
+			} {
+				if !slices.Contains(records, want) {
+					t.Errorf("expected record %s, got %v", want, records)
+				}
+			}
+		}))
+	}
+}
@@ -0,0 +1,969 @@
+package mcp
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OAuthTokenSource implements the client side of the OAuth 2.1 authorization flow of the MCP
+// specification for the HTTP transports. It discovers the authorization server metadata of the MCP
+// server, obtains the access token with the authorization code grant protected by PKCE, and refreshes
+// the token when it expires or when the MCP server rejects it.
+//
+// The token source is plugged into SSEClient or StreamableHTTPClient through the *http.Client returned
+// by HTTPClient, that sets the Authorization header of every request, and retries the request once
+// with a renewed token when the server responds with 401 Unauthorized.
+//
+// Instances should be created using NewOAuthTokenSource, and are safe for concurrent use.
+type OAuthTokenSource struct {
+	serverURL  string
+	config     OAuthConfig
+	httpClient *http.Client
+	logger     *slog.Logger
+
+	mu       sync.Mutex
+	metadata *AuthorizationServerMetadata
+	token    *OAuthToken
+}
+
+// OAuthTokenSourceOption represents the options for the OAuthTokenSource.
+type OAuthTokenSourceOption func(*OAuthTokenSource)
+
+// OAuthConfig holds the client registration used by OAuthTokenSource.
+type OAuthConfig struct {
+	// ClientID is the identifier of the client registered in the authorization server.
+	ClientID string
+	// ClientSecret is the secret of a confidential client, it's sent with HTTP Basic authentication
+	// to the token endpoint. Public clients should leave it empty.
+	ClientSecret string
+	// RedirectURL is the URL the authorization server redirects the user-agent to, after the user
+	// authorizes the client.
+	RedirectURL string
+	// Scopes are the scopes requested by the client.
+	Scopes []string
+	// Authorize directs the user-agent to the authorization URL, and returns the URL the user-agent is
+	// redirected to, with the authorization code in its query. It's called when the token source
+	// doesn't have a token, or its token can't be refreshed.
+	Authorize OAuthAuthorizer
+}
+
+// OAuthAuthorizer directs the user-agent to authorizationURL, and returns the redirect URL, including
+// its query, received by the client when the user-agent is redirected back.
+type OAuthAuthorizer func(ctx context.Context, authorizationURL string) (redirectURL string, err error)
+
+// OAuthToken is the token obtained from the authorization server.
+type OAuthToken struct {
+	AccessToken  string
+	TokenType    string
+	RefreshToken string
+	// Expiry is the time the access token expires, it's zero if the authorization server doesn't
+	// specify the lifetime of the token.
+	Expiry time.Time
+}
+
+// AuthorizationServerMetadata is the OAuth 2.0 Authorization Server Metadata, as defined in RFC 8414.
+type AuthorizationServerMetadata struct {
+	Issuer                            string   `json:"issuer,omitempty"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	RegistrationEndpoint              string   `json:"registration_endpoint,omitempty"`
+	ScopesSupported                   []string `json:"scopes_supported,omitempty"`
+	ResponseTypesSupported            []string `json:"response_types_supported,omitempty"`
+	GrantTypesSupported               []string `json:"grant_types_supported,omitempty"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported,omitempty"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported,omitempty"`
+}
+
+// OAuthError is the error response of the authorization server, as defined in RFC 6749.
+type OAuthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+// TokenVerifier verifies the bearer tokens received by the MCP server, and returns the claims of
+// the token. JWTVerifier is the implementation for the self-contained JWT access tokens.
+type TokenVerifier interface {
+	VerifyToken(ctx context.Context, token string) (map[string]any, error)
+}
+
+// JWTVerifier verifies the JWT access tokens signed with RS256, RS384, RS512, ES256, ES384, ES512,
+// HS256, HS384 or HS512, against a set of known keys. It checks the signature and the exp and nbf
+// claims of the token, and the iss and aud claims if they're configured.
+//
+// Instances should be created using NewJWKSVerifier or NewStaticKeyVerifier.
+type JWTVerifier struct {
+	keys     map[string]any
+	issuer   string
+	audience string
+	leeway   time.Duration
+	now      func() time.Time
+}
+
+// JWTVerifierOption represents the options for the JWTVerifier.
+type JWTVerifierOption func(*JWTVerifier)
+
+// JSONWebKeySet is a JSON Web Key Set, as defined in RFC 7517.
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// JSONWebKey is a public key in the JSON Web Key format, as defined in RFC 7517. The RSA keys use the
+// N and E fields, and the EC keys use the Crv, X and Y fields.
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// BearerTokenError is returned by the authenticator created by NewBearerTokenAuthenticator when the
+// request is rejected. SSEServer responds to the request with the status and the WWW-Authenticate
+// challenge of the error, as defined in RFC 6750.
+type BearerTokenError struct {
+	// Code is the error code of the challenge, such as invalid_token. It's empty when the request
+	// doesn't carry a token.
+	Code        string
+	Description string
+	// Scope is the scope required to access the resource, it's only set for insufficient_scope.
+	Scope string
+
+	realm string
+}
+
+// BearerTokenOption represents the options for the authenticator created by
+// NewBearerTokenAuthenticator.
+type BearerTokenOption func(*bearerTokenAuthenticator)
+
+type bearerTokenAuthenticator struct {
+	verifier TokenVerifier
+	realm    string
+	scopes   []string
+}
+
+type oauthTransport struct {
+	source *OAuthTokenSource
+	next   http.RoundTripper
+}
+
+// oauthProtocolVersionContextKey carries the protocol version of the request that triggers the
+// metadata discovery, which is only known once the client is initialized.
+type oauthProtocolVersionContextKey struct{}
+
+type oauthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+const (
+	// oauthExpiryDelta is subtracted from the expiry of the token, so the token is refreshed before
+	// the server rejects it.
+	oauthExpiryDelta = 10 * time.Second
+
+	defaultJWTVerifierLeeway = time.Minute
+)
+
+var (
+	errInvalidJWT = errors.New("invalid JWT")
+	errJWTExpired = errors.New("JWT is expired")
+)
+
+// NewOAuthTokenSource creates an OAuthTokenSource for the MCP server at serverURL. The authorization
+// server metadata is discovered from the /.well-known/oauth-authorization-server path of the origin
+// of serverURL, and falls back to the /authorize and /token endpoints of the origin if the MCP server
+// doesn't provide the metadata.
+func NewOAuthTokenSource(serverURL string, config OAuthConfig, options ...OAuthTokenSourceOption) *OAuthTokenSource {
+	o := &OAuthTokenSource{
+		serverURL:  serverURL,
+		config:     config,
+		httpClient: http.DefaultClient,
+		logger:     slog.Default(),
+	}
+	for _, opt := range options {
+		opt(o)
+	}
+
+	return o
+}
+
+// WithOAuthTokenSourceHTTPClient sets the HTTP client used to communicate with the authorization
+// server. If not set, http.DefaultClient is used.
+func WithOAuthTokenSourceHTTPClient(client *http.Client) OAuthTokenSourceOption {
+	return func(o *OAuthTokenSource) {
+		o.httpClient = client
+	}
+}
+
+// WithOAuthTokenSourceToken sets the token previously obtained by the client, so the authorization
+// flow is only started if the token can't be refreshed.
+func WithOAuthTokenSourceToken(token OAuthToken) OAuthTokenSourceOption {
+	return func(o *OAuthTokenSource) {
+		o.token = &token
+	}
+}
+
+// WithOAuthTokenSourceLogger sets the logger for the OAuthTokenSource.
+func WithOAuthTokenSourceLogger(logger *slog.Logger) OAuthTokenSourceOption {
+	return func(o *OAuthTokenSource) {
+		o.logger = logger.With(slog.String("package", "go-mcp"), slog.String("component", "oauth-token-source"))
+	}
+}
+
+// NewJWKSVerifier creates a JWTVerifier that verifies the tokens against the keys of the JSON Web Key
+// Set. The key is selected by the kid header of the token, or the only key of the set if the token
+// doesn't have the kid header. It returns an error if any of the keys can't be parsed.
+func NewJWKSVerifier(jwks JSONWebKeySet, options ...JWTVerifierOption) (JWTVerifier, error) {
+	keys := make(map[string]any, len(jwks.Keys))
+	for i, jwk := range jwks.Keys {
+		key, err := jwk.publicKey()
+		if err != nil {
+			return JWTVerifier{}, fmt.Errorf("failed to parse key %d: %w", i, err)
+		}
+		keys[jwk.Kid] = key
+	}
+
+	return newJWTVerifier(keys, options...), nil
+}
+
+// NewStaticKeyVerifier creates a JWTVerifier that verifies the tokens against a single key, regardless
+// of the kid header of the token. The key must be *rsa.PublicKey, *ecdsa.PublicKey, or the []byte
+// secret of the HMAC algorithms.
+func NewStaticKeyVerifier(key any, options ...JWTVerifierOption) (JWTVerifier, error) {
+	switch key.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey, []byte:
+	default:
+		return JWTVerifier{}, fmt.Errorf("unsupported key type %T", key)
+	}
+
+	return newJWTVerifier(map[string]any{"": key}, options...), nil
+}
+
+// WithJWTVerifierIssuer sets the expected iss claim of the tokens.
+func WithJWTVerifierIssuer(issuer string) JWTVerifierOption {
+	return func(v *JWTVerifier) {
+		v.issuer = issuer
+	}
+}
+
+// WithJWTVerifierAudience sets the expected aud claim of the tokens, usually the URL of the MCP server.
+func WithJWTVerifierAudience(audience string) JWTVerifierOption {
+	return func(v *JWTVerifier) {
+		v.audience = audience
+	}
+}
+
+// WithJWTVerifierLeeway sets the tolerated clock skew when checking the exp and nbf claims. If not set,
+// the default leeway is one minute.
+func WithJWTVerifierLeeway(leeway time.Duration) JWTVerifierOption {
+	return func(v *JWTVerifier) {
+		v.leeway = leeway
+	}
+}
+
+// NewBearerTokenAuthenticator creates an SSEAuthenticator that validates the bearer token of the
+// requests with the verifier. The principal of the client is identified by the sub claim of the
+// token, and the claims of the token are exposed in the Attributes of the principal, so the server
+// implementations may read them through PrincipalFromContext.
+//
+// The rejected requests are answered with the WWW-Authenticate challenge of RFC 6750, so the clients
+// using OAuthTokenSource are able to obtain a new token.
+func NewBearerTokenAuthenticator(verifier TokenVerifier, options ...BearerTokenOption) SSEAuthenticator {
+	b := bearerTokenAuthenticator{verifier: verifier}
+	for _, opt := range options {
+		opt(&b)
+	}
+
+	return b.authenticate
+}
+
+// WithBearerTokenRealm sets the realm of the WWW-Authenticate challenge.
+func WithBearerTokenRealm(realm string) BearerTokenOption {
+	return func(b *bearerTokenAuthenticator) {
+		b.realm = realm
+	}
+}
+
+// WithBearerTokenScopes sets the scopes the token must be granted, in its space-separated scope
+// claim. The requests with a token that lacks any of the scopes are rejected with 403 Forbidden.
+func WithBearerTokenScopes(scopes ...string) BearerTokenOption {
+	return func(b *bearerTokenAuthenticator) {
+		b.scopes = scopes
+	}
+}
+
+// HTTPClient returns an HTTP client that authorizes its requests with the token of the source. The
+// requests are sent with the transport of base, or http.DefaultTransport if base or its transport is
+// nil. The returned client is meant to be passed to NewSSEClient or NewStreamableHTTPClient.
+func (o *OAuthTokenSource) HTTPClient(base *http.Client) *http.Client {
+	cli := &http.Client{}
+	if base != nil {
+		*cli = *base
+	}
+	next := cli.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	cli.Transport = oauthTransport{source: o, next: next}
+
+	return cli
+}
+
+// Token returns a valid token. The cached token is returned if it's not expired, otherwise the token
+// is refreshed, and the authorization flow is started if the token can't be refreshed.
+func (o *OAuthTokenSource) Token(ctx context.Context) (OAuthToken, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.token != nil && (o.token.Expiry.IsZero() || time.Now().Add(oauthExpiryDelta).Before(o.token.Expiry)) {
+		return *o.token, nil
+	}
+
+	return o.renewToken(ctx)
+}
+
+// Metadata returns the authorization server metadata of the MCP server, the metadata is discovered
+// once and cached by the token source.
+func (o *OAuthTokenSource) Metadata(ctx context.Context) (AuthorizationServerMetadata, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.discoverMetadata(ctx)
+}
+
+// invalidateToken renews the token after the server rejected it. The token is only renewed if it's
+// still the current token, so the concurrent requests rejected with the same token only renew it once.
+func (o *OAuthTokenSource) invalidateToken(ctx context.Context, rejected string) (OAuthToken, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.token != nil && o.token.AccessToken != rejected {
+		return *o.token, nil
+	}
+
+	return o.renewToken(ctx)
+}
+
+func (o *OAuthTokenSource) renewToken(ctx context.Context) (OAuthToken, error) {
+	if o.token != nil && o.token.RefreshToken != "" {
+		token, err := o.refreshToken(ctx, o.token.RefreshToken)
+		if err == nil {
+			o.token = &token
+			return token, nil
+		}
+		o.logger.Warn("failed to refresh token, starting authorization flow", slog.String("err", err.Error()))
+	}
+
+	token, err := o.authorize(ctx)
+	if err != nil {
+		o.token = nil
+		return OAuthToken{}, err
+	}
+	o.token = &token
+
+	return token, nil
+}
+
+func (o *OAuthTokenSource) discoverMetadata(ctx context.Context) (AuthorizationServerMetadata, error) {
+	if o.metadata != nil {
+		return *o.metadata, nil
+	}
+
+	u, err := url.Parse(o.serverURL)
+	if err != nil {
+		return AuthorizationServerMetadata{}, fmt.Errorf("failed to parse server URL: %w", err)
+	}
+	baseURL := u.Scheme + "://" + u.Host
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/.well-known/oauth-authorization-server", nil)
+	if err != nil {
+		return AuthorizationServerMetadata{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	// The version is only sent once it's negotiated, the discovery before the initialization doesn't
+	// know the version the server will agree on.
+	if version, _ := ctx.Value(oauthProtocolVersionContextKey{}).(string); version != "" {
+		req.Header.Set(protocolVersionHeader, version)
+	}
+
+	resp, err := o.httpClient.Do(req)
+	if err != nil {
+		return AuthorizationServerMetadata{}, fmt.Errorf("failed to fetch authorization server metadata: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var metadata AuthorizationServerMetadata
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if err := json.NewDecoder(resp.Body).Decode(&metadata); err != nil {
+			return AuthorizationServerMetadata{}, fmt.Errorf("failed to decode authorization server metadata: %w", err)
+		}
+		if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" {
+			return AuthorizationServerMetadata{}, errors.New("authorization server metadata is missing required endpoints")
+		}
+	case http.StatusNotFound:
+		// The server doesn't support the metadata discovery, so the default endpoints are used.
+		metadata = AuthorizationServerMetadata{
+			AuthorizationEndpoint: baseURL + "/authorize",
+			TokenEndpoint:         baseURL + "/token",
+			RegistrationEndpoint:  baseURL + "/register",
+		}
+	default:
+		return AuthorizationServerMetadata{}, fmt.Errorf("unexpected status code fetching metadata: %d", resp.StatusCode)
+	}
+	o.metadata = &metadata
+
+	return metadata, nil
+}
+
+func (o *OAuthTokenSource) authorize(ctx context.Context) (OAuthToken, error) {
+	if o.config.Authorize == nil {
+		return OAuthToken{}, errors.New("authorization is required, but the authorizer is not set")
+	}
+	metadata, err := o.discoverMetadata(ctx)
+	if err != nil {
+		return OAuthToken{}, err
+	}
+
+	verifier, err := randomURLString(32)
+	if err != nil {
+		return OAuthToken{}, fmt.Errorf("failed to generate code verifier: %w", err)
+	}
+	state, err := randomURLString(16)
+	if err != nil {
+		return OAuthToken{}, fmt.Errorf("failed to generate state: %w", err)
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+
+	authURL, err := url.Parse(metadata.AuthorizationEndpoint)
+	if err != nil {
+		return OAuthToken{}, fmt.Errorf("failed to parse authorization endpoint: %w", err)
+	}
+	query := authURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", o.config.ClientID)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+	query.Set("state", state)
+	if o.config.RedirectURL != "" {
+		query.Set("redirect_uri", o.config.RedirectURL)
+	}
+	if len(o.config.Scopes) > 0 {
+		query.Set("scope", strings.Join(o.config.Scopes, " "))
+	}
+	authURL.RawQuery = query.Encode()
+
+	redirectURL, err := o.config.Authorize(ctx, authURL.String())
+	if err != nil {
+		return OAuthToken{}, fmt.Errorf("failed to authorize: %w", err)
+	}
+	code, err := authorizationCode(redirectURL, state)
+	if err != nil {
+		return OAuthToken{}, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("code_verifier", verifier)
+	if o.config.RedirectURL != "" {
+		form.Set("redirect_uri", o.config.RedirectURL)
+	}
+
+	return o.requestToken(ctx, metadata.TokenEndpoint, form)
+}
+
+func (o *OAuthTokenSource) refreshToken(ctx context.Context, refreshToken string) (OAuthToken, error) {
+	metadata, err := o.discoverMetadata(ctx)
+	if err != nil {
+		return OAuthToken{}, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", refreshToken)
+	if len(o.config.Scopes) > 0 {
+		form.Set("scope", strings.Join(o.config.Scopes, " "))
+	}
+
+	token, err := o.requestToken(ctx, metadata.TokenEndpoint, form)
+	if err != nil {
+		return OAuthToken{}, err
+	}
+	// The authorization server may not rotate the refresh token.
+	if token.RefreshToken == "" {
+		token.RefreshToken = refreshToken
+	}
+
+	return token, nil
+}
+
+func (o *OAuthTokenSource) requestToken(ctx context.Context, endpoint string, form url.Values) (OAuthToken, error) {
+	if o.config.ClientSecret == "" {
+		form.Set("client_id", o.config.ClientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return OAuthToken{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if o.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(o.config.ClientID), url.QueryEscape(o.config.ClientSecret))
+	}
+
+	resp, err := o.httpClient.Do(req)
+	if err != nil {
+		return OAuthToken{}, fmt.Errorf("failed to request token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var oauthErr OAuthError
+		if err := json.NewDecoder(resp.Body).Decode(&oauthErr); err == nil && oauthErr.Code != "" {
+			return OAuthToken{}, oauthErr
+		}
+		return OAuthToken{}, fmt.Errorf("unexpected status code requesting token: %d", resp.StatusCode)
+	}
+
+	var tokenResp oauthTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return OAuthToken{}, fmt.Errorf("failed to decode token response: %w", err)
+	}
+	if tokenResp.AccessToken == "" {
+		return OAuthToken{}, errors.New("token response is missing access_token")
+	}
+
+	token := OAuthToken{
+		AccessToken:  tokenResp.AccessToken,
+		TokenType:    tokenResp.TokenType,
+		RefreshToken: tokenResp.RefreshToken,
+	}
+	if tokenResp.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
+	}
+
+	return token, nil
+}
+
+func (e OAuthError) Error() string {
+	if e.Description == "" {
+		return fmt.Sprintf("oauth error: %s", e.Code)
+	}
+	return fmt.Sprintf("oauth error: %s: %s", e.Code, e.Description)
+}
+
+func (e *BearerTokenError) Error() string {
+	if e.Code == "" {
+		return "missing bearer token"
+	}
+	if e.Description == "" {
+		return e.Code
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Description)
+}
+
+// VerifyToken verifies the signature and the claims of the JWT, and returns its claims.
+func (v JWTVerifier) VerifyToken(_ context.Context, token string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", errInvalidJWT)
+	}
+
+	var header jwtHeader
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: invalid header: %w", errInvalidJWT, err)
+	}
+	key, err := v.key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid signature encoding: %w", errInvalidJWT, err)
+	}
+	if err := verifyJWTSignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]any
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: invalid claims: %w", errInvalidJWT, err)
+	}
+	if err := v.validateClaims(claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func (v JWTVerifier) key(kid string) (any, error) {
+	if key, ok := v.keys[kid]; ok {
+		return key, nil
+	}
+	// A static key, or the only key of the set, is used regardless of the kid of the token.
+	if len(v.keys) == 1 {
+		for k, key := range v.keys {
+			if k == "" || kid == "" {
+				return key, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("%w: unknown key %q", errInvalidJWT, kid)
+}
+
+func (v JWTVerifier) validateClaims(claims map[string]any) error {
+	now := v.now()
+
+	if exp, ok := claims["exp"].(float64); ok {
+		if now.After(time.Unix(int64(exp), 0).Add(v.leeway)) {
+			return errJWTExpired
+		}
+	} else if _, present := claims["exp"]; present {
+		return fmt.Errorf("%w: invalid exp claim", errInvalidJWT)
+	}
+	if nbf, ok := claims["nbf"].(float64); ok {
+		if now.Add(v.leeway).Before(time.Unix(int64(nbf), 0)) {
+			return fmt.Errorf("%w: token is not valid yet", errInvalidJWT)
+		}
+	}
+	if v.issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != v.issuer {
+			return fmt.Errorf("%w: unexpected issuer %q", errInvalidJWT, iss)
+		}
+	}
+	if v.audience != "" && !jwtAudienceContains(claims["aud"], v.audience) {
+		return fmt.Errorf("%w: token is not issued for audience %q", errInvalidJWT, v.audience)
+	}
+
+	return nil
+}
+
+func (b bearerTokenAuthenticator) authenticate(r *http.Request) (Principal, error) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return Principal{}, b.challenge(&BearerTokenError{})
+	}
+
+	claims, err := b.verifier.VerifyToken(r.Context(), token)
+	if err != nil {
+		return Principal{}, b.challenge(&BearerTokenError{Code: "invalid_token", Description: err.Error()})
+	}
+
+	granted := strings.Fields(fmt.Sprint(claims["scope"]))
+	for _, scope := range b.scopes {
+		if !containsString(granted, scope) {
+			return Principal{}, b.challenge(&BearerTokenError{
+				Code:        "insufficient_scope",
+				Description: fmt.Sprintf("token is missing scope %q", scope),
+				Scope:       strings.Join(b.scopes, " "),
+			})
+		}
+	}
+
+	sub, _ := claims["sub"].(string)
+	if sub == "" {
+		return Principal{}, b.challenge(&BearerTokenError{Code: "invalid_token", Description: "token is missing sub claim"})
+	}
+
+	return Principal{ID: sub, Attributes: claims}, nil
+}
+
+func (b bearerTokenAuthenticator) challenge(err *BearerTokenError) error {
+	err.realm = b.realm
+	return err
+}
+
+// challenge returns the value of the WWW-Authenticate header for the error.
+func (e *BearerTokenError) challenge() string {
+	var params []string
+	if e.realm != "" {
+		params = append(params, fmt.Sprintf("realm=%q", e.realm))
+	}
+	if e.Code != "" {
+		params = append(params, fmt.Sprintf("error=%q", e.Code))
+	}
+	if e.Description != "" {
+		params = append(params, fmt.Sprintf("error_description=%q", e.Description))
+	}
+	if e.Scope != "" {
+		params = append(params, fmt.Sprintf("scope=%q", e.Scope))
+	}
+	if len(params) == 0 {
+		return "Bearer"
+	}
+
+	return "Bearer " + strings.Join(params, ", ")
+}
+
+// statusCode returns the status of the response for the error, as defined in RFC 6750.
+func (e *BearerTokenError) statusCode() int {
+	switch e.Code {
+	case "invalid_request":
+		return http.StatusBadRequest
+	case "insufficient_scope":
+		return http.StatusForbidden
+	default:
+		return http.StatusUnauthorized
+	}
+}
+
+func (t oauthTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	ctx := r.Context()
+	if version := r.Header.Get(protocolVersionHeader); version != "" {
+		ctx = context.WithValue(ctx, oauthProtocolVersionContextKey{}, version)
+	}
+
+	token, err := t.source.Token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain token: %w", err)
+	}
+
+	resp, err := t.next.RoundTrip(authorizedRequest(r, token))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	// The request is only retried if its body can be sent again.
+	if r.Body != nil && r.Body != http.NoBody && r.GetBody == nil {
+		return resp, nil
+	}
+
+	renewed, err := t.source.invalidateToken(ctx, token.AccessToken)
+	if err != nil {
+		t.source.logger.Warn("failed to renew rejected token", slog.String("err", err.Error()))
+		return resp, nil
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	retry := authorizedRequest(r, renewed)
+	if r.GetBody != nil {
+		body, err := r.GetBody()
+		if err != nil {
+			return nil, fmt.Errorf("failed to rewind request body: %w", err)
+		}
+		retry.Body = body
+	}
+
+	return t.next.RoundTrip(retry)
+}
+
+func authorizedRequest(r *http.Request, token OAuthToken) *http.Request {
+	req := r.Clone(r.Context())
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	return req
+}
+
+func authorizationCode(redirectURL, state string) (string, error) {
+	u, err := url.Parse(redirectURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse redirect URL: %w", err)
+	}
+	query := u.Query()
+	if code := query.Get("error"); code != "" {
+		return "", OAuthError{Code: code, Description: query.Get("error_description")}
+	}
+	if subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(state)) != 1 {
+		return "", errors.New("authorization state mismatch")
+	}
+	code := query.Get("code")
+	if code == "" {
+		return "", errors.New("redirect URL is missing authorization code")
+	}
+
+	return code, nil
+}
+
+func randomURLString(size int) (string, error) {
+	bs := make([]byte, size)
+	if _, err := rand.Read(bs); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(bs), nil
+}
+
+func newJWTVerifier(keys map[string]any, options ...JWTVerifierOption) JWTVerifier {
+	v := JWTVerifier{
+		keys:   keys,
+		leeway: defaultJWTVerifierLeeway,
+		now:    time.Now,
+	}
+	for _, opt := range options {
+		opt(&v)
+	}
+
+	return v
+}
+
+func decodeJWTPart(part string, v any) error {
+	bs, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(bs, v)
+}
+
+func verifyJWTSignature(alg string, key any, signed, signature []byte) error {
+	var hash crypto.Hash
+	switch alg[min(2, len(alg)):] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("%w: unsupported algorithm %q", errInvalidJWT, alg)
+	}
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	var valid bool
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		valid = strings.HasPrefix(alg, "RS") && rsa.VerifyPKCS1v15(k, hash, digest, signature) == nil
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if strings.HasPrefix(alg, "ES") && len(signature) == 2*size && k.Curve == jwtCurve(hash) {
+			r := new(big.Int).SetBytes(signature[:size])
+			s := new(big.Int).SetBytes(signature[size:])
+			valid = ecdsa.Verify(k, digest, r, s)
+		}
+	case []byte:
+		if strings.HasPrefix(alg, "HS") {
+			mac := hmac.New(hash.New, k)
+			mac.Write(signed)
+			valid = hmac.Equal(mac.Sum(nil), signature)
+		}
+	}
+	if !valid {
+		return fmt.Errorf("%w: signature verification failed", errInvalidJWT)
+	}
+
+	return nil
+}
+
+func jwtCurve(hash crypto.Hash) elliptic.Curve {
+	switch hash {
+	case crypto.SHA384:
+		return elliptic.P384()
+	case crypto.SHA512:
+		return elliptic.P521()
+	default:
+		return elliptic.P256()
+	}
+}
+
+func jwtAudienceContains(aud any, audience string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == audience
+	case []any:
+		for _, a := range aud {
+			if s, ok := a.(string); ok && s == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (k JSONWebKey) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus: %w", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent: %w", err)
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 || exponent.Int64() < 3 {
+			return nil, errors.New("invalid exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x coordinate: %w", err)
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y coordinate: %w", err)
+		}
+		// The coordinates are encoded in the uncompressed form, so the point is checked to be on the
+		// curve when it's parsed.
+		size := (curve.Params().BitSize + 7) / 8
+		if len(x) > size || len(y) > size {
+			return nil, errors.New("invalid coordinates")
+		}
+		point := make([]byte, 1+2*size)
+		point[0] = 4
+		copy(point[1+size-len(x):1+size], x)
+		copy(point[1+2*size-len(y):], y)
+		return parseECDSAPublicKey(curve, point)
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func parseECDSAPublicKey(curve elliptic.Curve, point []byte) (*ecdsa.PublicKey, error) {
+	//nolint:staticcheck // The ecdsa package has no other way to build the key from its coordinates.
+	x, y := elliptic.Unmarshal(curve, point)
+	if x == nil {
+		return nil, errors.New("point is not on the curve")
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
@@ -0,0 +1,561 @@
+package mcp_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MegaGrindStone/go-mcp"
+)
+
+func TestJWTVerifier(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate EC key: %v", err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+	secret := []byte("test-secret")
+
+	jwksVerifier, err := mcp.NewJWKSVerifier(mcp.JSONWebKeySet{Keys: []mcp.JSONWebKey{
+		rsaJWK("rsa-key", &rsaKey.PublicKey),
+		ecJWK("ec-key", &ecKey.PublicKey),
+	}}, mcp.WithJWTVerifierIssuer("https://auth.example.com"), mcp.WithJWTVerifierAudience("https://mcp.example.com"))
+	if err != nil {
+		t.Fatalf("failed to create JWKS verifier: %v", err)
+	}
+	hmacVerifier, err := mcp.NewStaticKeyVerifier(secret)
+	if err != nil {
+		t.Fatalf("failed to create static key verifier: %v", err)
+	}
+
+	validClaims := func() map[string]any {
+		return map[string]any{
+			"sub": "alice",
+			"iss": "https://auth.example.com",
+			"aud": []string{"https://mcp.example.com"},
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}
+	}
+	withClaim := func(key string, value any) map[string]any {
+		claims := validClaims()
+		claims[key] = value
+		return claims
+	}
+
+	tests := []struct {
+		name     string
+		verifier mcp.JWTVerifier
+		token    string
+		wantErr  bool
+	}{
+		{
+			name:     "RS256 with kid",
+			verifier: jwksVerifier,
+			token:    signJWT(t, "RS256", "rsa-key", rsaKey, validClaims()),
+		},
+		{
+			name:     "ES256 with kid",
+			verifier: jwksVerifier,
+			token:    signJWT(t, "ES256", "ec-key", ecKey, validClaims()),
+		},
+		{
+			name:     "HS256 with static key",
+			verifier: hmacVerifier,
+			token:    signJWT(t, "HS256", "", secret, validClaims()),
+		},
+		{
+			name:     "unknown kid",
+			verifier: jwksVerifier,
+			token:    signJWT(t, "RS256", "unknown", rsaKey, validClaims()),
+			wantErr:  true,
+		},
+		{
+			name:     "wrong signing key",
+			verifier: jwksVerifier,
+			token:    signJWT(t, "RS256", "rsa-key", otherKey, validClaims()),
+			wantErr:  true,
+		},
+		{
+			name:     "algorithm mismatch",
+			verifier: jwksVerifier,
+			token:    signJWT(t, "HS256", "rsa-key", secret, validClaims()),
+			wantErr:  true,
+		},
+		{
+			name:     "expired",
+			verifier: jwksVerifier,
+			token:    signJWT(t, "RS256", "rsa-key", rsaKey, withClaim("exp", time.Now().Add(-time.Hour).Unix())),
+			wantErr:  true,
+		},
+		{
+			name:     "wrong issuer",
+			verifier: jwksVerifier,
+			token:    signJWT(t, "RS256", "rsa-key", rsaKey, withClaim("iss", "https://evil.example.com")),
+			wantErr:  true,
+		},
+		{
+			name:     "wrong audience",
+			verifier: jwksVerifier,
+			token:    signJWT(t, "RS256", "rsa-key", rsaKey, withClaim("aud", "https://other.example.com")),
+			wantErr:  true,
+		},
+		{
+			name:     "malformed",
+			verifier: jwksVerifier,
+			token:    "not-a-jwt",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := tt.verifier.VerifyToken(context.Background(), tt.token)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected error, got claims %v", claims)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to verify token: %v", err)
+			}
+			if claims["sub"] != "alice" {
+				t.Errorf("expected sub alice, got %v", claims["sub"])
+			}
+		})
+	}
+}
+
+func TestOAuthAuthorization(t *testing.T) {
+	signingKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	testServer := httptest.NewServer(mux)
+	defer testServer.Close()
+
+	authServer := &mockAuthorizationServer{
+		issuer:     testServer.URL,
+		signingKey: signingKey,
+		codes:      make(map[string]string),
+	}
+	authServer.register(mux)
+
+	jwksVerifier, err := mcp.NewJWKSVerifier(mcp.JSONWebKeySet{Keys: []mcp.JSONWebKey{
+		rsaJWK("auth-key", &signingKey.PublicKey),
+	}}, mcp.WithJWTVerifierIssuer(testServer.URL))
+	if err != nil {
+		t.Fatalf("failed to create verifier: %v", err)
+	}
+	verifier := &revokingVerifier{TokenVerifier: jwksVerifier, revoked: make(map[string]bool)}
+
+	sseServer := mcp.NewSSEServer(testServer.URL+"/message",
+		mcp.WithSSEServerAuthenticator(mcp.NewBearerTokenAuthenticator(verifier,
+			mcp.WithBearerTokenRealm("mcp"), mcp.WithBearerTokenScopes("tools"))))
+	mux.Handle("/connect", sseServer.HandleSSE())
+	mux.Handle("/message", sseServer.HandleMessage())
+
+	toolServer := &mockToolServer{}
+	server := mcp.NewServer(mcp.Info{Name: "test-server", Version: "1.0"}, sseServer,
+		mcp.WithToolServer(toolServer))
+	go server.Serve()
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := server.Shutdown(ctx); err != nil {
+			t.Errorf("failed to shutdown server: %v", err)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The unauthenticated request should be challenged.
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, testServer.URL+"/connect", nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	resp, err := testServer.Client().Do(req)
+	if err != nil {
+		t.Fatalf("failed to send request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected status %d, got %d", http.StatusUnauthorized, resp.StatusCode)
+	}
+	if challenge := resp.Header.Get("WWW-Authenticate"); challenge != `Bearer realm="mcp"` {
+		t.Errorf("unexpected challenge %q", challenge)
+	}
+
+	tokenSource := mcp.NewOAuthTokenSource(testServer.URL+"/connect", mcp.OAuthConfig{
+		ClientID:    "test-client",
+		RedirectURL: "http://localhost/callback",
+		Scopes:      []string{"tools"},
+		Authorize:   followAuthorization(testServer.Client()),
+	}, mcp.WithOAuthTokenSourceHTTPClient(testServer.Client()))
+
+	client := mcp.NewClient(mcp.Info{Name: "test-client", Version: "1.0"},
+		mcp.NewSSEClient(testServer.URL+"/connect", tokenSource.HTTPClient(testServer.Client())))
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer func() {
+		if err := client.Disconnect(ctx); err != nil {
+			t.Errorf("failed to disconnect: %v", err)
+		}
+	}()
+
+	if _, err := client.CallTool(ctx, mcp.CallToolParams{Name: "test-tool"}); err != nil {
+		t.Fatalf("failed to call tool: %v", err)
+	}
+	if toolServer.principal.ID != "alice" {
+		t.Errorf("expected principal alice, got %+v", toolServer.principal)
+	}
+	if scope := toolServer.principal.Attributes["scope"]; scope != "tools" {
+		t.Errorf("expected scope claim tools, got %v", scope)
+	}
+
+	// The rejected token should be refreshed, and the request retried with the new token.
+	token, err := tokenSource.Token(ctx)
+	if err != nil {
+		t.Fatalf("failed to get token: %v", err)
+	}
+	verifier.revoke(token.AccessToken)
+
+	if _, err := client.CallTool(ctx, mcp.CallToolParams{Name: "test-tool"}); err != nil {
+		t.Fatalf("failed to call tool after token revocation: %v", err)
+	}
+	refreshed, err := tokenSource.Token(ctx)
+	if err != nil {
+		t.Fatalf("failed to get token: %v", err)
+	}
+	if refreshed.AccessToken == token.AccessToken {
+		t.Error("expected token to be refreshed")
+	}
+	if authorizations, refreshes := authServer.grants(); authorizations != 1 || refreshes != 1 {
+		t.Errorf("expected 1 authorization and 1 refresh, got %d and %d", authorizations, refreshes)
+	}
+}
+
+func TestOAuthTokenSourceDefaultEndpoints(t *testing.T) {
+	mux := http.NewServeMux()
+	testServer := httptest.NewServer(mux)
+	defer testServer.Close()
+
+	tokenSource := mcp.NewOAuthTokenSource(testServer.URL+"/mcp", mcp.OAuthConfig{ClientID: "test-client"},
+		mcp.WithOAuthTokenSourceHTTPClient(testServer.Client()))
+
+	metadata, err := tokenSource.Metadata(context.Background())
+	if err != nil {
+		t.Fatalf("failed to discover metadata: %v", err)
+	}
+	if metadata.AuthorizationEndpoint != testServer.URL+"/authorize" {
+		t.Errorf("unexpected authorization endpoint %q", metadata.AuthorizationEndpoint)
+	}
+	if metadata.TokenEndpoint != testServer.URL+"/token" {
+		t.Errorf("unexpected token endpoint %q", metadata.TokenEndpoint)
+	}
+
+	// Without the authorizer, the token source can't obtain a token.
+	if _, err := tokenSource.Token(context.Background()); err == nil {
+		t.Error("expected error without authorizer")
+	}
+}
+
+func TestOAuthTokenSourceProtocolVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+	}{
+		{name: "before initialization", version: ""},
+		{name: "after initialization", version: mcp.ProtocolVersion20241105},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			discovered := make(chan string, 1)
+			mux := http.NewServeMux()
+			mux.HandleFunc("/.well-known/oauth-authorization-server", func(w http.ResponseWriter, r *http.Request) {
+				discovered <- r.Header.Get("MCP-Protocol-Version")
+				http.NotFound(w, r)
+			})
+			testServer := httptest.NewServer(mux)
+			defer testServer.Close()
+
+			// The authorization is declined, but the metadata is discovered first.
+			tokenSource := mcp.NewOAuthTokenSource(testServer.URL+"/mcp", mcp.OAuthConfig{
+				ClientID: "test-client",
+				Authorize: func(context.Context, string) (string, error) {
+					return "", errors.New("declined")
+				},
+			}, mcp.WithOAuthTokenSourceHTTPClient(testServer.Client()))
+			req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, testServer.URL+"/mcp", nil)
+			if err != nil {
+				t.Fatalf("failed to create request: %v", err)
+			}
+			if tc.version != "" {
+				req.Header.Set("MCP-Protocol-Version", tc.version)
+			}
+			if resp, err := tokenSource.HTTPClient(testServer.Client()).Do(req); err == nil {
+				resp.Body.Close()
+				t.Fatal("expected error for the declined authorization")
+			}
+
+			if got := <-discovered; got != tc.version {
+				t.Errorf("expected the protocol version header %q, got %q", tc.version, got)
+			}
+		})
+	}
+}
+
+// mockAuthorizationServer is an authorization server that issues the JWT access tokens for alice, and
+// checks the PKCE code verifier of the token requests.
+type mockAuthorizationServer struct {
+	issuer     string
+	signingKey *rsa.PrivateKey
+
+	lock           sync.Mutex
+	codes          map[string]string // code -> code challenge
+	issued         int
+	authorizations int
+	refreshes      int
+}
+
+func (m *mockAuthorizationServer) register(mux *http.ServeMux) {
+	mux.HandleFunc("/.well-known/oauth-authorization-server", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(mcp.AuthorizationServerMetadata{
+			Issuer:                        m.issuer,
+			AuthorizationEndpoint:         m.issuer + "/oauth/authorize",
+			TokenEndpoint:                 m.issuer + "/oauth/token",
+			CodeChallengeMethodsSupported: []string{"S256"},
+		})
+	})
+	mux.HandleFunc("/oauth/authorize", m.handleAuthorize)
+	mux.HandleFunc("/oauth/token", m.handleToken)
+}
+
+func (m *mockAuthorizationServer) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		http.Error(w, "PKCE is required", http.StatusBadRequest)
+		return
+	}
+
+	m.lock.Lock()
+	code := fmt.Sprintf("code-%d", len(m.codes))
+	m.codes[code] = query.Get("code_challenge")
+	m.lock.Unlock()
+
+	redirect, _ := url.Parse(query.Get("redirect_uri"))
+	redirect.RawQuery = url.Values{"code": {code}, "state": {query.Get("state")}}.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (m *mockAuthorizationServer) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		challenge, ok := m.codes[r.PostForm.Get("code")]
+		verifierHash := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if !ok || base64.RawURLEncoding.EncodeToString(verifierHash[:]) != challenge {
+			writeOAuthError(w, "invalid_grant")
+			return
+		}
+		delete(m.codes, r.PostForm.Get("code"))
+		m.authorizations++
+	case "refresh_token":
+		if r.PostForm.Get("refresh_token") != "refresh-alice" {
+			writeOAuthError(w, "invalid_grant")
+			return
+		}
+		m.refreshes++
+	default:
+		writeOAuthError(w, "unsupported_grant_type")
+		return
+	}
+
+	m.issued++
+	accessToken, err := signJWTWith("RS256", "auth-key", m.signingKey, map[string]any{
+		"sub":   "alice",
+		"iss":   m.issuer,
+		"scope": "tools",
+		"jti":   fmt.Sprintf("token-%d", m.issued),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"access_token":  accessToken,
+		"token_type":    "Bearer",
+		"refresh_token": "refresh-alice",
+		"expires_in":    3600,
+	})
+}
+
+func (m *mockAuthorizationServer) grants() (int, int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.authorizations, m.refreshes
+}
+
+// revokingVerifier rejects the revoked tokens, before verifying them with the embedded TokenVerifier.
+type revokingVerifier struct {
+	mcp.TokenVerifier
+
+	lock    sync.Mutex
+	revoked map[string]bool
+}
+
+func (r *revokingVerifier) VerifyToken(ctx context.Context, token string) (map[string]any, error) {
+	r.lock.Lock()
+	revoked := r.revoked[token]
+	r.lock.Unlock()
+	if revoked {
+		return nil, errors.New("token is revoked")
+	}
+	return r.TokenVerifier.VerifyToken(ctx, token)
+}
+
+func (r *revokingVerifier) revoke(token string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.revoked[token] = true
+}
+
+// followAuthorization returns an authorizer that acts as the user-agent approving the authorization,
+// by following the authorization URL until the authorization server redirects it to the client.
+func followAuthorization(httpClient *http.Client) mcp.OAuthAuthorizer {
+	return func(ctx context.Context, authorizationURL string) (string, error) {
+		cli := *httpClient
+		cli.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, authorizationURL, nil)
+		if err != nil {
+			return "", err
+		}
+		resp, err := cli.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusFound {
+			return "", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		}
+		return resp.Header.Get("Location"), nil
+	}
+}
+
+func writeOAuthError(w http.ResponseWriter, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	_ = json.NewEncoder(w).Encode(mcp.OAuthError{Code: code})
+}
+
+func signJWT(t *testing.T, alg, kid string, key any, claims map[string]any) string {
+	t.Helper()
+
+	token, err := signJWTWith(alg, kid, key, claims)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return token
+}
+
+func signJWTWith(alg, kid string, key any, claims map[string]any) (string, error) {
+	header := map[string]string{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		header["kid"] = kid
+	}
+	headerBs, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	claimsBs, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := base64.RawURLEncoding.EncodeToString(headerBs) + "." + base64.RawURLEncoding.EncodeToString(claimsBs)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, k, digest[:])
+		if err == nil {
+			signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+		}
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	default:
+		err = fmt.Errorf("unsupported key type %T", key)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func rsaJWK(kid string, key *rsa.PublicKey) mcp.JSONWebKey {
+	return mcp.JSONWebKey{
+		Kty: "RSA",
+		Kid: kid,
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func ecJWK(kid string, key *ecdsa.PublicKey) mcp.JSONWebKey {
+	return mcp.JSONWebKey{
+		Kty: "EC",
+		Kid: kid,
+		Crv: "P-256",
+		X:   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+		Y:   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+	}
+}
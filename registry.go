@@ -0,0 +1,589 @@
+package mcp
+
+import (
+	"cmp"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"iter"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Registry is a ToolServer, PromptServer and ResourceServer backed by the tools, prompts, resources and
+// resource templates registered at runtime, each with the handler that serves it. The lists are
+// paginated with opaque cursors, that stay valid when the entries are added or removed between the
+// pages. The requests for the entries that aren't registered, and the invalid cursors, fail with a
+// JSONRPCError, with the invalid params code, or the resource not found code (-32002) for reading
+// the resources.
+//
+// Registry also implements ToolListUpdater, PromptListUpdater and ResourceListUpdater, and emits an
+// update whenever an entry is added or removed, so the server sends the list_changed notifications
+// to the clients when the registry is passed to the corresponding options:
+//
+//	registry := mcp.NewRegistry()
+//	server := mcp.NewServer(info, transport,
+//		mcp.WithToolServer(registry), mcp.WithToolListUpdater(registry))
+//
+// Instances should be created using NewRegistry, and closed with Close before the server is shut
+// down, so the update iterators end. Registry is safe for concurrent use.
+type Registry struct {
+	pageSize int
+
+	mu        sync.RWMutex
+	tools     registryEntries[registryTool]
+	prompts   registryEntries[registryPrompt]
+	resources registryEntries[registryResource]
+	templates registryEntries[registryResourceTemplate]
+
+	toolUpdates     chan struct{}
+	promptUpdates   chan struct{}
+	resourceUpdates chan struct{}
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// RegistryOption represents the options for the Registry.
+type RegistryOption func(*Registry)
+
+// ToolHandler serves the calls of a tool registered in the Registry.
+type ToolHandler func(context.Context, CallToolParams, ProgressReporter, RequestClientFunc) (CallToolResult, error)
+
+// PromptHandler serves the requests of a prompt registered in the Registry.
+type PromptHandler func(context.Context, GetPromptParams, ProgressReporter, RequestClientFunc) (GetPromptResult, error)
+
+// ResourceHandler serves the reads of a resource, or of the resources matching a resource template,
+// registered in the Registry.
+type ResourceHandler func(context.Context, ReadResourceParams, ProgressReporter, RequestClientFunc) (
+	ReadResourceResult, error)
+
+// CompletionHandler provides the completion suggestions for the arguments of a prompt or a resource
+// template registered in the Registry.
+type CompletionHandler func(context.Context, CompletesCompletionParams, RequestClientFunc) (CompletionResult, error)
+
+type registryTool struct {
+	tool    Tool
+	handler ToolHandler
+}
+
+type registryPrompt struct {
+	prompt   Prompt
+	handler  PromptHandler
+	complete CompletionHandler
+}
+
+type registryResource struct {
+	resource Resource
+	handler  ResourceHandler
+}
+
+type registryResourceTemplate struct {
+	template ResourceTemplate
+	pattern  *regexp.Regexp
+	handler  ResourceHandler
+	complete CompletionHandler
+}
+
+// registryEntries holds the entries of a kind, keyed by their name or URI. Every entry is assigned an
+// increasing sequence number when it's added, that orders the entries in the lists and forms the
+// pagination cursors.
+type registryEntries[T any] struct {
+	entries map[string]registryEntry[T]
+	lastSeq uint64
+}
+
+type registryEntry[T any] struct {
+	seq   uint64
+	value T
+}
+
+const defaultRegistryPageSize = 50
+
+// templateVariable matches the expressions of the URI templates, such as {id} or {+path}.
+var templateVariable = regexp.MustCompile(`\{(\+?)[^{}]+\}`)
+
+// NewRegistry creates an empty Registry.
+func NewRegistry(options ...RegistryOption) *Registry {
+	r := &Registry{
+		pageSize:        defaultRegistryPageSize,
+		toolUpdates:     make(chan struct{}, 1),
+		promptUpdates:   make(chan struct{}, 1),
+		resourceUpdates: make(chan struct{}, 1),
+		done:            make(chan struct{}),
+	}
+	for _, opt := range options {
+		opt(r)
+	}
+
+	return r
+}
+
+// WithRegistryPageSize sets the maximum number of entries returned in a page of the lists. If not set,
+// the default page size is 50.
+func WithRegistryPageSize(size int) RegistryOption {
+	return func(r *Registry) {
+		r.pageSize = size
+	}
+}
+
+// AddTool registers the tool with the handler serving its calls. The tool registered with the same
+// name is replaced, keeping its position in the list.
+func (r *Registry) AddTool(tool Tool, handler ToolHandler) {
+	r.mu.Lock()
+	r.tools.put(tool.Name, registryTool{tool: tool, handler: handler})
+	r.mu.Unlock()
+
+	notifyRegistryUpdate(r.toolUpdates)
+}
+
+// RemoveTool removes the tool with the name, and reports whether the tool was registered.
+func (r *Registry) RemoveTool(name string) bool {
+	r.mu.Lock()
+	removed := r.tools.delete(name)
+	r.mu.Unlock()
+
+	if removed {
+		notifyRegistryUpdate(r.toolUpdates)
+	}
+	return removed
+}
+
+// AddPrompt registers the prompt with the handler serving its requests, and the optional complete
+// handler providing the completions of its arguments. The prompt registered with the same name is
+// replaced, keeping its position in the list.
+func (r *Registry) AddPrompt(prompt Prompt, handler PromptHandler, complete CompletionHandler) {
+	r.mu.Lock()
+	r.prompts.put(prompt.Name, registryPrompt{prompt: prompt, handler: handler, complete: complete})
+	r.mu.Unlock()
+
+	notifyRegistryUpdate(r.promptUpdates)
+}
+
+// RemovePrompt removes the prompt with the name, and reports whether the prompt was registered.
+func (r *Registry) RemovePrompt(name string) bool {
+	r.mu.Lock()
+	removed := r.prompts.delete(name)
+	r.mu.Unlock()
+
+	if removed {
+		notifyRegistryUpdate(r.promptUpdates)
+	}
+	return removed
+}
+
+// AddResource registers the resource with the handler serving its reads. The resource registered with
+// the same URI is replaced, keeping its position in the list.
+func (r *Registry) AddResource(resource Resource, handler ResourceHandler) {
+	r.mu.Lock()
+	r.resources.put(resource.URI, registryResource{resource: resource, handler: handler})
+	r.mu.Unlock()
+
+	notifyRegistryUpdate(r.resourceUpdates)
+}
+
+// RemoveResource removes the resource with the URI, and reports whether the resource was registered.
+func (r *Registry) RemoveResource(uri string) bool {
+	r.mu.Lock()
+	removed := r.resources.delete(uri)
+	r.mu.Unlock()
+
+	if removed {
+		notifyRegistryUpdate(r.resourceUpdates)
+	}
+	return removed
+}
+
+// AddResourceTemplate registers the resource template with the handler serving the reads of the
+// resources matching it, and the optional complete handler providing the completions of its
+// arguments. The URIs are matched against the simple expressions of the template, such as {id} that
+// matches a single path segment, and {+path} that matches the rest of the URI. The resources
+// registered with AddResource take precedence over the templates.
+//
+// It returns an error if the URI template can't be compiled. The template registered with the same
+// URI template is replaced, keeping its position in the list.
+func (r *Registry) AddResourceTemplate(template ResourceTemplate, handler ResourceHandler,
+	complete CompletionHandler,
+) error {
+	pattern, err := compileURITemplate(template.URITemplate)
+	if err != nil {
+		return fmt.Errorf("failed to compile URI template %q: %w", template.URITemplate, err)
+	}
+
+	r.mu.Lock()
+	r.templates.put(template.URITemplate, registryResourceTemplate{
+		template: template,
+		pattern:  pattern,
+		handler:  handler,
+		complete: complete,
+	})
+	r.mu.Unlock()
+
+	notifyRegistryUpdate(r.resourceUpdates)
+	return nil
+}
+
+// RemoveResourceTemplate removes the resource template with the URI template, and reports whether the
+// template was registered.
+func (r *Registry) RemoveResourceTemplate(uriTemplate string) bool {
+	r.mu.Lock()
+	removed := r.templates.delete(uriTemplate)
+	r.mu.Unlock()
+
+	if removed {
+		notifyRegistryUpdate(r.resourceUpdates)
+	}
+	return removed
+}
+
+// Close ends the update iterators of the registry, so the server is able to shut down. The registry
+// still serves the requests after it's closed, but doesn't emit the updates anymore.
+func (r *Registry) Close() {
+	r.closeOnce.Do(func() {
+		close(r.done)
+	})
+}
+
+// ListTools implements the ToolServer interface.
+func (r *Registry) ListTools(_ context.Context, params ListToolsParams, _ ProgressReporter, _ RequestClientFunc) (
+	ListToolsResult, error,
+) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entries, nextCursor, err := r.tools.page(params.Cursor, r.pageSize)
+	if err != nil {
+		return ListToolsResult{}, err
+	}
+	tools := make([]Tool, len(entries))
+	for i, entry := range entries {
+		tools[i] = entry.tool
+	}
+
+	return ListToolsResult{Tools: tools, NextCursor: nextCursor}, nil
+}
+
+// CallTool implements the ToolServer interface.
+func (r *Registry) CallTool(ctx context.Context, params CallToolParams, progress ProgressReporter,
+	requestClient RequestClientFunc,
+) (CallToolResult, error) {
+	r.mu.RLock()
+	entry, ok := r.tools.get(params.Name)
+	r.mu.RUnlock()
+	if !ok {
+		return CallToolResult{}, JSONRPCError{
+			Code:    jsonRPCInvalidParamsCode,
+			Message: fmt.Sprintf("tool %q not found", params.Name),
+		}
+	}
+
+	return entry.handler(ctx, params, progress, requestClient)
+}
+
+// ListPrompts implements the PromptServer interface.
+func (r *Registry) ListPrompts(_ context.Context, params ListPromptsParams, _ ProgressReporter,
+	_ RequestClientFunc,
+) (ListPromptResult, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entries, nextCursor, err := r.prompts.page(params.Cursor, r.pageSize)
+	if err != nil {
+		return ListPromptResult{}, err
+	}
+	prompts := make([]Prompt, len(entries))
+	for i, entry := range entries {
+		prompts[i] = entry.prompt
+	}
+
+	return ListPromptResult{Prompts: prompts, NextCursor: nextCursor}, nil
+}
+
+// GetPrompt implements the PromptServer interface.
+func (r *Registry) GetPrompt(ctx context.Context, params GetPromptParams, progress ProgressReporter,
+	requestClient RequestClientFunc,
+) (GetPromptResult, error) {
+	r.mu.RLock()
+	entry, ok := r.prompts.get(params.Name)
+	r.mu.RUnlock()
+	if !ok {
+		return GetPromptResult{}, JSONRPCError{
+			Code:    jsonRPCInvalidParamsCode,
+			Message: fmt.Sprintf("prompt %q not found", params.Name),
+		}
+	}
+
+	return entry.handler(ctx, params, progress, requestClient)
+}
+
+// CompletesPrompt implements the PromptServer interface. It returns empty completions if the prompt
+// is registered without the complete handler.
+func (r *Registry) CompletesPrompt(ctx context.Context, params CompletesCompletionParams,
+	requestClient RequestClientFunc,
+) (CompletionResult, error) {
+	r.mu.RLock()
+	entry, ok := r.prompts.get(params.Ref.Name)
+	r.mu.RUnlock()
+	if !ok {
+		return CompletionResult{}, JSONRPCError{
+			Code:    jsonRPCInvalidParamsCode,
+			Message: fmt.Sprintf("prompt %q not found", params.Ref.Name),
+		}
+	}
+	if entry.complete == nil {
+		return CompletionResult{}, nil
+	}
+
+	return entry.complete(ctx, params, requestClient)
+}
+
+// ListResources implements the ResourceServer interface.
+func (r *Registry) ListResources(_ context.Context, params ListResourcesParams, _ ProgressReporter,
+	_ RequestClientFunc,
+) (ListResourcesResult, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entries, nextCursor, err := r.resources.page(params.Cursor, r.pageSize)
+	if err != nil {
+		return ListResourcesResult{}, err
+	}
+	resources := make([]Resource, len(entries))
+	for i, entry := range entries {
+		resources[i] = entry.resource
+	}
+
+	return ListResourcesResult{Resources: resources, NextCursor: nextCursor}, nil
+}
+
+// ReadResource implements the ResourceServer interface. The resource with the URI is read with its
+// handler, or with the handler of the first registered template matching the URI.
+func (r *Registry) ReadResource(ctx context.Context, params ReadResourceParams, progress ProgressReporter,
+	requestClient RequestClientFunc,
+) (ReadResourceResult, error) {
+	r.mu.RLock()
+	handler := r.resourceHandler(params.URI)
+	r.mu.RUnlock()
+	if handler == nil {
+		return ReadResourceResult{}, JSONRPCError{
+			Code:    resourceNotFoundCode,
+			Message: fmt.Sprintf("resource %q not found", params.URI),
+			Data:    map[string]any{"uri": params.URI},
+		}
+	}
+
+	return handler(ctx, params, progress, requestClient)
+}
+
+// ListResourceTemplates implements the ResourceServer interface.
+func (r *Registry) ListResourceTemplates(_ context.Context, params ListResourceTemplatesParams,
+	_ ProgressReporter, _ RequestClientFunc,
+) (ListResourceTemplatesResult, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entries, nextCursor, err := r.templates.page(params.Cursor, r.pageSize)
+	if err != nil {
+		return ListResourceTemplatesResult{}, err
+	}
+	templates := make([]ResourceTemplate, len(entries))
+	for i, entry := range entries {
+		templates[i] = entry.template
+	}
+
+	return ListResourceTemplatesResult{Templates: templates, NextCursor: nextCursor}, nil
+}
+
+// CompletesResourceTemplate implements the ResourceServer interface. It returns empty completions if
+// the template is registered without the complete handler.
+func (r *Registry) CompletesResourceTemplate(ctx context.Context, params CompletesCompletionParams,
+	requestClient RequestClientFunc,
+) (CompletionResult, error) {
+	r.mu.RLock()
+	entry, ok := r.templates.get(params.Ref.URI)
+	r.mu.RUnlock()
+	if !ok {
+		return CompletionResult{}, JSONRPCError{
+			Code:    jsonRPCInvalidParamsCode,
+			Message: fmt.Sprintf("resource template %q not found", params.Ref.URI),
+		}
+	}
+	if entry.complete == nil {
+		return CompletionResult{}, nil
+	}
+
+	return entry.complete(ctx, params, requestClient)
+}
+
+// ToolListUpdates implements the ToolListUpdater interface.
+func (r *Registry) ToolListUpdates() iter.Seq[struct{}] {
+	return r.updates(r.toolUpdates)
+}
+
+// PromptListUpdates implements the PromptListUpdater interface.
+func (r *Registry) PromptListUpdates() iter.Seq[struct{}] {
+	return r.updates(r.promptUpdates)
+}
+
+// ResourceListUpdates implements the ResourceListUpdater interface. The update is emitted when either
+// a resource or a resource template is added or removed.
+func (r *Registry) ResourceListUpdates() iter.Seq[struct{}] {
+	return r.updates(r.resourceUpdates)
+}
+
+func (r *Registry) updates(ch <-chan struct{}) iter.Seq[struct{}] {
+	return func(yield func(struct{}) bool) {
+		for {
+			select {
+			case <-r.done:
+				return
+			case <-ch:
+				if !yield(struct{}{}) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func (r *Registry) resourceHandler(uri string) ResourceHandler {
+	if entry, ok := r.resources.get(uri); ok {
+		return entry.handler
+	}
+	for _, entry := range r.templates.sorted() {
+		if entry.value.pattern.MatchString(uri) {
+			return entry.value.handler
+		}
+	}
+	return nil
+}
+
+func (e *registryEntries[T]) put(key string, value T) {
+	if e.entries == nil {
+		e.entries = make(map[string]registryEntry[T])
+	}
+	if entry, ok := e.entries[key]; ok {
+		e.entries[key] = registryEntry[T]{seq: entry.seq, value: value}
+		return
+	}
+	e.lastSeq++
+	e.entries[key] = registryEntry[T]{seq: e.lastSeq, value: value}
+}
+
+func (e *registryEntries[T]) delete(key string) bool {
+	if _, ok := e.entries[key]; !ok {
+		return false
+	}
+	delete(e.entries, key)
+	return true
+}
+
+func (e *registryEntries[T]) get(key string) (T, bool) {
+	entry, ok := e.entries[key]
+	return entry.value, ok
+}
+
+// sorted returns the entries ordered by their sequence numbers.
+func (e *registryEntries[T]) sorted() []registryEntry[T] {
+	entries := make([]registryEntry[T], 0, len(e.entries))
+	for _, entry := range e.entries {
+		entries = append(entries, entry)
+	}
+	slices.SortFunc(entries, func(a, b registryEntry[T]) int {
+		return cmp.Compare(a.seq, b.seq)
+	})
+	return entries
+}
+
+// page returns the entries after the cursor, and the cursor of the next page, which is empty if there
+// are no more entries.
+func (e *registryEntries[T]) page(cursor string, size int) ([]T, string, error) {
+	var after uint64
+	if cursor != "" {
+		seq, err := decodeRegistryCursor(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		after = seq
+	}
+
+	var values []T
+	var lastSeq uint64
+	more := false
+	for _, entry := range e.sorted() {
+		if entry.seq <= after {
+			continue
+		}
+		if size > 0 && len(values) == size {
+			more = true
+			break
+		}
+		values = append(values, entry.value)
+		lastSeq = entry.seq
+	}
+
+	if !more {
+		return values, "", nil
+	}
+	return values, encodeRegistryCursor(lastSeq), nil
+}
+
+func notifyRegistryUpdate(ch chan<- struct{}) {
+	// The updates are coalesced, the pending update already tells the server to notify the clients.
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+func encodeRegistryCursor(seq uint64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("seq:" + strconv.FormatUint(seq, 10)))
+}
+
+func decodeRegistryCursor(cursor string) (uint64, error) {
+	bs, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, invalidRegistryCursor(cursor)
+	}
+	seq, ok := strings.CutPrefix(string(bs), "seq:")
+	if !ok {
+		return 0, invalidRegistryCursor(cursor)
+	}
+	n, err := strconv.ParseUint(seq, 10, 64)
+	if err != nil {
+		return 0, invalidRegistryCursor(cursor)
+	}
+	return n, nil
+}
+
+func invalidRegistryCursor(cursor string) error {
+	return JSONRPCError{
+		Code:    jsonRPCInvalidParamsCode,
+		Message: fmt.Sprintf("invalid cursor %q", cursor),
+	}
+}
+
+// compileURITemplate compiles the URI template into a regular expression matching the URIs it expands
+// to. The simple expressions match a single path segment, and the reserved expressions, prefixed
+// with +, match the rest of the URI.
+func compileURITemplate(uriTemplate string) (*regexp.Regexp, error) {
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	last := 0
+	for _, loc := range templateVariable.FindAllStringSubmatchIndex(uriTemplate, -1) {
+		pattern.WriteString(regexp.QuoteMeta(uriTemplate[last:loc[0]]))
+		if loc[3] > loc[2] {
+			pattern.WriteString(".+")
+		} else {
+			pattern.WriteString("[^/]+")
+		}
+		last = loc[1]
+	}
+	pattern.WriteString(regexp.QuoteMeta(uriTemplate[last:]))
+	pattern.WriteString("$")
+
+	return regexp.Compile(pattern.String())
+}
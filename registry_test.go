@@ -0,0 +1,189 @@
+package mcp_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MegaGrindStone/go-mcp"
+)
+
+func TestRegistryPagination(t *testing.T) {
+	registry := mcp.NewRegistry(mcp.WithRegistryPageSize(2))
+	defer registry.Close()
+
+	for i := range 5 {
+		registry.AddTool(mcp.Tool{Name: fmt.Sprintf("tool-%d", i)}, nil)
+	}
+
+	ctx := context.Background()
+	listNames := func(cursor string) ([]string, string) {
+		t.Helper()
+		result, err := registry.ListTools(ctx, mcp.ListToolsParams{Cursor: cursor}, nil, nil)
+		if err != nil {
+			t.Fatalf("failed to list tools: %v", err)
+		}
+		names := make([]string, len(result.Tools))
+		for i, tool := range result.Tools {
+			names[i] = tool.Name
+		}
+		return names, result.NextCursor
+	}
+
+	names, cursor := listNames("")
+	if fmt.Sprint(names) != "[tool-0 tool-1]" || cursor == "" {
+		t.Fatalf("unexpected first page %v with cursor %q", names, cursor)
+	}
+
+	// The cursor stays valid when the entries are removed or added between the pages, and the replaced
+	// entry keeps its position.
+	registry.RemoveTool("tool-1")
+	registry.RemoveTool("tool-2")
+	registry.AddTool(mcp.Tool{Name: "tool-5"}, nil)
+	registry.AddTool(mcp.Tool{Name: "tool-0", Description: "replaced"}, nil)
+
+	names, cursor = listNames(cursor)
+	if fmt.Sprint(names) != "[tool-3 tool-4]" || cursor == "" {
+		t.Fatalf("unexpected second page %v with cursor %q", names, cursor)
+	}
+	names, cursor = listNames(cursor)
+	if fmt.Sprint(names) != "[tool-5]" || cursor != "" {
+		t.Fatalf("unexpected last page %v with cursor %q", names, cursor)
+	}
+
+	names, _ = listNames("")
+	if fmt.Sprint(names) != "[tool-0 tool-3]" {
+		t.Errorf("unexpected first page after the changes %v", names)
+	}
+
+	_, err := registry.ListTools(ctx, mcp.ListToolsParams{Cursor: "invalid"}, nil, nil)
+	var jsonErr mcp.JSONRPCError
+	if !errors.As(err, &jsonErr) || jsonErr.Code != -32602 {
+		t.Errorf("expected invalid params error for invalid cursor, got %v", err)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	for _, transportName := range []string{"SSE", "StreamableHTTP", "StdIO"} {
+		registry := mcp.NewRegistry()
+		promptWatcher := &mockPromptListWatcher{}
+		cfg := testSuiteConfig{
+			transportName: transportName,
+			serverOptions: []mcp.ServerOption{
+				mcp.WithPromptServer(registry),
+				mcp.WithPromptListUpdater(registry),
+				mcp.WithResourceServer(registry),
+				mcp.WithResourceListUpdater(registry),
+				mcp.WithToolServer(registry),
+				mcp.WithToolListUpdater(registry),
+			},
+			clientOptions: []mcp.ClientOption{
+				mcp.WithPromptListWatcher(promptWatcher),
+			},
+		}
+
+		t.Run(transportName, testSuiteCase(cfg, func(t *testing.T, s *testSuite) {
+			defer registry.Close()
+
+			if s.clientConnectErr != nil {
+				t.Fatalf("failed to connect to server: %v", s.clientConnectErr)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			registry.AddPrompt(mcp.Prompt{Name: "greeting"},
+				func(context.Context, mcp.GetPromptParams, mcp.ProgressReporter, mcp.RequestClientFunc) (
+					mcp.GetPromptResult, error,
+				) {
+					return mcp.GetPromptResult{Description: "hello"}, nil
+				}, nil)
+			waitForCount(t, &promptWatcher.lock, &promptWatcher.updateCount, 1)
+
+			prompt, err := s.mcpClient.GetPrompt(ctx, mcp.GetPromptParams{Name: "greeting"})
+			if err != nil {
+				t.Fatalf("failed to get prompt: %v", err)
+			}
+			if prompt.Description != "hello" {
+				t.Errorf("expected prompt description hello, got %s", prompt.Description)
+			}
+
+			if !registry.RemovePrompt("greeting") {
+				t.Fatal("expected prompt to be removed")
+			}
+			waitForCount(t, &promptWatcher.lock, &promptWatcher.updateCount, 2)
+			// The entries that aren't registered are answered with the errors the specification defines,
+			// instead of an internal error.
+			var jsonErr *mcp.JSONRPCError
+			_, err = s.mcpClient.GetPrompt(ctx, mcp.GetPromptParams{Name: "greeting"})
+			if !errors.As(err, &jsonErr) || jsonErr.Code != -32602 {
+				t.Errorf("expected invalid params error for removed prompt, got %v", err)
+			}
+			_, err = s.mcpClient.CallTool(ctx, mcp.CallToolParams{Name: "missing"})
+			if !errors.As(err, &jsonErr) || jsonErr.Code != -32602 {
+				t.Errorf("expected invalid params error for missing tool, got %v", err)
+			}
+
+			registry.AddTool(mcp.Tool{Name: "echo"},
+				func(_ context.Context, params mcp.CallToolParams, _ mcp.ProgressReporter, _ mcp.RequestClientFunc) (
+					mcp.CallToolResult, error,
+				) {
+					return mcp.CallToolResult{
+						Content: []mcp.Content{{Type: mcp.ContentTypeText, Text: string(params.Arguments)}},
+					}, nil
+				})
+			result, err := s.mcpClient.CallTool(ctx, mcp.CallToolParams{Name: "echo", Arguments: []byte(`"hi"`)})
+			if err != nil {
+				t.Fatalf("failed to call tool: %v", err)
+			}
+			if len(result.Content) != 1 || result.Content[0].Text != `"hi"` {
+				t.Errorf("unexpected tool result %+v", result)
+			}
+
+			err = registry.AddResourceTemplate(mcp.ResourceTemplate{URITemplate: "test://items/{id}", Name: "item"},
+				func(_ context.Context, params mcp.ReadResourceParams, _ mcp.ProgressReporter, _ mcp.RequestClientFunc) (
+					mcp.ReadResourceResult, error,
+				) {
+					return mcp.ReadResourceResult{
+						Contents: []mcp.ResourceContents{{URI: params.URI, Text: "item"}},
+					}, nil
+				}, nil)
+			if err != nil {
+				t.Fatalf("failed to add resource template: %v", err)
+			}
+			resource, err := s.mcpClient.ReadResource(ctx, mcp.ReadResourceParams{URI: "test://items/42"})
+			if err != nil {
+				t.Fatalf("failed to read resource: %v", err)
+			}
+			if len(resource.Contents) != 1 || resource.Contents[0].URI != "test://items/42" {
+				t.Errorf("unexpected resource contents %+v", resource.Contents)
+			}
+			_, err = s.mcpClient.ReadResource(ctx, mcp.ReadResourceParams{URI: "test://items/42/parts"})
+			if !errors.As(err, &jsonErr) || jsonErr.Code != -32002 {
+				t.Errorf("expected resource not found error for the URI that doesn't match the template, got %v", err)
+			}
+		}))
+	}
+}
+
+// waitForCount waits until the count guarded by the lock reaches want.
+func waitForCount(t *testing.T, lock sync.Locker, count *int, want int) {
+	t.Helper()
+
+	for range 100 {
+		lock.Lock()
+		got := *count
+		lock.Unlock()
+		if got == want {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	t.Fatalf("expected count %d, got %d", want, *count)
+}
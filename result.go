@@ -0,0 +1,86 @@
+package mcp
+
+import "sync"
+
+// resultManager keeps the result channels of the requests waiting for their responses, so the
+// responses received by the session's loop can be fed to the waiting callers. It's used by the
+// Client for its requests to the server, and by the server sessions for the requests of the server
+// implementations to the client.
+type resultManager struct {
+	lock     sync.Mutex
+	channels map[string]chan JSONRPCMessage
+	closed   bool
+}
+
+func newResultManager() *resultManager {
+	return &resultManager{
+		channels: make(map[string]chan JSONRPCMessage),
+	}
+}
+
+func (r *resultManager) init() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.closed = false
+}
+
+func (r *resultManager) register(msgID string) <-chan JSONRPCMessage {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	// The channel is buffered, so the result is not dropped when it arrives before the caller
+	// starts waiting on it, e.g. when the response comes back before the Send call returns.
+	results := make(chan JSONRPCMessage, 1)
+	r.channels[msgID] = results
+
+	return results
+}
+
+// unregister removes the result channel of the request that is no longer waited, e.g. when the
+// request is cancelled, so the late response is ignored.
+func (r *resultManager) unregister(msgID string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	delete(r.channels, msgID)
+}
+
+func (r *resultManager) feed(result JSONRPCMessage) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	// It's already closed, so we should return.
+	if r.closed {
+		return
+	}
+
+	ch, ok := r.channels[string(result.ID)]
+	if !ok {
+		// Ignore the result if it's not registered.
+		return
+	}
+
+	// Feed the result to the registered channel and drop it if there is no receiver.
+	select {
+	case ch <- result:
+	default:
+	}
+
+	// Remove the channel from the map to avoid memory leaks.
+	delete(r.channels, string(result.ID))
+}
+
+func (r *resultManager) close() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	// Close all the result channels, and forget them, so they're not fed after the manager is
+	// initialized again.
+	for msgID, results := range r.channels {
+		close(results)
+		delete(r.channels, msgID)
+	}
+
+	r.closed = true
+}
@@ -1,8 +1,11 @@
 package mcp
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
 )
 
 // MustString is a type that enforces string representation for fields that can be either string or integer
@@ -15,6 +18,7 @@ type MustString string
 //   - Request: JSONRPC, ID, Method, and Params are set
 //   - Response: JSONRPC, ID, and either Result or Error are set
 //   - Notification: JSONRPC and Method are set (no ID)
+//   - Batch: only Batch is set, and the message is encoded as a JSON array of the messages in it
 type JSONRPCMessage struct {
 	// JSONRPC must always be "2.0" per the JSON-RPC specification
 	JSONRPC string `json:"jsonrpc"`
@@ -28,6 +32,26 @@ type JSONRPCMessage struct {
 	Result json.RawMessage `json:"result,omitempty"`
 	// Error contains error details if the request failed
 	Error *JSONRPCError `json:"error,omitempty"`
+	// Batch contains the messages of a JSON-RPC batch. When it's set, the other fields are ignored
+	Batch []JSONRPCMessage `json:"-"`
+}
+
+// BatchRequest represents a request sent within a batch by Client.Batch.
+type BatchRequest struct {
+	// Method is the method name of the request, such as MethodToolsList.
+	Method string
+	// Params is the parameters of the request, it's encoded to JSON before sent.
+	Params any
+}
+
+// BatchResult represents the outcome of a request sent within a batch by Client.Batch.
+// Either Result or Error is set, depending on whether the server succeeded to handle the request.
+type BatchResult struct {
+	// Result contains the raw result of the request, it should be decoded into the result type of
+	// the request's method, such as ListToolsResult.
+	Result json.RawMessage
+	// Error contains the error returned by the server for the request.
+	Error *JSONRPCError
 }
 
 // JSONRPCError represents an error response in the JSON-RPC 2.0 protocol.
@@ -182,9 +206,15 @@ type CallToolParams struct {
 
 // CallToolResult represents the outcome of a tool invocation via CallTool.
 // IsError indicates whether the operation failed, with details in Content.
+//
+// StructuredContent holds the result as a JSON object, it must match the tool's OutputSchema
+// if the tool declares one. For backwards compatibility, the server fills Content with the
+// serialized StructuredContent if the tool doesn't provide any Content. StructuredContent is only
+// sent to the clients that negotiated ProtocolVersion20250618.
 type CallToolResult struct {
-	Content []Content `json:"content"`
-	IsError bool      `json:"isError"`
+	Content           []Content       `json:"content"`
+	StructuredContent json.RawMessage `json:"structuredContent,omitempty"`
+	IsError           bool            `json:"isError"`
 }
 
 // RootList represents a collection of root resources in the system.
@@ -205,16 +235,18 @@ type LogParams struct {
 
 // ServerCapabilities represents server capabilities.
 type ServerCapabilities struct {
-	Prompts   *PromptsCapability   `json:"prompts,omitempty"`
-	Resources *ResourcesCapability `json:"resources,omitempty"`
-	Tools     *ToolsCapability     `json:"tools,omitempty"`
-	Logging   *LoggingCapability   `json:"logging,omitempty"`
+	Prompts     *PromptsCapability     `json:"prompts,omitempty"`
+	Resources   *ResourcesCapability   `json:"resources,omitempty"`
+	Tools       *ToolsCapability       `json:"tools,omitempty"`
+	Logging     *LoggingCapability     `json:"logging,omitempty"`
+	Completions *CompletionsCapability `json:"completions,omitempty"`
 }
 
 // ClientCapabilities represents client capabilities.
 type ClientCapabilities struct {
-	Roots    *RootsCapability    `json:"roots,omitempty"`
-	Sampling *SamplingCapability `json:"sampling,omitempty"`
+	Roots       *RootsCapability       `json:"roots,omitempty"`
+	Sampling    *SamplingCapability    `json:"sampling,omitempty"`
+	Elicitation *ElicitationCapability `json:"elicitation,omitempty"`
 }
 
 // PromptsCapability represents prompts-specific capabilities.
@@ -236,6 +268,10 @@ type ToolsCapability struct {
 // LoggingCapability represents logging-specific capabilities.
 type LoggingCapability struct{}
 
+// CompletionsCapability represents completions-specific capabilities. This capability is only
+// advertised to the clients that negotiated ProtocolVersion20250326 or later.
+type CompletionsCapability struct{}
+
 // RootsCapability represents roots-specific capabilities.
 type RootsCapability struct {
 	ListChanged bool `json:"listChanged,omitempty"`
@@ -244,6 +280,9 @@ type RootsCapability struct {
 // SamplingCapability represents sampling-specific capabilities.
 type SamplingCapability struct{}
 
+// ElicitationCapability represents elicitation-specific capabilities.
+type ElicitationCapability struct{}
+
 // Info contains metadata about a server or client instance including its name and version.
 type Info struct {
 	Name    string `json:"name"`
@@ -376,12 +415,40 @@ type ResourceTemplate struct {
 	MimeType    string       `json:"mimeType,omitempty"`
 }
 
-// Tool defines a callable tool with its input schema.
+// Tool defines a callable tool with its input and output schemas.
 // InputSchema defines the expected format of arguments for CallTool.
+// OutputSchema defines the expected format of the StructuredContent in CallToolResult,
+// the tools without OutputSchema may still return unstructured results. OutputSchema is only
+// sent to the clients that negotiated ProtocolVersion20250618.
+// Annotations describes the behavior of the tool to the clients, see ToolAnnotations.
 type Tool struct {
-	Name        string          `json:"name"`
-	Description string          `json:"description,omitempty"`
-	InputSchema json.RawMessage `json:"inputSchema,omitempty"`
+	Name         string           `json:"name"`
+	Description  string           `json:"description,omitempty"`
+	InputSchema  json.RawMessage  `json:"inputSchema,omitempty"`
+	OutputSchema json.RawMessage  `json:"outputSchema,omitempty"`
+	Annotations  *ToolAnnotations `json:"annotations,omitempty"`
+}
+
+// ToolAnnotations describes the behavior of a tool, so the clients can decide how to present it, and
+// which calls need the user's confirmation. The annotations are hints, the clients shouldn't rely on
+// them for the tools of the servers they don't trust.
+//
+// The unset hints take their default values from the specification, which assumes the worst for
+// the unknown tools, use the methods like IsDestructive to read them with the defaults applied.
+type ToolAnnotations struct {
+	// Title is the human-readable title of the tool.
+	Title string `json:"title,omitempty"`
+	// ReadOnlyHint indicates that the tool doesn't modify its environment, defaults to false.
+	ReadOnlyHint *bool `json:"readOnlyHint,omitempty"`
+	// DestructiveHint indicates that the tool may perform destructive updates, rather than only
+	// additive ones. It's only meaningful when the tool is not read-only, defaults to true.
+	DestructiveHint *bool `json:"destructiveHint,omitempty"`
+	// IdempotentHint indicates that calling the tool repeatedly with the same arguments has no
+	// additional effect. It's only meaningful when the tool is not read-only, defaults to false.
+	IdempotentHint *bool `json:"idempotentHint,omitempty"`
+	// OpenWorldHint indicates that the tool interacts with an open world of external entities, such
+	// as the web, rather than a closed domain, such as a memory store, defaults to true.
+	OpenWorldHint *bool `json:"openWorldHint,omitempty"`
 }
 
 // Root represents a root directory or file that the server can operate on.
@@ -412,6 +479,10 @@ type ParamsMeta struct {
 	ProgressToken MustString `json:"progressToken"`
 }
 
+// jsonRPCMessage has the same fields as JSONRPCMessage without its JSON methods, so it can be
+// used to encode and decode the single messages without recursing.
+type jsonRPCMessage JSONRPCMessage
+
 type initializeParams struct {
 	ProtocolVersion string             `json:"protocolVersion"`
 	Capabilities    ClientCapabilities `json:"capabilities"`
@@ -426,8 +497,8 @@ type initializeResult struct {
 }
 
 type notificationsCancelledParams struct {
-	RequestID string `json:"requestId"`
-	Reason    string `json:"reason"`
+	RequestID MustString `json:"requestId"`
+	Reason    string     `json:"reason"`
 }
 
 type notificationsResourcesUpdatedParams struct {
@@ -448,6 +519,13 @@ const (
 	ContentTypeResource ContentType = "resource"
 )
 
+// ElicitationAction represents the action taken by the user in response to an elicitation request.
+const (
+	ElicitationActionAccept  ElicitationAction = "accept"
+	ElicitationActionDecline ElicitationAction = "decline"
+	ElicitationActionCancel  ElicitationAction = "cancel"
+)
+
 // LogLevel represents the severity level of log messages.
 const (
 	LogLevelDebug LogLevel = iota
@@ -489,6 +567,8 @@ const (
 	MethodRootsList = "roots/list"
 	// MethodSamplingCreateMessage is the method name for creating a new sampling message.
 	MethodSamplingCreateMessage = "sampling/createMessage"
+	// MethodElicitationCreate is the method name for requesting additional information from the user.
+	MethodElicitationCreate = "elicitation/create"
 
 	// MethodCompletionComplete is the method name for requesting completion suggestions.
 	MethodCompletionComplete = "completion/complete"
@@ -501,7 +581,18 @@ const (
 	// CompletionRefResource is used in CompletionRef.Type for resource template argument completion.
 	CompletionRefResource = "ref/resource"
 
-	protocolVersion = "2024-11-05"
+	// ProtocolVersion20241105 is the 2024-11-05 revision of the MCP specification.
+	ProtocolVersion20241105 = "2024-11-05"
+	// ProtocolVersion20250326 is the 2025-03-26 revision of the MCP specification.
+	ProtocolVersion20250326 = "2025-03-26"
+	// ProtocolVersion20250618 is the 2025-06-18 revision of the MCP specification. The package only
+	// implements parts of this revision, such as the structured tool results and the elicitation, so
+	// it's not supported by default, and only negotiated if it's listed in the supported revisions.
+	ProtocolVersion20250618 = "2025-06-18"
+
+	// protocolVersionHeader carries the negotiated protocol version in the HTTP requests sent after
+	// the initialization.
+	protocolVersionHeader = "MCP-Protocol-Version"
 
 	methodPing       = "ping"
 	methodInitialize = "initialize"
@@ -524,8 +615,47 @@ const (
 	jsonRPCMethodNotFoundCode = -32601
 	jsonRPCInvalidParamsCode  = -32602
 	jsonRPCInternalErrorCode  = -32603
+
+	// resourceNotFoundCode is the error code defined by the specification for reading the resources
+	// that don't exist.
+	resourceNotFoundCode = -32002
 )
 
+// defaultProtocolVersions lists the protocol revisions supported by default by both Server and Client.
+// ProtocolVersion20250618 is left out, as it's only partially implemented.
+var defaultProtocolVersions = []string{ProtocolVersion20250326, ProtocolVersion20241105}
+
+// IsReadOnly reports whether the tool doesn't modify its environment. The tools without annotations
+// are not read-only.
+func (a *ToolAnnotations) IsReadOnly() bool {
+	return a != nil && a.ReadOnlyHint != nil && *a.ReadOnlyHint
+}
+
+// IsDestructive reports whether the tool may perform destructive updates. The read-only tools are
+// never destructive, while the other tools are destructive unless they're annotated otherwise.
+func (a *ToolAnnotations) IsDestructive() bool {
+	if a.IsReadOnly() {
+		return false
+	}
+	return a == nil || a.DestructiveHint == nil || *a.DestructiveHint
+}
+
+// IsIdempotent reports whether calling the tool repeatedly with the same arguments has no additional
+// effect. The read-only tools are always idempotent, while the other tools are not idempotent unless
+// they're annotated otherwise.
+func (a *ToolAnnotations) IsIdempotent() bool {
+	if a.IsReadOnly() {
+		return true
+	}
+	return a != nil && a.IdempotentHint != nil && *a.IdempotentHint
+}
+
+// IsOpenWorld reports whether the tool interacts with an open world of external entities. The tools
+// are open world unless they're annotated otherwise.
+func (a *ToolAnnotations) IsOpenWorld() bool {
+	return a == nil || a.OpenWorldHint == nil || *a.OpenWorldHint
+}
+
 func (l LogLevel) String() string {
 	switch l {
 	case LogLevelDebug:
@@ -564,6 +694,9 @@ func (m *MustString) UnmarshalJSON(data []byte) error {
 		*m = MustString(fmt.Sprintf("%d", int(v)))
 	case int:
 		*m = MustString(fmt.Sprintf("%d", v))
+	case nil:
+		// The null ID is carried by the error responses to the requests whose ID couldn't be read.
+		*m = ""
 	default:
 		return fmt.Errorf("invalid type: %T", v)
 	}
@@ -577,6 +710,104 @@ func (m MustString) MarshalJSON() ([]byte, error) {
 	return json.Marshal(string(m))
 }
 
+// MarshalJSON implements json.Marshaler to encode the message, or the batch of messages
+// as a JSON array if Batch is set.
+func (m JSONRPCMessage) MarshalJSON() ([]byte, error) {
+	if len(m.Batch) > 0 {
+		return json.Marshal(m.Batch)
+	}
+	// The error response to the request whose ID couldn't be read carries the null ID, as required by
+	// the JSON-RPC specification.
+	if m.ID == "" && m.Method == "" && m.Error != nil {
+		return json.Marshal(struct {
+			jsonRPCMessage
+			ID *MustString `json:"id"`
+		}{jsonRPCMessage: jsonRPCMessage(m)})
+	}
+	return json.Marshal(jsonRPCMessage(m))
+}
+
+// UnmarshalJSON implements json.Unmarshaler to decode either a single message, or a JSON array
+// of messages into Batch.
+func (m *JSONRPCMessage) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimLeft(data, " \t\r\n")
+	if len(data) == 0 || data[0] != '[' {
+		var msg jsonRPCMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return err
+		}
+		*m = JSONRPCMessage(msg)
+		return nil
+	}
+
+	var elements []json.RawMessage
+	if err := json.Unmarshal(data, &elements); err != nil {
+		return err
+	}
+	// The JSON-RPC specification defines the empty array as an invalid request.
+	if len(elements) == 0 {
+		return errors.New("empty batch")
+	}
+
+	batch := make([]JSONRPCMessage, len(elements))
+	for i, element := range elements {
+		// The element that isn't a valid message doesn't fail the whole batch. It's decoded without
+		// the JSON-RPC version, with the ID if it can be read, so it's answered as an invalid request.
+		var msg jsonRPCMessage
+		if err := json.Unmarshal(element, &msg); err != nil {
+			var withID struct {
+				ID MustString `json:"id"`
+			}
+			_ = json.Unmarshal(element, &withID)
+			msg = jsonRPCMessage{ID: withID.ID}
+		}
+		batch[i] = JSONRPCMessage(msg)
+	}
+	*m = JSONRPCMessage{Batch: batch}
+	return nil
+}
+
 func (j JSONRPCError) Error() string {
 	return fmt.Sprintf("request error, code: %d, message: %s, data %+v", j.Code, j.Message, j.Data)
 }
+
+// toJSONRPCError returns the JSONRPCError wrapped in err, either as a value or as a pointer, and
+// reports whether there is one.
+func toJSONRPCError(err error) (JSONRPCError, bool) {
+	var jsonErrPtr *JSONRPCError
+	if errors.As(err, &jsonErrPtr) && jsonErrPtr != nil {
+		return *jsonErrPtr, true
+	}
+	var jsonErr JSONRPCError
+	if errors.As(err, &jsonErr) {
+		return jsonErr, true
+	}
+	return JSONRPCError{}, false
+}
+
+// latestProtocolVersion returns the most recent revision in versions. The revisions are dates
+// in YYYY-MM-DD format, so the most recent one is the greatest in lexical order.
+func latestProtocolVersion(versions []string) string {
+	latest := ""
+	for _, v := range versions {
+		if v > latest {
+			latest = v
+		}
+	}
+	return latest
+}
+
+// negotiateProtocolVersion picks the revision to use for the requested one, following the
+// specification's fallback rules: the requested revision is used if it's supported, otherwise
+// the latest supported revision is proposed, and it's up to the requester to accept it.
+func negotiateProtocolVersion(requested string, supported []string) string {
+	if slices.Contains(supported, requested) {
+		return requested
+	}
+	return latestProtocolVersion(supported)
+}
+
+// protocolVersionAtLeast reports whether the revision version is the same as, or newer than, minVersion.
+func protocolVersionAtLeast(version, minVersion string) bool {
+	return version >= minVersion
+}
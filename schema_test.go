@@ -127,6 +127,67 @@ func TestMustString_RoundTrip(t *testing.T) {
 	}
 }
 
+func TestJSONRPCMessage_Batch(t *testing.T) {
+	batch := mcp.JSONRPCMessage{
+		Batch: []mcp.JSONRPCMessage{
+			{JSONRPC: mcp.JSONRPCVersion, ID: "1", Method: mcp.MethodToolsList},
+			{JSONRPC: mcp.JSONRPCVersion, Method: "notifications/initialized"},
+		},
+	}
+
+	marshaled, err := json.Marshal(batch)
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	if marshaled[0] != '[' {
+		t.Errorf("Marshaled batch is not an array: %s", marshaled)
+	}
+
+	var unmarshaled mcp.JSONRPCMessage
+	if err := json.Unmarshal(marshaled, &unmarshaled); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if len(unmarshaled.Batch) != 2 {
+		t.Fatalf("Unmarshaled batch length = %d, want 2", len(unmarshaled.Batch))
+	}
+	if unmarshaled.Batch[0].ID != "1" || unmarshaled.Batch[0].Method != mcp.MethodToolsList {
+		t.Errorf("Unmarshaled batch[0] = %+v, want request tools/list with ID 1", unmarshaled.Batch[0])
+	}
+
+	// Single message should not be decoded as a batch.
+	var single mcp.JSONRPCMessage
+	if err := json.Unmarshal([]byte(`{"jsonrpc":"2.0","id":1,"method":"ping"}`), &single); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if single.Batch != nil || single.ID != "1" || single.Method != "ping" {
+		t.Errorf("Unmarshaled message = %+v, want ping request with ID 1", single)
+	}
+
+	// Empty batch is an invalid request per JSON-RPC specification.
+	if err := json.Unmarshal([]byte(`[]`), &single); err == nil {
+		t.Errorf("Expected error for empty batch, got nil")
+	}
+
+	// The invalid elements don't fail the whole batch, they're decoded without the JSON-RPC version.
+	var invalid mcp.JSONRPCMessage
+	data := `[{"jsonrpc":"2.0","id":"1","method":"ping"},1,{"jsonrpc":"2.0","id":"3","method":5}]`
+	if err := json.Unmarshal([]byte(data), &invalid); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if len(invalid.Batch) != 3 {
+		t.Fatalf("Unmarshaled batch length = %d, want 3", len(invalid.Batch))
+	}
+	if invalid.Batch[0].JSONRPC != mcp.JSONRPCVersion || invalid.Batch[0].Method != "ping" {
+		t.Errorf("Unmarshaled batch[0] = %+v, want ping request", invalid.Batch[0])
+	}
+	if invalid.Batch[1].JSONRPC != "" || invalid.Batch[1].ID != "" {
+		t.Errorf("Unmarshaled batch[1] = %+v, want invalid element without ID", invalid.Batch[1])
+	}
+	if invalid.Batch[2].JSONRPC != "" || invalid.Batch[2].ID != "3" || invalid.Batch[2].Method != "" {
+		t.Errorf("Unmarshaled batch[2] = %+v, want invalid element with ID 3", invalid.Batch[2])
+	}
+}
+
 func TestLogLevel_String(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -188,3 +249,77 @@ func TestLogLevel_String(t *testing.T) {
 		})
 	}
 }
+
+func TestToolAnnotations_Hints(t *testing.T) {
+	hint := func(value bool) *bool { return &value }
+
+	tests := []struct {
+		name            string
+		annotations     *mcp.ToolAnnotations
+		wantReadOnly    bool
+		wantDestructive bool
+		wantIdempotent  bool
+		wantOpenWorld   bool
+	}{
+		{
+			name:            "no annotations",
+			annotations:     nil,
+			wantDestructive: true,
+			wantOpenWorld:   true,
+		},
+		{
+			name:            "unset hints",
+			annotations:     &mcp.ToolAnnotations{Title: "Tool"},
+			wantDestructive: true,
+			wantOpenWorld:   true,
+		},
+		{
+			name: "read-only",
+			annotations: &mcp.ToolAnnotations{
+				ReadOnlyHint:    hint(true),
+				DestructiveHint: hint(true),
+				OpenWorldHint:   hint(false),
+			},
+			wantReadOnly:   true,
+			wantIdempotent: true,
+		},
+		{
+			name: "additive",
+			annotations: &mcp.ToolAnnotations{
+				DestructiveHint: hint(false),
+				IdempotentHint:  hint(true),
+			},
+			wantIdempotent: true,
+			wantOpenWorld:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.annotations.IsReadOnly(); got != tt.wantReadOnly {
+				t.Errorf("IsReadOnly() = %v, want %v", got, tt.wantReadOnly)
+			}
+			if got := tt.annotations.IsDestructive(); got != tt.wantDestructive {
+				t.Errorf("IsDestructive() = %v, want %v", got, tt.wantDestructive)
+			}
+			if got := tt.annotations.IsIdempotent(); got != tt.wantIdempotent {
+				t.Errorf("IsIdempotent() = %v, want %v", got, tt.wantIdempotent)
+			}
+			if got := tt.annotations.IsOpenWorld(); got != tt.wantOpenWorld {
+				t.Errorf("IsOpenWorld() = %v, want %v", got, tt.wantOpenWorld)
+			}
+		})
+	}
+
+	data, err := json.Marshal(mcp.Tool{
+		Name:        "read",
+		Annotations: &mcp.ToolAnnotations{Title: "Read", ReadOnlyHint: hint(true)},
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal tool: %v", err)
+	}
+	want := `{"name":"read","annotations":{"title":"Read","readOnlyHint":true}}`
+	if string(data) != want {
+		t.Errorf("expected %s, got %s", want, data)
+	}
+}
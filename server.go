@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"iter"
 	"log/slog"
+	"runtime/debug"
 	"sync"
 	"time"
 
@@ -26,6 +27,7 @@ type Server struct {
 	instructions               string
 	capabilities               ServerCapabilities
 	requiredClientCapabilities ClientCapabilities
+	protocolVersions           []string
 	transport                  ServerTransport
 
 	requireRootsListClient bool
@@ -40,15 +42,22 @@ type Server struct {
 
 	toolServer      ToolServer
 	toolListUpdater ToolListUpdater
+	// validateToolArguments enables the validation of the tool arguments against the tools' input schemas.
+	validateToolArguments bool
 
 	rootsListWatcher RootsListWatcher
 
 	logHandler LogHandler
 
+	middlewares []Middleware
+	// redactInternalErrors replaces the message of the internal errors sent to the clients.
+	redactInternalErrors bool
+
 	pingInterval         time.Duration
 	pingTimeout          time.Duration
 	pingTimeoutThreshold int
 	sendTimeout          time.Duration
+	clientRequestTimeout time.Duration
 
 	logger *slog.Logger
 
@@ -56,6 +65,8 @@ type Server struct {
 	onClientDisconnected func(string)
 
 	sessionsWaitGroup *sync.WaitGroup
+	// sessions holds the active sessions, so the notifications are sent to the sessions they concern.
+	sessions *serverSessionRegistry
 
 	done                     chan struct{}
 	promptListClosed         chan struct{}
@@ -71,13 +82,18 @@ type serverSession struct {
 
 	serverCap         ServerCapabilities
 	requiredClientCap ClientCapabilities
+	protocolVersions  []string
 	serverInfo        Info
 	instructions      string
+	state             *serverSessionState
+	sessions          *serverSessionRegistry
+	clientResults     *resultManager
 
 	pingInterval         time.Duration
 	pingTimeout          time.Duration
 	pingTimeoutThreshold int
 	sendTimeout          time.Duration
+	clientRequestTimeout time.Duration
 
 	promptServer                PromptServer
 	resourceServer              ResourceServer
@@ -85,8 +101,87 @@ type serverSession struct {
 	resourceSubscriptionHandler ResourceSubscriptionHandler
 	logHandler                  LogHandler
 	rootsListWatcher            RootsListWatcher
+	middlewares                 []Middleware
+	redactInternalErrors        bool
+	// validateArguments enables the validation of the tool arguments against the cached input schemas.
+	validateArguments bool
+	// toolSchemas caches the schemas of the listed tools, to validate the tool arguments and the
+	// structured tool results.
+	toolSchemas *toolSchemaCache
+}
+
+// serverSessionState holds the state of a session that is established during its lifetime,
+// and shared between the goroutines that handle the session's messages.
+type serverSessionState struct {
+	lock               sync.Mutex
+	protocolVersion    string
+	clientInfo         Info
+	clientCapabilities ClientCapabilities
+	serverCapabilities ServerCapabilities
+	// logLevel is the minimum level of the log notifications requested by the client with
+	// logging/setLevel, the client receives all the log notifications until it sets the level.
+	logLevel    LogLevel
+	logLevelSet bool
+}
+
+// toolSchemaCache holds the schemas of the tools listed by the ToolServer for a session, so the tool
+// calls and their results are validated without listing the tools on every call. The cache is
+// dropped whenever the session is notified that the tools list has changed.
+type toolSchemaCache struct {
+	mu sync.Mutex
+	// tools maps the names of the tools to their schemas, it's nil until the tools are listed.
+	tools map[string]toolSchemas
+	// loading is closed once the listing in progress is done, it's nil if the tools aren't being
+	// listed. The lookups wait for the listing in progress instead of listing the tools themselves.
+	loading chan struct{}
+	// generation is increased whenever the cache is invalidated, so the tools listed before are not
+	// cached.
+	generation int
+}
+
+type toolSchemas struct {
+	// input is the parsed input schema of the tool, it's nil if the tool doesn't declare a valid one.
+	input  *jsonSchema
+	output json.RawMessage
+}
+
+// serverSessionRegistry holds the active sessions of the server, and the resources each session is
+// subscribed to.
+type serverSessionRegistry struct {
+	mu       sync.Mutex
+	sessions map[string]serverSession
+	// subscriptions maps the URI of the subscribed resources to the IDs of the subscribed sessions.
+	subscriptions map[string]map[string]struct{}
+}
+
+// SessionInfo describes the client session that made the request being handled by the server
+// implementation, see SessionFromContext.
+type SessionInfo struct {
+	// ID is the identifier of the session, as reported by its transport.
+	ID string
+	// ClientInfo is the name and version of the client, sent in its initialization request.
+	ClientInfo Info
+	// ClientCapabilities is the capabilities declared by the client.
+	ClientCapabilities ClientCapabilities
+	// ServerCapabilities is the capabilities the server advertised to the client, which may differ
+	// between the sessions, depending on the negotiated protocol version.
+	ServerCapabilities ServerCapabilities
+	// ProtocolVersion is the protocol revision negotiated with the client.
+	ProtocolVersion string
+}
+
+// clientRequest is carried in the context passed to the server implementations, so the helpers
+// like CreateMessage can send the requests to the client that made the request being handled.
+type clientRequest struct {
+	session serverSession
 }
 
+type protocolVersionContextKey struct{}
+
+type principalContextKey struct{}
+
+type clientRequestContextKey struct{}
+
 var (
 	defaultServerPingInterval         = 30 * time.Second
 	defaultServerPingTimeout          = 30 * time.Second
@@ -94,15 +189,27 @@ var (
 	defaultServerSendTimeout          = 30 * time.Second
 
 	errInvalidJSON = errors.New("invalid json")
+
+	// ErrClientCapabilityNotSupported is returned by the helpers like CreateMessage, when the client
+	// doesn't declare the capability required by the request.
+	ErrClientCapabilityNotSupported = errors.New("capability not supported by client")
+
+	// ErrSessionNotFound is returned by the Server's notification methods, when the addressed session
+	// is not connected to the server.
+	ErrSessionNotFound = errors.New("session not found")
 )
 
 // NewServer creates a new Model Context Protocol (MCP) server with the specified configuration.
 func NewServer(info Info, transport ServerTransport, options ...ServerOption) Server {
 	s := Server{
-		info:                     info,
-		transport:                transport,
-		logger:                   slog.Default(),
-		sessionsWaitGroup:        &sync.WaitGroup{},
+		info:              info,
+		transport:         transport,
+		logger:            slog.Default(),
+		sessionsWaitGroup: &sync.WaitGroup{},
+		sessions: &serverSessionRegistry{
+			sessions:      make(map[string]serverSession),
+			subscriptions: make(map[string]map[string]struct{}),
+		},
 		done:                     make(chan struct{}),
 		promptListClosed:         make(chan struct{}),
 		resourceListClosed:       make(chan struct{}),
@@ -125,6 +232,9 @@ func NewServer(info Info, transport ServerTransport, options ...ServerOption) Se
 	if s.sendTimeout == 0 {
 		s.sendTimeout = defaultServerSendTimeout
 	}
+	if len(s.protocolVersions) == 0 {
+		s.protocolVersions = defaultProtocolVersions
+	}
 
 	// Prepares the server's capabilities based on the provided server implementations.
 
@@ -154,6 +264,10 @@ func NewServer(info Info, transport ServerTransport, options ...ServerOption) Se
 	if s.logHandler != nil {
 		s.capabilities.Logging = &LoggingCapability{}
 	}
+	if s.promptServer != nil || s.resourceServer != nil {
+		// Both prompt and resource servers provide argument completions.
+		s.capabilities.Completions = &CompletionsCapability{}
+	}
 
 	s.requiredClientCapabilities = ClientCapabilities{}
 
@@ -237,6 +351,22 @@ func WithToolListUpdater(updater ToolListUpdater) ServerOption {
 	}
 }
 
+// WithToolArgumentsValidation returns a ServerOption that validates the arguments of the tool calls
+// against the InputSchema of the tools before they're passed to the ToolServer. The arguments that
+// don't match the schema are answered with an error result, listing the JSON pointer of every
+// invalid location with the reason, so the model can correct the call. The schemas are cached from
+// the tools list of each session, and the cache is refreshed when the session is notified that the
+// tools list has changed, or when the called tool is not in the cached list.
+//
+// The schemas are validated with a subset of JSON Schema draft 2020-12, see the README for the
+// supported keywords. The keywords that aren't supported are ignored, and the tools with an
+// invalid schema are called without validation.
+func WithToolArgumentsValidation() ServerOption {
+	return func(s *Server) {
+		s.validateToolArguments = true
+	}
+}
+
 // WithRootsListWatcher returns a ServerOption that configures the roots list watcher implementation.
 func WithRootsListWatcher(watcher RootsListWatcher) ServerOption {
 	return func(s *Server) {
@@ -258,6 +388,17 @@ func WithInstructions(instructions string) ServerOption {
 	}
 }
 
+// WithServerProtocolVersions sets the protocol revisions supported by the server, such as
+// ProtocolVersion20241105. The server answers the client with the requested revision if it's
+// supported, otherwise it proposes the latest revision from this list. By default,
+// ProtocolVersion20250326 and ProtocolVersion20241105 are supported, ProtocolVersion20250618 has
+// to be listed to be negotiated.
+func WithServerProtocolVersions(versions ...string) ServerOption {
+	return func(s *Server) {
+		s.protocolVersions = versions
+	}
+}
+
 // WithServerPingInterval returns a ServerOption that configures the server's ping interval.
 func WithServerPingInterval(interval time.Duration) ServerOption {
 	return func(s *Server) {
@@ -287,6 +428,16 @@ func WithServerSendTimeout(timeout time.Duration) ServerOption {
 	}
 }
 
+// WithServerClientRequestTimeout returns a ServerOption that configures how long the server waits for
+// the client's response to the requests sent by the server implementations, such as the sampling
+// requests. When the timeout is exceeded, the request is cancelled and the client is notified.
+// By default, the server waits until the context of the request being handled is done.
+func WithServerClientRequestTimeout(timeout time.Duration) ServerOption {
+	return func(s *Server) {
+		s.clientRequestTimeout = timeout
+	}
+}
+
 // WithServerOnClientConnected sets the callback for when a client connects.
 // The callback's parameter is the ID and Info of the client.
 func WithServerOnClientConnected(onClientConnected func(string, Info)) ServerOption {
@@ -303,6 +454,30 @@ func WithServerOnClientDisconnected(onClientDisconnected func(string)) ServerOpt
 	}
 }
 
+// WithServerMiddleware returns a ServerOption that wraps the handling of the messages received from
+// the clients with the middlewares, see Middleware. It wraps the initialization request, the requests
+// handled by the server implementations, and the notifications, except the pings. The middlewares
+// are composed in order, so the first one receives the message first, and they're appended to the
+// middlewares of the previous WithServerMiddleware options.
+//
+// The notifications are handled in the order they're received, so their middlewares should return
+// quickly, as they hold the handling of the next messages of the session.
+func WithServerMiddleware(middlewares ...Middleware) ServerOption {
+	return func(s *Server) {
+		s.middlewares = append(s.middlewares, middlewares...)
+	}
+}
+
+// WithServerRedactInternalErrors returns a ServerOption that replaces the message of the internal
+// errors (code -32603) sent to the clients with a generic message, and drops their data, so the
+// errors of the server implementations and the recovered panics don't leak the internal details to
+// the clients. The original errors are still logged.
+func WithServerRedactInternalErrors() ServerOption {
+	return func(s *Server) {
+		s.redactInternalErrors = true
+	}
+}
+
 // WithServerLogger sets the logger for the server.
 func WithServerLogger(logger *slog.Logger) ServerOption {
 	return func(s *Server) {
@@ -313,47 +488,246 @@ func WithServerLogger(logger *slog.Logger) ServerOption {
 	}
 }
 
+// ProtocolVersionFromContext returns the protocol revision negotiated with the client, from the
+// context passed to the server implementations. It returns an empty string if the context doesn't
+// come from a client session. The server implementations can use it to decide whether to populate
+// the fields that are only defined in the recent revisions.
+func ProtocolVersionFromContext(ctx context.Context) string {
+	version, _ := ctx.Value(protocolVersionContextKey{}).(string)
+	return version
+}
+
+// PrincipalFromContext returns the authenticated principal of the client, from the context passed to
+// the server implementations. It returns false if the session of the client is not authenticated by
+// its transport, see PrincipalSession.
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalContextKey{}).(Principal)
+	return principal, ok
+}
+
+// SessionFromContext returns the information of the client session that made the request, from the
+// context passed to the server implementations. It returns false if the context doesn't come from a
+// client session. The server implementations that serve several clients can use the session ID or the
+// client info to scope their data per caller.
+func SessionFromContext(ctx context.Context) (SessionInfo, bool) {
+	req, err := clientRequestFromContext(ctx)
+	if err != nil {
+		return SessionInfo{}, false
+	}
+	return req.session.state.sessionInfo(req.session.session.ID()), true
+}
+
+// CreateMessage requests the client to sample a message from its language model, on behalf of the
+// server implementation that handles the request carried by ctx. It waits for the client's result
+// until ctx is done.
+//
+// An error wrapping ErrClientCapabilityNotSupported is returned if the client doesn't declare the
+// sampling capability, and the error response from the client is returned as JSONRPCError.
+func CreateMessage(ctx context.Context, params SamplingParams) (SamplingResult, error) {
+	req, err := clientRequestFromContext(ctx)
+	if err != nil {
+		return SamplingResult{}, err
+	}
+	if req.clientCapabilities().Sampling == nil {
+		return SamplingResult{}, fmt.Errorf("%w: sampling", ErrClientCapabilityNotSupported)
+	}
+
+	var result SamplingResult
+	if err := req.call(ctx, MethodSamplingCreateMessage, params, &result); err != nil {
+		return SamplingResult{}, err
+	}
+	return result, nil
+}
+
+// ListRoots requests the list of roots from the client, on behalf of the server implementation that
+// handles the request carried by ctx. It waits for the client's result until ctx is done.
+//
+// An error wrapping ErrClientCapabilityNotSupported is returned if the client doesn't declare the
+// roots capability, and the error response from the client is returned as JSONRPCError.
+func ListRoots(ctx context.Context) (RootList, error) {
+	req, err := clientRequestFromContext(ctx)
+	if err != nil {
+		return RootList{}, err
+	}
+	if req.clientCapabilities().Roots == nil {
+		return RootList{}, fmt.Errorf("%w: roots", ErrClientCapabilityNotSupported)
+	}
+
+	var result RootList
+	if err := req.call(ctx, MethodRootsList, nil, &result); err != nil {
+		return RootList{}, err
+	}
+	return result, nil
+}
+
+// Elicit requests the input described by the params from the user, through the client that made the
+// request carried by ctx. It waits for the client's result until ctx is done. If the user accepts the
+// request, the submitted content is validated against the requested schema, and decoded into the
+// value pointed to by content, with the same rules as json.Unmarshal. The content is left untouched
+// if the user declines or cancels the request, so the caller should check the returned action.
+//
+// An error wrapping ErrClientCapabilityNotSupported is returned if the client doesn't declare the
+// elicitation capability, or negotiated a protocol revision earlier than ProtocolVersion20250618, which
+// introduced the elicitation, and the error response from the client is returned as JSONRPCError.
+func Elicit(ctx context.Context, params ElicitationParams, content any) (ElicitationAction, error) {
+	req, err := clientRequestFromContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	if req.clientCapabilities().Elicitation == nil ||
+		!protocolVersionAtLeast(req.session.state.getProtocolVersion(), ProtocolVersion20250618) {
+		return "", fmt.Errorf("%w: elicitation", ErrClientCapabilityNotSupported)
+	}
+
+	var result ElicitationResult
+	if err := req.call(ctx, MethodElicitationCreate, params, &result); err != nil {
+		return "", err
+	}
+
+	switch result.Action {
+	case ElicitationActionAccept:
+	case ElicitationActionDecline, ElicitationActionCancel:
+		return result.Action, nil
+	default:
+		return "", fmt.Errorf("unknown elicitation action %q", result.Action)
+	}
+
+	if result.Content == nil {
+		return "", errors.New("accepted elicitation has no content")
+	}
+	if params.RequestedSchema != nil {
+		if err := validateJSONSchema(params.RequestedSchema, result.Content); err != nil {
+			return "", fmt.Errorf("elicited content doesn't match the requested schema: %w", err)
+		}
+	}
+	if content != nil {
+		if err := json.Unmarshal(result.Content, content); err != nil {
+			return "", fmt.Errorf("failed to decode elicited content: %w", err)
+		}
+	}
+
+	return result.Action, nil
+}
+
+// Log sends the log message to the client that made the request carried by ctx, on behalf of the
+// server implementation that handles it. Unlike the LogHandler, which streams the logs to every
+// connected client, the message is only sent to this client.
+//
+// An error is returned if the server doesn't declare the logging capability, i.e. it's configured
+// without the LogHandler.
+func Log(ctx context.Context, params LogParams) error {
+	req, err := clientRequestFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	if req.session.serverCap.Logging == nil {
+		return errors.New("logging not supported by server")
+	}
+	if !req.session.state.logAllowed(params.Level) {
+		return nil
+	}
+
+	paramsBs, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("failed to marshal params: %w", err)
+	}
+
+	if err := req.session.session.Send(ctx, JSONRPCMessage{
+		JSONRPC: JSONRPCVersion,
+		Method:  methodNotificationsMessage,
+		Params:  paramsBs,
+	}); err != nil {
+		return fmt.Errorf("failed to send log: %w", err)
+	}
+	return nil
+}
+
 // Serve starts the MCP server and manages its lifecycle. It handles client connections,
 // protocol messages, and server capabilities according to the MCP specification.
 //
 // Serve blocks until the server is shut down.
 func (s Server) Serve() {
-	broadcasts := make(chan JSONRPCMessage, 10)
-
 	if s.promptListUpdater != nil {
 		go s.listenUpdates(methodNotificationsPromptsListChanged, s.promptListUpdater.PromptListUpdates(),
-			broadcasts, s.promptListClosed)
+			s.promptListClosed)
 	} else {
 		close(s.promptListClosed)
 	}
 
 	if s.resourceListUpdater != nil {
 		go s.listenUpdates(methodNotificationsResourcesListChanged, s.resourceListUpdater.ResourceListUpdates(),
-			broadcasts, s.resourceListClosed)
+			s.resourceListClosed)
 	} else {
 		close(s.resourceListClosed)
 	}
 
 	if s.resourceSubscriptionHandler != nil {
-		go s.listenSubcribedResources(broadcasts)
+		go s.listenSubcribedResources()
 	} else {
 		close(s.resourceSubscribedClosed)
 	}
 
 	if s.toolListUpdater != nil {
 		go s.listenUpdates(methodNotificationsToolsListChanged, s.toolListUpdater.ToolListUpdates(),
-			broadcasts, s.toolListClosed)
+			s.toolListClosed)
 	} else {
 		close(s.toolListClosed)
 	}
 
 	if s.logHandler != nil {
-		go s.listenLogs(broadcasts)
+		go s.listenLogs()
 	} else {
 		close(s.logClosed)
 	}
 
-	s.start(broadcasts)
+	s.start()
+}
+
+// NotifyPromptListChanged notifies the session with sessionID that the list of prompts has changed.
+// It returns ErrSessionNotFound if the session is not connected.
+func (s Server) NotifyPromptListChanged(ctx context.Context, sessionID string) error {
+	return s.notify(ctx, sessionID, methodNotificationsPromptsListChanged, nil)
+}
+
+// NotifyResourceListChanged notifies the session with sessionID that the list of resources has
+// changed. It returns ErrSessionNotFound if the session is not connected.
+func (s Server) NotifyResourceListChanged(ctx context.Context, sessionID string) error {
+	return s.notify(ctx, sessionID, methodNotificationsResourcesListChanged, nil)
+}
+
+// NotifyToolListChanged notifies the session with sessionID that the list of tools has changed.
+// It returns ErrSessionNotFound if the session is not connected.
+func (s Server) NotifyToolListChanged(ctx context.Context, sessionID string) error {
+	return s.notify(ctx, sessionID, methodNotificationsToolsListChanged, nil)
+}
+
+// NotifyResourceUpdated notifies the session with sessionID that the resource with uri has changed.
+// The notification is only sent if the session is subscribed to the resource, as the specification
+// requires. It returns ErrSessionNotFound if the session is not connected.
+func (s Server) NotifyResourceUpdated(ctx context.Context, sessionID, uri string) error {
+	if _, ok := s.sessions.get(sessionID); !ok {
+		return ErrSessionNotFound
+	}
+	if !s.sessions.subscribed(sessionID, uri) {
+		return nil
+	}
+	return s.notify(ctx, sessionID, methodNotificationsResourcesUpdated, notificationsResourcesUpdatedParams{
+		URI: uri,
+	})
+}
+
+// NotifyLog sends the log message to the session with sessionID. The message is dropped if its level
+// is below the level the session requested with logging/setLevel. It returns ErrSessionNotFound if
+// the session is not connected.
+func (s Server) NotifyLog(ctx context.Context, sessionID string, params LogParams) error {
+	sess, ok := s.sessions.get(sessionID)
+	if !ok {
+		return ErrSessionNotFound
+	}
+	if !sess.state.logAllowed(params.Level) {
+		return nil
+	}
+	return s.notify(ctx, sessionID, methodNotificationsMessage, params)
 }
 
 // Shutdown gracefully shuts down the server by terminating all active clients and cleaning up resources.
@@ -405,13 +779,7 @@ func (s Server) Shutdown(ctx context.Context) error {
 	return nil
 }
 
-func (s Server) start(broadcasts <-chan JSONRPCMessage) {
-	// These channles are used to send broadcasts to all sessions in the goroutine below.
-	sessions := make(chan serverSession, 5)
-	removedSessions := make(chan string, 5)
-
-	go s.broadcast(broadcasts, sessions, removedSessions)
-
+func (s Server) start() {
 	// This loop would break when the transport is closed.
 	for sess := range s.transport.Sessions() {
 		ss := serverSession{
@@ -419,21 +787,29 @@ func (s Server) start(broadcasts <-chan JSONRPCMessage) {
 			logger:                      s.logger.With(slog.String("sessionID", sess.ID())),
 			serverCap:                   s.capabilities,
 			requiredClientCap:           s.requiredClientCapabilities,
+			protocolVersions:            s.protocolVersions,
 			serverInfo:                  s.info,
+			state:                       &serverSessionState{},
+			sessions:                    s.sessions,
+			clientResults:               newResultManager(),
 			instructions:                s.instructions,
 			pingInterval:                s.pingInterval,
 			pingTimeout:                 s.pingTimeout,
 			pingTimeoutThreshold:        s.pingTimeoutThreshold,
 			sendTimeout:                 s.sendTimeout,
+			clientRequestTimeout:        s.clientRequestTimeout,
 			promptServer:                s.promptServer,
 			resourceServer:              s.resourceServer,
 			toolServer:                  s.toolServer,
 			resourceSubscriptionHandler: s.resourceSubscriptionHandler,
 			logHandler:                  s.logHandler,
 			rootsListWatcher:            s.rootsListWatcher,
+			middlewares:                 s.middlewares,
+			redactInternalErrors:        s.redactInternalErrors,
+			validateArguments:           s.validateToolArguments,
+			toolSchemas:                 &toolSchemaCache{},
 		}
-		// Updates the broadcaster about new sessions
-		sessions <- ss
+		s.sessions.add(ss)
 
 		s.sessionsWaitGroup.Add(1)
 
@@ -452,43 +828,63 @@ func (s Server) start(broadcasts <-chan JSONRPCMessage) {
 				s.onClientDisconnected(ss.session.ID())
 			}
 
-			// Notify the broadcaster about removed sessions
-			select {
-			case <-s.done:
-			case removedSessions <- ss.session.ID():
+			// The resources that were only subscribed by this session are unsubscribed from the handler.
+			for _, uri := range s.sessions.remove(ss.session.ID()) {
+				s.resourceSubscriptionHandler.UnsubscribeResource(UnsubscribeResourceParams{URI: uri})
 			}
 		}()
 	}
 }
 
-func (s Server) broadcast(messages <-chan JSONRPCMessage, sessions <-chan serverSession, removedSession <-chan string) {
-	// Store all active sessions in a map for easy lookup
-	sessMap := make(map[string]serverSession)
+// notify sends the notification to the session with sessionID.
+func (s Server) notify(ctx context.Context, sessionID, method string, params any) error {
+	sess, ok := s.sessions.get(sessionID)
+	if !ok {
+		return ErrSessionNotFound
+	}
 
-	for {
-		select {
-		case <-s.done:
-			return
-		case sess := <-sessions:
-			sessMap[sess.session.ID()] = sess
-		case sessID := <-removedSession:
-			delete(sessMap, sessID)
-		case msg := <-messages:
-			ctx, cancel := context.WithTimeout(context.Background(), s.sendTimeout)
-			// Broadcast the message to all active sessions
-			for _, sess := range sessMap {
-				if err := sess.session.Send(ctx, msg); err != nil {
-					sess.logger.Error("failed to send message",
-						slog.Any("message", msg),
-						slog.String("err", err.Error()))
-				}
-			}
-			cancel()
+	msg := JSONRPCMessage{
+		JSONRPC: JSONRPCVersion,
+		Method:  method,
+	}
+	if params != nil {
+		paramsBs, err := json.Marshal(params)
+		if err != nil {
+			return fmt.Errorf("failed to marshal params: %w", err)
+		}
+		msg.Params = paramsBs
+	}
+
+	if method == methodNotificationsToolsListChanged {
+		sess.toolSchemas.invalidate()
+	}
+	if err := sess.session.Send(ctx, msg); err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+	return nil
+}
+
+// sendNotification sends the notification to the sessions, logging the sessions that fail to
+// receive it.
+func (s Server) sendNotification(sessions []serverSession, msg JSONRPCMessage) {
+	for _, sess := range sessions {
+		if msg.Method == methodNotificationsToolsListChanged {
+			sess.toolSchemas.invalidate()
+		}
+		// Every session has its own send timeout, so the slow session doesn't use up the time of the
+		// sessions notified after it.
+		ctx, cancel := context.WithTimeout(context.Background(), s.sendTimeout)
+		err := sess.session.Send(ctx, msg)
+		cancel()
+		if err != nil {
+			sess.logger.Error("failed to send message",
+				slog.Any("message", msg),
+				slog.String("err", err.Error()))
 		}
 	}
 }
 
-func (s Server) listenSubcribedResources(messages chan<- JSONRPCMessage) {
+func (s Server) listenSubcribedResources() {
 	defer close(s.resourceSubscribedClosed)
 
 	for uri := range s.resourceSubscriptionHandler.SubscribedResourceUpdates() {
@@ -500,20 +896,16 @@ func (s Server) listenSubcribedResources(messages chan<- JSONRPCMessage) {
 			s.logger.Error("failed to marshal resources updated params", "err", err)
 			continue
 		}
-		msg := JSONRPCMessage{
+		// Only the sessions subscribed to the resource are notified.
+		s.sendNotification(s.sessions.subscribers(uri), JSONRPCMessage{
 			JSONRPC: JSONRPCVersion,
 			Method:  methodNotificationsResourcesUpdated,
 			Params:  paramsBs,
-		}
-		select {
-		case <-s.done:
-			return
-		case messages <- msg:
-		}
+		})
 	}
 }
 
-func (s Server) listenLogs(messages chan<- JSONRPCMessage) {
+func (s Server) listenLogs() {
 	defer close(s.logClosed)
 
 	for params := range s.logHandler.LogStreams() {
@@ -522,160 +914,230 @@ func (s Server) listenLogs(messages chan<- JSONRPCMessage) {
 			s.logger.Error("failed to marshal log params", "err", err)
 			continue
 		}
-		msg := JSONRPCMessage{
+		// Only the sessions that requested the level of the message, or didn't set any level, receive it.
+		var sessions []serverSession
+		for _, sess := range s.sessions.all() {
+			if sess.state.logAllowed(params.Level) {
+				sessions = append(sessions, sess)
+			}
+		}
+		s.sendNotification(sessions, JSONRPCMessage{
 			JSONRPC: JSONRPCVersion,
 			Method:  methodNotificationsMessage,
 			Params:  paramsBs,
-		}
-		select {
-		case <-s.done:
-			return
-		case messages <- msg:
-		}
+		})
 	}
 }
 
 func (s Server) listenUpdates(
 	method string,
 	updates iter.Seq[struct{}],
-	messages chan<- JSONRPCMessage,
 	closed chan<- struct{},
 ) {
 	defer close(closed)
 
 	for range updates {
-		msg := JSONRPCMessage{
+		s.sendNotification(s.sessions.all(), JSONRPCMessage{
 			JSONRPC: JSONRPCVersion,
 			Method:  method,
-		}
-		select {
-		case <-s.done:
-			return
-		case messages <- msg:
-		}
+		})
 	}
 }
 
-func (s serverSession) start(done <-chan struct{}) {
+// serverSessionLoop holds the state of the loop that handles the messages received in the session,
+// shared by the helpers handling each message.
+type serverSessionLoop struct {
+	done <-chan struct{}
 	// This channel is used to feed the ping goroutine a message ID we received from the client.
-	pingMessageIDs := make(chan MustString, 10)
-	// Spawn a goroutine to handle the session's lifetime with ping.
-	go s.ping(pingMessageIDs, done)
+	pingMessageIDs chan MustString
 	// This map is used to store the cancellation for the request
 	// we receive from the client and forwards to server implementation.
-	ctxCancels := make(map[MustString]context.CancelFunc)
-	// This map is used to store the result channels for the clientRequester. The channel
-	// would be feed once we receive the result back from the client.
-	requestResults := make(map[MustString]chan JSONRPCMessage)
-	// This base context is to make sure all the operations in the loop below is cancelled
+	ctxCancels map[MustString]context.CancelFunc
+	// This base context is to make sure all the operations started by the loop are cancelled
 	// when the loop is broken.
-	baseCtx, baseCancel := context.WithCancel(context.Background())
+	baseCtx context.Context
 	// This flag indicates whether we already established the session with the client.
 	// Before this flag is set to true, other than ping and initialization message,
-	// we should ignore any other messages from the client.
-	initialized := false
+	// we should reject the requests and ignore the notifications from the client.
+	initialized bool
+}
+
+func (s serverSession) start(done <-chan struct{}) {
+	baseCtx, baseCancel := context.WithCancel(context.Background())
+	loop := &serverSessionLoop{
+		done:           done,
+		pingMessageIDs: make(chan MustString, 10),
+		ctxCancels:     make(map[MustString]context.CancelFunc),
+		baseCtx:        baseCtx,
+	}
+	// Spawn a goroutine to handle the session's lifetime with ping.
+	go s.ping(loop.pingMessageIDs, done)
 
 	// This loops would break when the session is closed
-	for msg := range s.session.Messages() {
-		// Validate JSON-RPC version before processing any message
-		if msg.JSONRPC != JSONRPCVersion {
-			s.logger.Info("failed to handle message",
-				slog.Any("message", msg),
-				slog.String("err", errInvalidJSON.Error()),
-			)
-			continue
-		}
-		switch msg.Method {
-		case methodPing:
-			go func(msgID MustString) {
-				// Send pong back to the client
-				pongCtx, pongCancel := context.WithTimeout(context.Background(), s.pingTimeout)
-				if err := s.session.Send(pongCtx, JSONRPCMessage{
-					JSONRPC: JSONRPCVersion,
-					ID:      msgID,
-				}); err != nil {
-					s.logger.Error("failed to send pong", slog.String("err", err.Error()))
-				}
-				pongCancel()
-			}(msg.ID)
-		case methodInitialize:
-			// Handle initialization request.
-			go s.handleInitializeRequest(msg)
-		case MethodPromptsList, MethodPromptsGet, MethodResourcesList, MethodResourcesRead, MethodResourcesTemplatesList,
-			MethodResourcesSubscribe, MethodResourcesUnsubscribe, MethodToolsList, MethodToolsCall,
-			MethodCompletionComplete, MethodLoggingSetLevel:
-			if !initialized {
-				continue
-			}
-			// All the method above required us to call the server implementation, and all the call is cancellable,
-			// so we need to register it to the map, so we can cancel it if the client requests it.
-			serverCtx, serverCancel := context.WithCancel(baseCtx)
-			ctxCancels[msg.ID] = serverCancel
-			// Since the call for the server implementation may use clientRequester that wait for client's response,
-			// we need to register the result channel for the clientRequester to receive the response. Also, since
-			// waiting for the client's response is a blocking operation, we need to spawn a goroutine to handle it.
-			results := make(chan JSONRPCMessage)
-			requestResults[msg.ID] = results
-			go s.handleServerImplementationMessage(serverCtx, msg, results)
-		case methodNotificationsInitialized:
-			// Successfully established the session with the client
-			initialized = true
-		case methodNotificationsCancelled:
-			if !initialized {
-				continue
-			}
-			// Lookup the context cancellation for message ID
-			cancel, ok := ctxCancels[msg.ID]
-			if ok {
-				cancel()
-			}
-		case methodNotificationsRootsListChanged:
-			if !initialized {
-				continue
-			}
-			if s.rootsListWatcher != nil {
-				s.rootsListWatcher.OnRootsListChanged()
-			}
-		case "":
-			// This is the response from the client, it can be from initialization error, ping request or
-			// clientRequester that called by the server implementation.
-
-			// Check if this is an error response to our initialization request
-			if !initialized && msg.Error != nil {
-				// If we receive an error during initialization, log it and go on.
-				s.logger.Error("initialization failed with error from client",
-					slog.String("err", msg.Error.Error()))
-				break
-			}
-			// Feed the ping gourotine with the message ID we received from the client.
-			select {
-			case <-done:
-				break
-			case pingMessageIDs <- msg.ID:
-			}
-			// If it is indeed a ping response, it would not stored on the map.
-			// And as the other rseponse with invalid message ID, we ingore it.
-			results, rOk := requestResults[msg.ID]
-			if !rOk {
-				continue
-			}
-			// Feed the stored result channel, but drop it instantly if there is no receiver. The no-receiver case
-			// happens when the clientRequester is failed to send the request to the client, but somehow the client
-			// response back with this message ID.
-			select {
-			case results <- msg:
-			default:
-			}
-			delete(requestResults, msg.ID)
+	for sessMsg := range s.session.Messages() {
+		// The batch is fanned out to be handled as individual messages, and the responses for its
+		// requests are collected to be sent back as a single batch.
+		batch := newBatchCollector(sessMsg)
+		for _, msg := range batchMessages(sessMsg) {
+			s.handleMessage(loop, batch, msg)
 		}
 	}
 	// Cancel all the contexts that we created
 	baseCancel()
 	// Close the ping message ID channel
-	close(pingMessageIDs)
-	// Close all the results channel
-	for _, results := range requestResults {
-		close(results)
+	close(loop.pingMessageIDs)
+	// Close all the results channel of the pending requests to the client
+	s.clientResults.close()
+}
+
+// handleMessage handles a message received in the session, either on its own or within the batch.
+func (s serverSession) handleMessage(loop *serverSessionLoop, batch *batchCollector, msg JSONRPCMessage) {
+	// Validate JSON-RPC version before processing any message, the invalid message is answered
+	// with the ID that could be read, so the other elements of its batch are still answered.
+	if msg.JSONRPC != JSONRPCVersion {
+		s.logger.Info("failed to handle message",
+			slog.Any("message", msg),
+			slog.String("err", errInvalidJSON.Error()),
+		)
+		go s.sendErrorResponse(batch, msg, JSONRPCError{
+			Code:    jsonRPCInvalidRequestCode,
+			Message: "invalid request",
+		})
+		return
+	}
+	switch msg.Method {
+	case methodPing:
+		go func(msgID MustString) {
+			// Send pong back to the client
+			pongCtx, pongCancel := context.WithTimeout(context.Background(), s.pingTimeout)
+			if err := s.sendResponse(pongCtx, batch, JSONRPCMessage{
+				JSONRPC: JSONRPCVersion,
+				ID:      msgID,
+			}); err != nil {
+				s.logger.Error("failed to send pong", slog.String("err", err.Error()))
+			}
+			pongCancel()
+		}(msg.ID)
+	case methodInitialize:
+		// The JSON-RPC batches are not allowed to carry the initialization.
+		if batch != nil {
+			go s.sendErrorResponse(batch, msg, JSONRPCError{
+				Code:    jsonRPCInvalidRequestCode,
+				Message: "initialize request must not be part of a batch",
+			})
+			return
+		}
+		// Handle initialization request.
+		go s.handleInitializeRequest(msg)
+	case methodNotificationsInitialized, methodNotificationsCancelled, methodNotificationsRootsListChanged:
+		if !loop.initialized && msg.Method != methodNotificationsInitialized {
+			return
+		}
+		// The notifications are handled in place, as they change the state of the loop.
+		handler := func(_ context.Context, msg JSONRPCMessage) (any, error) {
+			s.handleLoopNotification(loop, msg)
+			return nil, nil
+		}
+		handler = chainMiddlewares(handler, s.middlewares)
+		if _, err := s.callRecovered(s.requestContext(loop.baseCtx), handler, msg); err != nil {
+			s.logger.Warn("failed to handle notification",
+				slog.String("method", msg.Method),
+				slog.String("err", err.Error()))
+		}
+	case "":
+		// This is the response from the client, it can be from initialization error, ping request or
+		// clientRequester that called by the server implementation.
+
+		// Check if this is an error response to our initialization request
+		if !loop.initialized && msg.Error != nil {
+			// If we receive an error during initialization, log it and go on.
+			s.logger.Error("initialization failed with error from client",
+				slog.String("err", msg.Error.Error()))
+			return
+		}
+		// Feed the ping gourotine with the message ID we received from the client.
+		select {
+		case <-loop.done:
+		case loop.pingMessageIDs <- msg.ID:
+		}
+		// Feed the pending request sent by the clientRequester. If it is indeed a ping response, it would not
+		// be registered, and as the other response with unknown message ID, it's ignored.
+		s.clientResults.feed(msg)
+	default:
+		if msg.ID == "" {
+			// The notification with unknown method is ignored.
+			return
+		}
+		if !loop.initialized {
+			go s.sendErrorResponse(batch, msg, JSONRPCError{
+				Code:    jsonRPCInvalidRequestCode,
+				Message: fmt.Sprintf("session is not initialized, %s is not allowed", msg.Method),
+			})
+			return
+		}
+		// The rest of the requests are handled by the server implementation, which answers the unknown
+		// methods. All the calls are cancellable, so we need to register it to the map, so we can cancel
+		// it if the client requests it.
+		serverCtx, serverCancel := context.WithCancel(loop.baseCtx)
+		loop.ctxCancels[msg.ID] = serverCancel
+		// Since the call for the server implementation may use clientRequester that wait for client's response,
+		// which is a blocking operation, we need to spawn a goroutine to handle it.
+		go s.handleServerImplementationMessage(serverCtx, batch, msg)
+	}
+}
+
+// handleLoopNotification handles the notification that changes the state of the loop.
+func (s serverSession) handleLoopNotification(loop *serverSessionLoop, msg JSONRPCMessage) {
+	switch msg.Method {
+	case methodNotificationsInitialized:
+		// Successfully established the session with the client
+		loop.initialized = true
+	case methodNotificationsCancelled:
+		// Lookup the context cancellation for the cancelled request ID, this package's client also
+		// sets it as the message ID.
+		requestID := msg.ID
+		var params notificationsCancelledParams
+		if err := json.Unmarshal(msg.Params, &params); err == nil && params.RequestID != "" {
+			requestID = params.RequestID
+		}
+		cancel, ok := loop.ctxCancels[requestID]
+		if ok {
+			cancel()
+		}
+	case methodNotificationsRootsListChanged:
+		if s.rootsListWatcher != nil {
+			s.rootsListWatcher.OnRootsListChanged()
+		}
+	}
+}
+
+// sendResponse sends the response to the client. If the response is for a request received within
+// the batch, it's collected instead, and sent along with the other responses once all of the requests
+// in the batch are answered.
+func (s serverSession) sendResponse(ctx context.Context, batch *batchCollector, msg JSONRPCMessage) error {
+	responses, collected := batch.collect(msg)
+	if !collected {
+		return s.session.Send(ctx, msg)
+	}
+	if responses == nil {
+		return nil
+	}
+	return s.session.Send(ctx, JSONRPCMessage{Batch: responses})
+}
+
+// sendErrorResponse answers the request with the error.
+func (s serverSession) sendErrorResponse(batch *batchCollector, msg JSONRPCMessage, jsonErr JSONRPCError) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.sendTimeout)
+	defer cancel()
+
+	if err := s.sendResponse(ctx, batch, JSONRPCMessage{
+		JSONRPC: JSONRPCVersion,
+		ID:      msg.ID,
+		Error:   &jsonErr,
+	}); err != nil {
+		s.logger.Error("failed to send error response",
+			slog.String("method", msg.Method),
+			slog.String("err", err.Error()))
 	}
 }
 
@@ -683,25 +1145,32 @@ func (s serverSession) handleInitializeRequest(msg JSONRPCMessage) {
 	ctx, cancel := context.WithTimeout(context.Background(), s.sendTimeout)
 	defer cancel()
 
-	// Verify client's initialization request
-	res, err := s.initializationHandshake(msg)
+	handler := func(_ context.Context, msg JSONRPCMessage) (any, error) {
+		// Verify client's initialization request
+		params, res, err := s.initializationHandshake(msg)
+		if err != nil {
+			return nil, err
+		}
+		s.state.initialize(res.ProtocolVersion, params, res.Capabilities)
+		return res, nil
+	}
+
+	res, err := s.callRecovered(s.requestContext(ctx), chainMiddlewares(handler, s.middlewares), msg)
 	if err != nil {
 		s.logger.Info("invalid initialization request", slog.String("err", err.Error()))
 		// Initialization failed, send the error to the client to notify them to close the session.
-		if err := s.session.Send(ctx, JSONRPCMessage{
+		if err := s.sendResponse(ctx, nil, JSONRPCMessage{
 			JSONRPC: JSONRPCVersion,
 			ID:      msg.ID,
-			Error: &JSONRPCError{
-				Code:    jsonRPCInvalidParamsCode,
-				Message: err.Error(),
-			},
+			Error:   s.responseError(err, jsonRPCInvalidParamsCode),
 		}); err != nil {
 			s.logger.Error("failed to send initialization error", slog.String("err", err.Error()))
 		}
 		return
 	}
+
 	resBs, _ := json.Marshal(res)
-	if err := s.session.Send(ctx, JSONRPCMessage{
+	if err := s.sendResponse(ctx, nil, JSONRPCMessage{
 		JSONRPC: JSONRPCVersion,
 		ID:      msg.ID,
 		Result:  resBs,
@@ -726,7 +1195,11 @@ func (s serverSession) ping(messageIDs <-chan MustString, done <-chan struct{})
 		select {
 		case <-done:
 			return
-		case id := <-messageIDs:
+		case id, ok := <-messageIDs:
+			if !ok {
+				// The session's main loop is finished, there's nothing to ping anymore.
+				return
+			}
 			// Received id from client response, check whether it's the same as the one we sent.
 			if id != msgID {
 				continue
@@ -756,37 +1229,126 @@ func (s serverSession) ping(messageIDs <-chan MustString, done <-chan struct{})
 	}
 }
 
+// requestContext returns the context passed to the middlewares and the server implementations, which
+// exposes the session that received the message.
+func (s serverSession) requestContext(ctx context.Context) context.Context {
+	// Expose the negotiated protocol version to the server implementation.
+	ctx = context.WithValue(ctx, protocolVersionContextKey{}, s.state.getProtocolVersion())
+	// Expose the principal of the client, if the transport authenticates it.
+	if sess, ok := s.session.(PrincipalSession); ok {
+		if principal, ok := sess.Principal(); ok {
+			ctx = context.WithValue(ctx, principalContextKey{}, principal)
+		}
+	}
+	// Let the server implementation send the requests to the client with the helpers like CreateMessage.
+	return context.WithValue(ctx, clientRequestContextKey{}, clientRequest{
+		session: s,
+	})
+}
+
 func (s serverSession) handleServerImplementationMessage(
 	ctx context.Context,
+	batch *batchCollector,
 	msg JSONRPCMessage,
-	results <-chan JSONRPCMessage,
 ) {
 	// This variables is used to store all the result from the server implementation
-	// to be sent back to the client below.
-	var result any
-	// The err is should always an instance of JSONRPCError, we declare it as an error type,
-	// is for the nil-check feature.
-	var err error
+	// to be sent back to the client below. The err is usually an instance of JSONRPCError, but the
+	// middlewares may return any error, which is answered as an internal error.
+	handler := chainMiddlewares(s.callServerImplementation, s.middlewares)
+	result, err := s.callRecovered(s.requestContext(ctx), handler, msg)
 
-	switch msg.Method {
-	case MethodPromptsList:
-		result, err = s.callListPrompts(ctx, msg, results)
-	case MethodPromptsGet:
-		result, err = s.callGetPrompt(ctx, msg, results)
-	case MethodResourcesList:
-		result, err = s.callListResources(ctx, msg, results)
-	case MethodResourcesRead:
-		result, err = s.callReadResource(ctx, msg, results)
-	case MethodResourcesTemplatesList:
-		result, err = s.callListResourceTemplates(ctx, msg, results)
-	case MethodResourcesSubscribe:
+	resMsg := JSONRPCMessage{
+		JSONRPC: JSONRPCVersion,
+		ID:      msg.ID,
+	}
+
+	if err != nil {
+		s.logger.Error("failed to call server implementation",
+			slog.String("method", msg.Method),
+			slog.String("err", err.Error()))
+		resMsg.Error = s.responseError(err, jsonRPCInternalErrorCode)
+	} else if result != nil {
+		// Some call doesn't return any result, so this nil check is needed.
+		resMsg.Result, _ = json.Marshal(result)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.sendTimeout)
+	defer cancel()
+
+	if err := s.sendResponse(ctx, batch, resMsg); err != nil {
+		s.logger.Error("failed to send result", slog.String("err", err.Error()))
+	}
+}
+
+// callRecovered calls the handler, and recovers its panic into an internal error, so a panicking
+// server implementation fails its own request instead of crashing the server with all of its sessions.
+func (s serverSession) callRecovered(
+	ctx context.Context,
+	handler MessageHandler,
+	msg JSONRPCMessage,
+) (result any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.logger.Error("recovered from panic while handling message",
+				slog.String("method", msg.Method),
+				slog.Any("panic", r),
+				slog.String("stack", string(debug.Stack())))
+			result = nil
+			err = JSONRPCError{
+				Code:    jsonRPCInternalErrorCode,
+				Message: fmt.Sprintf("panic while handling %s: %v", msg.Method, r),
+			}
+		}
+	}()
+	return handler(ctx, msg)
+}
+
+// responseError converts the error of the handler into the error of the response. The errors that
+// aren't JSONRPCError are answered with the code, and the internal errors are redacted if
+// configured with WithServerRedactInternalErrors.
+func (s serverSession) responseError(err error, code int) *JSONRPCError {
+	jsonErr, ok := toJSONRPCError(err)
+	if !ok {
+		jsonErr = JSONRPCError{
+			Code:    code,
+			Message: err.Error(),
+		}
+	}
+	if s.redactInternalErrors && jsonErr.Code == jsonRPCInternalErrorCode {
+		jsonErr.Message = "internal error"
+		jsonErr.Data = nil
+	}
+	return &jsonErr
+}
+
+// callServerImplementation calls the server implementation that handles the request's method.
+func (s serverSession) callServerImplementation(ctx context.Context, msg JSONRPCMessage) (any, error) {
+	if err := s.checkCapability(msg.Method); err != nil {
+		return nil, err
+	}
+
+	var result any
+	var err error
+
+	switch msg.Method {
+	case MethodPromptsList:
+		result, err = s.callListPrompts(ctx, msg)
+	case MethodPromptsGet:
+		result, err = s.callGetPrompt(ctx, msg)
+	case MethodResourcesList:
+		result, err = s.callListResources(ctx, msg)
+	case MethodResourcesRead:
+		result, err = s.callReadResource(ctx, msg)
+	case MethodResourcesTemplatesList:
+		result, err = s.callListResourceTemplates(ctx, msg)
+	case MethodResourcesSubscribe:
 		err = s.callSubscribeResource(msg)
 	case MethodResourcesUnsubscribe:
 		err = s.callUnsubscribeResource(msg)
 	case MethodToolsList:
-		result, err = s.callListTools(ctx, msg, results)
+		result, err = s.callListTools(ctx, msg)
 	case MethodToolsCall:
-		result, err = s.callCallTool(ctx, msg, results)
+		result, err = s.callCallTool(ctx, msg)
 	case MethodCompletionComplete:
 		var params CompletesCompletionParams
 		if err = json.Unmarshal(msg.Params, &params); err != nil {
@@ -798,69 +1360,89 @@ func (s serverSession) handleServerImplementationMessage(
 		}
 		switch params.Ref.Type {
 		case CompletionRefPrompt:
-			result, err = s.callCompletePrompt(ctx, msg, results)
+			result, err = s.callCompletePrompt(ctx, msg)
 		case CompletionRefResource:
-			result, err = s.callCompleteResource(ctx, msg, results)
+			result, err = s.callCompleteResource(ctx, msg)
 		default:
+			err = JSONRPCError{
+				Code:    jsonRPCInvalidParamsCode,
+				Message: fmt.Sprintf("unknown completion reference type %q", params.Ref.Type),
+			}
 		}
 	case MethodLoggingSetLevel:
 		err = s.callSetLogLevel(msg)
 	default:
-		return
+		err = JSONRPCError{
+			Code:    jsonRPCMethodNotFoundCode,
+			Message: fmt.Sprintf("method %s not found", msg.Method),
+		}
 	}
 
-	resMsg := JSONRPCMessage{
-		JSONRPC: JSONRPCVersion,
-		ID:      msg.ID,
-	}
+	return result, err
+}
 
-	if err != nil {
-		jsonErr := JSONRPCError{}
-		if errors.As(err, &jsonErr) {
-			s.logger.Error("failed to call server implementation",
-				slog.String("method", msg.Method),
-				slog.String("err", err.Error()))
-			resMsg.Error = &jsonErr
+// checkCapability checks that the server advertised the capability of the method to the client in
+// the initialization, so the methods of the capabilities that aren't advertised are rejected, even if
+// the server has their implementation.
+func (s serverSession) checkCapability(method string) error {
+	caps := s.state.getServerCapabilities()
+
+	var capability string
+	var supported bool
+	switch method {
+	case MethodPromptsList, MethodPromptsGet:
+		capability, supported = "prompts", caps.Prompts != nil
+	case MethodResourcesList, MethodResourcesRead, MethodResourcesTemplatesList:
+		capability, supported = "resources", caps.Resources != nil
+	case MethodResourcesSubscribe, MethodResourcesUnsubscribe:
+		capability, supported = "resources subscription", caps.Resources != nil && caps.Resources.Subscribe
+	case MethodToolsList, MethodToolsCall:
+		capability, supported = "tools", caps.Tools != nil
+	case MethodCompletionComplete:
+		// The completions capability is only advertised since 2025-03-26, the earlier revisions offer the
+		// completions along with the prompts and the resources.
+		capability, supported = "completions", caps.Completions != nil
+		if !protocolVersionAtLeast(s.state.getProtocolVersion(), ProtocolVersion20250326) {
+			supported = caps.Prompts != nil || caps.Resources != nil
 		}
-	} else if result != nil {
-		// Some call doesn't return any result, so this nil check is needed.
-		resMsg.Result, _ = json.Marshal(result)
+	case MethodLoggingSetLevel:
+		capability, supported = "logging", caps.Logging != nil
+	default:
+		return nil
+	}
+	if supported {
+		return nil
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), s.sendTimeout)
-	defer cancel()
-
-	if err := s.session.Send(ctx, resMsg); err != nil {
-		s.logger.Error("failed to send result", slog.String("err", err.Error()))
+	return JSONRPCError{
+		Code:    jsonRPCMethodNotFoundCode,
+		Message: fmt.Sprintf("%s capability is not advertised by server, %s is not allowed", capability, method),
 	}
 }
 
-func (s serverSession) initializationHandshake(msg JSONRPCMessage) (initializeResult, error) {
+func (s serverSession) initializationHandshake(msg JSONRPCMessage) (initializeParams, initializeResult, error) {
 	var params initializeParams
 	if err := json.Unmarshal(msg.Params, &params); err != nil {
-		return initializeResult{}, JSONRPCError{
+		return initializeParams{}, initializeResult{}, JSONRPCError{
 			Code:    jsonRPCInvalidParamsCode,
 			Message: fmt.Sprintf("failed to unmarshal params: %s", err.Error()),
 		}
 	}
 
-	if params.ProtocolVersion != protocolVersion {
-		return initializeResult{}, JSONRPCError{
-			Code:    jsonRPCInvalidParamsCode,
-			Message: fmt.Sprintf("protocol version mismatch: %s != %s", params.ProtocolVersion, protocolVersion),
-		}
-	}
+	// If the requested version is not supported, we propose our latest version, and let the client
+	// decide whether to continue with it.
+	version := negotiateProtocolVersion(params.ProtocolVersion, s.protocolVersions)
 
 	if s.requiredClientCap.Roots != nil {
 		if params.Capabilities.Roots == nil {
-			return initializeResult{}, JSONRPCError{
+			return initializeParams{}, initializeResult{}, JSONRPCError{
 				Code:    jsonRPCInvalidParamsCode,
 				Message: "insufficient client capabilities: missing required capability 'roots'",
 			}
 		}
 		if s.requiredClientCap.Roots.ListChanged {
 			if !params.Capabilities.Roots.ListChanged {
-				return initializeResult{}, JSONRPCError{
+				return initializeParams{}, initializeResult{}, JSONRPCError{
 					Code:    jsonRPCInvalidParamsCode,
 					Message: "insufficient client capabilities: missing required capability 'roots.listChanged'",
 				}
@@ -870,21 +1452,52 @@ func (s serverSession) initializationHandshake(msg JSONRPCMessage) (initializeRe
 
 	if s.requiredClientCap.Sampling != nil {
 		if params.Capabilities.Sampling == nil {
-			return initializeResult{}, JSONRPCError{
+			return initializeParams{}, initializeResult{}, JSONRPCError{
 				Code:    jsonRPCInvalidParamsCode,
 				Message: "insufficient client capabilities: missing required capability 'sampling'",
 			}
 		}
 	}
 
-	return initializeResult{
-		ProtocolVersion: protocolVersion,
-		Capabilities:    s.serverCap,
+	return params, initializeResult{
+		ProtocolVersion: version,
+		Capabilities:    s.capabilitiesFor(version),
 		ServerInfo:      s.serverInfo,
 		Instructions:    s.instructions,
 	}, nil
 }
 
+// capabilitiesFor returns the server capabilities, excluding the ones that are not defined in
+// the given protocol revision.
+func (s serverSession) capabilitiesFor(version string) ServerCapabilities {
+	caps := s.serverCap
+	if !protocolVersionAtLeast(version, ProtocolVersion20250326) {
+		caps.Completions = nil
+	}
+	return caps
+}
+
+// toolsFor returns the tools, excluding the output schemas and the annotations from the tools if
+// they're not defined in the given protocol revision. The given tools are left untouched, as they may
+// be shared by the ToolServer.
+func toolsFor(version string, tools []Tool) []Tool {
+	if protocolVersionAtLeast(version, ProtocolVersion20250618) {
+		return tools
+	}
+
+	res := make([]Tool, len(tools))
+	for i, tool := range tools {
+		// The output schemas are defined since 2025-06-18, while the annotations are defined since
+		// 2025-03-26.
+		tool.OutputSchema = nil
+		if !protocolVersionAtLeast(version, ProtocolVersion20250326) {
+			tool.Annotations = nil
+		}
+		res[i] = tool
+	}
+	return res
+}
+
 func (s serverSession) progressReporter(msgID MustString) func(ProgressParams) {
 	return func(params ProgressParams) {
 		paramsBs, err := json.Marshal(params)
@@ -909,25 +1522,79 @@ func (s serverSession) progressReporter(msgID MustString) func(ProgressParams) {
 	}
 }
 
-func (s serverSession) clientRequester(msgID MustString, results <-chan JSONRPCMessage) RequestClientFunc {
+// clientRequester returns the RequestClientFunc for the server implementation that handles a request
+// with the ctx. The returned function is safe to be called concurrently, as each of the requests to the
+// client is sent with its own unique ID.
+func (s serverSession) clientRequester(ctx context.Context) RequestClientFunc {
 	return func(msg JSONRPCMessage) (JSONRPCMessage, error) {
-		ctx, cancel := context.WithTimeout(context.Background(), s.sendTimeout)
+		return s.requestClient(ctx, msg)
+	}
+}
+
+// requestClient sends the request to the client with a unique ID, and waits for the client's response.
+// The waiting is stopped when ctx is done, e.g. when the client cancels the request being handled, or
+// the client request timeout is exceeded, in which case the client is notified of the cancellation.
+func (s serverSession) requestClient(ctx context.Context, msg JSONRPCMessage) (JSONRPCMessage, error) {
+	if s.clientRequestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.clientRequestTimeout)
 		defer cancel()
+	}
 
-		// Override the message ID, so we can intercept the result correctly in the main loop.
-		msg.ID = msgID
-		if err := s.session.Send(ctx, msg); err != nil {
-			return JSONRPCMessage{}, err
+	// Override the message ID, so we can intercept the result correctly in the main loop.
+	msgID := uuid.New().String()
+	msg.ID = MustString(msgID)
+
+	results := s.clientResults.register(msgID)
+	defer s.clientResults.unregister(msgID)
+
+	sendCtx, sendCancel := context.WithTimeout(ctx, s.sendTimeout)
+	defer sendCancel()
+
+	if err := s.session.Send(sendCtx, msg); err != nil {
+		return JSONRPCMessage{}, fmt.Errorf("failed to send %s request: %w", msg.Method, err)
+	}
+
+	select {
+	case <-ctx.Done():
+		s.sendCancellation(msg.ID, ctx.Err())
+		return JSONRPCMessage{}, fmt.Errorf("failed to wait for %s result: %w", msg.Method, ctx.Err())
+	case res, ok := <-results:
+		if !ok {
+			return JSONRPCMessage{}, errors.New("client session is closed")
 		}
+		return res, nil
+	}
+}
+
+// sendCancellation notifies the client that the request with msgID is cancelled, so the client can
+// stop processing it.
+func (s serverSession) sendCancellation(msgID MustString, reason error) {
+	params := notificationsCancelledParams{
+		RequestID: msgID,
+		Reason:    reason.Error(),
+	}
+	paramsBs, err := json.Marshal(params)
+	if err != nil {
+		s.logger.Error("failed to marshal cancellation params", slog.String("err", err.Error()))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.sendTimeout)
+	defer cancel()
 
-		return <-results, nil
+	if err := s.session.Send(ctx, JSONRPCMessage{
+		JSONRPC: JSONRPCVersion,
+		Method:  methodNotificationsCancelled,
+		Params:  paramsBs,
+	}); err != nil {
+		s.logger.Error("failed to send cancellation", slog.String("err", err.Error()))
 	}
 }
 
 func (s serverSession) callListPrompts(
 	ctx context.Context,
 	msg JSONRPCMessage,
-	results <-chan JSONRPCMessage,
 ) (ListPromptResult, error) {
 	if s.promptServer == nil {
 		return ListPromptResult{}, JSONRPCError{
@@ -944,13 +1611,9 @@ func (s serverSession) callListPrompts(
 		}
 	}
 
-	ps, err := s.promptServer.ListPrompts(ctx, params, s.progressReporter(msg.ID), s.clientRequester(msg.ID, results))
+	ps, err := s.promptServer.ListPrompts(ctx, params, s.progressReporter(msg.ID), s.clientRequester(ctx))
 	if err != nil {
-		nErr := fmt.Errorf("failed to list prompts: %w", err)
-		return ListPromptResult{}, JSONRPCError{
-			Code:    jsonRPCInternalErrorCode,
-			Message: nErr.Error(),
-		}
+		return ListPromptResult{}, fmt.Errorf("failed to list prompts: %w", err)
 	}
 
 	return ps, nil
@@ -959,7 +1622,6 @@ func (s serverSession) callListPrompts(
 func (s serverSession) callGetPrompt(
 	ctx context.Context,
 	msg JSONRPCMessage,
-	results <-chan JSONRPCMessage,
 ) (GetPromptResult, error) {
 	if s.promptServer == nil {
 		return GetPromptResult{}, JSONRPCError{
@@ -976,13 +1638,9 @@ func (s serverSession) callGetPrompt(
 		}
 	}
 
-	p, err := s.promptServer.GetPrompt(ctx, params, s.progressReporter(msg.ID), s.clientRequester(msg.ID, results))
+	p, err := s.promptServer.GetPrompt(ctx, params, s.progressReporter(msg.ID), s.clientRequester(ctx))
 	if err != nil {
-		nErr := fmt.Errorf("failed to get prompt: %w", err)
-		return GetPromptResult{}, JSONRPCError{
-			Code:    jsonRPCInternalErrorCode,
-			Message: nErr.Error(),
-		}
+		return GetPromptResult{}, fmt.Errorf("failed to get prompt: %w", err)
 	}
 
 	return p, nil
@@ -991,7 +1649,6 @@ func (s serverSession) callGetPrompt(
 func (s serverSession) callListResources(
 	ctx context.Context,
 	msg JSONRPCMessage,
-	results <-chan JSONRPCMessage,
 ) (ListResourcesResult, error) {
 	if s.resourceServer == nil {
 		return ListResourcesResult{}, JSONRPCError{
@@ -1008,13 +1665,9 @@ func (s serverSession) callListResources(
 		}
 	}
 
-	rs, err := s.resourceServer.ListResources(ctx, params, s.progressReporter(msg.ID), s.clientRequester(msg.ID, results))
+	rs, err := s.resourceServer.ListResources(ctx, params, s.progressReporter(msg.ID), s.clientRequester(ctx))
 	if err != nil {
-		nErr := fmt.Errorf("failed to list resources: %w", err)
-		return ListResourcesResult{}, JSONRPCError{
-			Code:    jsonRPCInternalErrorCode,
-			Message: nErr.Error(),
-		}
+		return ListResourcesResult{}, fmt.Errorf("failed to list resources: %w", err)
 	}
 
 	return rs, nil
@@ -1023,7 +1676,6 @@ func (s serverSession) callListResources(
 func (s serverSession) callReadResource(
 	ctx context.Context,
 	msg JSONRPCMessage,
-	results <-chan JSONRPCMessage,
 ) (ReadResourceResult, error) {
 	if s.resourceServer == nil {
 		return ReadResourceResult{}, JSONRPCError{
@@ -1040,13 +1692,9 @@ func (s serverSession) callReadResource(
 		}
 	}
 
-	r, err := s.resourceServer.ReadResource(ctx, params, s.progressReporter(msg.ID), s.clientRequester(msg.ID, results))
+	r, err := s.resourceServer.ReadResource(ctx, params, s.progressReporter(msg.ID), s.clientRequester(ctx))
 	if err != nil {
-		nErr := fmt.Errorf("failed to read resource: %w", err)
-		return ReadResourceResult{}, JSONRPCError{
-			Code:    jsonRPCInternalErrorCode,
-			Message: nErr.Error(),
-		}
+		return ReadResourceResult{}, fmt.Errorf("failed to read resource: %w", err)
 	}
 
 	return r, nil
@@ -1055,7 +1703,6 @@ func (s serverSession) callReadResource(
 func (s serverSession) callListResourceTemplates(
 	ctx context.Context,
 	msg JSONRPCMessage,
-	results <-chan JSONRPCMessage,
 ) (ListResourceTemplatesResult, error) {
 	if s.resourceServer == nil {
 		return ListResourceTemplatesResult{}, JSONRPCError{
@@ -1073,13 +1720,9 @@ func (s serverSession) callListResourceTemplates(
 	}
 
 	ts, err := s.resourceServer.ListResourceTemplates(ctx, params,
-		s.progressReporter(msg.ID), s.clientRequester(msg.ID, results))
+		s.progressReporter(msg.ID), s.clientRequester(ctx))
 	if err != nil {
-		nErr := fmt.Errorf("failed to list resource templates: %w", err)
-		return ListResourceTemplatesResult{}, JSONRPCError{
-			Code:    jsonRPCInternalErrorCode,
-			Message: nErr.Error(),
-		}
+		return ListResourceTemplatesResult{}, fmt.Errorf("failed to list resource templates: %w", err)
 	}
 
 	return ts, nil
@@ -1101,7 +1744,10 @@ func (s serverSession) callSubscribeResource(msg JSONRPCMessage) error {
 		}
 	}
 
-	s.resourceSubscriptionHandler.SubscribeResource(params)
+	// The handler is only asked to subscribe to the resource once, by its first subscriber.
+	if s.sessions.subscribe(s.session.ID(), params.URI) {
+		s.resourceSubscriptionHandler.SubscribeResource(params)
+	}
 
 	return nil
 }
@@ -1122,7 +1768,10 @@ func (s serverSession) callUnsubscribeResource(msg JSONRPCMessage) error {
 		}
 	}
 
-	s.resourceSubscriptionHandler.UnsubscribeResource(params)
+	// The handler is only asked to unsubscribe from the resource once it has no subscriber left.
+	if s.sessions.unsubscribe(s.session.ID(), params.URI) {
+		s.resourceSubscriptionHandler.UnsubscribeResource(params)
+	}
 
 	return nil
 }
@@ -1130,7 +1779,6 @@ func (s serverSession) callUnsubscribeResource(msg JSONRPCMessage) error {
 func (s serverSession) callCompletePrompt(
 	ctx context.Context,
 	msg JSONRPCMessage,
-	results <-chan JSONRPCMessage,
 ) (CompletionResult, error) {
 	if s.promptServer == nil {
 		return CompletionResult{}, JSONRPCError{
@@ -1147,13 +1795,9 @@ func (s serverSession) callCompletePrompt(
 		}
 	}
 
-	result, err := s.promptServer.CompletesPrompt(ctx, params, s.clientRequester(msg.ID, results))
+	result, err := s.promptServer.CompletesPrompt(ctx, params, s.clientRequester(ctx))
 	if err != nil {
-		nErr := fmt.Errorf("failed to complete prompt: %w", err)
-		return CompletionResult{}, JSONRPCError{
-			Code:    jsonRPCInternalErrorCode,
-			Message: nErr.Error(),
-		}
+		return CompletionResult{}, fmt.Errorf("failed to complete prompt: %w", err)
 	}
 
 	return result, nil
@@ -1162,7 +1806,6 @@ func (s serverSession) callCompletePrompt(
 func (s serverSession) callCompleteResource(
 	ctx context.Context,
 	msg JSONRPCMessage,
-	results <-chan JSONRPCMessage,
 ) (CompletionResult, error) {
 	if s.resourceServer == nil {
 		return CompletionResult{}, JSONRPCError{
@@ -1179,13 +1822,9 @@ func (s serverSession) callCompleteResource(
 		}
 	}
 
-	result, err := s.resourceServer.CompletesResourceTemplate(ctx, params, s.clientRequester(msg.ID, results))
+	result, err := s.resourceServer.CompletesResourceTemplate(ctx, params, s.clientRequester(ctx))
 	if err != nil {
-		nErr := fmt.Errorf("failed to complete resource template: %w", err)
-		return CompletionResult{}, JSONRPCError{
-			Code:    jsonRPCInternalErrorCode,
-			Message: nErr.Error(),
-		}
+		return CompletionResult{}, fmt.Errorf("failed to complete resource template: %w", err)
 	}
 
 	return result, nil
@@ -1194,7 +1833,6 @@ func (s serverSession) callCompleteResource(
 func (s serverSession) callListTools(
 	ctx context.Context,
 	msg JSONRPCMessage,
-	results <-chan JSONRPCMessage,
 ) (ListToolsResult, error) {
 	if s.toolServer == nil {
 		return ListToolsResult{}, JSONRPCError{
@@ -1211,14 +1849,11 @@ func (s serverSession) callListTools(
 		}
 	}
 
-	ts, err := s.toolServer.ListTools(ctx, params, s.progressReporter(msg.ID), s.clientRequester(msg.ID, results))
+	ts, err := s.toolServer.ListTools(ctx, params, s.progressReporter(msg.ID), s.clientRequester(ctx))
 	if err != nil {
-		nErr := fmt.Errorf("failed to list tools: %w", err)
-		return ListToolsResult{}, JSONRPCError{
-			Code:    jsonRPCInternalErrorCode,
-			Message: nErr.Error(),
-		}
+		return ListToolsResult{}, fmt.Errorf("failed to list tools: %w", err)
 	}
+	ts.Tools = toolsFor(s.state.getProtocolVersion(), ts.Tools)
 
 	return ts, nil
 }
@@ -1226,7 +1861,6 @@ func (s serverSession) callListTools(
 func (s serverSession) callCallTool(
 	ctx context.Context,
 	msg JSONRPCMessage,
-	results <-chan JSONRPCMessage,
 ) (CallToolResult, error) {
 	if s.toolServer == nil {
 		return CallToolResult{}, JSONRPCError{
@@ -1243,8 +1877,26 @@ func (s serverSession) callCallTool(
 		}
 	}
 
-	result, err := s.toolServer.CallTool(ctx, params, s.progressReporter(msg.ID), s.clientRequester(msg.ID, results))
+	if s.validateArguments {
+		invalid, err := s.validateToolArguments(ctx, params)
+		if err != nil {
+			return CallToolResult{}, JSONRPCError{
+				Code:    jsonRPCInternalErrorCode,
+				Message: fmt.Errorf("failed to get input schema of tool %s: %w", params.Name, err).Error(),
+			}
+		}
+		if invalid != nil {
+			return *invalid, nil
+		}
+	}
+
+	result, err := s.toolServer.CallTool(ctx, params, s.progressReporter(msg.ID), s.clientRequester(ctx))
 	if err != nil {
+		// The protocol errors, such as the unknown tool, are answered as the error response, while the
+		// errors of the tool execution are reported to the model in the result.
+		if _, ok := toJSONRPCError(err); ok {
+			return CallToolResult{}, fmt.Errorf("failed to call tool: %w", err)
+		}
 		result = CallToolResult{
 			Content: []Content{
 				{
@@ -1254,11 +1906,194 @@ func (s serverSession) callCallTool(
 			},
 			IsError: true,
 		}
+		return result, nil
+	}
+
+	if err := s.validateStructuredContent(ctx, params.Name, result); err != nil {
+		return CallToolResult{}, err
+	}
+
+	// The clients that don't support structured content still expect the result in the content.
+	if result.StructuredContent != nil && len(result.Content) == 0 {
+		result.Content = []Content{
+			{
+				Type: ContentTypeText,
+				Text: string(result.StructuredContent),
+			},
+		}
+	}
+	if !protocolVersionAtLeast(s.state.getProtocolVersion(), ProtocolVersion20250618) {
+		result.StructuredContent = nil
 	}
 
 	return result, nil
 }
 
+// validateStructuredContent validates the structured content of the successful tool result against
+// the output schema declared by the tool, if any. The result without structured content is not
+// validated, so the tools are only looked up for the results that need it.
+func (s serverSession) validateStructuredContent(
+	ctx context.Context,
+	toolName string,
+	result CallToolResult,
+) error {
+	if result.IsError || result.StructuredContent == nil {
+		return nil
+	}
+
+	schemas, _, err := s.toolSchemas.lookup(ctx, toolName, s.loadToolSchemas)
+	if err != nil {
+		return JSONRPCError{
+			Code:    jsonRPCInternalErrorCode,
+			Message: fmt.Errorf("failed to get output schema of tool %s: %w", toolName, err).Error(),
+		}
+	}
+	outputSchema := schemas.output
+	if outputSchema == nil {
+		return nil
+	}
+
+	if err := validateJSONSchema(outputSchema, result.StructuredContent); err != nil {
+		return JSONRPCError{
+			Code:    jsonRPCInternalErrorCode,
+			Message: fmt.Errorf("structured content of tool %s doesn't match its output schema: %w", toolName, err).Error(),
+		}
+	}
+
+	return nil
+}
+
+// validateToolArguments validates the arguments of the tool call against the cached input schema of
+// the tool. It returns the error result to answer the call with, if the arguments are invalid.
+func (s serverSession) validateToolArguments(ctx context.Context, params CallToolParams) (*CallToolResult, error) {
+	schemas, ok, err := s.toolSchemas.lookup(ctx, params.Name, s.loadToolSchemas)
+	if err != nil {
+		return nil, err
+	}
+	// The unknown tools are left to the ToolServer to report.
+	if !ok || schemas.input == nil {
+		return nil, nil
+	}
+
+	args := params.Arguments
+	if len(args) == 0 || string(args) == "null" {
+		args = json.RawMessage("{}")
+	}
+	if err := schemas.input.validateJSON(args); err != nil {
+		result := toolErrorResult(fmt.Sprintf("invalid arguments: %s", err))
+		return &result, nil
+	}
+	return nil, nil
+}
+
+// loadToolSchemas lists the schemas of all the tools. The input schemas are only parsed if the tool
+// arguments are validated, skipping the ones that can't be parsed, as the calls of those tools can't
+// be validated.
+func (s serverSession) loadToolSchemas(ctx context.Context) (map[string]toolSchemas, error) {
+	tools := make(map[string]toolSchemas)
+	err := s.listTools(ctx, func(tool Tool) bool {
+		schemas := toolSchemas{output: tool.OutputSchema}
+		if s.validateArguments && len(tool.InputSchema) > 0 {
+			var input jsonSchema
+			if err := json.Unmarshal(tool.InputSchema, &input); err != nil {
+				s.logger.Warn("failed to parse tool input schema, the tool arguments are not validated",
+					slog.String("tool", tool.Name),
+					slog.String("err", err.Error()))
+			} else {
+				schemas.input = &input
+			}
+		}
+		tools[tool.Name] = schemas
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tools, nil
+}
+
+// listTools calls yield with the tools through the pages of the tools list, until yield returns false.
+func (s serverSession) listTools(ctx context.Context, yield func(Tool) bool) error {
+	// The progress of the listing is not the progress of the tool call, so it's not reported.
+	noProgress := func(ProgressParams) {}
+
+	var params ListToolsParams
+	for {
+		ts, err := s.toolServer.ListTools(ctx, params, noProgress, s.clientRequester(ctx))
+		if err != nil {
+			return err
+		}
+		for _, tool := range ts.Tools {
+			if !yield(tool) {
+				return nil
+			}
+		}
+		// Stop on the repeated cursor as well, to avoid looping forever on the misbehaving implementation.
+		if ts.NextCursor == "" || ts.NextCursor == params.Cursor {
+			return nil
+		}
+		params.Cursor = ts.NextCursor
+	}
+}
+
+// lookup returns the schemas of the tool, listing the tools with load if they aren't cached yet. The
+// tools that aren't listed are reported as not found until the cache is invalidated, as the tools list
+// only changes along with its notification. The lock is not held while the tools are listed, so the
+// lookups of the cached tools aren't held behind a slow listing.
+func (c *toolSchemaCache) lookup(
+	ctx context.Context,
+	name string,
+	load func(context.Context) (map[string]toolSchemas, error),
+) (toolSchemas, bool, error) {
+	for {
+		c.mu.Lock()
+		if c.tools != nil {
+			schemas, ok := c.tools[name]
+			c.mu.Unlock()
+			return schemas, ok, nil
+		}
+		if loading := c.loading; loading != nil {
+			c.mu.Unlock()
+			select {
+			case <-loading:
+				// Look up again, or list the tools if the listing in progress failed.
+				continue
+			case <-ctx.Done():
+				return toolSchemas{}, false, ctx.Err()
+			}
+		}
+		loading := make(chan struct{})
+		c.loading = loading
+		generation := c.generation
+		c.mu.Unlock()
+
+		tools, err := load(ctx)
+
+		c.mu.Lock()
+		c.loading = nil
+		close(loading)
+		if err == nil && generation == c.generation {
+			c.tools = tools
+		}
+		c.mu.Unlock()
+
+		if err != nil {
+			return toolSchemas{}, false, err
+		}
+		schemas, ok := tools[name]
+		return schemas, ok, nil
+	}
+}
+
+// invalidate drops the cached schemas, so they're listed again on the next lookup.
+func (c *toolSchemaCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.tools = nil
+	c.generation++
+}
+
 func (s serverSession) callSetLogLevel(msg JSONRPCMessage) error {
 	if s.logHandler == nil {
 		return JSONRPCError{
@@ -1275,7 +2110,215 @@ func (s serverSession) callSetLogLevel(msg JSONRPCMessage) error {
 		}
 	}
 
+	s.state.setLogLevel(params.Level)
 	s.logHandler.SetLogLevel(params.Level)
 
 	return nil
 }
+
+func (s *serverSessionState) initialize(
+	version string,
+	params initializeParams,
+	serverCapabilities ServerCapabilities,
+) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.protocolVersion = version
+	s.clientInfo = params.ClientInfo
+	s.clientCapabilities = params.Capabilities
+	s.serverCapabilities = serverCapabilities
+}
+
+func (s *serverSessionState) getProtocolVersion() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.protocolVersion
+}
+
+func (s *serverSessionState) getServerCapabilities() ServerCapabilities {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.serverCapabilities
+}
+
+func (s *serverSessionState) getClientCapabilities() ClientCapabilities {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.clientCapabilities
+}
+
+func (s *serverSessionState) setLogLevel(level LogLevel) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.logLevel = level
+	s.logLevelSet = true
+}
+
+// logAllowed reports whether the log notification with the level should be sent to the client.
+func (s *serverSessionState) logAllowed(level LogLevel) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return !s.logLevelSet || level >= s.logLevel
+}
+
+func (s *serverSessionState) sessionInfo(id string) SessionInfo {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return SessionInfo{
+		ID:                 id,
+		ClientInfo:         s.clientInfo,
+		ClientCapabilities: s.clientCapabilities,
+		ServerCapabilities: s.serverCapabilities,
+		ProtocolVersion:    s.protocolVersion,
+	}
+}
+
+func (s *serverSessionRegistry) add(session serverSession) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions[session.session.ID()] = session
+}
+
+func (s *serverSessionRegistry) get(id string) (serverSession, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	return session, ok
+}
+
+// remove removes the session and its subscriptions, and returns the URIs of the resources that have no
+// subscriber left.
+func (s *serverSessionRegistry) remove(id string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, id)
+
+	var unsubscribed []string
+	for uri, subscribers := range s.subscriptions {
+		if _, ok := subscribers[id]; !ok {
+			continue
+		}
+		delete(subscribers, id)
+		if len(subscribers) == 0 {
+			delete(s.subscriptions, uri)
+			unsubscribed = append(unsubscribed, uri)
+		}
+	}
+	return unsubscribed
+}
+
+func (s *serverSessionRegistry) all() []serverSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sessions := make([]serverSession, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		sessions = append(sessions, session)
+	}
+	return sessions
+}
+
+// subscribe subscribes the session to the resource, and reports whether the session is the first
+// subscriber of the resource.
+func (s *serverSessionRegistry) subscribe(id, uri string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subscribers, ok := s.subscriptions[uri]
+	if !ok {
+		subscribers = make(map[string]struct{})
+		s.subscriptions[uri] = subscribers
+	}
+	subscribers[id] = struct{}{}
+	return !ok
+}
+
+// unsubscribe unsubscribes the session from the resource, and reports whether the resource has no
+// subscriber left.
+func (s *serverSessionRegistry) unsubscribe(id, uri string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subscribers, ok := s.subscriptions[uri]
+	if !ok {
+		return false
+	}
+	delete(subscribers, id)
+	if len(subscribers) > 0 {
+		return false
+	}
+	delete(s.subscriptions, uri)
+	return true
+}
+
+func (s *serverSessionRegistry) subscribed(id, uri string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.subscriptions[uri][id]
+	return ok
+}
+
+// subscribers returns the sessions subscribed to the resource.
+func (s *serverSessionRegistry) subscribers(uri string) []serverSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sessions := make([]serverSession, 0, len(s.subscriptions[uri]))
+	for id := range s.subscriptions[uri] {
+		if session, ok := s.sessions[id]; ok {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions
+}
+
+func clientRequestFromContext(ctx context.Context) (clientRequest, error) {
+	req, ok := ctx.Value(clientRequestContextKey{}).(clientRequest)
+	if !ok {
+		return clientRequest{}, errors.New("context doesn't come from a client request")
+	}
+	return req, nil
+}
+
+func (r clientRequest) clientCapabilities() ClientCapabilities {
+	return r.session.state.getClientCapabilities()
+}
+
+// call sends the request to the client, and decodes the client's result into the value pointed to by
+// result. The error response from the client is returned as JSONRPCError.
+func (r clientRequest) call(ctx context.Context, method string, params any, result any) error {
+	msg := JSONRPCMessage{
+		JSONRPC: JSONRPCVersion,
+		Method:  method,
+	}
+	if params != nil {
+		paramsBs, err := json.Marshal(params)
+		if err != nil {
+			return fmt.Errorf("failed to marshal params: %w", err)
+		}
+		msg.Params = paramsBs
+	}
+
+	resMsg, err := r.session.requestClient(ctx, msg)
+	if err != nil {
+		return err
+	}
+	if resMsg.Error != nil {
+		return *resMsg.Error
+	}
+	if err := json.Unmarshal(resMsg.Result, result); err != nil {
+		return fmt.Errorf("failed to unmarshal %s result: %w", method, err)
+	}
+	return nil
+}
@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"iter"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/MegaGrindStone/go-mcp"
@@ -46,8 +48,40 @@ type mockToolServer struct {
 	listParams mcp.ListToolsParams
 	callParams mcp.CallToolParams
 
-	requestRootsList bool
-	requestSampling  bool
+	protocolVersion string
+
+	requestRootsList   bool
+	requestSampling    bool
+	requestElicitation bool
+	requestWithHelpers bool
+	parallelSamplings  int
+
+	elicitedAction mcp.ElicitationAction
+	elicitedName   string
+
+	helperRoots    mcp.RootList
+	helperSampling mcp.SamplingResult
+	helperErr      error
+
+	samplingErrs []error
+
+	principal    mcp.Principal
+	hasPrincipal bool
+
+	session    mcp.SessionInfo
+	hasSession bool
+}
+
+type mockStructuredToolServer struct {
+	structuredContent json.RawMessage
+	// listCalls counts the calls of ListTools, if it's set.
+	listCalls *atomic.Int32
+}
+
+// mockSlowToolServer lists the tools once release is closed.
+type mockSlowToolServer struct {
+	listCalls *atomic.Int32
+	release   chan struct{}
 }
 
 type mockToolListUpdater struct {
@@ -63,6 +97,16 @@ type mockLogHandler struct {
 	done   chan struct{}
 }
 
+// mockSessionRecorder records the subscriptions and the log levels requested by the clients.
+type mockSessionRecorder struct {
+	lock          sync.Mutex
+	subscriptions []string
+	logLevels     []mcp.LogLevel
+
+	updates chan string
+	done    chan struct{}
+}
+
 type mockRootsListWatcher struct {
 	lock        sync.Mutex
 	updateCount int
@@ -204,12 +248,13 @@ func (m *mockResourceSubscriptionHandler) SubscribedResourceUpdates() iter.Seq[s
 }
 
 func (m *mockToolServer) ListTools(
-	_ context.Context,
+	ctx context.Context,
 	params mcp.ListToolsParams,
 	_ mcp.ProgressReporter,
 	clientFunc mcp.RequestClientFunc,
 ) (mcp.ListToolsResult, error) {
 	m.listParams = params
+	m.protocolVersion = mcp.ProtocolVersionFromContext(ctx)
 	if m.requestRootsList {
 		_, err := clientFunc(mcp.JSONRPCMessage{
 			JSONRPC: mcp.JSONRPCVersion,
@@ -223,7 +268,7 @@ func (m *mockToolServer) ListTools(
 }
 
 func (m *mockToolServer) CallTool(
-	_ context.Context,
+	ctx context.Context,
 	params mcp.CallToolParams,
 	_ mcp.ProgressReporter,
 	clientFunc mcp.RequestClientFunc,
@@ -243,10 +288,118 @@ func (m *mockToolServer) CallTool(
 			return mcp.CallToolResult{}, err
 		}
 	}
+	if m.requestElicitation {
+		var content struct {
+			Name string `json:"name"`
+		}
+		action, err := mcp.Elicit(ctx, mcp.ElicitationParams{
+			Message: "What is your name?",
+			RequestedSchema: json.RawMessage(`{
+				"type": "object",
+				"properties": {"name": {"type": "string"}},
+				"required": ["name"]
+			}`),
+		}, &content)
+		if err != nil {
+			return mcp.CallToolResult{}, err
+		}
+		m.elicitedAction = action
+		m.elicitedName = content.Name
+	}
+	if m.parallelSamplings > 0 {
+		m.samplingErrs = make([]error, m.parallelSamplings)
+		var wg sync.WaitGroup
+		for i := range m.parallelSamplings {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, m.samplingErrs[i] = mcp.CreateMessage(ctx, mcp.SamplingParams{})
+			}(i)
+		}
+		wg.Wait()
+	}
+	if m.requestWithHelpers {
+		m.helperRoots, m.helperErr = mcp.ListRoots(ctx)
+		if m.helperErr == nil {
+			m.helperSampling, m.helperErr = mcp.CreateMessage(ctx, mcp.SamplingParams{})
+		}
+		if m.helperErr == nil {
+			m.helperErr = mcp.Log(ctx, mcp.LogParams{
+				Level: mcp.LogLevelInfo,
+				Data:  json.RawMessage(`"called"`),
+			})
+		}
+	}
+	m.principal, m.hasPrincipal = mcp.PrincipalFromContext(ctx)
+	m.session, m.hasSession = mcp.SessionFromContext(ctx)
 	m.callParams = params
 	return mcp.CallToolResult{}, nil
 }
 
+func (m mockStructuredToolServer) ListTools(
+	context.Context,
+	mcp.ListToolsParams,
+	mcp.ProgressReporter,
+	mcp.RequestClientFunc,
+) (mcp.ListToolsResult, error) {
+	if m.listCalls != nil {
+		m.listCalls.Add(1)
+	}
+	return mcp.ListToolsResult{
+		Tools: []mcp.Tool{
+			{
+				Name:        "weather",
+				InputSchema: json.RawMessage(`{"type":"object"}`),
+				OutputSchema: json.RawMessage(`{
+					"type": "object",
+					"properties": {
+						"temperature": {"type": "number"},
+						"conditions": {"type": "string", "enum": ["sunny", "cloudy"]}
+					},
+					"required": ["temperature", "conditions"]
+				}`),
+			},
+		},
+	}, nil
+}
+
+func (m mockStructuredToolServer) CallTool(
+	context.Context,
+	mcp.CallToolParams,
+	mcp.ProgressReporter,
+	mcp.RequestClientFunc,
+) (mcp.CallToolResult, error) {
+	return mcp.CallToolResult{
+		StructuredContent: m.structuredContent,
+	}, nil
+}
+
+func (m mockSlowToolServer) ListTools(
+	ctx context.Context,
+	_ mcp.ListToolsParams,
+	_ mcp.ProgressReporter,
+	_ mcp.RequestClientFunc,
+) (mcp.ListToolsResult, error) {
+	m.listCalls.Add(1)
+	select {
+	case <-m.release:
+	case <-ctx.Done():
+		return mcp.ListToolsResult{}, ctx.Err()
+	}
+	return mcp.ListToolsResult{
+		Tools: []mcp.Tool{{Name: "slow", InputSchema: json.RawMessage(`{"type":"object"}`)}},
+	}, nil
+}
+
+func (m mockSlowToolServer) CallTool(
+	context.Context,
+	mcp.CallToolParams,
+	mcp.ProgressReporter,
+	mcp.RequestClientFunc,
+) (mcp.CallToolResult, error) {
+	return mcp.CallToolResult{Content: []mcp.Content{{Type: mcp.ContentTypeText, Text: "ok"}}}, nil
+}
+
 func (m mockToolListUpdater) ToolListUpdates() iter.Seq[struct{}] {
 	return func(yield func(struct{}) bool) {
 		for {
@@ -283,6 +436,47 @@ func (m *mockLogHandler) SetLogLevel(level mcp.LogLevel) {
 	m.level = level
 }
 
+func (m *mockSessionRecorder) SubscribeResource(params mcp.SubscribeResourceParams) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.subscriptions = append(m.subscriptions, params.URI)
+}
+
+func (m *mockSessionRecorder) UnsubscribeResource(mcp.UnsubscribeResourceParams) {}
+
+func (m *mockSessionRecorder) SubscribedResourceUpdates() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		for {
+			select {
+			case <-m.done:
+				return
+			case uri := <-m.updates:
+				if !yield(uri) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func (m *mockSessionRecorder) LogStreams() iter.Seq[mcp.LogParams] {
+	return func(func(mcp.LogParams) bool) {
+		<-m.done
+	}
+}
+
+func (m *mockSessionRecorder) SetLogLevel(level mcp.LogLevel) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.logLevels = append(m.logLevels, level)
+}
+
+func (m *mockSessionRecorder) recorded() ([]string, []mcp.LogLevel) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return slices.Clone(m.subscriptions), slices.Clone(m.logLevels)
+}
+
 func (m *mockRootsListWatcher) OnRootsListChanged() {
 	m.lock.Lock()
 	defer m.lock.Unlock()
@@ -9,7 +9,6 @@ import (
 	"time"
 
 	"github.com/MegaGrindStone/go-mcp"
-	"github.com/google/uuid"
 )
 
 var toolList = []mcp.Tool{
@@ -59,10 +58,10 @@ func (s *Server) ListTools(
 
 // CallTool implements mcp.ToolServer interface.
 func (s *Server) CallTool(
-	_ context.Context,
+	ctx context.Context,
 	params mcp.CallToolParams,
 	progressReporter mcp.ProgressReporter,
-	requestClient mcp.RequestClientFunc,
+	_ mcp.RequestClientFunc,
 ) (mcp.CallToolResult, error) {
 	s.log(fmt.Sprintf("CallTool: %s", params.Name), mcp.LogLevelDebug)
 
@@ -76,7 +75,7 @@ func (s *Server) CallTool(
 	case "printEnv":
 		return s.callPrintEnv(params)
 	case "sampleLLM":
-		return s.callSampleLLM(params, requestClient)
+		return s.callSampleLLM(ctx, params)
 	case "getTinyImage":
 		return s.callGetTinyImage(params)
 	default:
@@ -169,10 +168,7 @@ func (s *Server) callPrintEnv(_ mcp.CallToolParams) (mcp.CallToolResult, error)
 	}, nil
 }
 
-func (s *Server) callSampleLLM(
-	params mcp.CallToolParams,
-	requestClient mcp.RequestClientFunc,
-) (mcp.CallToolResult, error) {
+func (s *Server) callSampleLLM(ctx context.Context, params mcp.CallToolParams) (mcp.CallToolResult, error) {
 	var sllArgs SampleLLMArgs
 	if err := json.Unmarshal(params.Arguments, &sllArgs); err != nil {
 		return mcp.CallToolResult{}, err
@@ -197,26 +193,11 @@ func (s *Server) callSampleLLM(
 		MaxTokens:     int(sllArgs.MaxTokens),
 	}
 
-	samplingParamsBs, err := json.Marshal(samplingParams)
-	if err != nil {
-		return mcp.CallToolResult{}, fmt.Errorf("failed to marshal sampling params: %w", err)
-	}
-
-	resMsg, err := requestClient(mcp.JSONRPCMessage{
-		JSONRPC: mcp.JSONRPCVersion,
-		ID:      mcp.MustString(uuid.New().String()),
-		Method:  mcp.MethodSamplingCreateMessage,
-		Params:  samplingParamsBs,
-	})
+	samplingResult, err := mcp.CreateMessage(ctx, samplingParams)
 	if err != nil {
 		return mcp.CallToolResult{}, fmt.Errorf("failed to request sampling: %w", err)
 	}
 
-	var samplingResult mcp.SamplingResult
-	if err := json.Unmarshal(resMsg.Result, &samplingResult); err != nil {
-		return mcp.CallToolResult{}, fmt.Errorf("failed to unmarshal sampling result: %w", err)
-	}
-
 	return mcp.CallToolResult{
 		Content: []mcp.Content{
 			{
@@ -21,6 +21,7 @@ if the file cannot be read. Use this tool when you need to examine
 the contents of a single file. Only works within allowed directories.,
         `,
 			InputSchema: readFileSchema,
+			Annotations: readOnlyTool("Read File"),
 		},
 		{
 			Name: "read_multiple_files",
@@ -32,6 +33,7 @@ path as a reference. Failed reads for individual files won't stop
 the entire operation. Only works within allowed directories.
         `,
 			InputSchema: readMultipleFilesSchema,
+			Annotations: readOnlyTool("Read Multiple Files"),
 		},
 		{
 			Name: "write_file",
@@ -41,6 +43,7 @@ Use with caution as it will overwrite existing files without warning.
 Handles text content with proper encoding. Only works within allowed directories.
         `,
 			InputSchema: writeFileSchema,
+			Annotations: destructiveTool("Write File", true),
 		},
 		{
 			Name: "edit_file",
@@ -50,6 +53,7 @@ with new content. Returns a git-style diff showing the changes made.
 Only works within allowed directories.
         `,
 			InputSchema: editFileSchema,
+			Annotations: destructiveTool("Edit File", false),
 		},
 		{
 			Name: "create_directory",
@@ -60,6 +64,7 @@ this operation will succeed silently. Perfect for setting up directory
 structures for projects or ensuring required paths exist. Only works within allowed directories.
         `,
 			InputSchema: createDirectorySchema,
+			Annotations: additiveTool("Create Directory", true),
 		},
 		{
 			Name: "list_directory",
@@ -70,6 +75,7 @@ prefixes. This tool is essential for understanding directory structure and
 finding specific files within a directory. Only works within allowed directories.
         `,
 			InputSchema: listDirectorySchema,
+			Annotations: readOnlyTool("List Directory"),
 		},
 		{
 			Name: "directory_tree",
@@ -80,6 +86,7 @@ Files have no children array, while directories always have a children array (wh
 The output is formatted with 2-space indentation for readability. Only works within allowed directories.
         `,
 			InputSchema: directoryTreeSchema,
+			Annotations: readOnlyTool("Directory Tree"),
 		},
 		{
 			Name: "move_file",
@@ -89,6 +96,7 @@ operation will fail. Works across different directories and can be used
 for simple renaming within the same directory. Both source and destination must be within allowed directories.
         `,
 			InputSchema: moveFileSchema,
+			Annotations: additiveTool("Move File", false),
 		},
 		{
 			Name: "search_files",
@@ -99,6 +107,7 @@ matching items. Great for finding files when you don't know their exact location
 Only searches within allowed directories.
         `,
 			InputSchema: searchFilesSchema,
+			Annotations: readOnlyTool("Search Files"),
 		},
 		{
 			Name: "get_file_info",
@@ -108,15 +117,52 @@ and type. This tool is perfect for understanding file characteristics
 without reading the actual content. Only works within allowed directories.
         `,
 			InputSchema: getFileInfoSchema,
+			Annotations: readOnlyTool("Get File Info"),
 		},
 		{
 			Name:        "list_allowed_directories",
 			Description: ``,
 			InputSchema: listAllowedDirectoriesSchema,
+			Annotations: readOnlyTool("List Allowed Directories"),
 		},
 	},
 }
 
+// readOnlyTool annotates the tools that only read the file system, which is a closed domain.
+func readOnlyTool(title string) *mcp.ToolAnnotations {
+	return &mcp.ToolAnnotations{
+		Title:         title,
+		ReadOnlyHint:  hint(true),
+		OpenWorldHint: hint(false),
+	}
+}
+
+// additiveTool annotates the tools that create or move the files, without losing any content.
+func additiveTool(title string, idempotent bool) *mcp.ToolAnnotations {
+	return &mcp.ToolAnnotations{
+		Title:           title,
+		ReadOnlyHint:    hint(false),
+		DestructiveHint: hint(false),
+		IdempotentHint:  hint(idempotent),
+		OpenWorldHint:   hint(false),
+	}
+}
+
+// destructiveTool annotates the tools that overwrite the content of the files.
+func destructiveTool(title string, idempotent bool) *mcp.ToolAnnotations {
+	return &mcp.ToolAnnotations{
+		Title:           title,
+		ReadOnlyHint:    hint(false),
+		DestructiveHint: hint(true),
+		IdempotentHint:  hint(idempotent),
+		OpenWorldHint:   hint(false),
+	}
+}
+
+func hint(value bool) *bool {
+	return &value
+}
+
 func readFile(rootPaths []string, params mcp.CallToolParams) (mcp.CallToolResult, error) {
 	var rfParams ReadFileArgs
 	if err := json.Unmarshal(params.Arguments, &rfParams); err != nil {
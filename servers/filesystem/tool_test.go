@@ -354,3 +354,32 @@ func cleanup(t *testing.T, path string) {
 		t.Errorf("Failed to cleanup: %v", err)
 	}
 }
+
+func TestToolAnnotations(t *testing.T) {
+	destructive := map[string]bool{
+		"write_file": true,
+		"edit_file":  true,
+	}
+	modifying := map[string]bool{
+		"write_file":       true,
+		"edit_file":        true,
+		"create_directory": true,
+		"move_file":        true,
+	}
+
+	for _, tool := range toolList.Tools {
+		if tool.Annotations == nil || tool.Annotations.Title == "" {
+			t.Errorf("Expected tool %s to be annotated with a title", tool.Name)
+			continue
+		}
+		if got := tool.Annotations.IsReadOnly(); got == modifying[tool.Name] {
+			t.Errorf("Expected tool %s read-only %v, got %v", tool.Name, !modifying[tool.Name], got)
+		}
+		if got := tool.Annotations.IsDestructive(); got != destructive[tool.Name] {
+			t.Errorf("Expected tool %s destructive %v, got %v", tool.Name, destructive[tool.Name], got)
+		}
+		if tool.Annotations.IsOpenWorld() {
+			t.Errorf("Expected tool %s not to be open world", tool.Name)
+		}
+	}
+}
@@ -10,6 +10,7 @@ var toolList = mcp.ListToolsResult{
 Create multiple new entities in the knowledge graph.
       `,
 			InputSchema: createEntitiesSchema,
+			Annotations: additiveTool("Create Entities"),
 		},
 		{
 			Name: "create_relations",
@@ -17,6 +18,7 @@ Create multiple new entities in the knowledge graph.
 Create multiple new relations between entities in the knowledge graph. Relations should be in active voice.
       `,
 			InputSchema: createRelationsSchema,
+			Annotations: additiveTool("Create Relations"),
 		},
 		{
 			Name: "add_observations",
@@ -24,6 +26,7 @@ Create multiple new relations between entities in the knowledge graph. Relations
 Add new observations to existing entities in the knowledge graph.
       `,
 			InputSchema: addObservationsSchema,
+			Annotations: additiveTool("Add Observations"),
 		},
 		{
 			Name: "delete_entities",
@@ -31,6 +34,7 @@ Add new observations to existing entities in the knowledge graph.
 Delete multiple entities and their associated relations from the knowledge graph.
       `,
 			InputSchema: deleteEntitiesSchema,
+			Annotations: destructiveTool("Delete Entities"),
 		},
 		{
 			Name: "delete_observations",
@@ -38,6 +42,7 @@ Delete multiple entities and their associated relations from the knowledge graph
 Delete specific observations from entities in the knowledge graph.
       `,
 			InputSchema: deleteObservationsSchema,
+			Annotations: destructiveTool("Delete Observations"),
 		},
 		{
 			Name: "delete_relations",
@@ -45,6 +50,7 @@ Delete specific observations from entities in the knowledge graph.
 Delete multiple relations from the knowledge graph.
       `,
 			InputSchema: deleteRelationsSchema,
+			Annotations: destructiveTool("Delete Relations"),
 		},
 		{
 			Name: "read_graph",
@@ -52,6 +58,7 @@ Delete multiple relations from the knowledge graph.
 Read the entire knowledge graph.
       `,
 			InputSchema: readGraphSchema,
+			Annotations: readOnlyTool("Read Graph"),
 		},
 		{
 			Name: "search_nodes",
@@ -59,6 +66,7 @@ Read the entire knowledge graph.
 Search for nodes in the knowledge graph based on a query.
       `,
 			InputSchema: searchNodesSchema,
+			Annotations: readOnlyTool("Search Nodes"),
 		},
 		{
 			Name: "open_nodes",
@@ -66,6 +74,44 @@ Search for nodes in the knowledge graph based on a query.
 Open specific nodes in the knowledge graph by their names.
       `,
 			InputSchema: openNodesSchema,
+			Annotations: readOnlyTool("Open Nodes"),
 		},
 	},
 }
+
+// readOnlyTool annotates the tools that only read the knowledge graph, which is a closed domain.
+func readOnlyTool(title string) *mcp.ToolAnnotations {
+	return &mcp.ToolAnnotations{
+		Title:         title,
+		ReadOnlyHint:  hint(true),
+		OpenWorldHint: hint(false),
+	}
+}
+
+// additiveTool annotates the tools that add to the knowledge graph, skipping what already exists, so
+// they're idempotent.
+func additiveTool(title string) *mcp.ToolAnnotations {
+	return &mcp.ToolAnnotations{
+		Title:           title,
+		ReadOnlyHint:    hint(false),
+		DestructiveHint: hint(false),
+		IdempotentHint:  hint(true),
+		OpenWorldHint:   hint(false),
+	}
+}
+
+// destructiveTool annotates the tools that delete from the knowledge graph, deleting what is already
+// deleted has no effect, so they're idempotent.
+func destructiveTool(title string) *mcp.ToolAnnotations {
+	return &mcp.ToolAnnotations{
+		Title:           title,
+		ReadOnlyHint:    hint(false),
+		DestructiveHint: hint(true),
+		IdempotentHint:  hint(true),
+		OpenWorldHint:   hint(false),
+	}
+}
+
+func hint(value bool) *bool {
+	return &value
+}
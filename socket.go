@@ -0,0 +1,225 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SocketServer implements a server transport that accepts the client connections on a net.Listener,
+// such as a Unix domain socket or a TCP listener, so a local server can serve several clients at
+// once without HTTP. Every accepted connection becomes its own session, with the same
+// newline-delimited JSON message framing as StdIO.
+//
+// Instances should be created using NewSocketServer and properly shut down using Shutdown when
+// no longer needed, which also closes the listener.
+type SocketServer struct {
+	listener net.Listener
+	logger   *slog.Logger
+
+	done      chan struct{}
+	closed    chan struct{}
+	closeOnce *sync.Once
+}
+
+// SocketServerOption represents the options for the SocketServer.
+type SocketServerOption func(*SocketServer)
+
+// SocketClient implements a client transport that connects to the SocketServer with a net.Dialer,
+// and communicates with the same newline-delimited JSON message framing as StdIO. Every
+// StartSession dials a new connection, so the client is able to start a new session after the
+// previous one ends.
+//
+// Instances should be created using NewSocketClient.
+type SocketClient struct {
+	network string
+	address string
+	dialer  *net.Dialer
+	logger  *slog.Logger
+}
+
+// SocketClientOption represents the options for the SocketClient.
+type SocketClientOption func(*SocketClient)
+
+type socketSession struct {
+	stdIOSession
+
+	conn net.Conn
+}
+
+const maxSocketAcceptDelay = time.Second
+
+// NewSocketServer creates a new SocketServer that accepts the connections on the listener, for
+// example the one returned by net.Listen("unix", path) or net.Listen("tcp", address).
+func NewSocketServer(listener net.Listener, options ...SocketServerOption) SocketServer {
+	s := SocketServer{
+		listener:  listener,
+		logger:    slog.Default(),
+		done:      make(chan struct{}),
+		closed:    make(chan struct{}),
+		closeOnce: &sync.Once{},
+	}
+
+	for _, opt := range options {
+		opt(&s)
+	}
+
+	return s
+}
+
+// WithSocketServerLogger sets the logger for the SocketServer sessions.
+func WithSocketServerLogger(logger *slog.Logger) SocketServerOption {
+	return func(s *SocketServer) {
+		s.logger = logger.With(
+			slog.String("package", "go-mcp"),
+			slog.String("component", "socket-server"),
+		)
+	}
+}
+
+// NewSocketClient creates a new SocketClient that connects to the address on the named network,
+// with the same arguments as net.Dial, such as "unix" and the path of the socket, or "tcp" and the
+// host and port of the server.
+func NewSocketClient(network, address string, options ...SocketClientOption) SocketClient {
+	c := SocketClient{
+		network: network,
+		address: address,
+		dialer:  &net.Dialer{},
+		logger:  slog.Default(),
+	}
+
+	for _, opt := range options {
+		opt(&c)
+	}
+
+	return c
+}
+
+// WithSocketClientDialer sets the net.Dialer used to connect to the server, to configure the
+// timeout, the keepalive, or the local address of the connections.
+func WithSocketClientDialer(dialer *net.Dialer) SocketClientOption {
+	return func(c *SocketClient) {
+		c.dialer = dialer
+	}
+}
+
+// WithSocketClientLogger sets the logger for the SocketClient sessions.
+func WithSocketClientLogger(logger *slog.Logger) SocketClientOption {
+	return func(c *SocketClient) {
+		c.logger = logger.With(
+			slog.String("package", "go-mcp"),
+			slog.String("component", "socket-client"),
+		)
+	}
+}
+
+// Sessions implements the ServerTransport interface by accepting the connections on the listener,
+// and yielding a new session for every accepted connection, until the server is shut down.
+func (s SocketServer) Sessions() iter.Seq[Session] {
+	return func(yield func(Session) bool) {
+		defer close(s.closed)
+
+		var delay time.Duration
+		for {
+			conn, err := s.listener.Accept()
+			if err != nil {
+				select {
+				case <-s.done:
+					return
+				default:
+				}
+				if errors.Is(err, net.ErrClosed) {
+					s.logger.Error("listener is closed", slog.String("err", err.Error()))
+					return
+				}
+
+				// Retry the failed accept, such as when the process runs out of file descriptors, with
+				// an increasing delay, as net/http does.
+				delay = min(max(2*delay, 5*time.Millisecond), maxSocketAcceptDelay)
+				s.logger.Warn("failed to accept connection, retrying",
+					slog.String("err", err.Error()),
+					slog.Duration("delay", delay))
+				select {
+				case <-s.done:
+					return
+				case <-time.After(delay):
+				}
+				continue
+			}
+			delay = 0
+
+			if !yield(newSocketSession(conn, s.logger)) {
+				return
+			}
+		}
+	}
+}
+
+// Shutdown implements the ServerTransport interface by closing the listener, so no more connections
+// are accepted. The established sessions are left to be stopped by the caller.
+func (s SocketServer) Shutdown(ctx context.Context) error {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		if err := s.listener.Close(); err != nil {
+			s.logger.Warn("failed to close listener", slog.String("err", err.Error()))
+		}
+	})
+
+	// Wait for Sessions loop to breaks.
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("failed to close socket server: %w", ctx.Err())
+	case <-s.closed:
+	}
+	return nil
+}
+
+// StartSession implements the ClientTransport interface by dialing a new connection to the server,
+// and returning the session of the connection.
+func (c SocketClient) StartSession(ctx context.Context) (Session, error) {
+	conn, err := c.dialer.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s %s: %w", c.network, c.address, err)
+	}
+	return newSocketSession(conn, c.logger), nil
+}
+
+func newSocketSession(conn net.Conn, logger *slog.Logger) socketSession {
+	id := uuid.New().String()
+	sess := socketSession{
+		stdIOSession: stdIOSession{
+			id:            id,
+			reader:        conn,
+			writer:        conn,
+			logger:        logger.With(slog.String("sessionID", id)),
+			writeMessages: make(chan stdIOMessage),
+			done:          make(chan struct{}),
+			readClosed:    make(chan struct{}),
+			writeClosed:   make(chan struct{}),
+		},
+		conn: conn,
+	}
+
+	go sess.processWriteMessages()
+
+	return sess
+}
+
+// Stop implements the Session interface by closing the connection, which also ends the session of
+// the other party.
+func (s socketSession) Stop() {
+	close(s.done)
+	// Closing the connection unblocks the pending read and write of the session.
+	if err := s.conn.Close(); err != nil {
+		s.logger.Warn("failed to close connection", slog.String("err", err.Error()))
+	}
+	<-s.readClosed
+	<-s.writeClosed
+}
@@ -0,0 +1,146 @@
+package mcp_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MegaGrindStone/go-mcp"
+)
+
+func TestSocketConcurrentSessions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mcp.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	registry := mcp.NewRegistry()
+	defer registry.Close()
+	registry.AddTool(mcp.Tool{Name: "echo"}, nil)
+
+	srv := mcp.NewServer(mcp.Info{Name: "test-server", Version: "1.0"},
+		mcp.NewSocketServer(listener, mcp.WithSocketServerLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))),
+		mcp.WithToolServer(registry),
+		mcp.WithServerLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	go srv.Serve()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	clientTransport := mcp.NewSocketClient("unix", path,
+		mcp.WithSocketClientLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+
+	// Every client is connected at the same time, before any of them disconnects.
+	const clientsCount = 3
+	clients := make([]*mcp.Client, clientsCount)
+	for i := range clients {
+		clients[i] = mcp.NewClient(mcp.Info{Name: fmt.Sprintf("test-client-%d", i), Version: "1.0"}, clientTransport,
+			mcp.WithClientLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+		if err := clients[i].Connect(ctx); err != nil {
+			t.Fatalf("client %d failed to connect: %v", i, err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, clientsCount)
+	for i, cli := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tools, err := cli.ListTools(ctx, mcp.ListToolsParams{})
+			if err != nil {
+				errs <- fmt.Errorf("client %d failed to list tools: %w", i, err)
+				return
+			}
+			if len(tools.Tools) != 1 {
+				errs <- fmt.Errorf("client %d expected 1 tool, got %d", i, len(tools.Tools))
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	for i, cli := range clients {
+		if err := cli.Disconnect(ctx); err != nil {
+			t.Errorf("client %d failed to disconnect: %v", i, err)
+		}
+	}
+
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("failed to shutdown server: %v", err)
+	}
+	if _, err := clientTransport.StartSession(ctx); err == nil {
+		t.Error("expected error connecting to the shut down server")
+	}
+}
+
+func TestSocketSessionEnd(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	serverTransport := mcp.NewSocketServer(listener,
+		mcp.WithSocketServerLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+
+	sessions := make(chan mcp.Session, 1)
+	go func() {
+		for sess := range serverTransport.Sessions() {
+			sessions <- sess
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	defer serverTransport.Shutdown(ctx)
+
+	clientTransport := mcp.NewSocketClient("tcp", listener.Addr().String(),
+		mcp.WithSocketClientDialer(&net.Dialer{Timeout: time.Second}),
+		mcp.WithSocketClientLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	cliSession, err := clientTransport.StartSession(ctx)
+	if err != nil {
+		t.Fatalf("failed to start session: %v", err)
+	}
+	srvSession := <-sessions
+
+	received := make(chan mcp.JSONRPCMessage, 1)
+	go func() {
+		for msg := range srvSession.Messages() {
+			received <- msg
+		}
+		close(received)
+	}()
+	go func() {
+		for range cliSession.Messages() {
+		}
+	}()
+
+	msg := mcp.JSONRPCMessage{JSONRPC: mcp.JSONRPCVersion, Method: "hello"}
+	if err := cliSession.Send(ctx, msg); err != nil {
+		t.Fatalf("failed to send message: %v", err)
+	}
+	if got := <-received; got.Method != msg.Method {
+		t.Errorf("expected message %s, got %s", msg.Method, got.Method)
+	}
+
+	// Stopping the client session closes the connection, which ends the server session.
+	cliSession.Stop()
+	select {
+	case _, ok := <-received:
+		if ok {
+			t.Error("expected no more messages")
+		}
+	case <-ctx.Done():
+		t.Fatal("expected the server session to end")
+	}
+	srvSession.Stop()
+}
@@ -11,6 +11,11 @@ import (
 	"log/slog"
 	"net/http"
 	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/tmaxmax/go-sse"
@@ -24,12 +29,26 @@ import (
 // capabilities through its HandleSSE and HandleMessage http.Handlers. These handlers can
 // be integrated with any HTTP framework.
 //
+// Every message is sent with an event ID, formed by the session ID and a sequence number that
+// increases monotonically, and the latest messages of each session are kept in a bounded buffer.
+// When the client reconnects to HandleSSE with the Last-Event-ID header, the stream is resumed on
+// the same session, and the messages the client missed are sent again.
+//
+// With WithSSEServerAuthenticator, the SSE connection is authenticated, and the resulting principal
+// is bound to the session, so the messages and the resumed streams of the session are only accepted
+// from the same principal.
+//
 // Instances should be created using NewSSEServer and properly shut down using Shutdown when
 // no longer needed.
 type SSEServer struct {
-	messageURL string
-	scheme     string
-	logger     *slog.Logger
+	messageURL       string
+	scheme           string
+	replayBufferSize int
+	authenticator    SSEAuthenticator
+	logger           *slog.Logger
+
+	// registry holds the active sessions, so the streams can be resumed by the reconnecting clients.
+	registry *sseSessionRegistry
 
 	sessions         chan sseServerSession
 	removedSessions  chan string
@@ -42,33 +61,58 @@ type SSEServer struct {
 // SSEServerOption represents the options for the SSEServer.
 type SSEServerOption func(*SSEServer)
 
+// SSEAuthenticator authenticates the HTTP requests received by the SSEServer handlers, and returns
+// the principal of the client. The request is rejected with 401 Unauthorized if it returns an error,
+// or with the status and the challenge of the error if it's a BearerTokenError, see
+// NewBearerTokenAuthenticator.
+type SSEAuthenticator func(r *http.Request) (Principal, error)
+
 // SSEClient implements a Server-Sent Events (SSE) client that manages server connections
 // and bidirectional message handling. It provides real-time communication through SSE for
-// server-to-client streaming and HTTP POST for client-to-server messages.
+// server-to-client streaming and HTTP POST for client-to-server messages. Once the Client is
+// initialized, the requests carry the negotiated protocol version in the MCP-Protocol-Version header.
 // Instances should be created using NewSSEClient.
 type SSEClient struct {
 	httpClient *http.Client
 	connectURL string
-	messageURL string
 	logger     *slog.Logger
 
 	maxPayloadSize int
-
-	requestCancel context.CancelFunc
-
-	messages chan JSONRPCMessage
-	closed   chan struct{}
+	resumeAttempts int
+	resumeDelay    time.Duration
+
+	// The fields below are guarded by mu, as they're replaced on every StartSession, so the client
+	// is able to start a new session after the previous one ends.
+	mu              sync.Mutex
+	messageURL      string
+	protocolVersion string
+	requestCancel   context.CancelFunc
+	messages        chan JSONRPCMessage
+	closed          chan struct{}
 }
 
 // SSEClientOption represents the options for the SSEClient.
 type SSEClientOption func(*SSEClient)
 
+type sseSessionRegistry struct {
+	mu       sync.Mutex
+	sessions map[string]sseServerSession
+}
+
 type sseServerSession struct {
-	id           string
-	sess         *sse.Session
-	sendMsgs     chan sseServerSessionSendMsg
-	receivedMsgs chan JSONRPCMessage
-	logger       *slog.Logger
+	id string
+	// principal is the authenticated client of the session, it's nil if the server doesn't
+	// authenticate the clients.
+	principal        *Principal
+	sendMsgs         chan sseServerSessionSendMsg
+	receivedMsgs     chan JSONRPCMessage
+	replayBufferSize int
+	logger           *slog.Logger
+
+	// The streams are attached and detached through these channels, so they're only written by the
+	// processSendMessages goroutine.
+	attachStreams chan sseStreamAttachment
+	detachStreams chan chan struct{}
 
 	done           chan struct{}
 	sendClosed     chan struct{}
@@ -85,6 +129,32 @@ type sseServerSessionSendMsg struct {
 	errs chan<- error
 }
 
+// sseClientStream holds the state of the stream read by the SSEClient, which is kept when the stream
+// is resumed.
+type sseClientStream struct {
+	messages    chan<- JSONRPCMessage
+	initErrs    chan<- error
+	messageURL  string
+	lastEventID string
+	events      int
+}
+
+// sseStreamAttachment is the request to write the session's messages to a new stream, after the
+// messages that are sent after lastSeq are sent again.
+type sseStreamAttachment struct {
+	stream  *sse.Session
+	lastSeq uint64
+	// detached is closed when the session stops writing to the stream.
+	detached chan struct{}
+}
+
+var (
+	defaultSSEServerReplayBufferSize = 100
+
+	defaultSSEClientResumeAttempts = 3
+	defaultSSEClientResumeDelay    = 500 * time.Millisecond
+)
+
 // NewSSEServer creates and initializes a new SSE server that listens for client connections
 // at the specified messageURL. The server is immediately operational upon creation with
 // initialized internal channels for session and message management. The returned SSEServer
@@ -93,7 +163,11 @@ func NewSSEServer(messageURL string, options ...SSEServerOption) SSEServer {
 	s := SSEServer{
 		messageURL:       messageURL,
 		scheme:           "http",
+		replayBufferSize: defaultSSEServerReplayBufferSize,
 		logger:           slog.Default(),
+		registry: &sseSessionRegistry{
+			sessions: make(map[string]sseServerSession),
+		},
 		sessions:         make(chan sseServerSession, 5),
 		removedSessions:  make(chan string),
 		receivedMessages: make(chan sseSessionMessage, 100),
@@ -118,6 +192,25 @@ func WithSSEServerLogger(logger *slog.Logger) SSEServerOption {
 	}
 }
 
+// WithSSEServerReplayBufferSize sets the number of the latest messages kept for each session, to be
+// sent again when the client resumes its stream. If not set, the latest 100 messages are kept, and
+// zero disables the replay.
+func WithSSEServerReplayBufferSize(size int) SSEServerOption {
+	return func(s *SSEServer) {
+		s.replayBufferSize = size
+	}
+}
+
+// WithSSEServerAuthenticator sets the authenticator for the requests received by HandleSSE and
+// HandleMessage. The principal that established the session is bound to it, so the messages and the
+// resumed streams of the session from another principal are rejected with 403 Forbidden. The principal
+// is available to the server implementations through PrincipalFromContext.
+func WithSSEServerAuthenticator(authenticator SSEAuthenticator) SSEServerOption {
+	return func(s *SSEServer) {
+		s.authenticator = authenticator
+	}
+}
+
 // WithSSEScheme sets the scheme (http or https) for the SSE server. This is used to
 // construct the message URL for clients. If not set, the default scheme is "http".
 func WithSSEScheme(scheme string) SSEServerOption {
@@ -135,11 +228,11 @@ func NewSSEClient(connectURL string, httpClient *http.Client, options ...SSEClie
 		cli = http.DefaultClient
 	}
 	s := &SSEClient{
-		connectURL: connectURL,
-		httpClient: cli,
-		logger:     slog.Default(),
-		messages:   make(chan JSONRPCMessage, 10),
-		closed:     make(chan struct{}),
+		connectURL:     connectURL,
+		httpClient:     cli,
+		resumeAttempts: defaultSSEClientResumeAttempts,
+		resumeDelay:    defaultSSEClientResumeDelay,
+		logger:         slog.Default(),
 	}
 
 	for _, opt := range options {
@@ -149,6 +242,24 @@ func NewSSEClient(connectURL string, httpClient *http.Client, options ...SSEClie
 	return s
 }
 
+// WithSSEClientResumeAttempts sets the number of attempts to resume the SSE stream when it's dropped,
+// before the session is ended. The stream is resumed by connecting again with the Last-Event-ID header,
+// so the server sends the messages we missed. If not set, the client makes 3 attempts, and zero
+// disables the resumption.
+func WithSSEClientResumeAttempts(attempts int) SSEClientOption {
+	return func(s *SSEClient) {
+		s.resumeAttempts = attempts
+	}
+}
+
+// WithSSEClientResumeDelay sets the delay before each attempt to resume the dropped SSE stream. If not
+// set, the delay is 500ms.
+func WithSSEClientResumeDelay(delay time.Duration) SSEClientOption {
+	return func(s *SSEClient) {
+		s.resumeDelay = delay
+	}
+}
+
 // WithSSEClientMaxPayloadSize sets the maximum size of the payload that can be received
 // from the server. If the payload size exceeds this limit, the error will be logged and
 // the client will be disconnected.
@@ -183,12 +294,7 @@ func (s SSEServer) Sessions() iter.Seq[Session] {
 			case <-s.done:
 				return
 			case sess := <-s.sessions:
-				// Received a new session from handler.
-
-				// Process send messages for this session in a separate goroutine
-				go sess.processSendMessages()
-
-				// Store the session in the map.
+				// Received a new session from handler, store the session in the map.
 				sessionsMap[sess.id] = sess
 
 				// Forward the session to the caller.
@@ -200,6 +306,23 @@ func (s SSEServer) Sessions() iter.Seq[Session] {
 				delete(sessionsMap, sessID)
 			case msg := <-s.receivedMessages:
 				session, ok := sessionsMap[msg.sessID]
+				// The handler queues the session before sending the endpoint to the client, so if the session
+				// is not found, it may be still queued in the sessions channel. Drain the queue before giving up.
+				for !ok {
+					var sess sseServerSession
+					select {
+					case sess = <-s.sessions:
+					default:
+					}
+					if sess.id == "" {
+						break
+					}
+					sessionsMap[sess.id] = sess
+					if !yield(sess) {
+						return
+					}
+					session, ok = sessionsMap[msg.sessID]
+				}
 				if !ok {
 					// Ignore the message if the session is not found, it might already be closed.
 					continue
@@ -236,8 +359,16 @@ func (s SSEServer) Shutdown(ctx context.Context) error {
 // The handler upgrades HTTP connections to SSE, assigns unique session IDs, and
 // provides clients with their message endpoints. The connection remains active until
 // either the client disconnects or the server closes.
+//
+// If the request has the Last-Event-ID header, the stream of the session that sent the event is
+// resumed instead, or the handler responds with 404 Not Found if the session is already closed.
 func (s SSEServer) HandleSSE() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := s.authenticate(w, r)
+		if !ok {
+			return
+		}
+
 		// Received the request to establish a new SSE session.
 		sess, err := sse.Upgrade(w, r)
 		if err != nil {
@@ -247,6 +378,11 @@ func (s SSEServer) HandleSSE() http.Handler {
 			return
 		}
 
+		if sess.LastEventID.IsSet() {
+			s.resumeStream(w, r, sess, principal)
+			return
+		}
+
 		sessID := uuid.New().String()
 
 		// Check if s.messageUrl is a relative URL, if so, we need to convert it to an absolute URL.
@@ -267,38 +403,54 @@ func (s SSEServer) HandleSSE() http.Handler {
 		// Form an url for the client that can be used to communicate with the server session.
 		url := fmt.Sprintf("%s?sessionID=%s", s.messageURL, sessID)
 
-		// Use the type "endpoint" to indicate the endpoint URL.
-		msg := sse.Message{
-			Type: sse.Type("endpoint"),
+		srvSession := sseServerSession{
+			id:               sessID,
+			principal:        principal,
+			logger:           s.logger,
+			sendMsgs:         make(chan sseServerSessionSendMsg),
+			receivedMsgs:     make(chan JSONRPCMessage),
+			replayBufferSize: s.replayBufferSize,
+			attachStreams:    make(chan sseStreamAttachment),
+			detachStreams:    make(chan chan struct{}),
+			done:             make(chan struct{}),
+			sendClosed:       make(chan struct{}),
+			receivedClosed:   make(chan struct{}),
 		}
-		msg.AppendData(url)
-		if err := sess.Send(&msg); err != nil {
-			nErr := fmt.Errorf("failed to write SSE URL: %w", err)
-			s.logger.Error("failed to write SSE URL", "err", nErr)
-			http.Error(w, nErr.Error(), http.StatusInternalServerError)
+
+		// Feed the sessions channel that would be consumed in Sessions loop, so it can be fowarded to caller.
+		// This must happen before the endpoint is sent, so the session is already known by the Sessions loop
+		// when the client sends its first message.
+		select {
+		case <-s.done:
+			http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+			return
+		case <-r.Context().Done():
 			return
+		case s.sessions <- srvSession:
 		}
 
-		if err := sess.Flush(); err != nil {
-			nErr := fmt.Errorf("failed to flush SSE: %w", err)
-			s.logger.Error("failed to flush SSE", "err", nErr)
-			http.Error(w, nErr.Error(), http.StatusInternalServerError)
-			return
+		s.registry.add(srvSession)
+		defer s.registry.remove(sessID)
+
+		// Use the type "endpoint" to indicate the endpoint URL. It's the first event of the session, so
+		// the client is able to resume the stream even before receiving any message.
+		msg := sse.Message{
+			ID:   sse.ID(sseEventID(sessID, 0)),
+			Type: sse.Type("endpoint"),
 		}
+		msg.AppendData(url)
 
-		srvSession := sseServerSession{
-			id:             sessID,
-			sess:           sess,
-			logger:         s.logger,
-			sendMsgs:       make(chan sseServerSessionSendMsg),
-			receivedMsgs:   make(chan JSONRPCMessage),
-			done:           make(chan struct{}),
-			sendClosed:     make(chan struct{}),
-			receivedClosed: make(chan struct{}),
+		// The session is already queued at this point, so on failure we only log the error, and let the
+		// session be closed by its owner, as the client would never be able to respond to it.
+		if err := sess.Send(&msg); err != nil {
+			s.logger.Error("failed to write SSE URL", "err", fmt.Errorf("failed to write SSE URL: %w", err))
+		} else if err := sess.Flush(); err != nil {
+			s.logger.Error("failed to flush SSE", "err", fmt.Errorf("failed to flush SSE: %w", err))
 		}
 
-		// Feed the sessions channel that would be consumed in Sessions loop, so it can be fowarded to caller.
-		s.sessions <- srvSession
+		// Process send messages for this session in a separate goroutine. This is started after the
+		// endpoint is sent to avoid race in the sse library.
+		go srvSession.processSendMessages(sess)
 
 		// Block until the session is closed, so the connection is left open.
 		<-srvSession.sendClosed
@@ -312,6 +464,90 @@ func (s SSEServer) HandleSSE() http.Handler {
 	})
 }
 
+// authenticate authenticates the request, if the authenticator is set. It returns nil principal if the
+// server doesn't authenticate the clients, or false if the request is rejected.
+func (s SSEServer) authenticate(w http.ResponseWriter, r *http.Request) (*Principal, bool) {
+	if s.authenticator == nil {
+		return nil, true
+	}
+
+	principal, err := s.authenticator(r)
+	if err != nil {
+		s.logger.Warn("failed to authenticate request", slog.String("err", err.Error()))
+		var bearerErr *BearerTokenError
+		if errors.As(err, &bearerErr) {
+			w.Header().Set("WWW-Authenticate", bearerErr.challenge())
+			http.Error(w, strings.ToLower(http.StatusText(bearerErr.statusCode())), bearerErr.statusCode())
+			return nil, false
+		}
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	return &principal, true
+}
+
+// resumeStream attaches the stream of the reconnecting client to its session, and blocks until the
+// session stops writing to it.
+func (s SSEServer) resumeStream(w http.ResponseWriter, r *http.Request, stream *sse.Session, principal *Principal) {
+	sessID, lastSeq, ok := parseSSEEventID(stream.LastEventID.String())
+	if !ok {
+		http.Error(w, "invalid Last-Event-ID header", http.StatusBadRequest)
+		return
+	}
+	srvSession, ok := s.registry.get(sessID)
+	if !ok {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return
+	}
+	select {
+	case <-srvSession.done:
+		http.Error(w, "session not found", http.StatusNotFound)
+		return
+	default:
+	}
+	if !srvSession.authorized(principal) {
+		s.logger.Warn("rejected stream resumption from another principal", slog.String("sessionID", sessID))
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	// Send the response headers right away, as there may be no message to send again.
+	if err := stream.Flush(); err != nil {
+		s.logger.Error("failed to flush SSE", "err", fmt.Errorf("failed to flush SSE: %w", err))
+		return
+	}
+
+	attachment := sseStreamAttachment{
+		stream:   stream,
+		lastSeq:  lastSeq,
+		detached: make(chan struct{}),
+	}
+	select {
+	case <-srvSession.done:
+		return
+	case <-r.Context().Done():
+		return
+	case srvSession.attachStreams <- attachment:
+	}
+
+	select {
+	case <-attachment.detached:
+		return
+	case <-srvSession.sendClosed:
+		return
+	case <-r.Context().Done():
+	}
+
+	// The client is gone, detach the stream before returning, so it's never written after the
+	// response is finished.
+	select {
+	case <-srvSession.sendClosed:
+	case srvSession.detachStreams <- attachment.detached:
+		<-attachment.detached
+	}
+}
+
 // HandleMessage returns an http.Handler for processing client messages sent via POST
 // requests. The handler expects a sessionID query parameter and a JSON-encoded message
 // body. Valid messages are routed to their corresponding Session's message stream,
@@ -327,6 +563,24 @@ func (s SSEServer) HandleMessage() http.Handler {
 			return
 		}
 
+		principal, ok := s.authenticate(w, r)
+		if !ok {
+			return
+		}
+		if principal != nil {
+			// Only the principal that established the session is allowed to send its messages.
+			session, ok := s.registry.get(sessID)
+			if !ok {
+				http.Error(w, "session not found", http.StatusNotFound)
+				return
+			}
+			if !session.authorized(principal) {
+				s.logger.Warn("rejected message from another principal", slog.String("sessionID", sessID))
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+		}
+
 		decoder := json.NewDecoder(r.Body)
 		var msg JSONRPCMessage
 
@@ -353,12 +607,22 @@ func (s SSEServer) HandleMessage() http.Handler {
 // StartSession establishes the SSE connection and begins message processing. It sends
 // connection status through the ready channel and returns an iterator for received server
 // messages. The connection remains active until the context is cancelled or an error occurs.
+// If the connection is dropped, the stream is resumed with the Last-Event-ID header, see
+// WithSSEClientResumeAttempts. A new session can be started after the previous one ends.
 func (s *SSEClient) StartSession(ctx context.Context) (Session, error) {
 	// We cannot use the ctx as the parent context because the caller may cancel the context
 	// after calling this function. Since we need a long-lived context, we create a new one, and store
 	// the cancel function so we can cancel it when we want to stop the session.
 	reqCtx, reqCancel := context.WithCancel(context.Background())
+	messages := make(chan JSONRPCMessage, 10)
+
+	s.mu.Lock()
+	s.messageURL = ""
+	s.protocolVersion = ""
 	s.requestCancel = reqCancel
+	s.messages = messages
+	s.closed = make(chan struct{})
+	s.mu.Unlock()
 
 	// But we still need to cancel the request, if the cancellation is happen while the server is not responsing yet,
 	// or we still haven't finished the initialization process.
@@ -391,7 +655,7 @@ func (s *SSEClient) StartSession(ctx context.Context) (Session, error) {
 	// Start the sse message listener, and wait until we receive initialization response from the server.
 	initErrs := make(chan error)
 
-	go s.listenSSEMessages(resp.Body, initErrs)
+	go s.listenSSEMessages(reqCtx, resp.Body, messages, initErrs)
 
 	// Wait for initialization response or context cancellation.
 	select {
@@ -420,12 +684,19 @@ func (s *SSEClient) Send(ctx context.Context, msg JSONRPCMessage) error {
 		return fmt.Errorf("failed to marshal message: %w", err)
 	}
 
+	s.mu.Lock()
+	messageURL, protocolVersion := s.messageURL, s.protocolVersion
+	s.mu.Unlock()
+
 	r := bytes.NewReader(msgBs)
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.messageURL, r)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, messageURL, r)
 	if err != nil {
 		return err
 	}
 	req.Header.Set("Content-Type", "application/json")
+	if protocolVersion != "" {
+		req.Header.Set(protocolVersionHeader, protocolVersion)
+	}
 
 	resp, err := s.httpClient.Do(req)
 	if err != nil {
@@ -440,12 +711,25 @@ func (s *SSEClient) Send(ctx context.Context, msg JSONRPCMessage) error {
 	return nil
 }
 
+// setProtocolVersion records the protocol version negotiated by the Client, so it's sent in the
+// header of the following requests.
+func (s *SSEClient) setProtocolVersion(version string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.protocolVersion = version
+}
+
 // Messages returns an iterator over received messages from the server.
 func (s *SSEClient) Messages() iter.Seq[JSONRPCMessage] {
+	s.mu.Lock()
+	messages, closed := s.messages, s.closed
+	s.mu.Unlock()
+
 	return func(yield func(JSONRPCMessage) bool) {
-		defer close(s.closed)
+		defer close(closed)
 
-		for msg := range s.messages {
+		for msg := range messages {
 			if !yield(msg) {
 				return
 			}
@@ -455,19 +739,65 @@ func (s *SSEClient) Messages() iter.Seq[JSONRPCMessage] {
 
 // Stop gracefully shuts down the SSE client by closing the SSE connection.
 func (s *SSEClient) Stop() {
+	s.mu.Lock()
+	requestCancel, closed := s.requestCancel, s.closed
+	s.mu.Unlock()
+
 	// Cancel the request context that made for starting the session to signal the shutdown.
-	s.requestCancel()
+	requestCancel()
 
 	// Wait for the main loop to finish.
-	<-s.closed
+	<-closed
 }
 
-func (s *SSEClient) listenSSEMessages(body io.ReadCloser, initErrs chan<- error) {
-	defer func() {
+func (s *SSEClient) listenSSEMessages(
+	ctx context.Context,
+	body io.ReadCloser,
+	messages chan<- JSONRPCMessage,
+	initErrs chan<- error,
+) {
+	defer close(messages)
+
+	stream := sseClientStream{
+		messages: messages,
+		initErrs: initErrs,
+	}
+	attempt := 0
+	for {
+		events := stream.events
+		ok := s.readSSEStream(body, &stream)
 		body.Close()
-		close(s.messages)
-	}()
 
+		// The stream is only resumable after it's initialized, and it's not closed by Stop.
+		if !ok || stream.messageURL == "" || stream.lastEventID == "" || ctx.Err() != nil {
+			return
+		}
+
+		// Only the resumed streams that end without any event count as the failed attempts, so the
+		// stream that is dropped again later gets all the attempts.
+		if stream.events > events {
+			attempt = 0
+		}
+
+		body = nil
+		for body == nil {
+			attempt++
+			if attempt > s.resumeAttempts {
+				return
+			}
+
+			var retry bool
+			body, retry = s.resumeSSEStream(ctx, stream.lastEventID, attempt)
+			if !retry {
+				return
+			}
+		}
+	}
+}
+
+// readSSEStream reads the events of the stream until it ends, it returns false if the stream is ended
+// because of an invalid endpoint event.
+func (s *SSEClient) readSSEStream(body io.Reader, stream *sseClientStream) bool {
 	// The default value defined in the sse library is 65 KB, set this config if user set a custom value.
 	var config *sse.ReadConfig
 	if s.maxPayloadSize > 0 {
@@ -482,22 +812,30 @@ func (s *SSEClient) listenSSEMessages(body io.ReadCloser, initErrs chan<- error)
 			if !errors.Is(err, context.Canceled) {
 				s.logger.Error("failed to read SSE message", slog.String("err", err.Error()))
 			}
-			return
+			return true
 		}
 
+		stream.events++
+		stream.lastEventID = ev.LastEventID
+
 		switch ev.Type {
 		case "endpoint":
+			// The endpoint is not changed when the stream is resumed.
+			if stream.messageURL != "" {
+				continue
+			}
+
 			// Validate and parse the endpoint URL to ensure secure and correct message routing.
 			// This step is critical to prevent potential security vulnerabilities and
 			// ensure that messages are sent to the correct destination.
 			u, err := url.Parse(ev.Data)
 			if err != nil {
-				initErrs <- fmt.Errorf("parse endpoint URL: %w", err)
-				return
+				stream.initErrs <- fmt.Errorf("parse endpoint URL: %w", err)
+				return false
 			}
 			if u.String() == "" {
-				initErrs <- errors.New("empty endpoint URL")
-				return
+				stream.initErrs <- errors.New("empty endpoint URL")
+				return false
 			}
 
 			// If the URL is not absolute, resolve it against the connect URL
@@ -505,16 +843,19 @@ func (s *SSEClient) listenSSEMessages(body io.ReadCloser, initErrs chan<- error)
 				// Parse the connect URL to use as a base for resolving relative URL
 				baseURL, err := url.Parse(s.connectURL)
 				if err != nil {
-					initErrs <- fmt.Errorf("parse connect URL: %w", err)
-					return
+					stream.initErrs <- fmt.Errorf("parse connect URL: %w", err)
+					return false
 				}
 				u = baseURL.ResolveReference(u)
 			}
 
-			s.messageURL = u.String()
-			close(initErrs)
+			stream.messageURL = u.String()
+			s.mu.Lock()
+			s.messageURL = stream.messageURL
+			s.mu.Unlock()
+			close(stream.initErrs)
 		case "message":
-			if s.messageURL == "" {
+			if stream.messageURL == "" {
 				// This should not happen, as we cannot receive message, if we didn't request it to the messageURL,
 				// but just in case, we should log it.
 				s.logger.Error("received message before endpoint URL")
@@ -527,16 +868,80 @@ func (s *SSEClient) listenSSEMessages(body io.ReadCloser, initErrs chan<- error)
 				continue
 			}
 
-			s.messages <- msg
+			stream.messages <- msg
 
 		default:
 			s.logger.Error("unhandled event type", "type", ev.Type)
 		}
 	}
+
+	return true
+}
+
+// resumeSSEStream connects to the server again with the Last-Event-ID header, so the server resumes the
+// dropped stream of the session, and sends the messages we missed. It returns the body of the resumed
+// stream, or whether it's worth to make another attempt if it fails.
+func (s *SSEClient) resumeSSEStream(ctx context.Context, lastEventID string, attempt int) (io.ReadCloser, bool) {
+	select {
+	case <-ctx.Done():
+		return nil, false
+	case <-time.After(s.resumeDelay):
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.connectURL, nil)
+	if err != nil {
+		s.logger.Error("failed to create request", slog.String("err", err.Error()))
+		return nil, false
+	}
+	req.Header.Set("Last-Event-ID", lastEventID)
+	s.mu.Lock()
+	if s.protocolVersion != "" {
+		req.Header.Set(protocolVersionHeader, s.protocolVersion)
+	}
+	s.mu.Unlock()
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		s.logger.Warn("failed to resume SSE stream",
+			slog.Int("attempt", attempt),
+			slog.String("err", err.Error()))
+		return nil, ctx.Err() == nil
+	}
+	if resp.StatusCode == http.StatusOK {
+		return resp.Body, true
+	}
+	resp.Body.Close()
+
+	// The session is already closed by the server, there is nothing to resume.
+	if resp.StatusCode == http.StatusNotFound {
+		s.logger.Warn("session of the SSE stream is closed by the server")
+		return nil, false
+	}
+	s.logger.Warn("failed to resume SSE stream",
+		slog.Int("attempt", attempt),
+		slog.Int("statusCode", resp.StatusCode))
+
+	return nil, true
 }
 
 func (s sseServerSession) ID() string { return s.id }
 
+// Principal returns the authenticated client of the session, if the server authenticates the clients.
+func (s sseServerSession) Principal() (Principal, bool) {
+	if s.principal == nil {
+		return Principal{}, false
+	}
+	return *s.principal, true
+}
+
+// authorized reports whether the principal is the one bound to the session.
+func (s sseServerSession) authorized(principal *Principal) bool {
+	if s.principal == nil {
+		return true
+	}
+	return principal != nil && principal.ID == s.principal.ID
+}
+
 func (s sseServerSession) Send(ctx context.Context, msg JSONRPCMessage) error {
 	msgBs, err := json.Marshal(msg)
 	if err != nil {
@@ -548,7 +953,7 @@ func (s sseServerSession) Send(ctx context.Context, msg JSONRPCMessage) error {
 	}
 	sseMsg.AppendData(string(msgBs))
 
-	errs := make(chan error)
+	errs := make(chan error, 1)
 
 	// Queue the message for sending to avoid race in the sse library
 	select {
@@ -596,38 +1001,130 @@ func (s sseServerSession) Stop() {
 	<-s.receivedClosed
 }
 
-func (s sseServerSession) processSendMessages() {
+// processSendMessages writes the messages queued by Send to the current stream of the session, which is
+// replaced when the client resumes the stream. The written messages are kept in the replay buffer, so
+// they can be sent again to the resumed stream.
+func (s sseServerSession) processSendMessages(stream *sse.Session) {
 	defer close(s.sendClosed)
 
+	// detached is closed when the current stream is replaced or detached, it's nil for the first
+	// stream, as its handler waits until the session is closed.
+	var detached chan struct{}
+	defer func() {
+		if detached != nil {
+			close(detached)
+		}
+	}()
+
+	var seq uint64
+	var replay []*sse.Message
+
 	for {
 		select {
 		case sm := <-s.sendMsgs:
-			// Send and flush the message to the client.
-			if err := s.sess.Send(sm.msg); err != nil {
-				s.logger.Warn("failed to send message", slog.String("err", err.Error()))
-
-				select {
-				case sm.errs <- err:
-				default:
+			seq++
+			sm.msg.ID = sse.ID(sseEventID(s.id, seq))
+			if s.replayBufferSize > 0 {
+				replay = append(replay, sm.msg)
+				if len(replay) > s.replayBufferSize {
+					replay = slices.Delete(replay, 0, len(replay)-s.replayBufferSize)
 				}
-				continue
 			}
-			if err := s.sess.Flush(); err != nil {
-				s.logger.Warn("failed to flush message", slog.String("err", err.Error()))
 
-				select {
-				case sm.errs <- err:
-				default:
-				}
-				continue
+			var err error
+			if stream == nil {
+				// The message is kept in the replay buffer, it's sent if the client resumes the stream.
+				err = errors.New("no active stream")
+			} else {
+				err = s.writeMessage(stream, sm.msg)
 			}
 
 			select {
-			case sm.errs <- nil:
+			case sm.errs <- err:
 			default:
 			}
+		case attachment := <-s.attachStreams:
+			if detached != nil {
+				close(detached)
+			}
+			stream, detached = attachment.stream, attachment.detached
+			s.replayMessages(stream, attachment.lastSeq, seq, replay)
+		case d := <-s.detachStreams:
+			if d == detached {
+				close(detached)
+				stream, detached = nil, nil
+			}
 		case <-s.done:
 			return
 		}
 	}
 }
+
+// replayMessages sends the messages in the replay buffer that are sent after lastSeq to the stream.
+func (s sseServerSession) replayMessages(stream *sse.Session, lastSeq, seq uint64, replay []*sse.Message) {
+	missed := seq - min(lastSeq, seq)
+	if missed > uint64(len(replay)) {
+		s.logger.Warn("some messages are no longer kept for the resumed stream",
+			slog.String("sessionID", s.id),
+			slog.Uint64("lost", missed-uint64(len(replay))))
+		missed = uint64(len(replay))
+	}
+
+	for _, msg := range replay[uint64(len(replay))-missed:] {
+		if err := s.writeMessage(stream, msg); err != nil {
+			return
+		}
+	}
+}
+
+func (s sseServerSession) writeMessage(stream *sse.Session, msg *sse.Message) error {
+	// Send and flush the message to the client.
+	if err := stream.Send(msg); err != nil {
+		s.logger.Warn("failed to send message", slog.String("err", err.Error()))
+		return err
+	}
+	if err := stream.Flush(); err != nil {
+		s.logger.Warn("failed to flush message", slog.String("err", err.Error()))
+		return err
+	}
+	return nil
+}
+
+func (s *sseSessionRegistry) add(session sseServerSession) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions[session.id] = session
+}
+
+func (s *sseSessionRegistry) get(id string) (sseServerSession, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	return session, ok
+}
+
+func (s *sseSessionRegistry) remove(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, id)
+}
+
+// sseEventID forms the event ID of the session's message with the given sequence number.
+func sseEventID(sessID string, seq uint64) string {
+	return sessID + "_" + strconv.FormatUint(seq, 10)
+}
+
+func parseSSEEventID(eventID string) (string, uint64, bool) {
+	sessID, seqStr, ok := strings.Cut(eventID, "_")
+	if !ok {
+		return "", 0, false
+	}
+	seq, err := strconv.ParseUint(seqStr, 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return sessID, seq, true
+}
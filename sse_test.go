@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -130,6 +131,90 @@ func TestSSEServerAndClient(t *testing.T) {
 	}
 }
 
+func TestSSEStreamResumption(t *testing.T) {
+	mux := http.NewServeMux()
+	testServer := httptest.NewServer(mux)
+	defer testServer.Close()
+
+	server := mcp.NewSSEServer(testServer.URL + "/message")
+	mux.Handle("/connect", server.HandleSSE())
+	mux.Handle("/message", server.HandleMessage())
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := server.Shutdown(ctx); err != nil {
+			t.Errorf("failed to shutdown server: %v", err)
+		}
+	}()
+
+	sessionCount := int64(0)
+	sessions := make(chan mcp.Session, 1)
+	go func() {
+		for sess := range server.Sessions() {
+			atomic.AddInt64(&sessionCount, 1)
+			sessions <- sess
+		}
+	}()
+
+	client := mcp.NewSSEClient(testServer.URL+"/connect", testServer.Client(),
+		mcp.WithSSEClientResumeDelay(200*time.Millisecond))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	clientSession, err := client.StartSession(ctx)
+	if err != nil {
+		t.Fatalf("failed to start session: %v", err)
+	}
+	defer clientSession.Stop()
+
+	received := make(chan string, 10)
+	go func() {
+		for msg := range clientSession.Messages() {
+			received <- msg.Method
+		}
+	}()
+
+	serverSession := <-sessions
+	defer serverSession.Stop()
+	go func() {
+		for range serverSession.Messages() {
+		}
+	}()
+
+	expectReceived := func(method string) {
+		select {
+		case got := <-received:
+			if got != method {
+				t.Fatalf("got method %q, want %q", got, method)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timeout waiting for client to receive %q", method)
+		}
+	}
+
+	if err := serverSession.Send(ctx, mcp.JSONRPCMessage{JSONRPC: mcp.JSONRPCVersion, Method: "first"}); err != nil {
+		t.Fatalf("failed to send message: %v", err)
+	}
+	expectReceived("first")
+
+	// Drop the connection, the message sent while the client is reconnecting should be sent again
+	// when the stream is resumed.
+	testServer.CloseClientConnections()
+	_ = serverSession.Send(ctx, mcp.JSONRPCMessage{JSONRPC: mcp.JSONRPCVersion, Method: "second"})
+	expectReceived("second")
+
+	if err := serverSession.Send(ctx, mcp.JSONRPCMessage{JSONRPC: mcp.JSONRPCVersion, Method: "third"}); err != nil {
+		t.Fatalf("failed to send message after resumption: %v", err)
+	}
+	expectReceived("third")
+
+	if count := atomic.LoadInt64(&sessionCount); count != 1 {
+		t.Errorf("expected the stream to be resumed on the same session, got %d sessions", count)
+	}
+}
+
 func TestSSEServerMultipleClients(t *testing.T) {
 	// Create test server
 	mux := http.NewServeMux()
@@ -623,3 +708,114 @@ func TestSSELargeMessagePayload(t *testing.T) {
 		})
 	}
 }
+
+func TestSSEServerAuthentication(t *testing.T) {
+	mux := http.NewServeMux()
+	testServer := httptest.NewServer(mux)
+	defer testServer.Close()
+
+	principals := map[string]string{
+		"Bearer alice-token": "alice",
+		"Bearer bob-token":   "bob",
+	}
+	sseServer := mcp.NewSSEServer(testServer.URL+"/message",
+		mcp.WithSSEServerAuthenticator(func(r *http.Request) (mcp.Principal, error) {
+			id, ok := principals[r.Header.Get("Authorization")]
+			if !ok {
+				return mcp.Principal{}, errors.New("invalid token")
+			}
+			return mcp.Principal{ID: id}, nil
+		}))
+	mux.Handle("/connect", sseServer.HandleSSE())
+	mux.Handle("/message", sseServer.HandleMessage())
+
+	toolServer := &mockToolServer{}
+	sessionIDs := make(chan string, 1)
+	server := mcp.NewServer(mcp.Info{Name: "test-server", Version: "1.0"}, sseServer,
+		mcp.WithToolServer(toolServer),
+		mcp.WithServerOnClientConnected(func(id string, _ mcp.Info) {
+			sessionIDs <- id
+		}))
+	go server.Serve()
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := server.Shutdown(ctx); err != nil {
+			t.Errorf("failed to shutdown server: %v", err)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The client without the token should be rejected.
+	unauthenticated := mcp.NewSSEClient(testServer.URL+"/connect", testServer.Client())
+	if _, err := unauthenticated.StartSession(ctx); err == nil {
+		t.Fatal("expected unauthenticated client to be rejected")
+	}
+
+	httpClient := &http.Client{
+		Transport: headerRoundTripper{
+			header: "Authorization",
+			value:  "Bearer alice-token",
+			next:   testServer.Client().Transport,
+		},
+	}
+	client := mcp.NewClient(mcp.Info{Name: "test-client", Version: "1.0"},
+		mcp.NewSSEClient(testServer.URL+"/connect", httpClient))
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer func() {
+		if err := client.Disconnect(ctx); err != nil {
+			t.Errorf("failed to disconnect: %v", err)
+		}
+	}()
+
+	if _, err := client.CallTool(ctx, mcp.CallToolParams{Name: "test-tool"}); err != nil {
+		t.Fatalf("failed to call tool: %v", err)
+	}
+	if !toolServer.hasPrincipal || toolServer.principal.ID != "alice" {
+		t.Errorf("expected principal alice in the tool context, got %+v", toolServer.principal)
+	}
+
+	// Another principal must not be able to send messages to alice's session.
+	sessionID := <-sessionIDs
+	postMessage := func(authorization string) int {
+		body := bytes.NewReader([]byte(`{"jsonrpc":"2.0","method":"notifications/initialized"}`))
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, testServer.URL+"/message?sessionID="+sessionID, body)
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		resp, err := testServer.Client().Do(req)
+		if err != nil {
+			t.Fatalf("failed to send request: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status := postMessage(""); status != http.StatusUnauthorized {
+		t.Errorf("expected status %d without token, got %d", http.StatusUnauthorized, status)
+	}
+	if status := postMessage("Bearer bob-token"); status != http.StatusForbidden {
+		t.Errorf("expected status %d for another principal, got %d", http.StatusForbidden, status)
+	}
+}
+
+// headerRoundTripper sets the header of every request, before sending it with the next RoundTripper.
+type headerRoundTripper struct {
+	header string
+	value  string
+	next   http.RoundTripper
+}
+
+func (h headerRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Header.Set(h.header, h.value)
+	return h.next.RoundTrip(r)
+}
@@ -2,6 +2,7 @@ package mcp
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -9,7 +10,7 @@ import (
 	"io"
 	"iter"
 	"log/slog"
-	"strings"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -23,6 +24,12 @@ import (
 // be used as either ServerTransport or ClientTransport. Proper initialization requires
 // using the NewStdIO constructor function to create new instances.
 //
+// By default, the messages of any size are read and written, and Send waits until its message is
+// written. The sizes of the messages are limited with WithStdIOMaxInboundMessageSize and
+// WithStdIOMaxOutboundMessageSize, and the messages are queued for writing with
+// WithStdIOSendQueueSize, so Send only waits while the queue is full. Either way, the wait of Send
+// is bounded with WithStdIOSendTimeout.
+//
 // Resources must be properly released by calling Close when the StdIO instance is no
 // longer needed.
 type StdIO struct {
@@ -34,10 +41,18 @@ type StdIO struct {
 type StdIOOption func(*StdIO)
 
 type stdIOSession struct {
+	id     string
 	reader io.Reader
 	writer io.Writer
 	logger *slog.Logger
 
+	// The limits below are disabled when they're zero.
+	maxInboundSize  int
+	maxOutboundSize int
+	sendTimeout     time.Duration
+
+	// writeMessages is buffered with the size of the send queue, the Send doesn't wait for the write
+	// result of the queued messages.
 	writeMessages chan stdIOMessage
 	done          chan struct{}
 	readClosed    chan struct{}
@@ -45,16 +60,37 @@ type stdIOSession struct {
 }
 
 type stdIOMessage struct {
-	msg  []byte
+	msg []byte
+	// errs receives the result of the write, it's nil for the queued messages.
 	errs chan error
 }
 
+// stdIOLine is a line read from the reader. The line that exceeds the maximum inbound size is
+// truncated to the maximum size, and its size is the size of the whole line.
+type stdIOLine struct {
+	data     []byte
+	size     int
+	oversize bool
+	err      error
+}
+
+var (
+	// ErrMessageTooLarge is returned by the Send of StdIO, when the message exceeds the maximum
+	// outbound message size.
+	ErrMessageTooLarge = errors.New("message exceeds the maximum size")
+
+	// ErrSendQueueFull is returned by the Send of StdIO, when the message can't be queued, or written
+	// if there's no send queue, within the send timeout.
+	ErrSendQueueFull = errors.New("send queue is full")
+)
+
 // NewStdIO creates a new StdIO instance configured with the provided reader and writer.
 // The instance is initialized with default logging and required internal communication
 // channels.
 func NewStdIO(reader io.Reader, writer io.Writer, options ...StdIOOption) StdIO {
 	s := StdIO{
 		sess: stdIOSession{
+			id:            uuid.New().String(),
 			reader:        reader,
 			writer:        writer,
 			logger:        slog.Default(),
@@ -83,6 +119,47 @@ func WithStdIOLogger(logger *slog.Logger) StdIOOption {
 	}
 }
 
+// WithStdIOMaxInboundMessageSize sets the maximum size of the message that can be received, in
+// bytes. The larger message is discarded without being buffered as a whole: the larger request is
+// answered with an error response, and the larger response is replaced with an error response for
+// the request waiting for it, so neither party waits for the message that is never delivered. The
+// default is no limit.
+func WithStdIOMaxInboundMessageSize(size int) StdIOOption {
+	return func(s *StdIO) {
+		s.sess.maxInboundSize = size
+	}
+}
+
+// WithStdIOMaxOutboundMessageSize sets the maximum size of the message that can be sent, in bytes.
+// Send fails with ErrMessageTooLarge for the larger message, unless it's a response, which is replaced
+// with an error response, so the request is still answered. The default is no limit.
+func WithStdIOMaxOutboundMessageSize(size int) StdIOOption {
+	return func(s *StdIO) {
+		s.sess.maxOutboundSize = size
+	}
+}
+
+// WithStdIOSendQueueSize sets the number of the messages that can be queued for writing. Send
+// returns once its message is queued, and only waits while the queue is full, so the slow reader on
+// the other side applies back-pressure to the senders. The write errors of the queued messages are
+// logged, and the queued messages are dropped when the session is stopped. The default is zero,
+// where Send waits until its message is written.
+func WithStdIOSendQueueSize(size int) StdIOOption {
+	return func(s *StdIO) {
+		s.sess.writeMessages = make(chan stdIOMessage, size)
+	}
+}
+
+// WithStdIOSendTimeout sets how long Send waits for its message to be queued, or to be written if
+// there's no send queue, before failing with ErrSendQueueFull, so the senders don't block forever on
+// the other side that stops reading. The default is no timeout, where Send waits until its context
+// is done.
+func WithStdIOSendTimeout(timeout time.Duration) StdIOOption {
+	return func(s *StdIO) {
+		s.sess.sendTimeout = timeout
+	}
+}
+
 // Sessions implements the ServerTransport interface by providing an iterator that yields
 // a single persistent session. This session remains active throughout the lifetime of
 // the StdIO instance.
@@ -117,7 +194,7 @@ func (s StdIO) StartSession(_ context.Context) (Session, error) {
 }
 
 func (s stdIOSession) ID() string {
-	return uuid.New().String()
+	return s.id
 }
 
 func (s stdIOSession) Send(ctx context.Context, msg JSONRPCMessage) error {
@@ -125,14 +202,38 @@ func (s stdIOSession) Send(ctx context.Context, msg JSONRPCMessage) error {
 	if err != nil {
 		return fmt.Errorf("failed to marshal message: %w", err)
 	}
+
+	if s.maxOutboundSize > 0 && len(msgBs) > s.maxOutboundSize {
+		sizeErr := fmt.Errorf("%w: %d bytes exceeds %d bytes", ErrMessageTooLarge, len(msgBs), s.maxOutboundSize)
+		// The responses are replaced with the error responses, so the other party isn't left waiting
+		// for the responses that are never sent. The request is answered, so the Send succeeds.
+		errMsg, ok := oversizeResponse(msg, sizeErr.Error())
+		if !ok {
+			return sizeErr
+		}
+		s.logger.Warn("replacing the response that is too large with an error response",
+			slog.String("err", sizeErr.Error()))
+		if msgBs, err = json.Marshal(errMsg); err != nil {
+			return fmt.Errorf("failed to marshal message: %w", err)
+		}
+	}
+
 	// Append newline to maintain message framing protocol
 	msgBs = append(msgBs, '\n')
 
 	s.logger.Info("sending message", slog.String("msg", string(msgBs)))
 
-	ioMsg := stdIOMessage{
-		msg:  msgBs,
-		errs: make(chan error, 1),
+	ioMsg := stdIOMessage{msg: msgBs}
+	// The queued messages are written after Send returns, so there's no one to wait for their result.
+	if cap(s.writeMessages) == 0 {
+		ioMsg.errs = make(chan error, 1)
+	}
+
+	var timeout <-chan time.Time
+	if s.sendTimeout > 0 {
+		timer := time.NewTimer(s.sendTimeout)
+		defer timer.Stop()
+		timeout = timer.C
 	}
 
 	// Queue the message for sending to avoid race in the StdIO library.
@@ -140,22 +241,33 @@ func (s stdIOSession) Send(ctx context.Context, msg JSONRPCMessage) error {
 	case <-ctx.Done():
 		s.logger.Error("failed to feed writeMessages channel", slog.String("err", ctx.Err().Error()))
 		return ctx.Err()
+	case <-timeout:
+		s.logger.Error("failed to feed writeMessages channel", slog.String("err", ErrSendQueueFull.Error()))
+		return ErrSendQueueFull
 	case <-s.done:
 		s.logger.Warn("session is closed while feeding writeMessages channel", slog.String("message", string(msgBs)))
 		return nil
 	case s.writeMessages <- ioMsg:
 	}
 
+	if ioMsg.errs == nil {
+		return nil
+	}
+
 	// Wait for the resulting error channel to receive the error.
 	select {
 	case err := <-ioMsg.errs:
 		if err != nil {
 			s.logger.Error("get error result from write", slog.String("err", err.Error()))
+			return err
 		}
-		return err
+		return nil
 	case <-ctx.Done():
 		s.logger.Error("failed to wait for write result", slog.String("err", ctx.Err().Error()))
 		return ctx.Err()
+	case <-timeout:
+		s.logger.Error("failed to wait for write result", slog.String("err", ErrSendQueueFull.Error()))
+		return ErrSendQueueFull
 	case <-s.done:
 		s.logger.Warn("session is closed while waiting for write result", slog.String("message", string(msgBs)))
 		return nil
@@ -166,55 +278,41 @@ func (s stdIOSession) Messages() iter.Seq[JSONRPCMessage] {
 	return func(yield func(JSONRPCMessage) bool) {
 		defer close(s.readClosed)
 
-		// Use bufio.Reader instead of bufio.Scanner to avoid max token size errors.
-		reader := bufio.NewReader(s.reader)
+		// We read the lines in a separate goroutine to avoid blocking on slow readers, so we can listen
+		// to done channel and return if needed.
+		lines := make(chan stdIOLine)
+		go s.readLines(lines)
+
 		for {
-			type lineWithErr struct {
-				line string
-				err  error
+			var line stdIOLine
+			select {
+			case <-s.done:
+				return
+			case line = <-lines:
 			}
 
-			lines := make(chan lineWithErr)
-
-			// We use goroutines to avoid blocking on slow readers, so we can listen
-			// to done channel and return if needed.
-			go func() {
-				line, err := reader.ReadString('\n')
-				if err != nil {
-					select {
-					case lines <- lineWithErr{err: err}:
-					default:
-					}
+			if line.err != nil {
+				if errors.Is(line.err, io.EOF) {
 					return
 				}
-				s.logger.Info("received message", slog.String("msg", line))
-				select {
-				case lines <- lineWithErr{line: strings.TrimSuffix(line, "\n")}:
-				default:
-				}
-			}()
-
-			var lwe lineWithErr
-			select {
-			case <-s.done:
+				s.logger.Error("failed to read message", "err", line.err)
 				return
-			case lwe = <-lines:
 			}
 
-			if lwe.err != nil {
-				if errors.Is(lwe.err, io.EOF) {
+			if line.oversize {
+				msg, ok := s.handleOversizeLine(line)
+				if ok && !yield(msg) {
 					return
 				}
-				s.logger.Error("failed to read message", "err", lwe.err)
-				return
+				continue
 			}
 
-			if lwe.line == "" {
+			if len(line.data) == 0 {
 				continue
 			}
 
 			var msg JSONRPCMessage
-			if err := json.Unmarshal([]byte(lwe.line), &msg); err != nil {
+			if err := json.Unmarshal(line.data, &msg); err != nil {
 				s.logger.Error("failed to unmarshal message", "err", err)
 				continue
 			}
@@ -249,6 +347,196 @@ func (s stdIOSession) processWriteMessages() {
 
 		_, err := s.writer.Write(msg.msg)
 
+		if msg.errs == nil {
+			if err != nil {
+				s.logger.Error("failed to write queued message", slog.String("err", err.Error()))
+			}
+			continue
+		}
 		msg.errs <- err
 	}
 }
+
+// readLines reads the lines until the reader fails, the last line carries the error.
+func (s stdIOSession) readLines(lines chan<- stdIOLine) {
+	// Use bufio.Reader instead of bufio.Scanner to avoid max token size errors.
+	reader := bufio.NewReader(s.reader)
+	for {
+		line := readStdIOLine(reader, s.maxInboundSize)
+		if line.err == nil && !line.oversize {
+			s.logger.Info("received message", slog.String("msg", string(line.data)))
+		}
+
+		select {
+		case <-s.done:
+			return
+		case lines <- line:
+		}
+
+		if line.err != nil {
+			return
+		}
+	}
+}
+
+// handleOversizeLine answers the message that exceeds the maximum inbound size, identified from its
+// truncated data. The request and the batch are answered with an error response, and the response is
+// replaced with an error response that is returned to be delivered instead, the other messages are
+// dropped.
+func (s stdIOSession) handleOversizeLine(line stdIOLine) (JSONRPCMessage, bool) {
+	reason := fmt.Sprintf("message of %d bytes exceeds the maximum size of %d bytes", line.size, s.maxInboundSize)
+	// The requests of the batch can't be answered one by one, as the batch is truncated, so the whole
+	// batch is answered with a single error response with the null ID.
+	if data := bytes.TrimLeft(line.data, " \t\r"); len(data) > 0 && data[0] == '[' {
+		s.logger.Warn("dropping batch that is too large", slog.Int("size", line.size))
+		go s.answerOversizeRequest("", reason)
+		return JSONRPCMessage{}, false
+	}
+
+	id, method, response := peekJSONRPCMessage(line.data)
+	s.logger.Warn("dropping message that is too large",
+		slog.String("id", string(id)),
+		slog.String("method", method),
+		slog.Int("size", line.size))
+
+	switch {
+	case id != "" && method != "":
+		go s.answerOversizeRequest(id, reason)
+	case id != "" && response:
+		return JSONRPCMessage{
+			JSONRPC: JSONRPCVersion,
+			ID:      id,
+			Error:   &JSONRPCError{Code: jsonRPCInternalErrorCode, Message: reason},
+		}, true
+	}
+	return JSONRPCMessage{}, false
+}
+
+// answerOversizeRequest answers the request that exceeds the maximum inbound size with an invalid
+// request error. It should be called in the background, as the writer might be blocked by the other
+// party that is not reading until its request is answered.
+func (s stdIOSession) answerOversizeRequest(id MustString, reason string) {
+	if err := s.Send(context.Background(), JSONRPCMessage{
+		JSONRPC: JSONRPCVersion,
+		ID:      id,
+		Error:   &JSONRPCError{Code: jsonRPCInvalidRequestCode, Message: reason},
+	}); err != nil {
+		s.logger.Error("failed to answer message that is too large", slog.String("err", err.Error()))
+	}
+}
+
+// readStdIOLine reads a line without its newline. If the line exceeds the maxSize, only the first
+// maxSize bytes are kept, and the rest of the line is discarded.
+func readStdIOLine(reader *bufio.Reader, maxSize int) stdIOLine {
+	var line stdIOLine
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		line.size += len(chunk)
+		if keep := maxSize - len(line.data); maxSize <= 0 || keep > 0 {
+			if maxSize > 0 && len(chunk) > keep {
+				chunk = chunk[:keep]
+			}
+			line.data = append(line.data, chunk...)
+		}
+
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		if err != nil {
+			line.err = err
+			return line
+		}
+		break
+	}
+
+	// The size excludes the newline.
+	line.size--
+	line.oversize = maxSize > 0 && line.size > maxSize
+	if !line.oversize {
+		line.data = line.data[:line.size]
+	}
+	return line
+}
+
+// peekJSONRPCMessage identifies the message from the beginning of its encoded data, which may be
+// truncated. It returns the ID and the method of the message, and whether it's a response, as far as
+// they're found before the data ends.
+func peekJSONRPCMessage(data []byte) (MustString, string, bool) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	if tok, err := decoder.Token(); err != nil || tok != json.Delim('{') {
+		return "", "", false
+	}
+
+	var id MustString
+	var method string
+	var response bool
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			break
+		}
+
+		switch key {
+		case "id", "method":
+			value, err := decoder.Token()
+			if err != nil {
+				return id, method, response
+			}
+			switch v := value.(type) {
+			case string:
+				if key == "id" {
+					id = MustString(v)
+				} else {
+					method = v
+				}
+			case json.Number:
+				if key == "id" {
+					id = MustString(v.String())
+				}
+			}
+			continue
+		case "result", "error":
+			response = true
+		}
+
+		// Skip the value of the other keys, which ends the peeking if it's truncated.
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			break
+		}
+	}
+	return id, method, response && method == ""
+}
+
+// oversizeResponse returns the error response that replaces the response that exceeds the maximum
+// size, or the batch of them. It reports false if the message is not a response.
+func oversizeResponse(msg JSONRPCMessage, reason string) (JSONRPCMessage, bool) {
+	if len(msg.Batch) > 0 {
+		batch := make([]JSONRPCMessage, 0, len(msg.Batch))
+		for _, m := range msg.Batch {
+			resp, ok := oversizeResponse(m, reason)
+			if !ok {
+				return JSONRPCMessage{}, false
+			}
+			batch = append(batch, resp)
+		}
+		return JSONRPCMessage{Batch: batch}, true
+	}
+
+	if msg.ID == "" || msg.Method != "" {
+		return JSONRPCMessage{}, false
+	}
+	if msg.Error != nil {
+		// The error response is kept, but its data might be the reason it's too large.
+		resErr := *msg.Error
+		resErr.Data = nil
+		return JSONRPCMessage{JSONRPC: JSONRPCVersion, ID: msg.ID, Error: &resErr}, true
+	}
+	return JSONRPCMessage{
+		JSONRPC: JSONRPCVersion,
+		ID:      msg.ID,
+		Error:   &JSONRPCError{Code: jsonRPCInternalErrorCode, Message: reason},
+	}, true
+}
@@ -1,10 +1,14 @@
 package mcp_test
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -278,6 +282,261 @@ func TestStdIOMalformedJSONHandling(t *testing.T) {
 	}
 }
 
+func TestStdIOMaxInboundMessageSize(t *testing.T) {
+	clientReader, serverWriter := io.Pipe()
+	serverReader, clientWriter := io.Pipe()
+
+	serverTransport := mcp.NewStdIO(serverReader, serverWriter, mcp.WithStdIOMaxInboundMessageSize(256),
+		mcp.WithStdIOLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	srvSession, err := serverTransport.StartSession(ctx)
+	if err != nil {
+		t.Fatalf("failed to start session: %v", err)
+	}
+	defer srvSession.Stop()
+
+	received := make(chan mcp.JSONRPCMessage, 10)
+	go func() {
+		for msg := range srvSession.Messages() {
+			received <- msg
+		}
+	}()
+
+	largeParams := string(generateRandomJSON(1024))
+	lines := []string{
+		// The large request is answered with an error response.
+		`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":` + largeParams + `}`,
+		// The large response is replaced with an error response.
+		`{"jsonrpc":"2.0","id":"2","result":` + largeParams + `}`,
+		// The large notification is dropped.
+		`{"jsonrpc":"2.0","method":"notifications/message","params":` + largeParams + `}`,
+		// The large batch is answered with an error response with the null ID.
+		`[{"jsonrpc":"2.0","id":3,"method":"tools/call","params":` + largeParams + `}]`,
+		`{"jsonrpc":"2.0","method":"small"}`,
+	}
+	go func() {
+		for _, line := range lines {
+			if _, err := clientWriter.Write([]byte(line + "\n")); err != nil {
+				return
+			}
+		}
+	}()
+
+	// The error responses are sent in the background, so they might be written in any order.
+	reader := bufio.NewReader(clientReader)
+	errResps := make(map[mcp.MustString]string)
+	for range 2 {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("failed to read error response: %v", err)
+		}
+		var errResp mcp.JSONRPCMessage
+		if err := json.Unmarshal([]byte(line), &errResp); err != nil {
+			t.Fatalf("failed to unmarshal error response: %v", err)
+		}
+		if errResp.Error == nil || errResp.Error.Code != -32600 {
+			t.Errorf("expected invalid request error response, got %+v", errResp)
+		}
+		errResps[errResp.ID] = line
+	}
+	if _, ok := errResps["1"]; !ok {
+		t.Errorf("expected error response for request 1, got %v", errResps)
+	}
+	if line, ok := errResps[""]; !ok || !strings.Contains(line, `"id":null`) {
+		t.Errorf("expected error response with the null ID for the batch, got %v", errResps)
+	}
+
+	msg := <-received
+	if msg.ID != "2" || msg.Error == nil || !strings.Contains(msg.Error.Message, "exceeds the maximum size") {
+		t.Errorf("expected error response replacing response 2, got %+v", msg)
+	}
+	if msg := <-received; msg.Method != "small" {
+		t.Errorf("expected the small message after the dropped notification, got %+v", msg)
+	}
+}
+
+func TestStdIOMaxOutboundMessageSize(t *testing.T) {
+	clientReader, serverWriter := io.Pipe()
+	serverTransport := mcp.NewStdIO(strings.NewReader(""), serverWriter, mcp.WithStdIOMaxOutboundMessageSize(256),
+		mcp.WithStdIOLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	srvSession, err := serverTransport.StartSession(ctx)
+	if err != nil {
+		t.Fatalf("failed to start session: %v", err)
+	}
+	defer srvSession.Stop()
+
+	go func() {
+		for range srvSession.Messages() {
+		}
+	}()
+	written := make(chan mcp.JSONRPCMessage, 1)
+	go func() {
+		written <- readJSONRPCLine(t, bufio.NewReader(clientReader))
+	}()
+
+	largeParams := generateRandomJSON(1024)
+	err = srvSession.Send(ctx, mcp.JSONRPCMessage{JSONRPC: mcp.JSONRPCVersion, Method: "large", Params: largeParams})
+	if !errors.Is(err, mcp.ErrMessageTooLarge) {
+		t.Errorf("expected ErrMessageTooLarge for the large request, got %v", err)
+	}
+
+	// The large response is answered with the error response instead, so it's sent successfully.
+	err = srvSession.Send(ctx, mcp.JSONRPCMessage{JSONRPC: mcp.JSONRPCVersion, ID: "1", Result: largeParams})
+	if err != nil {
+		t.Errorf("expected the error response to be sent for the large response, got %v", err)
+	}
+	// Only the error response replacing the large response is written.
+	msg := <-written
+	if msg.ID != "1" || msg.Error == nil || msg.Error.Code != -32603 {
+		t.Errorf("expected internal error response for response 1, got %+v", msg)
+	}
+}
+
+func TestStdIOSendQueue(t *testing.T) {
+	clientReader, serverWriter := io.Pipe()
+	serverTransport := mcp.NewStdIO(strings.NewReader(""), serverWriter,
+		mcp.WithStdIOSendQueueSize(2),
+		mcp.WithStdIOSendTimeout(100*time.Millisecond),
+		mcp.WithStdIOLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	srvSession, err := serverTransport.StartSession(ctx)
+	if err != nil {
+		t.Fatalf("failed to start session: %v", err)
+	}
+	defer srvSession.Stop()
+	go func() {
+		for range srvSession.Messages() {
+		}
+	}()
+
+	// Nothing reads the pipe, so the writer is blocked by the first message, and the next two messages
+	// fill the queue.
+	for i := range 3 {
+		msg := mcp.JSONRPCMessage{JSONRPC: mcp.JSONRPCVersion, Method: fmt.Sprintf("queued-%d", i)}
+		if err := srvSession.Send(ctx, msg); err != nil {
+			t.Fatalf("failed to send message %d: %v", i, err)
+		}
+	}
+
+	start := time.Now()
+	err = srvSession.Send(ctx, mcp.JSONRPCMessage{JSONRPC: mcp.JSONRPCVersion, Method: "overflow"})
+	if !errors.Is(err, mcp.ErrSendQueueFull) {
+		t.Errorf("expected ErrSendQueueFull, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("expected Send to wait for the send timeout, took %s", elapsed)
+	}
+
+	// The queued messages are written in order once the other side reads them.
+	reader := bufio.NewReader(clientReader)
+	for i := range 3 {
+		if msg := readJSONRPCLine(t, reader); msg.Method != fmt.Sprintf("queued-%d", i) {
+			t.Errorf("expected message queued-%d, got %s", i, msg.Method)
+		}
+	}
+}
+
+func TestStdIOSendTimeout(t *testing.T) {
+	clientReader, serverWriter := io.Pipe()
+	serverTransport := mcp.NewStdIO(strings.NewReader(""), serverWriter,
+		mcp.WithStdIOSendTimeout(100*time.Millisecond),
+		mcp.WithStdIOLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	srvSession, err := serverTransport.StartSession(ctx)
+	if err != nil {
+		t.Fatalf("failed to start session: %v", err)
+	}
+	defer srvSession.Stop()
+	// Unblock the writer, so the session can be stopped.
+	defer clientReader.Close()
+	go func() {
+		for range srvSession.Messages() {
+		}
+	}()
+
+	// Without the send queue, the writer accepts the message, and blocks on writing it, as nothing
+	// reads the pipe.
+	start := time.Now()
+	err = srvSession.Send(ctx, mcp.JSONRPCMessage{JSONRPC: mcp.JSONRPCVersion, Method: "unread"})
+	if !errors.Is(err, mcp.ErrSendQueueFull) {
+		t.Errorf("expected ErrSendQueueFull, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("expected Send to fail after the send timeout, took %s", elapsed)
+	}
+}
+
+func TestStdIOToolResultTooLarge(t *testing.T) {
+	registry := mcp.NewRegistry()
+	defer registry.Close()
+	registry.AddTool(mcp.Tool{Name: "read_file"},
+		func(context.Context, mcp.CallToolParams, mcp.ProgressReporter, mcp.RequestClientFunc) (
+			mcp.CallToolResult, error,
+		) {
+			text := strings.Repeat("a", 4096)
+			return mcp.CallToolResult{Content: []mcp.Content{{Type: mcp.ContentTypeText, Text: text}}}, nil
+		})
+
+	srvReader, srvWriter := io.Pipe()
+	cliReader, cliWriter := io.Pipe()
+	defer srvWriter.Close()
+	defer cliWriter.Close()
+
+	srv := mcp.NewServer(mcp.Info{Name: "test-server", Version: "1.0"},
+		mcp.NewStdIO(srvReader, cliWriter, mcp.WithStdIOMaxOutboundMessageSize(1024),
+			mcp.WithStdIOLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))),
+		mcp.WithToolServer(registry),
+		mcp.WithServerLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	go srv.Serve()
+
+	cli := mcp.NewClient(mcp.Info{Name: "test-client", Version: "1.0"},
+		mcp.NewStdIO(cliReader, srvWriter, mcp.WithStdIOLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))),
+		mcp.WithClientLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := cli.Connect(ctx); err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer cli.Disconnect(ctx)
+	defer srv.Shutdown(ctx)
+
+	// The client receives the error instead of waiting for the result that is never sent.
+	_, err := cli.CallTool(ctx, mcp.CallToolParams{Name: "read_file"})
+	var jsonErr *mcp.JSONRPCError
+	if !errors.As(err, &jsonErr) || !strings.Contains(jsonErr.Message, "exceeds") {
+		t.Errorf("expected the message too large error, got %v", err)
+	}
+}
+
+// readJSONRPCLine reads a newline-delimited message written by StdIO.
+func readJSONRPCLine(t *testing.T, reader *bufio.Reader) mcp.JSONRPCMessage {
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		t.Errorf("failed to read line: %v", err)
+		return mcp.JSONRPCMessage{}
+	}
+	var msg mcp.JSONRPCMessage
+	if err := json.Unmarshal(line, &msg); err != nil {
+		t.Errorf("failed to unmarshal line: %v", err)
+	}
+	return msg
+}
+
 // func TestStdIOConcurrentMessageStress(t *testing.T) {
 // 	// Create buffered pipes to simulate stdin/stdout
 // 	clientReader, serverWriter, err := os.Pipe()
@@ -0,0 +1,1087 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"log/slog"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/tmaxmax/go-sse"
+)
+
+// StreamableHTTPServer implements a framework-agnostic server for the Streamable HTTP transport.
+// All the communication happens through a single endpoint: clients send their messages with
+// HTTP POST, and the server answers each request either with a single JSON response, or with
+// an SSE stream that carries the response along with the related requests and notifications.
+// Clients may also open a standalone SSE stream with HTTP GET to receive messages that are not
+// related to any request, and terminate their session with HTTP DELETE.
+//
+// Sessions are assigned when the client sends the initialize request, and tracked with the
+// Mcp-Session-Id header.
+//
+// Instances should be created using NewStreamableHTTPServer and properly shut down using
+// Shutdown when no longer needed.
+type StreamableHTTPServer struct {
+	logger             *slog.Logger
+	jsonResponse       bool
+	maxPendingMessages int
+
+	registry *streamableSessionRegistry
+	sessions chan *streamableServerSession
+
+	done   chan struct{}
+	closed chan struct{}
+}
+
+// StreamableHTTPServerOption represents the options for the StreamableHTTPServer.
+type StreamableHTTPServerOption func(*StreamableHTTPServer)
+
+// StreamableHTTPClient implements a Streamable HTTP client that sends messages to the server
+// with HTTP POST, and receives the server messages from the JSON responses or the SSE streams
+// opened by the server. Once the server assigned a session, the client also opens a standalone
+// SSE stream to receive the messages that are not related to any request. Once the Client is
+// initialized, the requests carry the negotiated protocol version in the MCP-Protocol-Version header.
+// Instances should be created using NewStreamableHTTPClient.
+type StreamableHTTPClient struct {
+	httpClient *http.Client
+	url        string
+	logger     *slog.Logger
+
+	maxPayloadSize int
+
+	// The fields below are guarded by mu, as they are accessed by the callers of Send
+	// and the goroutines that read the server streams, and they're replaced on every
+	// StartSession, so the client is able to start a new session after the previous one ends.
+	mu              sync.Mutex
+	sessionID       string
+	protocolVersion string
+	session         *streamableClientSession
+}
+
+// streamableClientSession holds the resources of a single session of the StreamableHTTPClient.
+type streamableClientSession struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// stopped is guarded by the mu of the client.
+	stopped bool
+	readers sync.WaitGroup
+
+	messages chan JSONRPCMessage
+	closed   chan struct{}
+}
+
+// StreamableHTTPClientOption represents the options for the StreamableHTTPClient.
+type StreamableHTTPClientOption func(*StreamableHTTPClient)
+
+type streamableSessionRegistry struct {
+	mu       sync.Mutex
+	sessions map[string]*streamableServerSession
+}
+
+type streamableServerSession struct {
+	id           string
+	registry     *streamableSessionRegistry
+	receivedMsgs chan JSONRPCMessage
+	logger       *slog.Logger
+
+	// The streams below are guarded by mu, as they are opened and closed by the http handlers,
+	// and looked up by the callers of Send.
+	mu             sync.Mutex
+	standalone     *streamableStream
+	requestStreams map[MustString]*streamableStream
+	// pending holds the messages sent while there's no open SSE stream to carry them, until the
+	// client opens the standalone stream.
+	pending            []JSONRPCMessage
+	maxPendingMessages int
+
+	stopOnce       *sync.Once
+	done           chan struct{}
+	receivedClosed chan struct{}
+}
+
+// streamableStream represents an open HTTP response that the session can write messages to.
+// The messages are queued to the handler that owns the response, so the writes only happen
+// in the handler's goroutine.
+type streamableStream struct {
+	sendMsgs chan streamableSendMsg
+	// events reports whether the stream is an SSE stream. The non-SSE stream is only able to
+	// carry the response of the request.
+	events bool
+	// pending is the messages queued before the stream is opened, written before the others.
+	pending []JSONRPCMessage
+	done    chan struct{}
+}
+
+type streamableSendMsg struct {
+	msg  JSONRPCMessage
+	errs chan<- error
+}
+
+const (
+	streamableSessionIDHeader = "Mcp-Session-Id"
+
+	streamableDeleteTimeout = 5 * time.Second
+
+	defaultStreamableMaxPendingMessages = 100
+)
+
+// NewStreamableHTTPServer creates and initializes a new Streamable HTTP server. The server is
+// immediately operational upon creation, and the endpoint is served by the handler returned from
+// HandleMCP. The returned StreamableHTTPServer must be closed using Shutdown when no longer needed.
+func NewStreamableHTTPServer(options ...StreamableHTTPServerOption) StreamableHTTPServer {
+	s := StreamableHTTPServer{
+		logger: slog.Default(),
+		registry: &streamableSessionRegistry{
+			sessions: make(map[string]*streamableServerSession),
+		},
+		sessions:           make(chan *streamableServerSession, 5),
+		maxPendingMessages: defaultStreamableMaxPendingMessages,
+		done:               make(chan struct{}),
+		closed:             make(chan struct{}),
+	}
+
+	for _, opt := range options {
+		opt(&s)
+	}
+
+	return s
+}
+
+// WithStreamableHTTPServerLogger sets the logger for the StreamableHTTPServer.
+func WithStreamableHTTPServerLogger(logger *slog.Logger) StreamableHTTPServerOption {
+	return func(s *StreamableHTTPServer) {
+		s.logger = logger.With(
+			slog.String("package", "go-mcp"),
+			slog.String("component", "streamable-http-server"),
+		)
+	}
+}
+
+// WithStreamableHTTPJSONResponse configures the server to answer the requests with a single JSON
+// response instead of an SSE stream. In this mode, the messages related to a request are delivered
+// through the standalone SSE stream opened by the client.
+func WithStreamableHTTPJSONResponse() StreamableHTTPServerOption {
+	return func(s *StreamableHTTPServer) {
+		s.jsonResponse = true
+	}
+}
+
+// WithStreamableHTTPServerMaxPendingMessages sets how many messages the server keeps for a session
+// while its client has no open SSE stream to receive them, such as before the client opens the
+// standalone stream, or when the requests are answered with JSON responses. The kept messages are
+// delivered once the client opens the standalone stream, and sending more messages fails right away.
+// The default is 100, and a non-positive size disables keeping the messages.
+func WithStreamableHTTPServerMaxPendingMessages(size int) StreamableHTTPServerOption {
+	return func(s *StreamableHTTPServer) {
+		s.maxPendingMessages = size
+	}
+}
+
+// NewStreamableHTTPClient creates a Streamable HTTP client that communicates with the server
+// endpoint at the specified url. The optional httpClient parameter allows custom HTTP client
+// configuration - if nil, the default HTTP client is used. The client must call StartSession
+// to begin communication.
+func NewStreamableHTTPClient(
+	url string,
+	httpClient *http.Client,
+	options ...StreamableHTTPClientOption,
+) *StreamableHTTPClient {
+	cli := httpClient
+	if cli == nil {
+		cli = http.DefaultClient
+	}
+	s := &StreamableHTTPClient{
+		url:        url,
+		httpClient: cli,
+		logger:     slog.Default(),
+	}
+
+	for _, opt := range options {
+		opt(s)
+	}
+
+	return s
+}
+
+// WithStreamableHTTPClientMaxPayloadSize sets the maximum size of the SSE event that can be
+// received from the server. If the payload size exceeds this limit, the error will be logged
+// and the stream will be closed.
+func WithStreamableHTTPClientMaxPayloadSize(size int) StreamableHTTPClientOption {
+	return func(s *StreamableHTTPClient) {
+		s.maxPayloadSize = size
+	}
+}
+
+// WithStreamableHTTPClientLogger sets the logger for the StreamableHTTPClient.
+func WithStreamableHTTPClientLogger(logger *slog.Logger) StreamableHTTPClientOption {
+	return func(s *StreamableHTTPClient) {
+		s.logger = logger.With(
+			slog.String("package", "go-mcp"),
+			slog.String("component", "streamable-http-client"),
+		)
+	}
+}
+
+// Sessions returns an iterator over client sessions. The iterator yields a new Session
+// every time a client sends an initialize request without a session ID.
+func (s StreamableHTTPServer) Sessions() iter.Seq[Session] {
+	return func(yield func(Session) bool) {
+		defer close(s.closed)
+
+		for {
+			select {
+			case <-s.done:
+				return
+			case sess := <-s.sessions:
+				if !yield(sess) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Shutdown gracefully shuts down the Streamable HTTP server by terminating all the open
+// streams and cleaning up internal resources. This method blocks until shutdown is complete.
+func (s StreamableHTTPServer) Shutdown(ctx context.Context) error {
+	// Signal the server to shutdown.
+	close(s.done)
+
+	// Wait for main loop to finish.
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("failed to close Streamable HTTP server: %w", ctx.Err())
+	case <-s.closed:
+	}
+	return nil
+}
+
+// HandleMCP returns an http.Handler for the MCP endpoint. The handler processes client
+// messages sent via POST requests, opens the standalone SSE stream for GET requests, and
+// terminates the session for DELETE requests.
+func (s StreamableHTTPServer) HandleMCP() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			s.handlePost(w, r)
+		case http.MethodGet:
+			s.handleGet(w, r)
+		case http.MethodDelete:
+			s.handleDelete(w, r)
+		default:
+			w.Header().Set("Allow", "GET, POST, DELETE")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func (s StreamableHTTPServer) handlePost(w http.ResponseWriter, r *http.Request) {
+	decoder := json.NewDecoder(r.Body)
+	var msg JSONRPCMessage
+
+	if err := decoder.Decode(&msg); err != nil {
+		nErr := fmt.Errorf("failed to decode message: %w", err)
+		s.logger.Warn("failed to decode message", slog.String("err", nErr.Error()))
+		http.Error(w, nErr.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var session *streamableServerSession
+	if r.Header.Get(streamableSessionIDHeader) == "" && msg.Method == methodInitialize {
+		// The client is initializing a new session, register it, and feed the sessions channel that
+		// would be consumed in Sessions loop, so it can be forwarded to caller.
+		session = s.newSession()
+		select {
+		case <-s.done:
+			s.registry.remove(session.id)
+			http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+			return
+		case <-r.Context().Done():
+			s.registry.remove(session.id)
+			return
+		case s.sessions <- session:
+		}
+	} else {
+		var ok bool
+		if session, ok = s.lookupSession(w, r); !ok {
+			return
+		}
+	}
+
+	w.Header().Set(streamableSessionIDHeader, session.id)
+
+	// Notifications and responses don't expect any answer from the server, so we only need to
+	// forward them to the session.
+	reqIDs := requestIDs(msg)
+	if len(reqIDs) == 0 {
+		if !s.deliverMessage(w, r, session, msg) {
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	// Open the stream for the requests before forwarding them, so the response can't be sent before
+	// the stream is known by the session.
+	events := !s.jsonResponse && acceptsEventStream(r)
+	stream := session.openRequestStream(reqIDs, events)
+	defer session.closeRequestStream(reqIDs, stream)
+
+	if !s.deliverMessage(w, r, session, msg) {
+		return
+	}
+
+	if !events {
+		s.writeJSONResponse(w, r, session, stream)
+		return
+	}
+	s.writeEventStream(w, r, session, stream, reqIDs)
+}
+
+func (s StreamableHTTPServer) handleGet(w http.ResponseWriter, r *http.Request) {
+	if !acceptsEventStream(r) {
+		http.Error(w, "client must accept text/event-stream", http.StatusNotAcceptable)
+		return
+	}
+
+	session, ok := s.lookupSession(w, r)
+	if !ok {
+		return
+	}
+
+	stream, ok := session.openStandaloneStream()
+	if !ok {
+		http.Error(w, "standalone stream is already open", http.StatusConflict)
+		return
+	}
+	defer session.closeStandaloneStream(stream)
+
+	w.Header().Set(streamableSessionIDHeader, session.id)
+	s.writeEventStream(w, r, session, stream, nil)
+}
+
+func (s StreamableHTTPServer) handleDelete(w http.ResponseWriter, r *http.Request) {
+	session, ok := s.lookupSession(w, r)
+	if !ok {
+		return
+	}
+
+	// Signal the session to close, the owner of the session would call Stop once it notices.
+	session.terminate()
+	s.registry.remove(session.id)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s StreamableHTTPServer) newSession() *streamableServerSession {
+	session := &streamableServerSession{
+		id:                 uuid.New().String(),
+		registry:           s.registry,
+		receivedMsgs:       make(chan JSONRPCMessage),
+		logger:             s.logger,
+		requestStreams:     make(map[MustString]*streamableStream),
+		maxPendingMessages: s.maxPendingMessages,
+		stopOnce:           &sync.Once{},
+		done:               make(chan struct{}),
+		receivedClosed:     make(chan struct{}),
+	}
+	s.registry.add(session)
+	return session
+}
+
+func (s StreamableHTTPServer) lookupSession(w http.ResponseWriter, r *http.Request) (*streamableServerSession, bool) {
+	sessID := r.Header.Get(streamableSessionIDHeader)
+	if sessID == "" {
+		nErr := fmt.Errorf("missing %s header", streamableSessionIDHeader)
+		s.logger.Warn("missing session ID header", slog.String("err", nErr.Error()))
+		http.Error(w, nErr.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+
+	session, ok := s.registry.get(sessID)
+	if !ok {
+		// The session might be already terminated, the client should start a new session.
+		http.Error(w, "session not found", http.StatusNotFound)
+		return nil, false
+	}
+	return session, true
+}
+
+func (s StreamableHTTPServer) deliverMessage(
+	w http.ResponseWriter,
+	r *http.Request,
+	session *streamableServerSession,
+	msg JSONRPCMessage,
+) bool {
+	select {
+	case <-s.done:
+		http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+		return false
+	case <-session.done:
+		http.Error(w, "session not found", http.StatusNotFound)
+		return false
+	case <-r.Context().Done():
+		s.logger.Warn("context is cancelled while handling message", slog.Any("message", msg))
+		return false
+	case session.receivedMsgs <- msg:
+	}
+	return true
+}
+
+func (s StreamableHTTPServer) writeJSONResponse(
+	w http.ResponseWriter,
+	r *http.Request,
+	session *streamableServerSession,
+	stream *streamableStream,
+) {
+	select {
+	case <-s.done:
+		http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+	case <-session.done:
+		http.Error(w, "session is closed", http.StatusNotFound)
+	case <-r.Context().Done():
+	case sm := <-stream.sendMsgs:
+		// Only the response is routed to the non-SSE stream, so we can answer the request with it.
+		w.Header().Set("Content-Type", "application/json")
+		err := json.NewEncoder(w).Encode(sm.msg)
+		if err != nil {
+			s.logger.Warn("failed to write response", slog.String("err", err.Error()))
+		}
+		sm.errs <- err
+	}
+}
+
+// writeEventStream writes the messages routed to the stream as SSE events until the client
+// disconnects or the session is closed. If reqIDs is not empty, the stream ends after the response
+// for those requests is written.
+func (s StreamableHTTPServer) writeEventStream(
+	w http.ResponseWriter,
+	r *http.Request,
+	session *streamableServerSession,
+	stream *streamableStream,
+	reqIDs []MustString,
+) {
+	sess, err := sse.Upgrade(w, r)
+	if err != nil {
+		nErr := fmt.Errorf("failed to upgrade session: %w", err)
+		s.logger.Error("failed to upgrade session", "err", nErr)
+		http.Error(w, nErr.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Flush the headers right away, so the client can start reading the stream before
+	// the first message is sent.
+	if err := sess.Flush(); err != nil {
+		s.logger.Warn("failed to flush SSE", slog.String("err", err.Error()))
+		return
+	}
+
+	for _, msg := range stream.pending {
+		if err := writeStreamableEvent(sess, msg); err != nil {
+			s.logger.Warn("failed to send pending message", slog.String("err", err.Error()))
+			return
+		}
+	}
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-session.done:
+			return
+		case <-r.Context().Done():
+			return
+		case sm := <-stream.sendMsgs:
+			err := writeStreamableEvent(sess, sm.msg)
+			if err != nil {
+				s.logger.Warn("failed to send message", slog.String("err", err.Error()))
+			}
+			sm.errs <- err
+			if err != nil {
+				return
+			}
+			if slices.ContainsFunc(responseIDs(sm.msg), func(id MustString) bool {
+				return slices.Contains(reqIDs, id)
+			}) {
+				// The response is written, this stream is done.
+				return
+			}
+		}
+	}
+}
+
+func writeStreamableEvent(sess *sse.Session, msg JSONRPCMessage) error {
+	msgBs, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	sseMsg := &sse.Message{
+		Type: sse.Type("message"),
+	}
+	sseMsg.AppendData(string(msgBs))
+
+	if err := sess.Send(sseMsg); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	if err := sess.Flush(); err != nil {
+		return fmt.Errorf("failed to flush message: %w", err)
+	}
+	return nil
+}
+
+func acceptsEventStream(r *http.Request) bool {
+	for _, accept := range r.Header.Values("Accept") {
+		if strings.Contains(accept, "text/event-stream") {
+			return true
+		}
+	}
+	return false
+}
+
+// StartSession prepares the client for communication with the server. No request is made
+// at this point, as the server assigns the session when it receives the initialize request,
+// which is the first message sent by the MCP client. A new session can be started after the
+// previous one ends.
+func (s *StreamableHTTPClient) StartSession(context.Context) (Session, error) {
+	// We need a long-lived context for the streams that outlive the Send calls, so we create a new
+	// one, and store the cancel function so we can cancel it when we want to stop the session.
+	ctx, cancel := context.WithCancel(context.Background())
+	sess := &streamableClientSession{
+		ctx:      ctx,
+		cancel:   cancel,
+		messages: make(chan JSONRPCMessage, 10),
+		closed:   make(chan struct{}),
+	}
+
+	s.mu.Lock()
+	s.sessionID = ""
+	s.protocolVersion = ""
+	s.session = sess
+	s.mu.Unlock()
+
+	go func() {
+		<-sess.ctx.Done()
+
+		// No reader can be started after this point, wait for the running ones before closing
+		// the messages channel, so they never send to a closed channel.
+		s.mu.Lock()
+		sess.stopped = true
+		s.mu.Unlock()
+
+		sess.readers.Wait()
+		close(sess.messages)
+	}()
+
+	return s, nil
+}
+
+// ID returns the session ID assigned by the server, or an empty string if the session is
+// not initialized yet.
+func (s *StreamableHTTPClient) ID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.sessionID
+}
+
+// Send transmits a JSON-encoded message to the server through an HTTP POST request. The
+// provided context allows request cancellation until the server responds. The messages the
+// server answers with are delivered through Messages. Returns an error if message encoding fails,
+// the request cannot be created, or the server responds with an unexpected status code.
+func (s *StreamableHTTPClient) Send(ctx context.Context, msg JSONRPCMessage) error {
+	msgBs, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	// The response body may be an SSE stream that outlives this call, so the request uses the
+	// long-lived context, and only cancelled by ctx while the server is not responding yet.
+	sess := s.currentSession()
+	reqCtx, reqCancel := context.WithCancel(sess.ctx)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			reqCancel()
+		case <-done:
+		}
+	}()
+
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodPost, s.url, bytes.NewReader(msgBs))
+	if err != nil {
+		close(done)
+		reqCancel()
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	if sessID := s.ID(); sessID != "" {
+		req.Header.Set(streamableSessionIDHeader, sessID)
+	}
+	s.setProtocolVersionHeader(req)
+
+	resp, err := s.httpClient.Do(req)
+	close(done)
+	if err != nil {
+		reqCancel()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusNotFound && s.ID() != "" {
+		// The server terminated our session, end the session so the caller would notice.
+		resp.Body.Close()
+		reqCancel()
+		sess.cancel()
+		return fmt.Errorf("session is terminated by the server")
+	}
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		resp.Body.Close()
+		reqCancel()
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	s.storeSessionID(sess, resp.Header.Get(streamableSessionIDHeader))
+
+	if resp.StatusCode == http.StatusAccepted {
+		resp.Body.Close()
+		reqCancel()
+		return nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || (mediaType != "application/json" && mediaType != "text/event-stream") {
+		resp.Body.Close()
+		reqCancel()
+		return fmt.Errorf("unexpected content type: %s", resp.Header.Get("Content-Type"))
+	}
+
+	// Read the response in a separate goroutine, as the stream may carry the server's requests
+	// that need to be answered by our caller before the response is sent.
+	if !s.startReader(sess) {
+		resp.Body.Close()
+		reqCancel()
+		return fmt.Errorf("session is closed")
+	}
+	go func() {
+		defer sess.readers.Done()
+		defer reqCancel()
+
+		if mediaType == "application/json" {
+			s.readJSON(sess, resp.Body)
+			return
+		}
+		s.readEvents(sess, resp.Body)
+	}()
+
+	return nil
+}
+
+// Messages returns an iterator over received messages from the server.
+func (s *StreamableHTTPClient) Messages() iter.Seq[JSONRPCMessage] {
+	sess := s.currentSession()
+
+	return func(yield func(JSONRPCMessage) bool) {
+		defer close(sess.closed)
+
+		for msg := range sess.messages {
+			if !yield(msg) {
+				return
+			}
+		}
+	}
+}
+
+// Stop gracefully shuts down the Streamable HTTP client by terminating the session on the
+// server and closing all the open streams.
+func (s *StreamableHTTPClient) Stop() {
+	sess := s.currentSession()
+
+	if sessID := s.ID(); sessID != "" {
+		// Terminate the session on the server, this is best-effort, as the server may already
+		// close the session, or may not support the termination.
+		if err := s.terminateSession(sess, sessID); err != nil {
+			s.logger.Warn("failed to terminate session", slog.String("err", err.Error()))
+		}
+	}
+
+	// Cancel the long-lived context to close all the streams.
+	sess.cancel()
+
+	// Wait for the main loop to finish.
+	<-sess.closed
+}
+
+func (s *StreamableHTTPClient) currentSession() *streamableClientSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.session
+}
+
+// setProtocolVersion records the protocol version negotiated by the Client, so it's sent in the
+// header of the following requests.
+func (s *StreamableHTTPClient) setProtocolVersion(version string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.protocolVersion = version
+}
+
+func (s *StreamableHTTPClient) setProtocolVersionHeader(req *http.Request) {
+	s.mu.Lock()
+	version := s.protocolVersion
+	s.mu.Unlock()
+
+	if version != "" {
+		req.Header.Set(protocolVersionHeader, version)
+	}
+}
+
+func (s *StreamableHTTPClient) terminateSession(sess *streamableClientSession, sessID string) error {
+	ctx, cancel := context.WithTimeout(sess.ctx, streamableDeleteTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, s.url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set(streamableSessionIDHeader, sessID)
+	s.setProtocolVersionHeader(req)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+// startReader registers a new goroutine that reads the server messages, it returns false if
+// the session is already stopped.
+func (s *StreamableHTTPClient) startReader(sess *streamableClientSession) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sess.stopped {
+		return false
+	}
+	sess.readers.Add(1)
+	return true
+}
+
+func (s *StreamableHTTPClient) storeSessionID(sess *streamableClientSession, sessID string) {
+	if sessID == "" {
+		return
+	}
+
+	s.mu.Lock()
+	// The response may arrive after a new session is started, then it's not for us to store.
+	if s.session != sess {
+		s.mu.Unlock()
+		return
+	}
+	first := s.sessionID == ""
+	s.sessionID = sessID
+	s.mu.Unlock()
+
+	// Once we know our session, open the standalone stream to receive the messages that are
+	// not related to any of our requests.
+	if first && s.startReader(sess) {
+		go s.listenStandaloneStream(sess, sessID)
+	}
+}
+
+func (s *StreamableHTTPClient) listenStandaloneStream(sess *streamableClientSession, sessID string) {
+	defer sess.readers.Done()
+
+	req, err := http.NewRequestWithContext(sess.ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		s.logger.Error("failed to create request", slog.String("err", err.Error()))
+		return
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set(streamableSessionIDHeader, sessID)
+	s.setProtocolVersionHeader(req)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		if !errors.Is(err, context.Canceled) {
+			s.logger.Error("failed to open standalone stream", slog.String("err", err.Error()))
+		}
+		return
+	}
+
+	if resp.StatusCode == http.StatusMethodNotAllowed {
+		// The server doesn't offer the standalone stream, which is allowed by the specification.
+		resp.Body.Close()
+		s.logger.Debug("server doesn't support standalone stream")
+		return
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		s.logger.Warn("failed to open standalone stream", slog.Int("statusCode", resp.StatusCode))
+		return
+	}
+
+	s.readEvents(sess, resp.Body)
+}
+
+func (s *StreamableHTTPClient) readJSON(sess *streamableClientSession, body io.ReadCloser) {
+	defer body.Close()
+
+	var msg JSONRPCMessage
+	if err := json.NewDecoder(body).Decode(&msg); err != nil {
+		s.logger.Error("failed to unmarshal message", slog.String("err", err.Error()))
+		return
+	}
+
+	s.feedMessage(sess, msg)
+}
+
+func (s *StreamableHTTPClient) readEvents(sess *streamableClientSession, body io.ReadCloser) {
+	defer body.Close()
+
+	// The default value defined in the sse library is 65 KB, set this config if user set a custom value.
+	var config *sse.ReadConfig
+	if s.maxPayloadSize > 0 {
+		config = &sse.ReadConfig{
+			MaxEventSize: s.maxPayloadSize,
+		}
+	}
+
+	// This stream would break when the server ends it, or when the Stop is called.
+	for ev, err := range sse.Read(body, config) {
+		if err != nil {
+			if !errors.Is(err, context.Canceled) {
+				s.logger.Error("failed to read SSE message", slog.String("err", err.Error()))
+			}
+			return
+		}
+
+		if ev.Type != "" && ev.Type != "message" {
+			s.logger.Error("unhandled event type", "type", ev.Type)
+			continue
+		}
+
+		var msg JSONRPCMessage
+		if err := json.Unmarshal([]byte(ev.Data), &msg); err != nil {
+			s.logger.Error("failed to unmarshal message", slog.String("err", err.Error()))
+			continue
+		}
+
+		if !s.feedMessage(sess, msg) {
+			return
+		}
+	}
+}
+
+func (s *StreamableHTTPClient) feedMessage(sess *streamableClientSession, msg JSONRPCMessage) bool {
+	select {
+	case <-sess.ctx.Done():
+		return false
+	case sess.messages <- msg:
+	}
+	return true
+}
+
+func (s *streamableSessionRegistry) add(session *streamableServerSession) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions[session.id] = session
+}
+
+func (s *streamableSessionRegistry) get(id string) (*streamableServerSession, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[id]
+	return session, ok
+}
+
+func (s *streamableSessionRegistry) remove(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, id)
+}
+
+func (s *streamableServerSession) ID() string { return s.id }
+
+func (s *streamableServerSession) Send(ctx context.Context, msg JSONRPCMessage) error {
+	stream, err := s.route(msg)
+	if err != nil {
+		return err
+	}
+	if stream == nil {
+		// The message is kept until the client opens the standalone stream.
+		return nil
+	}
+
+	errs := make(chan error, 1)
+
+	// Queue the message to the handler that owns the stream.
+	select {
+	case stream.sendMsgs <- streamableSendMsg{msg, errs}:
+	case <-stream.done:
+		return fmt.Errorf("stream is closed")
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-s.done:
+		s.logger.Warn("session is closed while sending message", slog.Any("message", msg))
+		return fmt.Errorf("session is closed")
+	}
+
+	// The handler always reports the result once it received the message.
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *streamableServerSession) Messages() iter.Seq[JSONRPCMessage] {
+	return func(yield func(JSONRPCMessage) bool) {
+		defer close(s.receivedClosed)
+
+		for {
+			select {
+			case msg := <-s.receivedMsgs:
+				if !yield(msg) {
+					return
+				}
+			case <-s.done:
+				return
+			}
+		}
+	}
+}
+
+func (s *streamableServerSession) Stop() {
+	s.terminate()
+	s.registry.remove(s.id)
+
+	<-s.receivedClosed
+}
+
+func (s *streamableServerSession) terminate() {
+	s.stopOnce.Do(func() {
+		close(s.done)
+	})
+}
+
+// route finds the stream for the message. The response, and the messages that carry the
+// request ID (such as progress notifications), are routed to the stream of that request, while
+// the other messages are routed to the standalone stream. If the standalone stream is not open,
+// any open SSE stream of this session is used. If there's no open SSE stream for the message that
+// isn't a response, the message is kept in pending, and no stream is returned.
+func (s *streamableServerSession) route(msg JSONRPCMessage) (*streamableStream, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if ids := responseIDs(msg); len(ids) > 0 {
+		for _, id := range ids {
+			if stream, ok := s.requestStreams[id]; ok {
+				return stream, nil
+			}
+		}
+		return nil, fmt.Errorf("no open stream for the response of request %s", ids[0])
+	}
+	if msg.ID != "" {
+		stream, ok := s.requestStreams[msg.ID]
+		if ok && stream.events {
+			return stream, nil
+		}
+	}
+	if s.standalone != nil {
+		return s.standalone, nil
+	}
+	for _, stream := range s.requestStreams {
+		if stream.events {
+			return stream, nil
+		}
+	}
+	// The client may never open the standalone stream, so fail right away instead of waiting for
+	// it once there are too many pending messages.
+	if len(s.pending) >= s.maxPendingMessages {
+		return nil, fmt.Errorf("no open stream to send the message, and %d messages are pending", len(s.pending))
+	}
+	s.pending = append(s.pending, msg)
+	return nil, nil
+}
+
+func (s *streamableServerSession) openRequestStream(reqIDs []MustString, events bool) *streamableStream {
+	stream := &streamableStream{
+		sendMsgs: make(chan streamableSendMsg),
+		events:   events,
+		done:     make(chan struct{}),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The requests of a batch share the same stream, as they are answered with a single batch.
+	for _, id := range reqIDs {
+		s.requestStreams[id] = stream
+	}
+	return stream
+}
+
+func (s *streamableServerSession) closeRequestStream(reqIDs []MustString, stream *streamableStream) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The client may reuse the request ID, so only remove the stream if it's still ours.
+	for _, id := range reqIDs {
+		if s.requestStreams[id] == stream {
+			delete(s.requestStreams, id)
+		}
+	}
+	close(stream.done)
+}
+
+func (s *streamableServerSession) openStandaloneStream() (*streamableStream, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.standalone != nil {
+		return nil, false
+	}
+	s.standalone = &streamableStream{
+		sendMsgs: make(chan streamableSendMsg),
+		events:   true,
+		pending:  s.pending,
+		done:     make(chan struct{}),
+	}
+	s.pending = nil
+	return s.standalone, true
+}
+
+func (s *streamableServerSession) closeStandaloneStream(stream *streamableStream) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.standalone == stream {
+		s.standalone = nil
+	}
+	close(stream.done)
+}
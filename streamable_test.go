@@ -0,0 +1,499 @@
+package mcp_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MegaGrindStone/go-mcp"
+)
+
+func TestStreamableHTTPServerAndClient(t *testing.T) {
+	server := mcp.NewStreamableHTTPServer()
+	testServer := httptest.NewServer(server.HandleMCP())
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := server.Shutdown(ctx); err != nil {
+			t.Errorf("failed to shutdown server: %v", err)
+		}
+		testServer.Close()
+	}()
+
+	// Forward the messages of the server session, so the client's request can be delivered.
+	sessions := make(chan mcp.Session, 1)
+	serverMsgs := make(chan mcp.JSONRPCMessage, 10)
+	go func() {
+		for s := range server.Sessions() {
+			sessions <- s
+			go func() {
+				for msg := range s.Messages() {
+					serverMsgs <- msg
+				}
+			}()
+		}
+	}()
+
+	client := mcp.NewStreamableHTTPClient(testServer.URL, testServer.Client())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	clientSession, err := client.StartSession(ctx)
+	if err != nil {
+		t.Fatalf("failed to start session: %v", err)
+	}
+	defer clientSession.Stop()
+
+	clientMsgs := make(chan mcp.JSONRPCMessage, 10)
+	go func() {
+		for msg := range clientSession.Messages() {
+			clientMsgs <- msg
+		}
+	}()
+
+	// The session is only created by the server when the client sends the initialize request.
+	initMsg := mcp.JSONRPCMessage{
+		JSONRPC: mcp.JSONRPCVersion,
+		ID:      "1",
+		Method:  "initialize",
+		Params:  json.RawMessage(`{}`),
+	}
+	if err := clientSession.Send(ctx, initMsg); err != nil {
+		t.Fatalf("failed to send initialize message: %v", err)
+	}
+
+	var serverSession mcp.Session
+	select {
+	case serverSession = <-sessions:
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for server session")
+	}
+	defer serverSession.Stop()
+
+	receivedByServer := receiveMessage(t, serverMsgs)
+	if receivedByServer.Method != initMsg.Method {
+		t.Errorf("got method %q, want %q", receivedByServer.Method, initMsg.Method)
+	}
+
+	// Progress notification carries the request ID, so it should be delivered within the request stream.
+	progressMsg := mcp.JSONRPCMessage{
+		JSONRPC: mcp.JSONRPCVersion,
+		ID:      initMsg.ID,
+		Method:  "notifications/progress",
+		Params:  json.RawMessage(`{"progress": 1}`),
+	}
+	if err := serverSession.Send(ctx, progressMsg); err != nil {
+		t.Fatalf("failed to send progress message: %v", err)
+	}
+
+	responseMsg := mcp.JSONRPCMessage{
+		JSONRPC: mcp.JSONRPCVersion,
+		ID:      initMsg.ID,
+		Result:  json.RawMessage(`{"hello": "world"}`),
+	}
+	if err := serverSession.Send(ctx, responseMsg); err != nil {
+		t.Fatalf("failed to send response message: %v", err)
+	}
+
+	if msg := receiveMessage(t, clientMsgs); msg.Method != progressMsg.Method {
+		t.Errorf("got method %q, want %q", msg.Method, progressMsg.Method)
+	}
+	if msg := receiveMessage(t, clientMsgs); msg.ID != responseMsg.ID || msg.Method != "" {
+		t.Errorf("got message %+v, want response for %q", msg, responseMsg.ID)
+	}
+
+	if clientSession.ID() != serverSession.ID() {
+		t.Errorf("got client session ID %q, want %q", clientSession.ID(), serverSession.ID())
+	}
+
+	// Notification from client should be forwarded to the server session.
+	notifMsg := mcp.JSONRPCMessage{
+		JSONRPC: mcp.JSONRPCVersion,
+		Method:  "notifications/initialized",
+	}
+	if err := clientSession.Send(ctx, notifMsg); err != nil {
+		t.Fatalf("failed to send notification: %v", err)
+	}
+	if msg := receiveMessage(t, serverMsgs); msg.Method != notifMsg.Method {
+		t.Errorf("got method %q, want %q", msg.Method, notifMsg.Method)
+	}
+
+	// Messages that are not related to any request should be delivered through the standalone stream.
+	serverNotif := mcp.JSONRPCMessage{
+		JSONRPC: mcp.JSONRPCVersion,
+		Method:  "notifications/tools/list_changed",
+	}
+	if err := serverSession.Send(ctx, serverNotif); err != nil {
+		t.Fatalf("failed to send server notification: %v", err)
+	}
+	if msg := receiveMessage(t, clientMsgs); msg.Method != serverNotif.Method {
+		t.Errorf("got method %q, want %q", msg.Method, serverNotif.Method)
+	}
+}
+
+func TestStreamableHTTPJSONResponse(t *testing.T) {
+	server := mcp.NewStreamableHTTPServer(mcp.WithStreamableHTTPJSONResponse())
+	testServer := httptest.NewServer(server.HandleMCP())
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := server.Shutdown(ctx); err != nil {
+			t.Errorf("failed to shutdown server: %v", err)
+		}
+		testServer.Close()
+	}()
+
+	go func() {
+		for s := range server.Sessions() {
+			go func() {
+				for msg := range s.Messages() {
+					_ = s.Send(context.Background(), mcp.JSONRPCMessage{
+						JSONRPC: mcp.JSONRPCVersion,
+						ID:      msg.ID,
+						Result:  json.RawMessage(`{}`),
+					})
+				}
+			}()
+		}
+	}()
+
+	resp := postMessage(t, testServer, "", `{"jsonrpc":"2.0","id":"1","method":"initialize","params":{}}`)
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status code %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("got content type %q, want application/json", ct)
+	}
+	if resp.Header.Get("Mcp-Session-Id") == "" {
+		t.Error("expected session ID header to be set")
+	}
+
+	var msg mcp.JSONRPCMessage
+	if err := json.NewDecoder(resp.Body).Decode(&msg); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if msg.ID != "1" {
+		t.Errorf("got response ID %q, want %q", msg.ID, "1")
+	}
+}
+
+func TestStreamableHTTPProtocolVersionHeader(t *testing.T) {
+	transport := mcp.NewStreamableHTTPServer()
+	var lock sync.Mutex
+	var versions []string
+	handler := transport.HandleMCP()
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			lock.Lock()
+			versions = append(versions, r.Header.Get("MCP-Protocol-Version"))
+			lock.Unlock()
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer testServer.Close()
+
+	srv := mcp.NewServer(mcp.Info{Name: "test-server", Version: "1.0"}, transport,
+		mcp.WithToolServer(&mockToolServer{}))
+	go srv.Serve()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	defer srv.Shutdown(ctx)
+
+	cli := mcp.NewClient(mcp.Info{Name: "test-client", Version: "1.0"},
+		mcp.NewStreamableHTTPClient(testServer.URL, testServer.Client()))
+	if err := cli.Connect(ctx); err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer cli.Disconnect(ctx)
+
+	if _, err := cli.ListTools(ctx, mcp.ListToolsParams{}); err != nil {
+		t.Fatalf("failed to list tools: %v", err)
+	}
+
+	// The version is only sent once it's negotiated by the initialization.
+	lock.Lock()
+	defer lock.Unlock()
+	if len(versions) < 2 || versions[0] != "" || versions[len(versions)-1] != mcp.ProtocolVersion20250326 {
+		t.Errorf("expected no version for the initialization, and %s after, got %q",
+			mcp.ProtocolVersion20250326, versions)
+	}
+}
+
+func TestStreamableHTTPSendBeforeStandaloneStream(t *testing.T) {
+	server := mcp.NewStreamableHTTPServer(mcp.WithStreamableHTTPJSONResponse(),
+		mcp.WithStreamableHTTPServerMaxPendingMessages(2))
+	testServer := httptest.NewServer(server.HandleMCP())
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := server.Shutdown(ctx); err != nil {
+			t.Errorf("failed to shutdown server: %v", err)
+		}
+		testServer.Close()
+	}()
+
+	serverSessions := make(chan mcp.Session, 1)
+	go func() {
+		for s := range server.Sessions() {
+			serverSessions <- s
+			go func() {
+				for msg := range s.Messages() {
+					_ = s.Send(context.Background(), mcp.JSONRPCMessage{
+						JSONRPC: mcp.JSONRPCVersion,
+						ID:      msg.ID,
+						Result:  json.RawMessage(`{}`),
+					})
+				}
+			}()
+		}
+	}()
+
+	resp := postMessage(t, testServer, "", `{"jsonrpc":"2.0","id":"1","method":"initialize","params":{}}`)
+	resp.Body.Close()
+	sessID := resp.Header.Get("Mcp-Session-Id")
+	serverSession := <-serverSessions
+	defer serverSession.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The JSON responses can't carry the notifications, so they're kept until the client opens the
+	// standalone stream, instead of being dropped.
+	notifs := []string{"notifications/tools/list_changed", "notifications/prompts/list_changed"}
+	for _, method := range notifs {
+		if err := serverSession.Send(ctx, mcp.JSONRPCMessage{JSONRPC: mcp.JSONRPCVersion, Method: method}); err != nil {
+			t.Fatalf("failed to send server notification: %v", err)
+		}
+	}
+	// The client may never open the standalone stream, so sending fails right away once the
+	// pending messages are full.
+	err := serverSession.Send(ctx, mcp.JSONRPCMessage{
+		JSONRPC: mcp.JSONRPCVersion,
+		Method:  "notifications/resources/list_changed",
+	})
+	if err == nil || errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the send to fail right away, got %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, testServer.URL, nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Mcp-Session-Id", sessID)
+	getResp, err := testServer.Client().Do(req)
+	if err != nil {
+		t.Fatalf("failed to open standalone stream: %v", err)
+	}
+	defer getResp.Body.Close()
+
+	reader := bufio.NewReader(getResp.Body)
+	for _, method := range notifs {
+		if msg := readStreamEvent(t, reader); msg.Method != method {
+			t.Errorf("got method %q, want %q", msg.Method, method)
+		}
+	}
+}
+
+func TestStreamableHTTPNegativeCases(t *testing.T) {
+	server := mcp.NewStreamableHTTPServer()
+	testServer := httptest.NewServer(server.HandleMCP())
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := server.Shutdown(ctx); err != nil {
+			t.Errorf("failed to shutdown server: %v", err)
+		}
+		testServer.Close()
+	}()
+
+	sessions := make(chan mcp.Session, 1)
+	go func() {
+		for s := range server.Sessions() {
+			sessions <- s
+		}
+	}()
+
+	t.Run("Missing Session ID", func(t *testing.T) {
+		resp := postMessage(t, testServer, "", `{"jsonrpc":"2.0","id":"1","method":"ping"}`)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("got status code %d, want %d", resp.StatusCode, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("Unknown Session ID", func(t *testing.T) {
+		resp := postMessage(t, testServer, "unknown", `{"jsonrpc":"2.0","id":"1","method":"ping"}`)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("got status code %d, want %d", resp.StatusCode, http.StatusNotFound)
+		}
+	})
+
+	t.Run("Invalid Message Format", func(t *testing.T) {
+		resp := postMessage(t, testServer, "", `{invalid json}`)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("got status code %d, want %d", resp.StatusCode, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("Unsupported Method", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPut, testServer.URL, nil)
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+		resp, err := testServer.Client().Do(req)
+		if err != nil {
+			t.Fatalf("failed to send request: %v", err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusMethodNotAllowed {
+			t.Errorf("got status code %d, want %d", resp.StatusCode, http.StatusMethodNotAllowed)
+		}
+	})
+
+	t.Run("Terminated Session", func(t *testing.T) {
+		// Answer all the requests of the new session, so the initialize request below gets its response.
+		serverSessions := make(chan mcp.Session, 1)
+		msgsClosed := make(chan struct{})
+		go func() {
+			defer close(msgsClosed)
+
+			serverSession := <-sessions
+			serverSessions <- serverSession
+			for msg := range serverSession.Messages() {
+				_ = serverSession.Send(context.Background(), mcp.JSONRPCMessage{
+					JSONRPC: mcp.JSONRPCVersion,
+					ID:      msg.ID,
+					Result:  json.RawMessage(`{}`),
+				})
+			}
+		}()
+
+		resp := postMessage(t, testServer, "", `{"jsonrpc":"2.0","id":"1","method":"initialize","params":{}}`)
+		resp.Body.Close()
+		serverSession := <-serverSessions
+		sessID := resp.Header.Get("Mcp-Session-Id")
+
+		req, err := http.NewRequest(http.MethodDelete, testServer.URL, nil)
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+		req.Header.Set("Mcp-Session-Id", sessID)
+		delResp, err := testServer.Client().Do(req)
+		if err != nil {
+			t.Fatalf("failed to send request: %v", err)
+		}
+		delResp.Body.Close()
+
+		if delResp.StatusCode != http.StatusOK {
+			t.Errorf("got status code %d, want %d", delResp.StatusCode, http.StatusOK)
+		}
+
+		// The server session should be closed after the termination.
+		select {
+		case <-msgsClosed:
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for server session to close")
+		}
+		serverSession.Stop()
+
+		resp = postMessage(t, testServer, sessID, `{"jsonrpc":"2.0","id":"2","method":"ping"}`)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("got status code %d, want %d", resp.StatusCode, http.StatusNotFound)
+		}
+	})
+
+	t.Run("Standalone Stream Without Accept Header", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, testServer.URL, nil)
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+		resp, err := testServer.Client().Do(req)
+		if err != nil {
+			t.Fatalf("failed to send request: %v", err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusNotAcceptable {
+			t.Errorf("got status code %d, want %d", resp.StatusCode, http.StatusNotAcceptable)
+		}
+	})
+}
+
+func postMessage(t *testing.T, testServer *httptest.Server, sessID, body string) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, testServer.URL, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	if sessID != "" {
+		req.Header.Set("Mcp-Session-Id", sessID)
+	}
+
+	resp, err := testServer.Client().Do(req)
+	if err != nil {
+		t.Fatalf("failed to send request: %v", err)
+	}
+	return resp
+}
+
+func receiveMessage(t *testing.T, msgs <-chan mcp.JSONRPCMessage) mcp.JSONRPCMessage {
+	t.Helper()
+
+	select {
+	case msg := <-msgs:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for message")
+	}
+	return mcp.JSONRPCMessage{}
+}
+
+// readStreamEvent reads the message of the next event of the SSE stream.
+func readStreamEvent(t *testing.T, reader *bufio.Reader) mcp.JSONRPCMessage {
+	t.Helper()
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("failed to read event: %v", err)
+		}
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok {
+			continue
+		}
+
+		var msg mcp.JSONRPCMessage
+		if err := json.Unmarshal([]byte(data), &msg); err != nil {
+			t.Fatalf("failed to decode event: %v", err)
+		}
+		return msg
+	}
+}
@@ -0,0 +1,367 @@
+package mcp
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var (
+	callToolResultType  = reflect.TypeFor[CallToolResult]()
+	rawMessageType      = reflect.TypeFor[json.RawMessage]()
+	timeType            = reflect.TypeFor[time.Time]()
+	jsonMarshalerType   = reflect.TypeFor[json.Marshaler]()
+	jsonUnmarshalerType = reflect.TypeFor[json.Unmarshaler]()
+	textMarshalerType   = reflect.TypeFor[encoding.TextMarshaler]()
+)
+
+// NewTool creates a tool with the handler serving its calls from a typed Go function, so the tool can be
+// registered with Registry.AddTool. The InputSchema of the tool is derived from In, which must be a
+// struct or a map with string keys, and the arguments of every call are validated against it before
+// they are decoded into In and passed to the function. The arguments that don't match the schema are
+// reported to the client as an error result, pointing at the invalid location, without calling the
+// function.
+//
+// The schema follows the encoding/json rules: the properties are named by the json tag of the fields,
+// and the fields tagged with "-" or unexported are skipped. The fields are required, unless they're
+// tagged with omitempty or omitzero. The description tag sets the description of the property, and
+// the enum tag restricts the property to the comma separated values, which are JSON values, except
+// for the string properties, where they're the strings themselves:
+//
+//	type WeatherArgs struct {
+//		City  string `json:"city" description:"Name of the city"`
+//		Units string `json:"units,omitempty" enum:"metric,imperial"`
+//	}
+//
+// The result of the function is returned to the client depending on Out:
+//   - If Out is a struct or a map with string keys, the tool declares the OutputSchema derived from Out,
+//     and the result is returned as the StructuredContent.
+//   - If Out is a CallToolResult, the result is returned as is.
+//   - If Out is a string, the result is returned as a text content.
+//   - Otherwise, the result is returned as a text content holding its JSON encoding.
+//
+// The error returned by the function is reported to the client as an error result. NewTool returns an
+// error if the schema of In or Out can't be derived, such as when they contain channels or functions.
+func NewTool[In, Out any](
+	name, description string,
+	handler func(context.Context, In) (Out, error),
+) (Tool, ToolHandler, error) {
+	inType := derefType(reflect.TypeFor[In]())
+	if inType.Kind() != reflect.Struct && inType.Kind() != reflect.Map {
+		return Tool{}, nil, fmt.Errorf("input type %s must be a struct or a map", inType)
+	}
+	inSchema, err := generateObjectSchema(inType)
+	if err != nil {
+		return Tool{}, nil, fmt.Errorf("failed to generate input schema: %w", err)
+	}
+	inputSchema, err := json.Marshal(inSchema)
+	if err != nil {
+		return Tool{}, nil, fmt.Errorf("failed to marshal input schema: %w", err)
+	}
+
+	tool := Tool{
+		Name:        name,
+		Description: description,
+		InputSchema: inputSchema,
+	}
+
+	outType := reflect.TypeFor[Out]()
+	structured := outType != callToolResultType &&
+		(derefType(outType).Kind() == reflect.Struct || derefType(outType).Kind() == reflect.Map)
+	if structured {
+		outSchema, err := generateObjectSchema(derefType(outType))
+		if err != nil {
+			return Tool{}, nil, fmt.Errorf("failed to generate output schema: %w", err)
+		}
+		if tool.OutputSchema, err = json.Marshal(outSchema); err != nil {
+			return Tool{}, nil, fmt.Errorf("failed to marshal output schema: %w", err)
+		}
+	}
+
+	toolHandler := func(ctx context.Context, params CallToolParams, _ ProgressReporter, _ RequestClientFunc) (
+		CallToolResult, error,
+	) {
+		args := params.Arguments
+		if len(args) == 0 || string(args) == "null" {
+			args = json.RawMessage("{}")
+		}
+		if err := inSchema.validateJSON(args); err != nil {
+			return toolErrorResult(fmt.Sprintf("invalid arguments: %s", err)), nil
+		}
+		var in In
+		if err := json.Unmarshal(args, &in); err != nil {
+			return toolErrorResult(fmt.Sprintf("invalid arguments: %s", err)), nil
+		}
+
+		out, err := handler(ctx, in)
+		if err != nil {
+			return CallToolResult{}, err
+		}
+
+		return toolResult(out, structured)
+	}
+
+	return tool, toolHandler, nil
+}
+
+func toolResult(out any, structured bool) (CallToolResult, error) {
+	if result, ok := out.(CallToolResult); ok {
+		return result, nil
+	}
+	if text, ok := out.(string); ok {
+		return CallToolResult{Content: []Content{{Type: ContentTypeText, Text: text}}}, nil
+	}
+
+	data, err := json.Marshal(out)
+	if err != nil {
+		return CallToolResult{}, fmt.Errorf("failed to marshal result: %w", err)
+	}
+	if !structured {
+		return CallToolResult{Content: []Content{{Type: ContentTypeText, Text: string(data)}}}, nil
+	}
+	if string(data) == "null" {
+		return CallToolResult{}, errors.New("tool returned no result")
+	}
+	return CallToolResult{StructuredContent: data}, nil
+}
+
+func toolErrorResult(message string) CallToolResult {
+	return CallToolResult{
+		Content: []Content{
+			{
+				Type: ContentTypeText,
+				Text: message,
+			},
+		},
+		IsError: true,
+	}
+}
+
+func derefType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
+
+// generateJSONSchema derives the JSON schema of the values of the type, as they're encoded by
+// encoding/json.
+func generateJSONSchema(t reflect.Type) (*jsonSchema, error) {
+	g := jsonSchemaGenerator{visiting: make(map[reflect.Type]bool)}
+	return g.generate(t)
+}
+
+// generateObjectSchema derives the JSON schema of the struct or map type, used at the root of the tool
+// schemas, which must be objects.
+func generateObjectSchema(t reflect.Type) (*jsonSchema, error) {
+	schema, err := generateJSONSchema(t)
+	if err != nil {
+		return nil, err
+	}
+	schema.Type = jsonSchemaTypes{"object"}
+	return schema, nil
+}
+
+type jsonSchemaGenerator struct {
+	// visiting holds the struct types being generated, so the recursive types don't recurse forever.
+	visiting map[reflect.Type]bool
+}
+
+func (g jsonSchemaGenerator) generate(t reflect.Type) (*jsonSchema, error) {
+	switch {
+	case t.Kind() == reflect.Pointer:
+		// The pointers are encoded as the values they point to, or null.
+	case t == timeType:
+		return &jsonSchema{Type: jsonSchemaTypes{"string"}}, nil
+	case t == rawMessageType:
+		return &jsonSchema{}, nil
+	case t.Implements(jsonMarshalerType), reflect.PointerTo(t).Implements(jsonUnmarshalerType):
+		// The encoding of the type is unknown, so any value is accepted.
+		return &jsonSchema{}, nil
+	case t.Implements(textMarshalerType):
+		return &jsonSchema{Type: jsonSchemaTypes{"string"}}, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &jsonSchema{Type: jsonSchemaTypes{"boolean"}}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return &jsonSchema{Type: jsonSchemaTypes{"integer"}}, nil
+	case reflect.Float32, reflect.Float64:
+		return &jsonSchema{Type: jsonSchemaTypes{"number"}}, nil
+	case reflect.String:
+		return &jsonSchema{Type: jsonSchemaTypes{"string"}}, nil
+	case reflect.Interface:
+		return &jsonSchema{}, nil
+	case reflect.Pointer:
+		schema, err := g.generate(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return nullable(schema), nil
+	case reflect.Slice, reflect.Array:
+		// The byte slices are encoded as base64 strings.
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			return nullable(&jsonSchema{Type: jsonSchemaTypes{"string"}}), nil
+		}
+		items, err := g.generate(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		schema := &jsonSchema{Type: jsonSchemaTypes{"array"}, Items: items}
+		if t.Kind() == reflect.Slice {
+			return nullable(schema), nil
+		}
+		return schema, nil
+	case reflect.Map:
+		key := t.Key()
+		if key.Kind() != reflect.String && !isJSONIntegerKind(key.Kind()) && !key.Implements(textMarshalerType) {
+			return nil, fmt.Errorf("unsupported map key type %s", key)
+		}
+		values, err := g.generate(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return nullable(&jsonSchema{Type: jsonSchemaTypes{"object"}, AdditionalProperties: values}), nil
+	case reflect.Struct:
+		if g.visiting[t] {
+			return &jsonSchema{}, nil
+		}
+		g.visiting[t] = true
+		defer delete(g.visiting, t)
+
+		schema := &jsonSchema{
+			Type:       jsonSchemaTypes{"object"},
+			Properties: make(map[string]*jsonSchema),
+		}
+		if err := g.addFields(schema, t); err != nil {
+			return nil, err
+		}
+		return schema, nil
+	default:
+		return nil, fmt.Errorf("unsupported type %s", t)
+	}
+}
+
+// addFields adds the fields of the struct type to the properties of the schema. The fields of the
+// embedded structs are added after the direct fields, so the direct fields take precedence, as they
+// do in encoding/json.
+func (g jsonSchemaGenerator) addFields(schema *jsonSchema, t reflect.Type) error {
+	var embedded []reflect.Type
+
+	for i := range t.NumField() {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		if field.Anonymous && name == "" {
+			ft := derefType(field.Type)
+			if ft.Kind() == reflect.Struct {
+				embedded = append(embedded, ft)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if _, ok := schema.Properties[name]; ok {
+			continue
+		}
+
+		prop, err := g.fieldSchema(field, opts)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		schema.Properties[name] = prop
+
+		if !hasTagOption(opts, "omitempty") && !hasTagOption(opts, "omitzero") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+
+	for _, et := range embedded {
+		if err := g.addFields(schema, et); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (g jsonSchemaGenerator) fieldSchema(field reflect.StructField, opts string) (*jsonSchema, error) {
+	var prop *jsonSchema
+	if hasTagOption(opts, "string") && isJSONStringOptionKind(derefType(field.Type).Kind()) {
+		// The string option encodes the value inside a JSON string.
+		prop = &jsonSchema{Type: jsonSchemaTypes{"string"}}
+	} else {
+		var err error
+		if prop, err = g.generate(field.Type); err != nil {
+			return nil, err
+		}
+	}
+
+	prop.Description = field.Tag.Get("description")
+
+	if enum, ok := field.Tag.Lookup("enum"); ok {
+		for _, value := range strings.Split(enum, ",") {
+			raw := json.RawMessage(value)
+			if derefType(field.Type).Kind() == reflect.String {
+				raw, _ = json.Marshal(value)
+			} else if !json.Valid(raw) {
+				return nil, fmt.Errorf("invalid enum value %q", value)
+			}
+			prop.Enum = append(prop.Enum, raw)
+		}
+	}
+
+	return prop, nil
+}
+
+func nullable(schema *jsonSchema) *jsonSchema {
+	if len(schema.Type) > 0 {
+		schema.Type = append(schema.Type, "null")
+	}
+	return schema
+}
+
+func hasTagOption(opts, option string) bool {
+	for opts != "" {
+		var opt string
+		opt, opts, _ = strings.Cut(opts, ",")
+		if opt == option {
+			return true
+		}
+	}
+	return false
+}
+
+func isJSONIntegerKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	default:
+		return false
+	}
+}
+
+func isJSONStringOptionKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Bool, reflect.Float32, reflect.Float64, reflect.String:
+		return true
+	default:
+		return isJSONIntegerKind(kind)
+	}
+}
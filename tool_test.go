@@ -0,0 +1,269 @@
+package mcp_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MegaGrindStone/go-mcp"
+)
+
+type weatherArgs struct {
+	City   string   `json:"city" description:"Name of the city"`
+	Units  string   `json:"units,omitempty" enum:"metric,imperial"`
+	Days   int      `json:"days,omitempty"`
+	Tags   []string `json:"tags,omitempty"`
+	Ignore string   `json:"-"`
+	weatherPaging
+}
+
+type weatherPaging struct {
+	Page int `json:"page,omitempty"`
+}
+
+type weatherReport struct {
+	City        string  `json:"city"`
+	Temperature float64 `json:"temperature"`
+	Alerts      []string
+}
+
+func TestNewToolSchema(t *testing.T) {
+	tool, _, err := mcp.NewTool("weather", "Gets the weather",
+		func(context.Context, weatherArgs) (weatherReport, error) { return weatherReport{}, nil })
+	if err != nil {
+		t.Fatalf("failed to create tool: %v", err)
+	}
+
+	wantInput := `{"type":"object","properties":{` +
+		`"city":{"type":"string","description":"Name of the city"},` +
+		`"days":{"type":"integer"},` +
+		`"page":{"type":"integer"},` +
+		`"tags":{"type":["array","null"],"items":{"type":"string"}},` +
+		`"units":{"type":"string","enum":["metric","imperial"]}},` +
+		`"required":["city"]}`
+	if string(tool.InputSchema) != wantInput {
+		t.Errorf("expected input schema %s, got %s", wantInput, tool.InputSchema)
+	}
+
+	wantOutput := `{"type":"object","properties":{` +
+		`"Alerts":{"type":["array","null"],"items":{"type":"string"}},` +
+		`"city":{"type":"string"},` +
+		`"temperature":{"type":"number"}},` +
+		`"required":["city","temperature","Alerts"]}`
+	if string(tool.OutputSchema) != wantOutput {
+		t.Errorf("expected output schema %s, got %s", wantOutput, tool.OutputSchema)
+	}
+
+	if _, _, err := mcp.NewTool("invalid", "",
+		func(context.Context, string) (string, error) { return "", nil }); err == nil {
+		t.Error("expected error for the input that isn't a struct")
+	}
+	if _, _, err := mcp.NewTool("invalid", "",
+		func(context.Context, struct{ C chan int }) (string, error) { return "", nil }); err == nil {
+		t.Error("expected error for the unsupported field type")
+	}
+	if _, _, err := mcp.NewTool("invalid", "",
+		func(context.Context, struct {
+			N int `enum:"one"`
+		},
+		) (string, error) {
+			return "", nil
+		}); err == nil {
+		t.Error("expected error for the invalid enum value")
+	}
+}
+
+func TestNewToolCall(t *testing.T) {
+	called := 0
+	_, handler, err := mcp.NewTool("weather", "Gets the weather",
+		func(_ context.Context, args weatherArgs) (weatherReport, error) {
+			called++
+			if args.City == "nowhere" {
+				return weatherReport{}, errors.New("unknown city")
+			}
+			return weatherReport{City: args.City, Temperature: 21.5}, nil
+		})
+	if err != nil {
+		t.Fatalf("failed to create tool: %v", err)
+	}
+
+	tests := []struct {
+		name              string
+		arguments         string
+		wantErr           string
+		wantIsError       string
+		wantStructContent string
+	}{
+		{
+			name:              "valid",
+			arguments:         `{"city":"Paris","units":"metric"}`,
+			wantStructContent: `{"city":"Paris","temperature":21.5,"Alerts":null}`,
+		},
+		{
+			name:        "missing required",
+			arguments:   `{"units":"metric"}`,
+			wantIsError: `invalid arguments: /: missing required property "city"`,
+		},
+		{
+			name:        "invalid type",
+			arguments:   `{"city":"Paris","days":"two"}`,
+			wantIsError: "invalid arguments: /days: expected integer, got string",
+		},
+		{
+			name:        "invalid enum",
+			arguments:   `{"city":"Paris","units":"kelvin"}`,
+			wantIsError: "invalid arguments: /units: value is not one of the enum values",
+		},
+		{
+			name:        "invalid item",
+			arguments:   `{"city":"Paris","tags":["a",1]}`,
+			wantIsError: "invalid arguments: /tags/1: expected string, got integer",
+		},
+		{
+			name:        "no arguments",
+			wantIsError: `invalid arguments: /: missing required property "city"`,
+		},
+		{
+			name:      "handler error",
+			arguments: `{"city":"nowhere"}`,
+			wantErr:   "unknown city",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			called = 0
+			params := mcp.CallToolParams{Name: "weather", Arguments: json.RawMessage(tc.arguments)}
+			result, err := handler(context.Background(), params, nil, nil)
+			if tc.wantErr != "" {
+				if err == nil || err.Error() != tc.wantErr {
+					t.Fatalf("expected error %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if tc.wantIsError != "" {
+				if !result.IsError || len(result.Content) != 1 || result.Content[0].Text != tc.wantIsError {
+					t.Errorf("expected error result %q, got %+v", tc.wantIsError, result)
+				}
+				if called != 0 {
+					t.Error("expected the function not to be called for the invalid arguments")
+				}
+				return
+			}
+			if result.IsError || string(result.StructuredContent) != tc.wantStructContent {
+				t.Errorf("expected structured content %s, got %+v", tc.wantStructContent, result)
+			}
+		})
+	}
+}
+
+func TestNewToolResults(t *testing.T) {
+	type empty struct{}
+
+	ctx := context.Background()
+	params := mcp.CallToolParams{Name: "tool"}
+
+	textTool, textHandler, err := mcp.NewTool("tool", "",
+		func(context.Context, empty) (string, error) { return "hello", nil })
+	if err != nil {
+		t.Fatalf("failed to create tool: %v", err)
+	}
+	if textTool.OutputSchema != nil {
+		t.Errorf("expected no output schema for the text result, got %s", textTool.OutputSchema)
+	}
+	result, err := textHandler(ctx, params, nil, nil)
+	if err != nil || len(result.Content) != 1 || result.Content[0].Text != "hello" {
+		t.Errorf("unexpected text result %+v, err %v", result, err)
+	}
+
+	_, numberHandler, err := mcp.NewTool("tool", "",
+		func(context.Context, empty) ([]int, error) { return []int{1, 2}, nil })
+	if err != nil {
+		t.Fatalf("failed to create tool: %v", err)
+	}
+	result, err = numberHandler(ctx, params, nil, nil)
+	if err != nil || len(result.Content) != 1 || result.Content[0].Text != "[1,2]" {
+		t.Errorf("unexpected JSON result %+v, err %v", result, err)
+	}
+
+	image := mcp.Content{Type: mcp.ContentTypeImage, Data: "aW1hZ2U=", MimeType: "image/png"}
+	_, rawHandler, err := mcp.NewTool("tool", "",
+		func(context.Context, empty) (mcp.CallToolResult, error) {
+			return mcp.CallToolResult{Content: []mcp.Content{image}}, nil
+		})
+	if err != nil {
+		t.Fatalf("failed to create tool: %v", err)
+	}
+	result, err = rawHandler(ctx, params, nil, nil)
+	if err != nil || len(result.Content) != 1 || result.Content[0] != image {
+		t.Errorf("unexpected raw result %+v, err %v", result, err)
+	}
+}
+
+func TestNewToolServer(t *testing.T) {
+	for _, transportName := range []string{"SSE", "StreamableHTTP", "StdIO"} {
+		registry := mcp.NewRegistry()
+		registry.AddTool(must(mcp.NewTool("weather", "Gets the weather",
+			func(_ context.Context, args weatherArgs) (weatherReport, error) {
+				return weatherReport{City: args.City, Temperature: 21.5}, nil
+			})))
+
+		// The structured content is only sent to the clients that negotiated 2025-06-18.
+		cfg := testSuiteConfig{
+			transportName: transportName,
+			serverOptions: []mcp.ServerOption{
+				mcp.WithToolServer(registry),
+				mcp.WithServerProtocolVersions(mcp.ProtocolVersion20250618),
+			},
+			clientOptions: []mcp.ClientOption{mcp.WithClientProtocolVersions(mcp.ProtocolVersion20250618)},
+		}
+
+		t.Run(transportName, testSuiteCase(cfg, func(t *testing.T, s *testSuite) {
+			defer registry.Close()
+
+			if s.clientConnectErr != nil {
+				t.Fatalf("failed to connect to server: %v", s.clientConnectErr)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			result, err := s.mcpClient.CallTool(ctx, mcp.CallToolParams{
+				Name:      "weather",
+				Arguments: json.RawMessage(`{"city":"Paris"}`),
+			})
+			if err != nil {
+				t.Fatalf("failed to call tool: %v", err)
+			}
+			if result.IsError || !strings.Contains(string(result.StructuredContent), `"city":"Paris"`) {
+				t.Errorf("unexpected result %+v", result)
+			}
+
+			result, err = s.mcpClient.CallTool(ctx, mcp.CallToolParams{
+				Name:      "weather",
+				Arguments: json.RawMessage(`{"city":3}`),
+			})
+			if err != nil {
+				t.Fatalf("failed to call tool: %v", err)
+			}
+			if !result.IsError {
+				t.Errorf("expected error result for the invalid arguments, got %+v", result)
+			}
+		}))
+	}
+}
+
+// must unwraps the tool created by NewTool, so it can be registered in place.
+func must(tool mcp.Tool, handler mcp.ToolHandler, err error) (mcp.Tool, mcp.ToolHandler) {
+	if err != nil {
+		panic(err)
+	}
+	return tool, handler
+}
@@ -0,0 +1,971 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1" //nolint:gosec // The WebSocket handshake is defined with SHA-1, it's not used for security.
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// WebSocketServer implements a framework-agnostic WebSocket server transport, which carries all the
+// messages of a session in both directions over a single upgraded connection, instead of the SSE
+// stream and the HTTP POST requests of SSEServer.
+//
+// Every connection upgraded by the HandleWebSocket http.Handler becomes a new session. The server
+// sends a ping frame every ping interval, and closes the connection if the client doesn't answer it
+// with a pong frame before the next ping. The messages larger than the maximum message size are
+// rejected by closing the connection with the 1009 (message too big) status code.
+//
+// Instances should be created using NewWebSocketServer and properly shut down using Shutdown when
+// no longer needed.
+type WebSocketServer struct {
+	maxMessageSize int
+	pingInterval   time.Duration
+	checkOrigin    func(r *http.Request) bool
+	logger         *slog.Logger
+
+	sessions chan *webSocketSession
+
+	done   chan struct{}
+	closed chan struct{}
+}
+
+// WebSocketServerOption represents the options for the WebSocketServer.
+type WebSocketServerOption func(*WebSocketServer)
+
+// WebSocketClient implements a WebSocket client transport that connects to the WebSocketServer.
+// Every StartSession opens a new connection with the WebSocket handshake, which is sent with the
+// http.Client, so its transport, such as the one returned by OAuthTokenSource.HTTPClient, is used
+// for the handshake request.
+//
+// The sessions of the client send the keepalive pings and limit the size of the received messages
+// the same way as the WebSocketServer, and implement ErrorSession to report the close status sent
+// by the server.
+//
+// Instances should be created using NewWebSocketClient.
+type WebSocketClient struct {
+	url            string
+	httpClient     *http.Client
+	maxMessageSize int
+	pingInterval   time.Duration
+	logger         *slog.Logger
+}
+
+// WebSocketClientOption represents the options for the WebSocketClient.
+type WebSocketClientOption func(*WebSocketClient)
+
+// WebSocketCloseError is the error of the session that is ended by a close frame, with the status
+// code and the reason of the close frame.
+type WebSocketCloseError struct {
+	Code   int
+	Reason string
+}
+
+// webSocketSession is the session of a single WebSocket connection, used by both the server and
+// the client. The frames are read by the readLoop goroutine, and written by the writeLoop goroutine,
+// so the control frames are answered even while the messages are not consumed.
+type webSocketSession struct {
+	id     string
+	conn   io.ReadWriteCloser
+	reader *bufio.Reader
+	// mask reports whether the sent frames are masked, as the client must mask all of its frames.
+	mask           bool
+	maxMessageSize int
+	pingInterval   time.Duration
+	logger         *slog.Logger
+
+	writeFrames chan webSocketFrame
+	received    chan JSONRPCMessage
+	pongs       chan struct{}
+
+	// The fields below are guarded by mu.
+	mu sync.Mutex
+	// err is the reason the session is ended, it's reported by Err unless the session is stopped.
+	err       error
+	closeSent bool
+
+	stopOnce    sync.Once
+	closeOnce   sync.Once
+	done        chan struct{}
+	readClosed  chan struct{}
+	writeClosed chan struct{}
+}
+
+type webSocketFrame struct {
+	opcode  byte
+	payload []byte
+	// errs receives the result of the write, it's nil for the control frames.
+	errs chan<- error
+}
+
+// webSocketClientConn is the connection upgraded by the http.Client, which also cancels the context
+// of the handshake request when it's closed.
+type webSocketClientConn struct {
+	io.ReadWriteCloser
+	cancel context.CancelFunc
+}
+
+// webSocketProtocolError is the violation of the protocol by the other party, which closes the
+// connection with the code.
+type webSocketProtocolError struct {
+	code    int
+	message string
+}
+
+const (
+	webSocketGUID        = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	webSocketVersion     = "13"
+	webSocketSubprotocol = "mcp"
+
+	webSocketOpContinuation = 0x0
+	webSocketOpText         = 0x1
+	webSocketOpBinary       = 0x2
+	webSocketOpClose        = 0x8
+	webSocketOpPing         = 0x9
+	webSocketOpPong         = 0xa
+
+	webSocketCloseNormal        = 1000
+	webSocketCloseGoingAway     = 1001
+	webSocketCloseProtocol      = 1002
+	webSocketCloseNoStatus      = 1005
+	webSocketCloseInvalidData   = 1007
+	webSocketCloseMessageTooBig = 1009
+
+	webSocketMaxControlPayload = 125
+	webSocketCloseTimeout      = 5 * time.Second
+
+	defaultWebSocketMaxMessageSize = 16 << 20
+	defaultWebSocketPingInterval   = 30 * time.Second
+)
+
+// NewWebSocketServer creates and initializes a new WebSocket server, its connections are upgraded
+// by the handler returned from HandleWebSocket. The returned WebSocketServer must be closed using
+// Shutdown when no longer needed.
+func NewWebSocketServer(options ...WebSocketServerOption) WebSocketServer {
+	s := WebSocketServer{
+		maxMessageSize: defaultWebSocketMaxMessageSize,
+		pingInterval:   defaultWebSocketPingInterval,
+		checkOrigin:    sameOrigin,
+		logger:         slog.Default(),
+		sessions:       make(chan *webSocketSession),
+		done:           make(chan struct{}),
+		closed:         make(chan struct{}),
+	}
+
+	for _, opt := range options {
+		opt(&s)
+	}
+
+	return s
+}
+
+// WithWebSocketServerMaxMessageSize sets the maximum size of the message that can be received from
+// the clients, the connection of the client that sends a larger message is closed. The default is
+// 16 MiB, which is also used if the size is not positive.
+func WithWebSocketServerMaxMessageSize(size int) WebSocketServerOption {
+	return func(s *WebSocketServer) {
+		s.maxMessageSize = size
+	}
+}
+
+// WithWebSocketServerPingInterval sets the interval of the keepalive pings sent to the clients, the
+// connection of the client that doesn't answer a ping before the next one is closed. The default is
+// 30 seconds, and zero disables the pings.
+func WithWebSocketServerPingInterval(interval time.Duration) WebSocketServerOption {
+	return func(s *WebSocketServer) {
+		s.pingInterval = interval
+	}
+}
+
+// WithWebSocketServerCheckOrigin sets the function that reports whether the handshake request is
+// allowed from its Origin header. By default, only the requests without the Origin header, or with
+// the Origin of the same host as the request, are allowed, so the web pages of other sites can't
+// connect to the server from the browser.
+func WithWebSocketServerCheckOrigin(checkOrigin func(r *http.Request) bool) WebSocketServerOption {
+	return func(s *WebSocketServer) {
+		s.checkOrigin = checkOrigin
+	}
+}
+
+// WithWebSocketServerLogger sets the logger for the WebSocketServer.
+func WithWebSocketServerLogger(logger *slog.Logger) WebSocketServerOption {
+	return func(s *WebSocketServer) {
+		s.logger = logger.With(
+			slog.String("package", "go-mcp"),
+			slog.String("component", "websocket-server"),
+		)
+	}
+}
+
+// NewWebSocketClient creates a WebSocket client that connects to the server at the url, with the
+// ws, wss, http or https scheme. The optional httpClient parameter allows custom HTTP client
+// configuration - if nil, the default HTTP client is used. The client must call StartSession to
+// begin communication.
+func NewWebSocketClient(url string, httpClient *http.Client, options ...WebSocketClientOption) WebSocketClient {
+	cli := httpClient
+	if cli == nil {
+		cli = http.DefaultClient
+	}
+	c := WebSocketClient{
+		url:            url,
+		httpClient:     cli,
+		maxMessageSize: defaultWebSocketMaxMessageSize,
+		pingInterval:   defaultWebSocketPingInterval,
+		logger:         slog.Default(),
+	}
+
+	for _, opt := range options {
+		opt(&c)
+	}
+
+	return c
+}
+
+// WithWebSocketClientMaxMessageSize sets the maximum size of the message that can be received from
+// the server, the session is ended if the server sends a larger message. The default is 16 MiB, which
+// is also used if the size is not positive.
+func WithWebSocketClientMaxMessageSize(size int) WebSocketClientOption {
+	return func(c *WebSocketClient) {
+		c.maxMessageSize = size
+	}
+}
+
+// WithWebSocketClientPingInterval sets the interval of the keepalive pings sent to the server, the
+// session is ended if the server doesn't answer a ping before the next one. The default is 30
+// seconds, and zero disables the pings.
+func WithWebSocketClientPingInterval(interval time.Duration) WebSocketClientOption {
+	return func(c *WebSocketClient) {
+		c.pingInterval = interval
+	}
+}
+
+// WithWebSocketClientLogger sets the logger for the WebSocketClient.
+func WithWebSocketClientLogger(logger *slog.Logger) WebSocketClientOption {
+	return func(c *WebSocketClient) {
+		c.logger = logger.With(
+			slog.String("package", "go-mcp"),
+			slog.String("component", "websocket-client"),
+		)
+	}
+}
+
+// Sessions returns an iterator over the client sessions. The iterator yields a new Session every
+// time a client connection is upgraded by HandleWebSocket.
+func (s WebSocketServer) Sessions() iter.Seq[Session] {
+	return func(yield func(Session) bool) {
+		defer close(s.closed)
+
+		for {
+			select {
+			case <-s.done:
+				return
+			case sess := <-s.sessions:
+				if !yield(sess) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Shutdown gracefully shuts down the WebSocket server by stopping to accept the new connections.
+// This method blocks until shutdown is complete.
+func (s WebSocketServer) Shutdown(ctx context.Context) error {
+	// Signal the server to shutdown.
+	close(s.done)
+
+	// Wait for main loop to finish.
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("failed to close WebSocket server: %w", ctx.Err())
+	case <-s.closed:
+	}
+	return nil
+}
+
+// HandleWebSocket returns an http.Handler that upgrades the GET requests to WebSocket connections,
+// and starts a new session for every connection. The connection remains open until either the
+// client or the server closes the session.
+func (s WebSocketServer) HandleWebSocket() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !headerHasToken(r.Header, "Connection", "upgrade") || !headerHasToken(r.Header, "Upgrade", "websocket") {
+			w.Header().Set("Upgrade", "websocket")
+			http.Error(w, "websocket upgrade required", http.StatusUpgradeRequired)
+			return
+		}
+		if r.Header.Get("Sec-WebSocket-Version") != webSocketVersion {
+			w.Header().Set("Sec-WebSocket-Version", webSocketVersion)
+			http.Error(w, "unsupported websocket version", http.StatusUpgradeRequired)
+			return
+		}
+		key := r.Header.Get("Sec-WebSocket-Key")
+		if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+			http.Error(w, "invalid Sec-WebSocket-Key header", http.StatusBadRequest)
+			return
+		}
+		if !s.checkOrigin(r) {
+			http.Error(w, "origin is not allowed", http.StatusForbidden)
+			return
+		}
+
+		conn, rw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			nErr := fmt.Errorf("failed to hijack connection: %w", err)
+			s.logger.Error("failed to hijack connection", slog.String("err", nErr.Error()))
+			http.Error(w, nErr.Error(), http.StatusInternalServerError)
+			return
+		}
+		// The hijacked connection keeps the deadlines of the http.Server, which don't apply to the
+		// long-lived connection.
+		if err := conn.SetDeadline(time.Time{}); err != nil {
+			s.logger.Warn("failed to clear connection deadline", slog.String("err", err.Error()))
+		}
+
+		resp := "HTTP/1.1 101 Switching Protocols\r\n" +
+			"Upgrade: websocket\r\n" +
+			"Connection: Upgrade\r\n" +
+			"Sec-WebSocket-Accept: " + webSocketAccept(key) + "\r\n"
+		if headerHasToken(r.Header, "Sec-WebSocket-Protocol", webSocketSubprotocol) {
+			resp += "Sec-WebSocket-Protocol: " + webSocketSubprotocol + "\r\n"
+		}
+		resp += "\r\n"
+		_, err = rw.WriteString(resp)
+		if err == nil {
+			err = rw.Flush()
+		}
+		if err != nil {
+			s.logger.Error("failed to write handshake response", slog.String("err", err.Error()))
+			conn.Close()
+			return
+		}
+
+		sess := newWebSocketSession(conn, rw.Reader, false, s.maxMessageSize, s.pingInterval, s.logger)
+
+		// Feed the sessions channel that would be consumed in Sessions loop, so it can be forwarded to
+		// caller.
+		select {
+		case s.sessions <- sess:
+		case <-s.done:
+			sess.stop(webSocketCloseGoingAway, "server is shutting down")
+		}
+	})
+}
+
+// StartSession implements the ClientTransport interface by connecting to the server with the
+// WebSocket handshake, and returning the session of the connection. A new connection is opened on
+// every call, so the client is able to start a new session after the previous one ends.
+func (c WebSocketClient) StartSession(ctx context.Context) (Session, error) {
+	u, err := url.Parse(c.url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse url: %w", err)
+	}
+	switch u.Scheme {
+	case "ws":
+		u.Scheme = "http"
+	case "wss":
+		u.Scheme = "https"
+	}
+
+	keyBs := make([]byte, 16)
+	if _, err := rand.Read(keyBs); err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	key := base64.StdEncoding.EncodeToString(keyBs)
+
+	// The connection outlives the ctx, so the request has its own context, which is only cancelled if
+	// the ctx is done before the handshake is completed, or when the session is closed.
+	reqCtx, reqCancel := context.WithCancel(context.Background())
+	handshakeDone := make(chan struct{})
+	defer close(handshakeDone)
+	go func() {
+		select {
+		case <-ctx.Done():
+			reqCancel()
+		case <-handshakeDone:
+		}
+	}()
+
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		reqCancel()
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", webSocketVersion)
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Protocol", webSocketSubprotocol)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		reqCancel()
+		return nil, fmt.Errorf("failed to connect to WebSocket server: %w", err)
+	}
+
+	conn, err := c.checkHandshake(resp, key)
+	if err != nil {
+		resp.Body.Close()
+		reqCancel()
+		return nil, err
+	}
+
+	sess := newWebSocketSession(webSocketClientConn{ReadWriteCloser: conn, cancel: reqCancel},
+		bufio.NewReader(conn), true, c.maxMessageSize, c.pingInterval, c.logger)
+	return sess, nil
+}
+
+// checkHandshake checks the handshake response of the server, and returns the upgraded connection.
+func (c WebSocketClient) checkHandshake(resp *http.Response, key string) (io.ReadWriteCloser, error) {
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	if !headerHasToken(resp.Header, "Upgrade", "websocket") {
+		return nil, errors.New("server didn't upgrade the connection to websocket")
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != webSocketAccept(key) {
+		return nil, errors.New("invalid Sec-WebSocket-Accept header")
+	}
+	// The http.Client returns the upgraded connection as the body of the 101 Switching Protocols
+	// response.
+	conn, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		return nil, errors.New("upgraded connection is not writable")
+	}
+	return conn, nil
+}
+
+func newWebSocketSession(
+	conn io.ReadWriteCloser,
+	reader *bufio.Reader,
+	mask bool,
+	maxMessageSize int,
+	pingInterval time.Duration,
+	logger *slog.Logger,
+) *webSocketSession {
+	// The message size is always bounded, as the payload of the frame is allocated before it's read.
+	if maxMessageSize <= 0 {
+		maxMessageSize = defaultWebSocketMaxMessageSize
+	}
+
+	id := uuid.New().String()
+	s := &webSocketSession{
+		id:             id,
+		conn:           conn,
+		reader:         reader,
+		mask:           mask,
+		maxMessageSize: maxMessageSize,
+		pingInterval:   pingInterval,
+		logger:         logger.With(slog.String("sessionID", id)),
+		writeFrames:    make(chan webSocketFrame),
+		received:       make(chan JSONRPCMessage),
+		pongs:          make(chan struct{}, 1),
+		done:           make(chan struct{}),
+		readClosed:     make(chan struct{}),
+		writeClosed:    make(chan struct{}),
+	}
+
+	go s.readLoop()
+	go s.writeLoop()
+
+	return s
+}
+
+func (s *webSocketSession) ID() string {
+	return s.id
+}
+
+func (s *webSocketSession) Send(ctx context.Context, msg JSONRPCMessage) error {
+	msgBs, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	errs := make(chan error, 1)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-s.writeClosed:
+		return errors.New("session is closed")
+	case s.writeFrames <- webSocketFrame{opcode: webSocketOpText, payload: msgBs, errs: errs}:
+	}
+
+	// The frame is always answered once it's received by the writeLoop.
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-errs:
+		return err
+	}
+}
+
+func (s *webSocketSession) Messages() iter.Seq[JSONRPCMessage] {
+	return func(yield func(JSONRPCMessage) bool) {
+		for msg := range s.received {
+			if !yield(msg) {
+				return
+			}
+		}
+	}
+}
+
+// Stop implements the Session interface by closing the connection with the close handshake, it
+// waits for the other party to answer the close frame before closing the connection.
+func (s *webSocketSession) Stop() {
+	s.stop(webSocketCloseNormal, "")
+}
+
+// Err implements the ErrorSession interface, it returns the WebSocketCloseError of the close frame
+// sent by the other party, or the error that broke the connection.
+func (s *webSocketSession) Err() error {
+	select {
+	case <-s.done:
+		return nil
+	default:
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+func (s *webSocketSession) stop(code int, reason string) {
+	s.stopOnce.Do(func() {
+		close(s.done)
+	})
+
+	s.sendClose(code, reason)
+
+	timer := time.NewTimer(webSocketCloseTimeout)
+	defer timer.Stop()
+	select {
+	case <-s.readClosed:
+	case <-timer.C:
+		s.logger.Warn("close frame is not answered, closing connection")
+	}
+
+	s.closeConn()
+	<-s.readClosed
+	<-s.writeClosed
+}
+
+// readLoop reads the messages until the connection is closed, and answers the control frames.
+func (s *webSocketSession) readLoop() {
+	defer close(s.readClosed)
+	defer close(s.received)
+
+	for {
+		data, err := s.readMessage()
+		if err != nil {
+			s.readFailed(err)
+			return
+		}
+
+		var msg JSONRPCMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			s.logger.Error("failed to unmarshal message", slog.String("err", err.Error()))
+			continue
+		}
+
+		// The messages received after the session is stopped are dropped, as no one is consuming them,
+		// but the frames are still read until the other party answers the close frame.
+		select {
+		case s.received <- msg:
+		case <-s.done:
+		}
+	}
+}
+
+// readFailed ends the session with the error that stopped the readLoop, and completes the close
+// handshake if it's started by the other party, or by the violation of the protocol.
+func (s *webSocketSession) readFailed(err error) {
+	var closeErr *WebSocketCloseError
+	var protocolErr *webSocketProtocolError
+	switch {
+	case errors.As(err, &closeErr):
+		// Echo the status code of the close frame, as the reply of the close handshake.
+		code := closeErr.Code
+		if code == webSocketCloseNoStatus {
+			code = 0
+		}
+		s.sendClose(code, "")
+		s.waitCloseWritten()
+	case errors.As(err, &protocolErr):
+		s.logger.Warn("closing connection", slog.Int("code", protocolErr.code), slog.String("err", protocolErr.message))
+		s.sendClose(protocolErr.code, protocolErr.message)
+		s.waitCloseWritten()
+	}
+
+	s.mu.Lock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-s.done:
+	default:
+		if closeErr == nil {
+			s.logger.Error("websocket connection is closed", slog.String("err", err.Error()))
+		}
+	}
+
+	s.closeConn()
+}
+
+// readMessage reads the frames of the next data message, answering the control frames in between.
+func (s *webSocketSession) readMessage() ([]byte, error) {
+	var opcode byte
+	var data []byte
+	for {
+		fin, op, payload, err := s.readFrame(len(data))
+		if err != nil {
+			return nil, err
+		}
+
+		switch op {
+		case webSocketOpPing:
+			s.queueControl(webSocketOpPong, payload)
+			continue
+		case webSocketOpPong:
+			select {
+			case s.pongs <- struct{}{}:
+			default:
+			}
+			continue
+		case webSocketOpClose:
+			return nil, parseWebSocketClose(payload)
+		case webSocketOpContinuation:
+			if opcode == 0 {
+				return nil, &webSocketProtocolError{webSocketCloseProtocol, "unexpected continuation frame"}
+			}
+		case webSocketOpText, webSocketOpBinary:
+			if opcode != 0 {
+				return nil, &webSocketProtocolError{webSocketCloseProtocol, "expected continuation frame"}
+			}
+			opcode = op
+		default:
+			return nil, &webSocketProtocolError{webSocketCloseProtocol, fmt.Sprintf("unknown opcode %d", op)}
+		}
+
+		data = append(data, payload...)
+		if !fin {
+			continue
+		}
+		if opcode == webSocketOpText && !utf8.Valid(data) {
+			return nil, &webSocketProtocolError{webSocketCloseInvalidData, "invalid UTF-8 text message"}
+		}
+		return data, nil
+	}
+}
+
+// readFrame reads a single frame, the read size is the size of the message read before the frame,
+// so the frame is rejected before its payload is read if the message would exceed the maximum size.
+func (s *webSocketSession) readFrame(readSize int) (bool, byte, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(s.reader, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	fin := header[0]&0x80 != 0
+	opcode := header[0] & 0x0f
+	masked := header[1]&0x80 != 0
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, &webSocketProtocolError{webSocketCloseProtocol, "reserved bits are set"}
+	}
+	// The client must mask its frames, and the server must not.
+	if masked == s.mask {
+		return false, 0, nil, &webSocketProtocolError{webSocketCloseProtocol, "invalid frame masking"}
+	}
+
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(s.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(s.reader, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+		// The most significant bit of the 64-bit length must be 0.
+		if length>>63 != 0 {
+			return false, 0, nil, &webSocketProtocolError{webSocketCloseProtocol, "invalid payload length"}
+		}
+	}
+
+	if opcode >= webSocketOpClose {
+		if !fin || length > webSocketMaxControlPayload {
+			return false, 0, nil, &webSocketProtocolError{webSocketCloseProtocol, "invalid control frame"}
+		}
+	} else if length > uint64(s.maxMessageSize-readSize) {
+		return false, 0, nil, &webSocketProtocolError{
+			webSocketCloseMessageTooBig,
+			fmt.Sprintf("message exceeds the maximum size of %d bytes", s.maxMessageSize),
+		}
+	}
+
+	var maskKey [4]byte
+	if masked {
+		if _, err := io.ReadFull(s.reader, maskKey[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(s.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		maskWebSocketPayload(payload, maskKey)
+	}
+
+	return fin, opcode, payload, nil
+}
+
+// writeLoop writes the queued frames and the keepalive pings, until the close frame is written or
+// the connection is closed.
+func (s *webSocketSession) writeLoop() {
+	defer close(s.writeClosed)
+
+	var pings <-chan time.Time
+	if s.pingInterval > 0 {
+		ticker := time.NewTicker(s.pingInterval)
+		defer ticker.Stop()
+		pings = ticker.C
+	}
+	awaitingPong := false
+
+	for {
+		select {
+		case <-s.readClosed:
+			return
+		case <-s.pongs:
+			awaitingPong = false
+		case <-pings:
+			if awaitingPong {
+				s.mu.Lock()
+				if s.err == nil {
+					s.err = errors.New("ping is not answered within the ping interval")
+				}
+				s.mu.Unlock()
+				s.logger.Error("ping is not answered within the ping interval, closing connection")
+				s.closeConn()
+				return
+			}
+			if err := s.writeFrame(webSocketOpPing, nil); err != nil {
+				s.writeFailed(err)
+				return
+			}
+			awaitingPong = true
+		case frame := <-s.writeFrames:
+			err := s.writeFrame(frame.opcode, frame.payload)
+			if frame.errs != nil {
+				frame.errs <- err
+			}
+			if err != nil {
+				s.writeFailed(err)
+				return
+			}
+			// Nothing can be sent after the close frame.
+			if frame.opcode == webSocketOpClose {
+				return
+			}
+		}
+	}
+}
+
+func (s *webSocketSession) writeFailed(err error) {
+	select {
+	case <-s.done:
+	default:
+		s.logger.Error("failed to write frame", slog.String("err", err.Error()))
+	}
+	s.closeConn()
+}
+
+func (s *webSocketSession) writeFrame(opcode byte, payload []byte) error {
+	frame := make([]byte, 0, len(payload)+14)
+	frame = append(frame, 0x80|opcode)
+
+	var maskBit byte
+	if s.mask {
+		maskBit = 0x80
+	}
+	switch length := len(payload); {
+	case length <= webSocketMaxControlPayload:
+		frame = append(frame, maskBit|byte(length))
+	case length <= 0xffff:
+		frame = append(frame, maskBit|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(length))
+	default:
+		frame = append(frame, maskBit|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(length))
+	}
+
+	if !s.mask {
+		frame = append(frame, payload...)
+	} else {
+		var maskKey [4]byte
+		if _, err := rand.Read(maskKey[:]); err != nil {
+			return fmt.Errorf("failed to generate mask key: %w", err)
+		}
+		frame = append(frame, maskKey[:]...)
+		start := len(frame)
+		frame = append(frame, payload...)
+		maskWebSocketPayload(frame[start:], maskKey)
+	}
+
+	_, err := s.conn.Write(frame)
+	return err
+}
+
+// queueControl queues the control frame to the writeLoop, it's dropped if the writeLoop is already
+// closed.
+func (s *webSocketSession) queueControl(opcode byte, payload []byte) {
+	select {
+	case s.writeFrames <- webSocketFrame{opcode: opcode, payload: payload}:
+	case <-s.writeClosed:
+	}
+}
+
+// sendClose sends the close frame with the code and the reason, or without a payload if the code is
+// zero. Only the first close frame of the session is sent.
+func (s *webSocketSession) sendClose(code int, reason string) {
+	s.mu.Lock()
+	closeSent := s.closeSent
+	s.closeSent = true
+	s.mu.Unlock()
+	if closeSent {
+		return
+	}
+
+	var payload []byte
+	if code != 0 {
+		payload = binary.BigEndian.AppendUint16(nil, uint16(code))
+		// The reason must fit in the control frame, along with the code.
+		if len(reason) > webSocketMaxControlPayload-2 {
+			reason = reason[:webSocketMaxControlPayload-2]
+		}
+		payload = append(payload, reason...)
+	}
+
+	timer := time.NewTimer(webSocketCloseTimeout)
+	defer timer.Stop()
+	select {
+	case s.writeFrames <- webSocketFrame{opcode: webSocketOpClose, payload: payload}:
+	case <-s.writeClosed:
+	case <-timer.C:
+		s.logger.Warn("failed to send close frame, the connection is blocked")
+	}
+}
+
+// waitCloseWritten waits for the writeLoop to write the close frame, before the connection is closed.
+func (s *webSocketSession) waitCloseWritten() {
+	timer := time.NewTimer(webSocketCloseTimeout)
+	defer timer.Stop()
+	select {
+	case <-s.writeClosed:
+	case <-timer.C:
+	}
+}
+
+func (s *webSocketSession) closeConn() {
+	s.closeOnce.Do(func() {
+		if err := s.conn.Close(); err != nil {
+			s.logger.Warn("failed to close connection", slog.String("err", err.Error()))
+		}
+	})
+}
+
+func (e *WebSocketCloseError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("websocket closed with status %d", e.Code)
+	}
+	return fmt.Sprintf("websocket closed with status %d: %s", e.Code, e.Reason)
+}
+
+func (e *webSocketProtocolError) Error() string {
+	return e.message
+}
+
+func (c webSocketClientConn) Close() error {
+	defer c.cancel()
+	return c.ReadWriteCloser.Close()
+}
+
+func parseWebSocketClose(payload []byte) error {
+	if len(payload) == 0 {
+		return &WebSocketCloseError{Code: webSocketCloseNoStatus}
+	}
+	if len(payload) < 2 || !utf8.Valid(payload[2:]) {
+		return &webSocketProtocolError{webSocketCloseProtocol, "invalid close frame"}
+	}
+	return &WebSocketCloseError{
+		Code:   int(binary.BigEndian.Uint16(payload)),
+		Reason: string(payload[2:]),
+	}
+}
+
+func maskWebSocketPayload(payload []byte, maskKey [4]byte) {
+	for i := range payload {
+		payload[i] ^= maskKey[i%4]
+	}
+}
+
+func webSocketAccept(key string) string {
+	//nolint:gosec // The WebSocket handshake is defined with SHA-1, it's not used for security.
+	sum := sha1.Sum([]byte(key + webSocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// headerHasToken reports whether the comma-separated values of the header contain the token,
+// ignoring the case.
+func headerHasToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sameOrigin reports whether the request has no Origin header, or the Origin has the same host as
+// the request.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
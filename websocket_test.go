@@ -0,0 +1,356 @@
+package mcp_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MegaGrindStone/go-mcp"
+)
+
+func TestWebSocketHandshake(t *testing.T) {
+	srv := mcp.NewWebSocketServer(mcp.WithWebSocketServerLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	httpSrv := httptest.NewServer(srv.HandleWebSocket())
+	defer httpSrv.Close()
+
+	tests := []struct {
+		name       string
+		method     string
+		header     map[string]string
+		wantStatus int
+	}{
+		{
+			name:       "not upgrade",
+			method:     http.MethodGet,
+			wantStatus: http.StatusUpgradeRequired,
+		},
+		{
+			name:   "unsupported version",
+			method: http.MethodGet,
+			header: map[string]string{
+				"Connection": "Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Version": "8",
+				"Sec-WebSocket-Key": "dGhlIHNhbXBsZSBub25jZQ==",
+			},
+			wantStatus: http.StatusUpgradeRequired,
+		},
+		{
+			name:   "cross origin",
+			method: http.MethodGet,
+			header: map[string]string{
+				"Connection": "Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Version": "13",
+				"Sec-WebSocket-Key": "dGhlIHNhbXBsZSBub25jZQ==", "Origin": "https://evil.example.com",
+			},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "post",
+			method:     http.MethodPost,
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, httpSrv.URL, nil)
+			if err != nil {
+				t.Fatalf("failed to create request: %v", err)
+			}
+			for key, value := range tt.header {
+				req.Header.Set(key, value)
+			}
+
+			resp, err := httpSrv.Client().Do(req)
+			if err != nil {
+				t.Fatalf("failed to send request: %v", err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestWebSocketMaxMessageSize(t *testing.T) {
+	srv := mcp.NewWebSocketServer(mcp.WithWebSocketServerMaxMessageSize(1024),
+		mcp.WithWebSocketServerLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	httpSrv := httptest.NewServer(srv.HandleWebSocket())
+	defer httpSrv.Close()
+	srvSessions := serveWebSocketSessions(srv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cli := mcp.NewWebSocketClient(httpSrv.URL, httpSrv.Client(),
+		mcp.WithWebSocketClientLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	cliSession, err := cli.StartSession(ctx)
+	if err != nil {
+		t.Fatalf("failed to start session: %v", err)
+	}
+	defer cliSession.Stop()
+	srvSession := <-srvSessions
+	defer srvSession.Stop()
+
+	received := make(chan mcp.JSONRPCMessage, 1)
+	go func() {
+		for msg := range srvSession.Messages() {
+			received <- msg
+		}
+		close(received)
+	}()
+
+	small := mcp.JSONRPCMessage{JSONRPC: mcp.JSONRPCVersion, Method: "small", Params: generateRandomJSON(512)}
+	if err := cliSession.Send(ctx, small); err != nil {
+		t.Fatalf("failed to send message: %v", err)
+	}
+	if msg := <-received; msg.Method != small.Method {
+		t.Errorf("expected message %s, got %s", small.Method, msg.Method)
+	}
+
+	large := mcp.JSONRPCMessage{JSONRPC: mcp.JSONRPCVersion, Method: "large", Params: generateRandomJSON(2048)}
+	if err := cliSession.Send(ctx, large); err != nil {
+		t.Fatalf("failed to send message: %v", err)
+	}
+	// The server closes the connection instead of delivering the large message.
+	for msg := range received {
+		t.Errorf("expected no message, got %s", msg.Method)
+	}
+
+	// The client session ends with the close status sent by the server.
+	for range cliSession.Messages() {
+	}
+	var closeErr *mcp.WebSocketCloseError
+	if err := cliSession.(mcp.ErrorSession).Err(); !errors.As(err, &closeErr) || closeErr.Code != 1009 {
+		t.Errorf("expected close status 1009, got %v", err)
+	}
+}
+
+func TestWebSocketCloseHandshake(t *testing.T) {
+	srv := mcp.NewWebSocketServer(mcp.WithWebSocketServerLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	httpSrv := httptest.NewServer(srv.HandleWebSocket())
+	defer httpSrv.Close()
+	srvSessions := serveWebSocketSessions(srv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cli := mcp.NewWebSocketClient(httpSrv.URL, httpSrv.Client(),
+		mcp.WithWebSocketClientLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	cliSession, err := cli.StartSession(ctx)
+	if err != nil {
+		t.Fatalf("failed to start session: %v", err)
+	}
+	srvSession := <-srvSessions
+
+	go func() {
+		for range srvSession.Messages() {
+		}
+	}()
+
+	// The client answers the close frame of the server, so the server doesn't wait for the timeout.
+	start := time.Now()
+	srvSession.Stop()
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("expected the close frame to be answered, took %s", elapsed)
+	}
+
+	for range cliSession.Messages() {
+	}
+	var closeErr *mcp.WebSocketCloseError
+	if err := cliSession.(mcp.ErrorSession).Err(); !errors.As(err, &closeErr) || closeErr.Code != 1000 {
+		t.Errorf("expected close status 1000, got %v", err)
+	}
+	if err := srvSession.(mcp.ErrorSession).Err(); err != nil {
+		t.Errorf("expected no error for the stopped session, got %v", err)
+	}
+	if err := cliSession.Send(ctx, mcp.JSONRPCMessage{JSONRPC: mcp.JSONRPCVersion, Method: "ping"}); err == nil {
+		t.Error("expected error sending to the closed session")
+	}
+	cliSession.Stop()
+}
+
+func TestWebSocketFrames(t *testing.T) {
+	srv := mcp.NewWebSocketServer(mcp.WithWebSocketServerPingInterval(100*time.Millisecond),
+		mcp.WithWebSocketServerLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	httpSrv := httptest.NewServer(srv.HandleWebSocket())
+	defer httpSrv.Close()
+	srvSessions := serveWebSocketSessions(srv)
+
+	conn, reader := dialWebSocket(t, httpSrv.Listener.Addr().String())
+	defer conn.Close()
+	srvSession := <-srvSessions
+	defer srvSession.Stop()
+
+	received := make(chan mcp.JSONRPCMessage, 1)
+	go func() {
+		for msg := range srvSession.Messages() {
+			received <- msg
+		}
+		close(received)
+	}()
+
+	// The fragmented message is delivered as a whole, with the ping answered in between.
+	msg := `{"jsonrpc":"2.0","method":"fragmented"}`
+	writeWebSocketFrame(t, conn, false, 0x1, []byte(msg[:10]))
+	writeWebSocketFrame(t, conn, true, 0x9, []byte("hello"))
+	writeWebSocketFrame(t, conn, true, 0x0, []byte(msg[10:]))
+
+	opcode, payload := readWebSocketFrame(t, reader)
+	for opcode == 0x9 {
+		// Skip the keepalive pings of the server.
+		opcode, payload = readWebSocketFrame(t, reader)
+	}
+	if opcode != 0xa || string(payload) != "hello" {
+		t.Errorf("expected pong with the ping payload, got opcode %d with %q", opcode, payload)
+	}
+	if got := <-received; got.Method != "fragmented" {
+		t.Errorf("expected the fragmented message, got %s", got.Method)
+	}
+
+	// The server sends the pings, and closes the connection once they're not answered.
+	for {
+		if _, err := reader.ReadByte(); err != nil {
+			break
+		}
+	}
+	for range received {
+	}
+	if err := srvSession.(mcp.ErrorSession).Err(); err == nil || !strings.Contains(err.Error(), "ping") {
+		t.Errorf("expected the unanswered ping error, got %v", err)
+	}
+}
+
+func TestWebSocketFrameLength(t *testing.T) {
+	// The non-positive maximum size falls back to the default, so the length is always bounded.
+	srv := mcp.NewWebSocketServer(mcp.WithWebSocketServerMaxMessageSize(0),
+		mcp.WithWebSocketServerLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	httpSrv := httptest.NewServer(srv.HandleWebSocket())
+	defer httpSrv.Close()
+	srvSessions := serveWebSocketSessions(srv)
+
+	tests := []struct {
+		name   string
+		length uint64
+		code   uint16
+	}{
+		{name: "too large", length: 1 << 40, code: 1009},
+		{name: "most significant bit", length: 1 << 63, code: 1002},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			conn, reader := dialWebSocket(t, httpSrv.Listener.Addr().String())
+			defer conn.Close()
+			srvSession := <-srvSessions
+			defer srvSession.Stop()
+			go func() {
+				for range srvSession.Messages() {
+				}
+			}()
+
+			// The frame header with the 64-bit length, followed by the mask key.
+			frame := []byte{0x81, 0x80 | 127}
+			frame = binary.BigEndian.AppendUint64(frame, tc.length)
+			frame = append(frame, 1, 2, 3, 4)
+			if _, err := conn.Write(frame); err != nil {
+				t.Fatalf("failed to write frame: %v", err)
+			}
+
+			opcode, payload := readWebSocketFrame(t, reader)
+			for opcode == 0x9 {
+				opcode, payload = readWebSocketFrame(t, reader)
+			}
+			if opcode != 0x8 || len(payload) < 2 || binary.BigEndian.Uint16(payload) != tc.code {
+				t.Errorf("expected close status %d, got opcode %d with %q", tc.code, opcode, payload)
+			}
+		})
+	}
+}
+
+// serveWebSocketSessions forwards the sessions of the WebSocketServer to the returned channel.
+func serveWebSocketSessions(srv mcp.WebSocketServer) <-chan mcp.Session {
+	sessions := make(chan mcp.Session, 1)
+	go func() {
+		for sess := range srv.Sessions() {
+			sessions <- sess
+		}
+	}()
+	return sessions
+}
+
+// dialWebSocket opens the WebSocket connection without the WebSocketClient, so the test controls
+// the sent frames.
+func dialWebSocket(t *testing.T, addr string) (net.Conn, *bufio.Reader) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+
+	handshake := fmt.Sprintf("GET / HTTP/1.1\r\nHost: %s\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n"+
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n", addr)
+	if _, err := conn.Write([]byte(handshake)); err != nil {
+		t.Fatalf("failed to write handshake: %v", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("failed to read handshake response: %v", err)
+	}
+	// The accept key of the sample nonce from RFC 6455.
+	if resp.StatusCode != http.StatusSwitchingProtocols ||
+		resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("unexpected handshake response: %d %v", resp.StatusCode, resp.Header)
+	}
+
+	return conn, reader
+}
+
+// writeWebSocketFrame writes the masked frame of the client.
+func writeWebSocketFrame(t *testing.T, conn net.Conn, fin bool, opcode byte, payload []byte) {
+	header := opcode
+	if fin {
+		header |= 0x80
+	}
+	maskKey := []byte{1, 2, 3, 4}
+	frame := []byte{header, 0x80 | byte(len(payload))}
+	frame = append(frame, maskKey...)
+	for i, b := range payload {
+		frame = append(frame, b^maskKey[i%4])
+	}
+	if _, err := conn.Write(frame); err != nil {
+		t.Fatalf("failed to write frame: %v", err)
+	}
+}
+
+// readWebSocketFrame reads the unmasked frame of the server, with a payload shorter than 126 bytes.
+func readWebSocketFrame(t *testing.T, reader *bufio.Reader) (byte, []byte) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		t.Fatalf("failed to read frame: %v", err)
+	}
+	length := int(header[1] & 0x7f)
+	if length == 126 {
+		ext := make([]byte, 2)
+		if _, err := io.ReadFull(reader, ext); err != nil {
+			t.Fatalf("failed to read frame: %v", err)
+		}
+		length = int(binary.BigEndian.Uint16(ext))
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		t.Fatalf("failed to read frame: %v", err)
+	}
+	return header[0] & 0x0f, payload
+}